@@ -6,7 +6,6 @@ import (
 	"ys-cloud/internal/config"
 	"ys-cloud/internal/handler"
 	"ys-cloud/internal/middleware"
-	"ys-cloud/internal/repository"
 	"ys-cloud/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -34,91 +33,97 @@ func Run() error {
 		// 不返回错误，继续初始化其他组件
 	}
 
-	// Initialize repositories
-	var userRepo *repository.UserRepository
-	var projectRepo *repository.ProjectRepository
-	var pipelineRepo *repository.PipelineRepository
-	var buildRepo *repository.BuildRepository
-	var deploymentRepo *repository.DeploymentRepository
-	
-	// 只有在数据库连接成功时才初始化仓库
-	if db != nil {
-		userRepo = repository.NewUserRepository(db)
-		projectRepo = repository.NewProjectRepository(db)
-		pipelineRepo = repository.NewPipelineRepository(db)
-		buildRepo = repository.NewBuildRepository(db)
-		deploymentRepo = repository.NewDeploymentRepository(db)
+	// Initialize services, those needing the database stay nil without it
+	services, err := service.NewServices(db, cfg)
+	if err != nil {
+		return err
 	}
+	services.StartWorkers()
 
-	// Initialize services
-	var userService *service.UserService
-	var projectService *service.ProjectService
-	var pipelineService *service.PipelineService
-	var buildService *service.BuildService
-	var deploymentService *service.DeploymentService
+	// Initialize handlers
+	var userHandler *handler.UserHandler
+	var projectHandler *handler.ProjectHandler
+	var pipelineHandler *handler.PipelineHandler
+	var buildHandler *handler.BuildHandler
+	var deploymentHandler *handler.DeploymentHandler
+	var clusterHandler *handler.ClusterHandler
+	var environmentHandler *handler.EnvironmentHandler
+	var approvalHandler *handler.ApprovalHandler
+	var freezeHandler *handler.FreezeHandler
+	var previewHandler *handler.PreviewHandler
+	var certificateHandler *handler.CertificateHandler
+	var registryHandler *handler.RegistryCredentialHandler
+	var gcHandler *handler.GarbageCollectionHandler
+	var driftHandler *handler.DriftHandler
+	var retentionHandler *handler.RetentionHandler
+	var cacheHandler *handler.CacheHandler
 	
-	// 根据仓库是否初始化来决定服务初始化
-	if userRepo != nil {
-		userService = service.NewUserService(userRepo)
+	// 根据服务是否初始化来决定处理器初始化
+	if services.User != nil {
+		userHandler = handler.NewUserHandler(services.User)
 	}
 	
-	if projectRepo != nil && userRepo != nil {
-		projectService = service.NewProjectService(projectRepo, userRepo)
+	if services.Project != nil {
+		projectHandler = handler.NewProjectHandler(services.Project)
 	}
 	
-	if pipelineRepo != nil && projectRepo != nil {
-		pipelineService = service.NewPipelineService(pipelineRepo, projectRepo)
+	if services.Pipeline != nil && services.Git != nil {
+		pipelineHandler = handler.NewPipelineHandler(services.Pipeline, services.Git)
 	}
 	
-	if buildRepo != nil && pipelineRepo != nil {
-		buildService = service.NewBuildService(buildRepo, pipelineRepo)
+	if services.Build != nil && services.Scan != nil && services.Artifact != nil && services.Git != nil {
+		buildHandler = handler.NewBuildHandler(services.Build, services.Scan, services.Artifact, services.Git, services.K8s)
 	}
 	
-	gitService := service.NewGitService()
-	dockerService, err := service.NewDockerService(cfg)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize Docker service: %v", err)
-		dockerService = nil
+	if services.Deployment != nil && services.K8s != nil {
+		deploymentHandler = handler.NewDeploymentHandler(services.Deployment, services.K8s)
 	}
-	k8sService, err := service.NewK8sService(cfg)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize Kubernetes service: %v", err)
-		k8sService = nil
+	
+	if services.Cluster != nil {
+		clusterHandler = handler.NewClusterHandler(services.Cluster)
 	}
 	
-	if deploymentRepo != nil {
-		deploymentService = service.NewDeploymentService(deploymentRepo, k8sService)
+	if services.Environment != nil && services.Deployment != nil {
+		environmentHandler = handler.NewEnvironmentHandler(services.Environment, services.Deployment)
 	}
-
-	// Initialize handlers
-	var userHandler *handler.UserHandler
-	var projectHandler *handler.ProjectHandler
-	var pipelineHandler *handler.PipelineHandler
-	var buildHandler *handler.BuildHandler
-	var deploymentHandler *handler.DeploymentHandler
 	
-	// 根据服务是否初始化来决定处理器初始化
-	if userService != nil {
-		userHandler = handler.NewUserHandler(userService)
+	if services.Approval != nil {
+		approvalHandler = handler.NewApprovalHandler(services.Approval)
 	}
 	
-	if projectService != nil {
-		projectHandler = handler.NewProjectHandler(projectService)
+	if services.Freeze != nil {
+		freezeHandler = handler.NewFreezeHandler(services.Freeze)
 	}
 	
-	if pipelineService != nil && gitService != nil {
-		pipelineHandler = handler.NewPipelineHandler(pipelineService, gitService)
+	if services.Preview != nil {
+		previewHandler = handler.NewPreviewHandler(services.Preview)
 	}
 	
-	if buildService != nil && gitService != nil && dockerService != nil && k8sService != nil {
-		buildHandler = handler.NewBuildHandler(buildService, gitService, dockerService, k8sService)
+	if services.Certificate != nil {
+		certificateHandler = handler.NewCertificateHandler(services.Certificate)
 	}
 	
-	if deploymentService != nil && k8sService != nil {
-		deploymentHandler = handler.NewDeploymentHandler(deploymentService, k8sService)
+	if services.Registry != nil {
+		registryHandler = handler.NewRegistryCredentialHandler(services.Registry)
 	}
 	
-	webhookHandler := handler.NewWebhookHandler(projectService, pipelineService, buildService)
+	if services.GC != nil {
+		gcHandler = handler.NewGarbageCollectionHandler(services.GC)
+	}
+	
+	if services.Drift != nil {
+		driftHandler = handler.NewDriftHandler(services.Drift)
+	}
+	
+	if services.Retention != nil {
+		retentionHandler = handler.NewRetentionHandler(services.Retention)
+	}
+	
+	if services.Cache != nil {
+		cacheHandler = handler.NewCacheHandler(services.Cache)
+	}
+	
+	webhookHandler := handler.NewWebhookHandler(services.Project, services.Pipeline, services.Build, services.Git, services.Preview)
 
 	// Set Gin mode
 	gin.SetMode(cfg.Server.GinMode)
@@ -180,9 +185,77 @@ func Run() error {
 					projects.DELETE("/:id", projectHandler.DeleteProject)
 					projects.POST("/:id/collaborators", projectHandler.AddCollaborator)
 					projects.DELETE("/:id/collaborators/:userId", projectHandler.RemoveCollaborator)
+					projects.POST("/:id/webhook-secret", projectHandler.RotateWebhookSecret)
 				}
 			}
 
+			// Environment routes
+			if environmentHandler != nil {
+				protected.GET("/projects/:id/environments", environmentHandler.GetEnvironments)
+				protected.POST("/projects/:id/environments", environmentHandler.CreateEnvironment)
+
+				environments := protected.Group("/environments")
+				{
+					environments.GET("/:id", environmentHandler.GetEnvironment)
+					environments.PUT("/:id", environmentHandler.UpdateEnvironment)
+					environments.DELETE("/:id", environmentHandler.DeleteEnvironment)
+					environments.GET("/:id/deployments", environmentHandler.GetEnvironmentDeployments)
+					environments.POST("/:id/promote", environmentHandler.PromoteEnvironment)
+					environments.POST("/:id/promote/override", middleware.RequireRole("admin"), environmentHandler.PromoteEnvironmentOverride)
+				}
+			}
+
+			// Preview environment routes
+			if previewHandler != nil {
+				protected.GET("/projects/:id/previews", previewHandler.GetPreviews)
+
+				previews := protected.Group("/previews")
+				{
+					previews.GET("/:id", previewHandler.GetPreview)
+					previews.DELETE("/:id", previewHandler.DeletePreview)
+				}
+			}
+
+			// Certificate routes
+			if certificateHandler != nil {
+				protected.GET("/projects/:id/certificates", certificateHandler.GetCertificates)
+				protected.POST("/projects/:id/certificates", certificateHandler.CreateCertificate)
+
+				certificates := protected.Group("/certificates")
+				{
+					certificates.GET("/:id", certificateHandler.GetCertificate)
+					certificates.DELETE("/:id", certificateHandler.DeleteCertificate)
+				}
+			}
+
+			// Registry credential routes
+			if registryHandler != nil {
+				protected.GET("/projects/:id/registry-credentials", registryHandler.GetRegistryCredentials)
+				protected.POST("/projects/:id/registry-credentials", registryHandler.CreateRegistryCredential)
+
+				registryCredentials := protected.Group("/registry-credentials")
+				{
+					registryCredentials.GET("/:id", registryHandler.GetRegistryCredential)
+					registryCredentials.PUT("/:id", registryHandler.UpdateRegistryCredential)
+					registryCredentials.DELETE("/:id", registryHandler.DeleteRegistryCredential)
+				}
+			}
+
+			// Image retention routes
+			if retentionHandler != nil {
+				protected.GET("/projects/:id/retention-policy", retentionHandler.GetRetentionPolicy)
+				protected.PUT("/projects/:id/retention-policy", retentionHandler.UpdateRetentionPolicy)
+				protected.DELETE("/projects/:id/retention-policy", retentionHandler.DeleteRetentionPolicy)
+				protected.GET("/projects/:id/retention/report", retentionHandler.GetRetentionReport)
+				protected.POST("/projects/:id/retention/enforce", retentionHandler.EnforceRetentionPolicy)
+			}
+
+			// Step cache routes
+			if cacheHandler != nil {
+				protected.GET("/projects/:id/caches", cacheHandler.GetProjectCaches)
+				protected.DELETE("/projects/:id/caches/:cacheId", cacheHandler.DeleteCache)
+			}
+
 			// Pipeline routes
 			if pipelineHandler != nil {
 				pipelines := protected.Group("/pipelines")
@@ -206,6 +279,9 @@ func Run() error {
 					builds.GET("/", buildHandler.GetBuilds)
 					builds.GET("/:id", buildHandler.GetBuild)
 					builds.GET("/:id/logs", buildHandler.GetBuildLogs)
+					builds.GET("/:id/vulnerabilities", buildHandler.GetBuildVulnerabilities)
+					builds.GET("/:id/artifacts", buildHandler.GetBuildArtifacts)
+					builds.GET("/:id/artifacts/:artifactId", buildHandler.DownloadBuildArtifact)
 					builds.POST("/:id/cancel", buildHandler.CancelBuild)
 				}
 			}
@@ -214,22 +290,106 @@ func Run() error {
 			if deploymentHandler != nil {
 				deployments := protected.Group("/deployments")
 				{
+					deployments.POST("/", deploymentHandler.CreateDeployment)
+					deployments.POST("/override", middleware.RequireRole("admin"), deploymentHandler.CreateDeploymentOverride)
 					deployments.GET("/", deploymentHandler.GetDeployments)
 					deployments.GET("/:id", deploymentHandler.GetDeployment)
 					deployments.GET("/:id/logs", deploymentHandler.GetDeploymentLogs)
+					deployments.GET("/:id/pods", deploymentHandler.GetDeploymentPods)
+					deployments.GET("/:id/events", deploymentHandler.GetDeploymentEvents)
+					deployments.GET("/:id/releases", deploymentHandler.GetDeploymentReleases)
 					deployments.POST("/:id/rollback", deploymentHandler.RollbackDeployment)
+					deployments.POST("/:id/rollback/override", middleware.RequireRole("admin"), deploymentHandler.RollbackDeploymentOverride)
+					deployments.POST("/:id/scale", deploymentHandler.ScaleDeployment)
+					deployments.POST("/:id/scale/override", middleware.RequireRole("admin"), deploymentHandler.ScaleDeploymentOverride)
+					deployments.PUT("/:id/canary/weight", deploymentHandler.SetCanaryWeight)
+					deployments.PUT("/:id/canary/weight/override", middleware.RequireRole("admin"), deploymentHandler.SetCanaryWeightOverride)
+					deployments.POST("/:id/canary/promote", deploymentHandler.PromoteCanary)
+					deployments.POST("/:id/canary/promote/override", middleware.RequireRole("admin"), deploymentHandler.PromoteCanaryOverride)
+					deployments.POST("/:id/canary/abort", deploymentHandler.AbortCanary)
+				}
+			}
+
+			// Drift routes
+			if driftHandler != nil {
+				protected.GET("/deployments/:id/drift", driftHandler.GetDeploymentDrifts)
+				protected.POST("/deployments/:id/drift/check", driftHandler.CheckDeploymentDrift)
+				protected.POST("/deployments/:id/drift/revert", driftHandler.RevertDeploymentDrift)
+
+				drifts := protected.Group("/drifts")
+				{
+					drifts.GET("/", driftHandler.GetDrifts)
+					drifts.GET("/:id", driftHandler.GetDrift)
+					drifts.POST("/detect", middleware.RequireRole("admin"), driftHandler.DetectDrift)
+				}
+			}
+
+			// Approval routes
+			if approvalHandler != nil {
+				protected.GET("/deployments/:id/approval", approvalHandler.GetDeploymentApproval)
+
+				approvals := protected.Group("/approvals")
+				{
+					approvals.GET("/", approvalHandler.GetApprovals)
+					approvals.GET("/:id", approvalHandler.GetApproval)
+					approvals.POST("/:id/approve", approvalHandler.Approve)
+					approvals.POST("/:id/reject", approvalHandler.Reject)
+				}
+			}
+
+			// Freeze window routes
+			if freezeHandler != nil {
+				freezeWindows := protected.Group("/freeze-windows")
+				{
+					freezeWindows.GET("/", freezeHandler.GetFreezeWindows)
+					freezeWindows.GET("/:id", freezeHandler.GetFreezeWindow)
+					freezeWindows.POST("/", middleware.RequireRole("admin"), freezeHandler.CreateFreezeWindow)
+					freezeWindows.PUT("/:id", middleware.RequireRole("admin"), freezeHandler.UpdateFreezeWindow)
+					freezeWindows.DELETE("/:id", middleware.RequireRole("admin"), freezeHandler.DeleteFreezeWindow)
+				}
+			}
+
+			// Cluster routes
+			if clusterHandler != nil {
+				clusters := protected.Group("/clusters")
+				clusters.Use(middleware.RequireRole("admin"))
+				{
+					clusters.POST("/", clusterHandler.CreateCluster)
+					clusters.GET("/", clusterHandler.GetClusters)
+					clusters.GET("/:id", clusterHandler.GetCluster)
+					clusters.PUT("/:id", clusterHandler.UpdateCluster)
+					clusters.DELETE("/:id", clusterHandler.DeleteCluster)
+					clusters.POST("/:id/check", clusterHandler.CheckCluster)
+				}
+
+				bindings := protected.Group("/cluster-bindings")
+				bindings.Use(middleware.RequireRole("admin"))
+				{
+					bindings.GET("/", clusterHandler.GetBindings)
+					bindings.PUT("/:environment", clusterHandler.SetBinding)
+					bindings.DELETE("/:environment", clusterHandler.DeleteBinding)
+				}
+			}
+
+			// Garbage collection routes
+			if gcHandler != nil {
+				gc := protected.Group("/gc")
+				gc.Use(middleware.RequireRole("admin"))
+				{
+					gc.GET("/report", gcHandler.GetReport)
+					gc.POST("/collect", gcHandler.Collect)
 				}
 			}
 		}
 	}
 
-	// Webhook routes (public, secured by secret)
+	// Webhook routes (public, verified with the project's webhook secret)
 	if webhookHandler != nil {
 		webhooks := r.Group("/webhooks")
 		{
-			webhooks.POST("/github/:projectSecret", webhookHandler.HandleGitHub)
-			webhooks.POST("/gitlab/:projectSecret", webhookHandler.HandleGitLab)
-			webhooks.POST("/gitee/:projectSecret", webhookHandler.HandleGitee)
+			webhooks.POST("/github/:projectId", webhookHandler.HandleGitHub)
+			webhooks.POST("/gitlab/:projectId", webhookHandler.HandleGitLab)
+			webhooks.POST("/gitee/:projectId", webhookHandler.HandleGitee)
 		}
 	}
 
@@ -13,10 +13,16 @@ type Config struct {
 	Redis    RedisConfig    `mapstructure:"redis"`
 	JWT      JWTConfig      `mapstructure:"jwt"`
 	Docker   DockerConfig   `mapstructure:"docker"`
+	Build    BuildConfig    `mapstructure:"build"`
+	Scan     ScanConfig     `mapstructure:"scan"`
+	Signing  SigningConfig  `mapstructure:"signing"`
 	K8s      K8sConfig      `mapstructure:"k8s"`
 	Git      GitConfig      `mapstructure:"git"`
 	Storage  StorageConfig  `mapstructure:"storage"`
 	Log      LogConfig      `mapstructure:"log"`
+	Security SecurityConfig `mapstructure:"security"`
+	Approval ApprovalConfig `mapstructure:"approval"`
+	Preview  PreviewConfig  `mapstructure:"preview"`
 }
 
 type ServerConfig struct {
@@ -50,11 +56,63 @@ type DockerConfig struct {
 	Registry string `mapstructure:"registry"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
+	BuildKit bool   `mapstructure:"buildkit"` // build with docker buildx instead of the classic builder
+	Builder  string `mapstructure:"builder"`  // buildx builder instance, e.g. a docker-container builder for local cache export
+
+	MaxContextSize string `mapstructure:"max_context_size"` // e.g. 2GB, unlimited when empty
+	SecretsDir     string `mapstructure:"secrets_dir"`      // build secrets and SSH keys pipelines may mount, disabled when empty
+}
+
+type BuildConfig struct {
+	Backend        string `mapstructure:"backend"`         // docker, kubernetes, or auto to use Docker when its daemon is reachable
+	Namespace      string `mapstructure:"namespace"`       // namespace of build jobs, defaults to k8s.namespace
+	Executor       string `mapstructure:"executor"`        // kaniko or buildkit
+	ExecutorImage  string `mapstructure:"executor_image"`  // overrides the default executor image
+	RegistrySecret string `mapstructure:"registry_secret"` // dockerconfigjson Secret build jobs push with
+	Timeout        string `mapstructure:"timeout"`
+
+	RetentionInterval string `mapstructure:"retention_interval"` // image retention enforcement, disabled when empty
+
+	StepTimeout string  `mapstructure:"step_timeout"` // default timeout of pipeline steps
+	StepCPUs    float64 `mapstructure:"step_cpus"`    // CPU limit of pipeline step containers, unlimited when zero
+	StepMemory  string  `mapstructure:"step_memory"`  // memory limit of pipeline step containers, e.g. 2GB, unlimited when empty
+	CacheTTL    string  `mapstructure:"cache_ttl"`    // step caches unused for longer are deleted, kept forever when empty
+
+	CacheCleanInterval string `mapstructure:"cache_clean_interval"` // unused step cache cleanup, disabled when empty
+}
+
+type ScanConfig struct {
+	Enabled      bool   `mapstructure:"enabled"`
+	Command      string `mapstructure:"command"`        // Trivy compatible scanner
+	CacheDir     string `mapstructure:"cache_dir"`      // vulnerability database location
+	SkipDBUpdate bool   `mapstructure:"skip_db_update"` // scan against the local database only, for offline clusters
+	SBOMFormat   string `mapstructure:"sbom_format"`    // cyclonedx or spdx-json
+	Timeout      string `mapstructure:"timeout"`
+}
+
+type SigningConfig struct {
+	Enabled         bool   `mapstructure:"enabled"` // sign the images of successful builds
+	Command         string `mapstructure:"command"` // cosign
+	Key             string `mapstructure:"key"`     // cosign private key file
+	PublicKey       string `mapstructure:"public_key"`
+	Password        string `mapstructure:"password"`         // password of the private key
+	TransparencyLog bool   `mapstructure:"transparency_log"` // record signatures in the public Rekor log
+	RequireSigned   bool   `mapstructure:"require_signed"`   // refuse to deploy images without a valid signature
+	Timeout         string `mapstructure:"timeout"`
 }
 
 type K8sConfig struct {
-	Kubeconfig string `mapstructure:"kubeconfig"`
-	Namespace  string `mapstructure:"namespace"`
+	Kubeconfig           string `mapstructure:"kubeconfig"`
+	Namespace            string `mapstructure:"namespace"`
+	ReadyTimeout         string `mapstructure:"ready_timeout"`
+	BlueGreenRetention   string `mapstructure:"blue_green_retention"`
+	InstallationID       string `mapstructure:"installation_id"` // labels the resources of this instance, required to delete orphans
+	GCInterval           string `mapstructure:"gc_interval"`     // orphaned resource collection, disabled when empty
+	GCDelete             bool   `mapstructure:"gc_delete"`       // the collector only reports orphans unless set
+	DriftInterval        string `mapstructure:"drift_interval"`            // periodic drift detection, disabled when empty
+	DriftAutoRevert      bool   `mapstructure:"drift_auto_revert"`         // restore drifted workloads to their applied state
+	ManifestClusterKinds string `mapstructure:"manifest_cluster_kinds"`    // comma separated cluster-scoped kinds manifest and Helm deployments may apply
+	RegistryRefresh      string `mapstructure:"registry_refresh_interval"` // renewal of short-lived image pull credentials, disabled when empty
 }
 
 type GitConfig struct {
@@ -62,6 +120,9 @@ type GitConfig struct {
 	GitHubClientSecret string `mapstructure:"github_client_secret"`
 	GitLabClientID     string `mapstructure:"gitlab_client_id"`
 	GitLabClientSecret string `mapstructure:"gitlab_client_secret"`
+	GitHubToken        string `mapstructure:"github_token"`
+	CloneUsername      string `mapstructure:"clone_username"` // credentials for cloning private repositories over HTTPS
+	ClonePassword      string `mapstructure:"clone_password"`
 }
 
 type StorageConfig struct {
@@ -75,6 +136,20 @@ type AWSConfig struct {
 	SecretAccessKey string `mapstructure:"secret_access_key"`
 	Region string `mapstructure:"region"`
 	S3Bucket string `mapstructure:"s3_bucket"`
+	Endpoint string `mapstructure:"endpoint"` // S3 compatible service such as MinIO, AWS when empty
+}
+
+type SecurityConfig struct {
+	EncryptionKey string `mapstructure:"encryption_key"` // encrypts stored credentials, which cannot be used while it is empty
+}
+
+type ApprovalConfig struct {
+	TTL string `mapstructure:"ttl"`
+}
+
+type PreviewConfig struct {
+	Domain string `mapstructure:"domain"`
+	TTL    string `mapstructure:"ttl"`
 }
 
 type LogConfig struct {
@@ -112,11 +187,56 @@ func LoadConfig() (*Config, error) {
 	viper.SetDefault("jwt.expires_in", "168h")
 	viper.SetDefault("docker.host", "unix:///var/run/docker.sock")
 	viper.SetDefault("docker.registry", "registry.hub.docker.com")
+	viper.SetDefault("docker.buildkit", false)
+	viper.SetDefault("docker.builder", "")
+	viper.SetDefault("docker.max_context_size", "2GB")
+	viper.SetDefault("docker.secrets_dir", "")
+	viper.SetDefault("build.backend", "auto")
+	viper.SetDefault("build.executor", "kaniko")
+	viper.SetDefault("build.timeout", "30m")
+	viper.SetDefault("build.retention_interval", "")
+	viper.SetDefault("build.step_timeout", "30m")
+	viper.SetDefault("build.step_cpus", 2)
+	viper.SetDefault("build.step_memory", "2GB")
+	viper.SetDefault("build.cache_ttl", "168h")
+	viper.SetDefault("build.cache_clean_interval", "1h")
+	viper.SetDefault("scan.enabled", false)
+	viper.SetDefault("scan.command", "trivy")
+	viper.SetDefault("scan.cache_dir", "")
+	viper.SetDefault("scan.skip_db_update", false)
+	viper.SetDefault("scan.sbom_format", "cyclonedx")
+	viper.SetDefault("scan.timeout", "10m")
+	viper.SetDefault("signing.enabled", false)
+	viper.SetDefault("signing.command", "cosign")
+	viper.SetDefault("signing.key", "")
+	viper.SetDefault("signing.public_key", "")
+	viper.SetDefault("signing.password", "")
+	viper.SetDefault("signing.transparency_log", false)
+	viper.SetDefault("signing.require_signed", false)
+	viper.SetDefault("signing.timeout", "5m")
 	viper.SetDefault("k8s.namespace", "default")
+	viper.SetDefault("k8s.ready_timeout", "10m")
+	viper.SetDefault("k8s.blue_green_retention", "30m")
+	viper.SetDefault("k8s.installation_id", "")
+	viper.SetDefault("k8s.gc_interval", "")
+	viper.SetDefault("k8s.gc_delete", false)
+	viper.SetDefault("k8s.drift_interval", "")
+	viper.SetDefault("k8s.registry_refresh_interval", "30m")
+	viper.SetDefault("k8s.manifest_cluster_kinds", "")
+	viper.SetDefault("git.clone_username", "")
+	viper.SetDefault("git.clone_password", "")
 	viper.SetDefault("storage.type", "local")
 	viper.SetDefault("storage.path", "./uploads")
+	viper.SetDefault("storage.aws.access_key_id", "")
+	viper.SetDefault("storage.aws.secret_access_key", "")
+	viper.SetDefault("storage.aws.region", "")
+	viper.SetDefault("storage.aws.s3_bucket", "")
+	viper.SetDefault("storage.aws.endpoint", "")
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.format", "json")
+	viper.SetDefault("security.encryption_key", "")
+	viper.SetDefault("approval.ttl", "24h")
+	viper.SetDefault("preview.ttl", "72h")
 
 	if err := viper.ReadInConfig(); err != nil {
 		// Config file not found, use environment variables and defaults
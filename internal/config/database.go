@@ -47,9 +47,23 @@ func InitDatabase(config *Config) (*gorm.DB, error) {
 		&models.Pipeline{},
 		&models.PipelineTrigger{},
 		&models.Build{},
+		&models.Vulnerability{},
+		&models.BuildArtifact{},
+		&models.BuildCache{},
+		&models.RetentionPolicy{},
 		&models.Deployment{},
 		&models.EnvironmentVariable{},
 		&models.WebhookLog{},
+		&models.Environment{},
+		&models.ApprovalRequest{},
+		&models.ApprovalDecision{},
+		&models.FreezeWindow{},
+		&models.PreviewEnvironment{},
+		&models.Certificate{},
+		&models.RegistryCredential{},
+		&models.DeploymentDrift{},
+		&models.Cluster{},
+		&models.ClusterBinding{},
 	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApprovalHandler struct {
+	approvalService *service.ApprovalService
+}
+
+func NewApprovalHandler(approvalService *service.ApprovalService) *ApprovalHandler {
+	return &ApprovalHandler{
+		approvalService: approvalService,
+	}
+}
+
+type ApprovalDecisionRequest struct {
+	Comment string `json:"comment"`
+}
+
+func (h *ApprovalHandler) GetApprovals(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	approvals, err := h.approvalService.List(userID.(uint), c.Query("status"), offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get approval requests"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Approval requests retrieved successfully",
+		"approvals": approvals,
+	})
+}
+
+func (h *ApprovalHandler) GetApproval(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid approval request ID"})
+		return
+	}
+
+	approval, err := h.approvalService.GetByID(uint(id), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approval request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Approval request retrieved successfully",
+		"approval": approval,
+	})
+}
+
+func (h *ApprovalHandler) GetDeploymentApproval(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	approval, err := h.approvalService.GetByDeploymentID(uint(id), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approval request not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Approval request retrieved successfully",
+		"approval": approval,
+	})
+}
+
+func (h *ApprovalHandler) Approve(c *gin.Context) {
+	h.decide(c, h.approvalService.Approve, "Deployment approved successfully")
+}
+
+func (h *ApprovalHandler) Reject(c *gin.Context) {
+	h.decide(c, h.approvalService.Reject, "Deployment rejected successfully")
+}
+
+func (h *ApprovalHandler) decide(c *gin.Context, decide func(id, userID uint, comment string) (*models.ApprovalRequest, error), message string) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid approval request ID"})
+		return
+	}
+
+	var req ApprovalDecisionRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	approval, err := decide(uint(id), userID.(uint), req.Comment)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  message,
+		"approval": approval,
+	})
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"ys-cloud/internal/service"
@@ -10,17 +11,19 @@ import (
 
 type BuildHandler struct {
 	buildService     *service.BuildService
+	scanService      *service.ScanService
+	artifactService  *service.ArtifactService
 	gitService       *service.GitService
-	dockerService    *service.DockerService
 	k8sService       *service.K8sService
 }
 
-func NewBuildHandler(buildService *service.BuildService, gitService *service.GitService, dockerService *service.DockerService, k8sService *service.K8sService) *BuildHandler {
+func NewBuildHandler(buildService *service.BuildService, scanService *service.ScanService, artifactService *service.ArtifactService, gitService *service.GitService, k8sService *service.K8sService) *BuildHandler {
 	return &BuildHandler{
-		buildService:  buildService,
-		gitService:    gitService,
-		dockerService: dockerService,
-		k8sService:    k8sService,
+		buildService:    buildService,
+		scanService:     scanService,
+		artifactService: artifactService,
+		gitService:      gitService,
+		k8sService:      k8sService,
 	}
 }
 
@@ -110,6 +113,86 @@ func (h *BuildHandler) GetBuildLogs(c *gin.Context) {
 	})
 }
 
+func (h *BuildHandler) GetBuildVulnerabilities(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid build ID"})
+		return
+	}
+
+	build, err := h.buildService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+
+	vulnerabilities, summary, err := h.scanService.GetByBuildID(build.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get vulnerabilities"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":         "Vulnerabilities retrieved successfully",
+		"scan_status":     build.ScanStatus,
+		"summary":         summary,
+		"vulnerabilities": vulnerabilities,
+	})
+}
+
+func (h *BuildHandler) GetBuildArtifacts(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid build ID"})
+		return
+	}
+
+	build, err := h.buildService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Build not found"})
+		return
+	}
+
+	artifacts, err := h.artifactService.GetByBuildID(build.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get build artifacts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":   "Build artifacts retrieved successfully",
+		"signed":    build.Signed,
+		"artifacts": artifacts,
+	})
+}
+
+// DownloadBuildArtifact returns the content of an artifact, e.g. the SBOM document
+func (h *BuildHandler) DownloadBuildArtifact(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid build ID"})
+		return
+	}
+	artifactID, err := strconv.ParseUint(c.Param("artifactId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid artifact ID"})
+		return
+	}
+
+	artifact, err := h.artifactService.GetByID(uint(artifactID))
+	if err != nil || artifact.BuildID != uint(id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artifact not found"})
+		return
+	}
+	if artifact.Content == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Artifact has no content"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=build-%d-%s.%s.json", artifact.BuildID, artifact.Type, artifact.Format))
+	c.Data(http.StatusOK, "application/json", []byte(artifact.Content))
+}
+
 func (h *BuildHandler) CancelBuild(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
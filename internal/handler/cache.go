@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CacheHandler struct {
+	cacheService *service.CacheService
+}
+
+func NewCacheHandler(cacheService *service.CacheService) *CacheHandler {
+	return &CacheHandler{
+		cacheService: cacheService,
+	}
+}
+
+// GetProjectCaches lists the saved step caches of a project
+func (h *CacheHandler) GetProjectCaches(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	caches, err := h.cacheService.GetByProjectID(uint(projectID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"caches": caches})
+}
+
+func (h *CacheHandler) DeleteCache(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+	cacheID, err := strconv.ParseUint(c.Param("cacheId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cache ID"})
+		return
+	}
+
+	if err := h.cacheService.Delete(uint(projectID), uint(cacheID), userID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cache deleted successfully",
+	})
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ClusterHandler struct {
+	clusterService *service.ClusterService
+}
+
+func NewClusterHandler(clusterService *service.ClusterService) *ClusterHandler {
+	return &ClusterHandler{
+		clusterService: clusterService,
+	}
+}
+
+type ClusterRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	AuthType    string `json:"auth_type" binding:"required,oneof=kubeconfig token"`
+	Server      string `json:"server"`
+	CAData      string `json:"ca_data"`
+	Insecure    bool   `json:"insecure"`
+	Kubeconfig  string `json:"kubeconfig"`
+	Token       string `json:"token"`
+}
+
+type ClusterBindingRequest struct {
+	ClusterID uint   `json:"cluster_id" binding:"required"`
+	Namespace string `json:"namespace"`
+}
+
+func (r ClusterRequest) input() service.ClusterInput {
+	return service.ClusterInput{
+		Name:        r.Name,
+		Description: r.Description,
+		AuthType:    r.AuthType,
+		Server:      r.Server,
+		CAData:      r.CAData,
+		Insecure:    r.Insecure,
+		Kubeconfig:  r.Kubeconfig,
+		Token:       r.Token,
+	}
+}
+
+func (h *ClusterHandler) CreateCluster(c *gin.Context) {
+	var req ClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cluster, err := h.clusterService.Create(req.input())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Cluster created successfully",
+		"cluster": cluster,
+	})
+}
+
+func (h *ClusterHandler) GetClusters(c *gin.Context) {
+	clusters, err := h.clusterService.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"clusters": clusters})
+}
+
+func (h *ClusterHandler) GetCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster ID"})
+		return
+	}
+
+	cluster, err := h.clusterService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"cluster": cluster})
+}
+
+func (h *ClusterHandler) UpdateCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster ID"})
+		return
+	}
+
+	var req ClusterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cluster, err := h.clusterService.Update(uint(id), req.input())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cluster updated successfully",
+		"cluster": cluster,
+	})
+}
+
+func (h *ClusterHandler) DeleteCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster ID"})
+		return
+	}
+
+	if err := h.clusterService.Delete(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cluster deleted successfully"})
+}
+
+func (h *ClusterHandler) CheckCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cluster ID"})
+		return
+	}
+
+	version, err := h.clusterService.CheckConnectivity(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{
+			"reachable": false,
+			"error":     err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reachable": true,
+		"version":   version,
+	})
+}
+
+func (h *ClusterHandler) GetBindings(c *gin.Context) {
+	bindings, err := h.clusterService.ListBindings()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bindings": bindings})
+}
+
+func (h *ClusterHandler) SetBinding(c *gin.Context) {
+	var req ClusterBindingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	binding, err := h.clusterService.SetBinding(c.Param("environment"), req.ClusterID, req.Namespace)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Cluster binding saved successfully",
+		"binding": binding,
+	})
+}
+
+func (h *ClusterHandler) DeleteBinding(c *gin.Context) {
+	if err := h.clusterService.DeleteBinding(c.Param("environment")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cluster binding deleted successfully"})
+}
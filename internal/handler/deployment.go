@@ -23,10 +23,79 @@ func NewDeploymentHandler(deploymentService *service.DeploymentService, k8sServi
 type CreateDeploymentRequest struct {
 	BuildID      uint   `json:"build_id" binding:"required"`
 	Environment  string `json:"environment" binding:"required"`
-	Replicas     int32  `json:"replicas" binding:"required"`
+	Replicas     int32  `json:"replicas" binding:"min=0"` // 0 uses the environment default
 	Namespace    string `json:"namespace"`
 	ServiceName  string `json:"service_name"`
 	IngressHost  string `json:"ingress_host"`
+	Type         string `json:"type" binding:"omitempty,oneof=kubernetes helm manifests kustomize"`
+	Strategy     string `json:"strategy" binding:"omitempty,oneof=rolling blue_green canary"`
+	CanaryWeight int    `json:"canary_weight" binding:"omitempty,min=0,max=100"`
+
+	Spec *service.DeploymentSpec `json:"spec"`
+}
+
+type ScaleDeploymentRequest struct {
+	Replicas *int32 `json:"replicas" binding:"required,min=0"`
+}
+
+type CanaryWeightRequest struct {
+	Weight *int `json:"weight" binding:"required,min=0,max=100"`
+}
+
+func (h *DeploymentHandler) CreateDeployment(c *gin.Context) {
+	h.createDeployment(c, false)
+}
+
+// CreateDeploymentOverride deploys through active freeze windows; routed for admins only
+func (h *DeploymentHandler) CreateDeploymentOverride(c *gin.Context) {
+	h.createDeployment(c, true)
+}
+
+func (h *DeploymentHandler) createDeployment(c *gin.Context, override bool) {
+	userID, _ := c.Get("user_id")
+
+	var req CreateDeploymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deployment, err := h.deploymentService.Create(service.CreateDeploymentInput{
+		BuildID:      req.BuildID,
+		Environment:  req.Environment,
+		Replicas:     req.Replicas,
+		Namespace:    req.Namespace,
+		ServiceName:  req.ServiceName,
+		IngressHost:  req.IngressHost,
+		Type:         req.Type,
+		Strategy:     req.Strategy,
+		CanaryWeight: req.CanaryWeight,
+		Spec:         req.Spec,
+		RequestedBy:  userID.(uint),
+		Override:     override,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if deployment.Status == "awaiting_approval" {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    "Deployment is awaiting approval",
+			"deployment": deployment,
+		})
+		return
+	}
+
+	if err := h.deploymentService.StartDeployment(deployment.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Deployment started successfully",
+		"deployment": deployment,
+	})
 }
 
 func (h *DeploymentHandler) GetDeployments(c *gin.Context) {
@@ -51,9 +120,31 @@ func (h *DeploymentHandler) GetDeployments(c *gin.Context) {
 		return
 	}
 
+	// environment filters by name, environmentId by a project environment
 	environment := c.Query("environment")
 	if environment != "" {
-		deployments, err := h.deploymentService.GetByEnvironment(environment)
+		deployments, err := h.deploymentService.GetByEnvironmentName(environment)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deployments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":     "Deployments retrieved successfully",
+			"deployments": deployments,
+		})
+		return
+	}
+
+	environmentIDStr := c.Query("environmentId")
+	if environmentIDStr != "" {
+		environmentID, err := strconv.ParseUint(environmentIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+			return
+		}
+
+		deployments, err := h.deploymentService.GetByEnvironment(uint(environmentID))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deployments"})
 			return
@@ -92,6 +183,12 @@ func (h *DeploymentHandler) GetDeployment(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	deployment, err := h.deploymentService.GetByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
@@ -111,6 +208,12 @@ func (h *DeploymentHandler) GetDeploymentLogs(c *gin.Context) {
 		return
 	}
 
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
 	deployment, err := h.deploymentService.GetByID(uint(id))
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Deployment not found"})
@@ -125,14 +228,86 @@ func (h *DeploymentHandler) GetDeploymentLogs(c *gin.Context) {
 	})
 }
 
+func (h *DeploymentHandler) GetDeploymentPods(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	pods, err := h.deploymentService.GetPods(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Deployment pods retrieved successfully",
+		"pods":    pods,
+	})
+}
+
+func (h *DeploymentHandler) GetDeploymentEvents(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	events, err := h.deploymentService.GetEvents(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Deployment events retrieved successfully",
+		"events":  events,
+	})
+}
+
 func (h *DeploymentHandler) RollbackDeployment(c *gin.Context) {
+	h.rollbackDeployment(c, false)
+}
+
+// RollbackDeploymentOverride rolls back deployments in protected environments without approval and through freeze windows; routed for admins only
+func (h *DeploymentHandler) RollbackDeploymentOverride(c *gin.Context) {
+	h.rollbackDeployment(c, true)
+}
+
+func (h *DeploymentHandler) rollbackDeployment(c *gin.Context, override bool) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
 		return
 	}
 
-	if err := h.deploymentService.Rollback(uint(id)); err != nil {
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Helm deployments may roll back to a specific release revision
+	revision, err := strconv.Atoi(c.DefaultQuery("revision", "0"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
+		return
+	}
+
+	if err := h.deploymentService.Rollback(uint(id), revision, override); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
@@ -140,4 +315,164 @@ func (h *DeploymentHandler) RollbackDeployment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Deployment rollback initiated successfully",
 	})
+}
+
+func (h *DeploymentHandler) GetDeploymentReleases(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	releases, err := h.deploymentService.GetReleases(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Releases retrieved successfully",
+		"releases": releases,
+	})
+}
+
+func (h *DeploymentHandler) SetCanaryWeight(c *gin.Context) {
+	h.setCanaryWeight(c, false)
+}
+
+// SetCanaryWeightOverride shifts canary traffic through active freeze windows; routed for admins only
+func (h *DeploymentHandler) SetCanaryWeightOverride(c *gin.Context) {
+	h.setCanaryWeight(c, true)
+}
+
+func (h *DeploymentHandler) setCanaryWeight(c *gin.Context, override bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req CanaryWeightRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deployment, err := h.deploymentService.SetCanaryWeight(uint(id), *req.Weight, override)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Canary weight updated successfully",
+		"deployment": deployment,
+	})
+}
+
+func (h *DeploymentHandler) PromoteCanary(c *gin.Context) {
+	h.promoteCanary(c, false)
+}
+
+// PromoteCanaryOverride promotes canaries in protected environments without approval and through freeze windows; routed for admins only
+func (h *DeploymentHandler) PromoteCanaryOverride(c *gin.Context) {
+	h.promoteCanary(c, true)
+}
+
+func (h *DeploymentHandler) promoteCanary(c *gin.Context, override bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.deploymentService.PromoteCanary(uint(id), override); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Canary promoted successfully",
+	})
+}
+
+func (h *DeploymentHandler) AbortCanary(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.deploymentService.AbortCanary(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Canary aborted successfully",
+	})
+}
+
+func (h *DeploymentHandler) ScaleDeployment(c *gin.Context) {
+	h.scaleDeployment(c, false)
+}
+
+// ScaleDeploymentOverride scales deployments in protected environments without approval and through freeze windows; routed for admins only
+func (h *DeploymentHandler) ScaleDeploymentOverride(c *gin.Context) {
+	h.scaleDeployment(c, true)
+}
+
+func (h *DeploymentHandler) scaleDeployment(c *gin.Context, override bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.deploymentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req ScaleDeploymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deployment, err := h.deploymentService.Scale(uint(id), *req.Replicas, override)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Deployment scaled successfully",
+		"deployment": deployment,
+	})
 }
\ No newline at end of file
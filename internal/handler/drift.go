@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DriftHandler struct {
+	driftService *service.DriftService
+}
+
+func NewDriftHandler(driftService *service.DriftService) *DriftHandler {
+	return &DriftHandler{
+		driftService: driftService,
+	}
+}
+
+func (h *DriftHandler) GetDrifts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	drifts, err := h.driftService.List(userID.(uint), c.Query("status"), offset, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get drifts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Drifts retrieved successfully",
+		"drifts":  drifts,
+	})
+}
+
+func (h *DriftHandler) GetDrift(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid drift ID"})
+		return
+	}
+
+	drift, err := h.driftService.GetByID(uint(id), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Drift not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Drift retrieved successfully",
+		"drift":   drift,
+	})
+}
+
+// DetectDrift checks every live deployment immediately instead of waiting for the detector
+func (h *DriftHandler) DetectDrift(c *gin.Context) {
+	if err := h.driftService.DetectAll(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Drift detection completed successfully"})
+}
+
+func (h *DriftHandler) GetDeploymentDrifts(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	drifts, err := h.driftService.GetByDeployment(uint(id), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get drifts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Drifts retrieved successfully",
+		"drifts":  drifts,
+	})
+}
+
+func (h *DriftHandler) CheckDeploymentDrift(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	check, err := h.driftService.Check(uint(id), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Drift checked successfully",
+		"check":   check,
+	})
+}
+
+func (h *DriftHandler) RevertDeploymentDrift(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid deployment ID"})
+		return
+	}
+
+	check, err := h.driftService.Revert(uint(id), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Drift reverted successfully",
+		"check":   check,
+	})
+}
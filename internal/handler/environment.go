@@ -0,0 +1,235 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EnvironmentHandler struct {
+	environmentService *service.EnvironmentService
+	deploymentService  *service.DeploymentService
+}
+
+func NewEnvironmentHandler(environmentService *service.EnvironmentService, deploymentService *service.DeploymentService) *EnvironmentHandler {
+	return &EnvironmentHandler{
+		environmentService: environmentService,
+		deploymentService:  deploymentService,
+	}
+}
+
+type EnvironmentRequest struct {
+	Name            string `json:"name" binding:"required"`
+	ClusterID       *uint  `json:"cluster_id"`
+	Namespace       string `json:"namespace"`
+	IngressDomain   string `json:"ingress_domain"`
+	DefaultReplicas int32  `json:"default_replicas" binding:"min=0"`
+	Protected       bool   `json:"protected"`
+	Order           int    `json:"order"`
+
+	RequiredApprovals int    `json:"required_approvals" binding:"min=0"`
+	ApproverIDs       []uint `json:"approver_ids"`
+}
+
+type PromoteRequest struct {
+	TargetEnvironmentID *uint `json:"target_environment_id"`
+}
+
+func (r EnvironmentRequest) input() service.EnvironmentInput {
+	return service.EnvironmentInput{
+		Name:            r.Name,
+		ClusterID:       r.ClusterID,
+		Namespace:       r.Namespace,
+		IngressDomain:   r.IngressDomain,
+		DefaultReplicas: r.DefaultReplicas,
+		Protected:       r.Protected,
+		Order:           r.Order,
+
+		RequiredApprovals: r.RequiredApprovals,
+		ApproverIDs:       r.ApproverIDs,
+	}
+}
+
+func (h *EnvironmentHandler) CreateEnvironment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req EnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	environment, err := h.environmentService.Create(uint(projectID), req.input(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":     "Environment created successfully",
+		"environment": environment,
+	})
+}
+
+func (h *EnvironmentHandler) GetEnvironments(c *gin.Context) {
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	environments, err := h.environmentService.GetByProjectID(uint(projectID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get environments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Environments retrieved successfully",
+		"environments": environments,
+	})
+}
+
+func (h *EnvironmentHandler) GetEnvironment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	environment, err := h.environmentService.GetByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Environment not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Environment retrieved successfully",
+		"environment": environment,
+	})
+}
+
+func (h *EnvironmentHandler) UpdateEnvironment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	var req EnvironmentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	environment, err := h.environmentService.Update(uint(id), req.input(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Environment updated successfully",
+		"environment": environment,
+	})
+}
+
+func (h *EnvironmentHandler) DeleteEnvironment(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	if err := h.environmentService.Delete(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Environment deleted successfully"})
+}
+
+func (h *EnvironmentHandler) GetEnvironmentDeployments(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	if err := h.environmentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	deployments, err := h.deploymentService.GetByEnvironment(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get deployments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Deployments retrieved successfully",
+		"deployments": deployments,
+	})
+}
+
+// PromoteEnvironment deploys the environment's current build to the next environment
+func (h *EnvironmentHandler) PromoteEnvironment(c *gin.Context) {
+	h.promote(c, false)
+}
+
+// PromoteEnvironmentOverride promotes through active freeze windows; routed for admins only
+func (h *EnvironmentHandler) PromoteEnvironmentOverride(c *gin.Context) {
+	h.promote(c, true)
+}
+
+func (h *EnvironmentHandler) promote(c *gin.Context, override bool) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid environment ID"})
+		return
+	}
+
+	if err := h.environmentService.CheckMember(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	var req PromoteRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	deployment, err := h.deploymentService.Promote(uint(id), req.TargetEnvironmentID, userID.(uint), override)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if deployment.Status == "awaiting_approval" {
+		c.JSON(http.StatusAccepted, gin.H{
+			"message":    "Promotion is awaiting approval",
+			"deployment": deployment,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Promotion started successfully",
+		"deployment": deployment,
+	})
+}
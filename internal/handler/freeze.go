@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FreezeHandler struct {
+	freezeService *service.FreezeService
+}
+
+func NewFreezeHandler(freezeService *service.FreezeService) *FreezeHandler {
+	return &FreezeHandler{
+		freezeService: freezeService,
+	}
+}
+
+type FreezeWindowRequest struct {
+	ProjectID     uint       `json:"project_id" binding:"required"`
+	EnvironmentID *uint      `json:"environment_id"`
+	Reason        string     `json:"reason" binding:"required"`
+	Schedule      string     `json:"schedule"`
+	Duration      string     `json:"duration"`
+	Timezone      string     `json:"timezone"`
+	StartsAt      *time.Time `json:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at"`
+	Active        *bool      `json:"active"`
+}
+
+func (r FreezeWindowRequest) input() service.FreezeWindowInput {
+	active := true
+	if r.Active != nil {
+		active = *r.Active
+	}
+
+	return service.FreezeWindowInput{
+		ProjectID:     r.ProjectID,
+		EnvironmentID: r.EnvironmentID,
+		Reason:        r.Reason,
+		Schedule:      r.Schedule,
+		Duration:      r.Duration,
+		Timezone:      r.Timezone,
+		StartsAt:      r.StartsAt,
+		EndsAt:        r.EndsAt,
+		Active:        active,
+	}
+}
+
+func (h *FreezeHandler) CreateFreezeWindow(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+
+	var req FreezeWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window, err := h.freezeService.Create(req.input(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Freeze window created successfully",
+		"freeze_window": window,
+	})
+}
+
+func (h *FreezeHandler) GetFreezeWindows(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Query("projectId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	windows, err := h.freezeService.GetByProjectID(uint(projectID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Freeze windows retrieved successfully",
+		"freeze_windows": windows,
+	})
+}
+
+func (h *FreezeHandler) GetFreezeWindow(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freeze window ID"})
+		return
+	}
+
+	window, err := h.freezeService.GetByID(uint(id), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Freeze window retrieved successfully",
+		"freeze_window": window,
+	})
+}
+
+func (h *FreezeHandler) UpdateFreezeWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freeze window ID"})
+		return
+	}
+
+	var req FreezeWindowRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	window, err := h.freezeService.Update(uint(id), req.input())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Freeze window updated successfully",
+		"freeze_window": window,
+	})
+}
+
+func (h *FreezeHandler) DeleteFreezeWindow(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid freeze window ID"})
+		return
+	}
+
+	if err := h.freezeService.Delete(uint(id)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Freeze window deleted successfully"})
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"net/http"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GarbageCollectionHandler struct {
+	gcService *service.GarbageCollectionService
+}
+
+func NewGarbageCollectionHandler(gcService *service.GarbageCollectionService) *GarbageCollectionHandler {
+	return &GarbageCollectionHandler{
+		gcService: gcService,
+	}
+}
+
+// GetReport lists the orphaned cluster resources a collection would delete
+func (h *GarbageCollectionHandler) GetReport(c *gin.Context) {
+	report, err := h.gcService.Report()
+	if err != nil {
+		// A run that fails midway still reports what it found and deleted
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+func (h *GarbageCollectionHandler) Collect(c *gin.Context) {
+	report, err := h.gcService.Collect()
+	if err != nil {
+		// A run that fails midway still reports what it found and deleted
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "report": report})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Garbage collection completed successfully",
+		"report":  report,
+	})
+}
@@ -177,4 +177,25 @@ func (h *ProjectHandler) RemoveCollaborator(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Collaborator removed successfully",
 	})
-}
\ No newline at end of file
+}
+
+// RotateWebhookSecret generates a new webhook secret, returned only in this response
+func (h *ProjectHandler) RotateWebhookSecret(c *gin.Context) {
+	ownerID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	secret, err := h.projectService.RotateWebhookSecret(uint(projectID), ownerID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Webhook secret rotated successfully",
+		"webhook_secret": secret,
+	})
+}
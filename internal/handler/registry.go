@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RegistryCredentialHandler struct {
+	registryService *service.RegistryCredentialService
+}
+
+func NewRegistryCredentialHandler(registryService *service.RegistryCredentialService) *RegistryCredentialHandler {
+	return &RegistryCredentialHandler{
+		registryService: registryService,
+	}
+}
+
+type RegistryCredentialRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Provider  string `json:"provider"`
+	Registry  string `json:"registry"`
+	Namespace string `json:"namespace"`
+	Username  string `json:"username" binding:"required"`
+	Password  string `json:"password"` // required on creation, the stored one is kept on update when empty
+	Region    string `json:"region"`
+	Push      bool   `json:"push"`
+}
+
+func (r RegistryCredentialRequest) input() service.RegistryCredentialInput {
+	return service.RegistryCredentialInput{
+		Name:      r.Name,
+		Provider:  r.Provider,
+		Registry:  r.Registry,
+		Namespace: r.Namespace,
+		Username:  r.Username,
+		Password:  r.Password,
+		Region:    r.Region,
+		Push:      r.Push,
+	}
+}
+
+func (h *RegistryCredentialHandler) CreateRegistryCredential(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req RegistryCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := h.registryService.Create(uint(projectID), req.input(), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Registry credential created successfully",
+		"credential": credential,
+	})
+}
+
+func (h *RegistryCredentialHandler) GetRegistryCredentials(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	credentials, err := h.registryService.GetByProjectID(uint(projectID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Registry credentials retrieved successfully",
+		"credentials": credentials,
+	})
+}
+
+func (h *RegistryCredentialHandler) GetRegistryCredential(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid registry credential ID"})
+		return
+	}
+
+	credential, err := h.registryService.GetByID(uint(id), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Registry credential retrieved successfully",
+		"credential": credential,
+	})
+}
+
+func (h *RegistryCredentialHandler) UpdateRegistryCredential(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid registry credential ID"})
+		return
+	}
+
+	var req RegistryCredentialRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	credential, err := h.registryService.Update(uint(id), req.input(), userID.(uint))
+	if err != nil {
+		if err.Error() == "access denied" {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Registry credential updated successfully",
+		"credential": credential,
+	})
+}
+
+func (h *RegistryCredentialHandler) DeleteRegistryCredential(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid registry credential ID"})
+		return
+	}
+
+	if err := h.registryService.Delete(uint(id), userID.(uint)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Registry credential deleted successfully"})
+}
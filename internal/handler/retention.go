@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"ys-cloud/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RetentionHandler struct {
+	retentionService *service.RetentionService
+}
+
+func NewRetentionHandler(retentionService *service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+	}
+}
+
+type RetentionPolicyRequest struct {
+	Enabled       bool `json:"enabled"`
+	KeepPerBranch int  `json:"keep_per_branch"`
+	MaxAgeDays    int  `json:"max_age_days"`
+	KeepTags      bool `json:"keep_tags"`
+	CleanRegistry bool `json:"clean_registry"`
+}
+
+func (h *RetentionHandler) GetRetentionPolicy(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	policy, err := h.retentionService.GetPolicy(uint(projectID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Retention policy retrieved successfully",
+		"policy":  policy,
+	})
+}
+
+func (h *RetentionHandler) UpdateRetentionPolicy(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	var req RetentionPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, err := h.retentionService.SavePolicy(uint(projectID), service.RetentionPolicyInput{
+		Enabled:       req.Enabled,
+		KeepPerBranch: req.KeepPerBranch,
+		MaxAgeDays:    req.MaxAgeDays,
+		KeepTags:      req.KeepTags,
+		CleanRegistry: req.CleanRegistry,
+	}, userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Retention policy updated successfully",
+		"policy":  policy,
+	})
+}
+
+func (h *RetentionHandler) DeleteRetentionPolicy(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	if err := h.retentionService.DeletePolicy(uint(projectID), userID.(uint)); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Retention policy deleted successfully",
+	})
+}
+
+// GetRetentionReport lists the images an enforcement of the project's policy would delete
+func (h *RetentionHandler) GetRetentionReport(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	report, err := h.retentionService.Report(uint(projectID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"report": report})
+}
+
+func (h *RetentionHandler) EnforceRetentionPolicy(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	projectID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return
+	}
+
+	report, err := h.retentionService.Enforce(uint(projectID), userID.(uint))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Retention policy enforced successfully",
+		"report":  report,
+	})
+}
@@ -1,88 +1,216 @@
 package handler
 
 import (
+	"io"
 	"net/http"
+	"strconv"
+	"ys-cloud/internal/models"
 	"ys-cloud/internal/service"
+	"ys-cloud/pkg/git"
 
 	"github.com/gin-gonic/gin"
 )
 
 type WebhookHandler struct {
-	projectService *service.ProjectService
+	projectService  *service.ProjectService
 	pipelineService *service.PipelineService
-	buildService   *service.BuildService
+	buildService    *service.BuildService
+	gitService      *service.GitService
+	previewService  *service.PreviewService
 }
 
-func NewWebhookHandler(projectService *service.ProjectService, pipelineService *service.PipelineService, buildService *service.BuildService) *WebhookHandler {
+func NewWebhookHandler(projectService *service.ProjectService, pipelineService *service.PipelineService, buildService *service.BuildService, gitService *service.GitService, previewService *service.PreviewService) *WebhookHandler {
 	return &WebhookHandler{
 		projectService:  projectService,
 		pipelineService: pipelineService,
 		buildService:    buildService,
+		gitService:      gitService,
+		previewService:  previewService,
 	}
 }
 
 func (h *WebhookHandler) HandleGitHub(c *gin.Context) {
-	projectSecret := c.Param("projectSecret")
+	project, payload, ok := h.verify(c, func(payload []byte, secret string) bool {
+		return git.VerifyGitHubSignature(payload, c.GetHeader("X-Hub-Signature-256"), secret)
+	})
+	if !ok {
+		return
+	}
 
-	// Get headers
-	headers := make(map[string]string)
-	for key, values := range c.Request.Header {
-		if len(values) > 0 {
-			headers[key] = values[0]
-		}
+	event, err := h.gitService.ParseGitHubWebhook(payload, webhookHeaders(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	// TODO: Verify webhook signature
-	// TODO: Parse GitHub webhook payload
-	// TODO: Find project by secret
-	// TODO: Trigger pipelines based on webhook events
+	if event.Event == "pull_request" && event.PullRequest != nil {
+		h.handlePullRequest(c, project, event)
+		return
+	}
+
+	// TODO: Trigger pipelines based on push events
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "GitHub webhook received",
-		"secret":  projectSecret,
 	})
 }
 
-func (h *WebhookHandler) HandleGitLab(c *gin.Context) {
-	projectSecret := c.Param("projectSecret")
+// verify authenticates a delivery with the webhook secret of the project in the URL before any
+// work starts, and responds itself when the delivery is rejected
+func (h *WebhookHandler) verify(c *gin.Context, verify func(payload []byte, secret string) bool) (*models.Project, []byte, bool) {
+	projectID, err := strconv.ParseUint(c.Param("projectId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		return nil, nil, false
+	}
+	if h.projectService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Webhooks are not available"})
+		return nil, nil, false
+	}
 
-	// Get headers
-	headers := make(map[string]string)
-	for key, values := range c.Request.Header {
-		if len(values) > 0 {
-			headers[key] = values[0]
+	project, err := h.projectService.GetByID(uint(projectID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		return nil, nil, false
+	}
+	// Webhooks set up before secrets existed keep being acknowledged, but trigger nothing until
+	// the project owner generates a secret
+	if project.WebhookSecret == "" {
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook received, generate a webhook secret to trigger builds"})
+		return nil, nil, false
+	}
+	secret, err := h.projectService.WebhookSecret(project)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read webhook secret"})
+		return nil, nil, false
+	}
+
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read webhook payload"})
+		return nil, nil, false
+	}
+	if !verify(payload, secret) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid webhook signature"})
+		return nil, nil, false
+	}
+
+	return project, payload, true
+}
+
+// handlePullRequest builds every pipeline of the project for an opened or updated pull
+// request, whose preview environments are deployed once the builds succeed, and tears the
+// previews down when the pull request is closed or merged. Pull requests from forks are not
+// built: their code would run with the project's credentials and secrets.
+func (h *WebhookHandler) handlePullRequest(c *gin.Context, project *models.Project, event *git.GitWebhookPayload) {
+	if h.pipelineService == nil || h.buildService == nil || h.previewService == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Preview environments are not available"})
+		return
+	}
+
+	pullRequest := event.PullRequest
+	switch event.Action {
+	case "opened", "reopened", "synchronize":
+		if pullRequest.Fork {
+			c.JSON(http.StatusOK, gin.H{"message": "Pull requests from forks are not built"})
+			return
 		}
+
+		pipelines, err := h.pipelineService.GetByProjectID(project.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		previews := make([]*models.PreviewEnvironment, 0, len(pipelines))
+		builds := make([]*models.Build, 0, len(pipelines))
+		for _, pipeline := range pipelines {
+			preview, err := h.previewService.Open(pipeline, event.Repository.FullName, pullRequest.Number, pullRequest.Branch, pullRequest.Commit)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			previews = append(previews, preview)
+
+			build, err := h.buildService.CreateForPullRequest(pipeline.ID, pullRequest.Commit, pullRequest.Branch, pullRequest.Number)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if err := h.buildService.StartBuild(build.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			builds = append(builds, build)
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "Pull request builds triggered successfully",
+			"previews": previews,
+			"builds":   builds,
+		})
+	case "closed":
+		if err := h.previewService.Close(project.ID, pullRequest.Number); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Preview environments torn down successfully"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "Pull request event ignored"})
 	}
+}
 
-	// TODO: Verify webhook signature
-	// TODO: Parse GitLab webhook payload
-	// TODO: Find project by secret
-	// TODO: Trigger pipelines based on webhook events
+func (h *WebhookHandler) HandleGitLab(c *gin.Context) {
+	project, payload, ok := h.verify(c, func(payload []byte, secret string) bool {
+		return git.VerifyToken(c.GetHeader("X-Gitlab-Token"), secret)
+	})
+	if !ok {
+		return
+	}
+
+	event, err := h.gitService.ParseGitLabWebhook(payload, webhookHeaders(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if event.Event == "pull_request" && event.PullRequest != nil {
+		h.handlePullRequest(c, project, event)
+		return
+	}
+
+	// TODO: Trigger pipelines based on push events
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "GitLab webhook received",
-		"secret":  projectSecret,
 	})
 }
 
 func (h *WebhookHandler) HandleGitee(c *gin.Context) {
-	projectSecret := c.Param("projectSecret")
-
-	// Get headers
-	headers := make(map[string]string)
-	for key, values := range c.Request.Header {
-		if len(values) > 0 {
-			headers[key] = values[0]
-		}
+	// Gitee sends the webhook password as is unless signing is enabled
+	_, _, ok := h.verify(c, func(payload []byte, secret string) bool {
+		return git.VerifyToken(c.GetHeader("X-Gitee-Token"), secret)
+	})
+	if !ok {
+		return
 	}
 
-	// TODO: Verify webhook signature
 	// TODO: Parse Gitee webhook payload
-	// TODO: Find project by secret
 	// TODO: Trigger pipelines based on webhook events
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Gitee webhook received",
-		"secret":  projectSecret,
 	})
-}
\ No newline at end of file
+}
+
+// webhookHeaders flattens the request headers to their first values
+func webhookHeaders(c *gin.Context) map[string]string {
+	headers := make(map[string]string)
+	for key, values := range c.Request.Header {
+		if len(values) > 0 {
+			headers[key] = values[0]
+		}
+	}
+	return headers
+}
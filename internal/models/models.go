@@ -20,15 +20,16 @@ type User struct {
 }
 
 type Project struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	Name        string         `json:"name" gorm:"not null"`
-	Description string         `json:"description"`
-	GitURL      string         `json:"git_url"`
-	GitProvider string         `json:"git_provider"`
-	OwnerID     uint           `json:"owner_id"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Name          string         `json:"name" gorm:"not null"`
+	Description   string         `json:"description"`
+	GitURL        string         `json:"git_url"`
+	GitProvider   string         `json:"git_provider"`
+	OwnerID       uint           `json:"owner_id"`
+	WebhookSecret string         `json:"-" gorm:"type:text"` // encrypted, verifies webhook deliveries
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
 
 	Owner     User         `json:"owner" gorm:"foreignKey:OwnerID"`
 	Pipelines []Pipeline   `json:"pipelines"`
@@ -66,41 +67,302 @@ type PipelineTrigger struct {
 }
 
 type Build struct {
-	ID          uint           `json:"id" gorm:"primaryKey"`
-	PipelineID  uint           `json:"pipeline_id"`
-	CommitHash  string         `json:"commit_hash"`
-	Branch      string         `json:"branch"`
-	Tag         string         `json:"tag"`
-	Status      string         `json:"status"` // pending, running, success, failed, cancelled
-	Logs        string         `json:"logs" gorm:"type:text"`
-	ImageName   string         `json:"image_name"`
-	ImageTag    string         `json:"image_tag"`
-	StartedAt   *time.Time     `json:"started_at"`
-	CompletedAt *time.Time     `json:"completed_at"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	PipelineID     uint           `json:"pipeline_id"`
+	CommitHash     string         `json:"commit_hash"`
+	Branch         string         `json:"branch"`
+	Tag            string         `json:"tag"`
+	PullRequest    int            `json:"pull_request"` // pull request the build was made for, 0 otherwise
+	Status         string         `json:"status"`       // pending, running, success, failed, cancelled
+	Logs           string         `json:"logs" gorm:"type:text"`
+	ImageName      string         `json:"image_name"`
+	ImageTag       string         `json:"image_tag"`        // primary tag
+	ImageTags      string         `json:"image_tags"`       // comma separated, every tag pushed for the build
+	ImageDigest    string         `json:"image_digest"`     // digest of the pushed image, deployments pull by digest
+	ImageDeletedAt *time.Time     `json:"image_deleted_at"` // image removed from the registry by the retention policy
+	ScanStatus     string         `json:"scan_status"`      // passed, blocked, failed or error; empty when not scanned
+	Signed         bool           `json:"signed"`           // image digest signed with the key of ys-cloud
+	StartedAt      *time.Time     `json:"started_at"`
+	CompletedAt    *time.Time     `json:"completed_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 
 	Pipeline    Pipeline      `json:"pipeline" gorm:"foreignKey:PipelineID"`
 	Deployments []Deployment  `json:"deployments"`
 }
 
+// Vulnerability is a finding of the image scan of a build
+type Vulnerability struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	BuildID          uint      `json:"build_id" gorm:"index"`
+	VulnerabilityID  string    `json:"vulnerability_id"` // e.g. CVE-2024-3094
+	Severity         string    `json:"severity"`         // UNKNOWN, LOW, MEDIUM, HIGH, CRITICAL
+	Package          string    `json:"package"`
+	InstalledVersion string    `json:"installed_version"`
+	FixedVersion     string    `json:"fixed_version"` // empty when no fix is available
+	Title            string    `json:"title" gorm:"type:text"`
+	Target           string    `json:"target"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// RetentionPolicy decides when the build images of a project are deleted from the build host
+// and the registry. Images of deployed builds are always kept.
+type RetentionPolicy struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	ProjectID     uint      `json:"project_id" gorm:"uniqueIndex"`
+	Enabled       bool      `json:"enabled"`         // enforced by the background job; reports are available regardless
+	KeepPerBranch int       `json:"keep_per_branch"` // newest builds kept per branch, 0 for no limit
+	MaxAgeDays    int       `json:"max_age_days"`    // builds older than this are deleted, 0 for no limit
+	KeepTags      bool      `json:"keep_tags"`       // builds of git tags are never deleted
+	CleanRegistry bool      `json:"clean_registry"`  // delete images from the registry as well as from the build host
+	UpdatedBy     uint      `json:"updated_by"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// BuildArtifact is a supply chain artifact of a build image: its SBOM or its signature
+type BuildArtifact struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	BuildID   uint      `json:"build_id" gorm:"index"`
+	Type      string    `json:"type"`      // sbom, signature; attestation for failed attestations
+	Format    string    `json:"format"`    // cyclonedx, spdx-json, cosign
+	Reference string    `json:"reference"` // registry reference the artifact is attached to the image under
+	Digest    string    `json:"digest"`    // sha256 of the content for SBOMs, the signed image digest for signatures
+	Size      int       `json:"size"`
+	Content   string    `json:"-" gorm:"type:text"`
+	Error     string    `json:"error,omitempty"` // why the artifact could not be produced; the build went on without it
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BuildCache is a dependency cache saved by the pipeline steps of a project, stored as a gzipped
+// tar archive in the storage backend
+type BuildCache struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	ProjectID  uint      `json:"project_id" gorm:"uniqueIndex:idx_build_cache_scope"`
+	Scope      string    `json:"scope" gorm:"uniqueIndex:idx_build_cache_scope"` // pull-<n> for pull request builds, empty otherwise
+	Name       string    `json:"name" gorm:"uniqueIndex:idx_build_cache_scope"`
+	Key        string    `json:"key" gorm:"uniqueIndex:idx_build_cache_scope"` // rendered key template
+	BuildID    uint      `json:"build_id"`                                     // build that saved the cache
+	Size       int64     `json:"size"`
+	LastUsedAt time.Time `json:"last_used_at" gorm:"index"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 type Deployment struct {
+	ID             uint           `json:"id" gorm:"primaryKey"`
+	BuildID        uint           `json:"build_id"`
+	Environment    string         `json:"environment"` // dev, staging, prod
+	EnvironmentID  *uint          `json:"environment_id"`
+	Status         string         `json:"status"` // pending, awaiting_approval, running, success, failed, cancelled; canary while a canary takes traffic, aborted once it is removed without promotion, deleted once its preview is torn down
+	Message        string         `json:"message"`
+	Type           string         `json:"type" gorm:"default:kubernetes"`  // kubernetes, helm, manifests, kustomize
+	Strategy       string         `json:"strategy" gorm:"default:rolling"` // rolling, blue_green, canary
+	Color          string         `json:"color"`                           // blue/green color serving this release
+	RetireColor    string         `json:"retire_color"`                    // inactive blue/green color deleted at RetireAt
+	RetireImage    string         `json:"-"`                               // image the retired color ran, it is kept once replaced
+	RetireAt       *time.Time     `json:"retire_at" gorm:"index"`
+	CanaryWeight   int            `json:"canary_weight"`                   // share of traffic routed to a canary release
+	Replicas       int32          `json:"replicas"`
+	Namespace      string         `json:"namespace"`
+	ServiceName    string         `json:"service_name"`
+	IngressHost    string         `json:"ingress_host"`
+	Spec           string         `json:"spec" gorm:"type:text"` // JSON container settings: ports, probes, resources, volumes
+	ClusterID      *uint          `json:"cluster_id"`            // nil targets the default cluster
+	FreezeOverride bool           `json:"freeze_override"`       // deployed through a freeze window by an admin
+	HelmRevision   int            `json:"helm_revision"`         // release revision a helm deployment produced
+	Resources      string         `json:"-" gorm:"type:text"`    // JSON objects a manifest deployment applied, pruned once later manifests drop them
+	AppliedState   string         `json:"-" gorm:"type:text"`    // JSON workload state rendered from the deployment options of a successful rollout
+	StartedAt      *time.Time     `json:"started_at"`
+	CompletedAt    *time.Time     `json:"completed_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Build Build `json:"build" gorm:"foreignKey:BuildID"`
+}
+
+// Environment is a deployment target of a project; builds are promoted through environments in ascending order
+type Environment struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	ProjectID         uint           `json:"project_id" gorm:"uniqueIndex:idx_project_environment"`
+	Name              string         `json:"name" gorm:"uniqueIndex:idx_project_environment;not null"`
+	ClusterID         *uint          `json:"cluster_id"` // nil falls back to the cluster binding of the environment name
+	Namespace         string         `json:"namespace"`
+	IngressDomain     string         `json:"ingress_domain"` // ingress hosts default to <service>.<domain>
+	DefaultReplicas   int32          `json:"default_replicas" gorm:"default:1"`
+	Protected         bool           `json:"protected" gorm:"default:false"`
+	RequiredApprovals int            `json:"required_approvals"` // approvals a deployment to a protected environment needs
+	Order             int            `json:"order" gorm:"column:sort_order"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Project   Project `json:"-" gorm:"foreignKey:ProjectID"`
+	Approvers []User  `json:"approvers" gorm:"many2many:environment_approvers;"`
+}
+
+// ApprovalRequest holds a deployment to a protected environment until enough approvers sign off
+type ApprovalRequest struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	DeploymentID      uint           `json:"deployment_id" gorm:"uniqueIndex"`
+	EnvironmentID     uint           `json:"environment_id"`
+	RequestedBy       uint           `json:"requested_by"`
+	Status            string         `json:"status"` // pending, approved, rejected, expired, cancelled
+	RequiredApprovals int            `json:"required_approvals"`
+	ExpiresAt         time.Time      `json:"expires_at"`
+	ResolvedAt        *time.Time     `json:"resolved_at"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Deployment  Deployment         `json:"deployment" gorm:"foreignKey:DeploymentID"`
+	Environment Environment        `json:"environment" gorm:"foreignKey:EnvironmentID"`
+	Requester   User               `json:"requester" gorm:"foreignKey:RequestedBy"`
+	Decisions   []ApprovalDecision `json:"decisions"`
+}
+
+// ApprovalDecision records one approver's verdict on an approval request
+type ApprovalDecision struct {
+	ID                uint           `json:"id" gorm:"primaryKey"`
+	ApprovalRequestID uint           `json:"approval_request_id" gorm:"uniqueIndex:idx_approval_decision_user"`
+	UserID            uint           `json:"user_id" gorm:"uniqueIndex:idx_approval_decision_user"`
+	Decision          string         `json:"decision"` // approved, rejected
+	Comment           string         `json:"comment" gorm:"type:text"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"-" gorm:"index"`
+
+	User User `json:"user" gorm:"foreignKey:UserID"`
+}
+
+// FreezeWindow blocks deployments to a project, or one of its environments, while it is in effect.
+// A window is either recurring (cron schedule plus duration) or a one-off date range.
+type FreezeWindow struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	ProjectID     uint           `json:"project_id" gorm:"index"`
+	EnvironmentID *uint          `json:"environment_id"` // nil freezes every environment of the project
+	Reason        string         `json:"reason" gorm:"not null"`
+	Schedule      string         `json:"schedule"` // cron expression marking the start of each recurring window
+	Duration      string         `json:"duration"` // length of each recurring window, e.g. 62h
+	Timezone      string         `json:"timezone"` // location the schedule is evaluated in, defaults to UTC
+	StartsAt      *time.Time     `json:"starts_at"`
+	EndsAt        *time.Time     `json:"ends_at"`
+	Active        bool           `json:"active" gorm:"default:true"`
+	CreatedBy     uint           `json:"created_by"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Project     Project      `json:"-" gorm:"foreignKey:ProjectID"`
+	Environment *Environment `json:"environment,omitempty" gorm:"foreignKey:EnvironmentID"`
+}
+
+// PreviewEnvironment is the ephemeral namespace a pipeline of a pull request is deployed into for review
+type PreviewEnvironment struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	ProjectID     uint           `json:"project_id" gorm:"uniqueIndex:idx_preview_pull_request_pipeline"`
+	PullRequest   int            `json:"pull_request" gorm:"uniqueIndex:idx_preview_pull_request_pipeline"`
+	PipelineID    uint           `json:"pipeline_id" gorm:"uniqueIndex:idx_preview_pull_request_pipeline"`
+	Repository    string         `json:"repository"` // provider repository name, e.g. owner/repo
+	Branch        string         `json:"branch"`
+	CommitHash    string         `json:"commit_hash"`
+	BuildID       *uint          `json:"build_id"`
+	DeploymentID  *uint          `json:"deployment_id"`
+	ClusterID     *uint          `json:"cluster_id"`
+	Namespace     string         `json:"namespace"`
+	OwnsNamespace bool           `json:"owns_namespace"` // the namespace was created for the preview and is deleted with it
+	Host          string         `json:"host"`
+	Status        string         `json:"status"` // pending, deploying, active, failed, closed, expired
+	ExpiresAt     time.Time      `json:"expires_at"`
+	ClosedAt      *time.Time     `json:"closed_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Project Project `json:"-" gorm:"foreignKey:ProjectID"`
+}
+
+// DeploymentDrift records changes made to a deployment's live workload outside ys-cloud
+type DeploymentDrift struct {
 	ID           uint           `json:"id" gorm:"primaryKey"`
-	BuildID      uint           `json:"build_id"`
-	Environment  string         `json:"environment"` // dev, staging, prod
-	Status       string         `json:"status"`      // pending, running, success, failed, cancelled
-	Replicas     int32          `json:"replicas"`
-	Namespace    string         `json:"namespace"`
-	ServiceName  string         `json:"service_name"`
-	IngressHost  string         `json:"ingress_host"`
-	StartedAt    *time.Time     `json:"started_at"`
-	CompletedAt  *time.Time     `json:"completed_at"`
+	DeploymentID uint           `json:"deployment_id" gorm:"index"`
+	Status       string         `json:"status"`                       // open, reverted, resolved
+	Differences  string         `json:"differences" gorm:"type:text"` // JSON list of fields whose live value changed
+	DetectedAt   time.Time      `json:"detected_at"`
+	CheckedAt    time.Time      `json:"checked_at"`
+	ResolvedAt   *time.Time     `json:"resolved_at"`
 	CreatedAt    time.Time      `json:"created_at"`
 	UpdatedAt    time.Time      `json:"updated_at"`
 	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
 
-	Build Build `json:"build" gorm:"foreignKey:BuildID"`
+	Deployment Deployment `json:"deployment" gorm:"foreignKey:DeploymentID"`
+}
+
+// Certificate is an uploaded TLS certificate that ingresses of the project's deployments can serve
+type Certificate struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	ProjectID   uint           `json:"project_id" gorm:"index"`
+	Name        string         `json:"name" gorm:"not null"`
+	Certificate string         `json:"certificate" gorm:"type:text"` // PEM encoded chain
+	PrivateKey  string         `json:"-" gorm:"type:text"`           // encrypted
+	Domains     string         `json:"domains"`                      // comma separated DNS names of the certificate
+	ExpiresAt   time.Time      `json:"expires_at"`
+	CreatedBy   uint           `json:"created_by"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Project Project `json:"-" gorm:"foreignKey:ProjectID"`
+}
+
+// RegistryCredential authenticates a project against a container registry for pushing images,
+// pulling base images and pulling deployed images in clusters
+type RegistryCredential struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	ProjectID uint           `json:"project_id" gorm:"index"`
+	Name      string         `json:"name" gorm:"not null"`
+	Provider  string         `json:"provider"`           // dockerhub, harbor, acr, ecr, generic
+	Registry  string         `json:"registry"`           // registry host, e.g. harbor.example.com
+	Namespace string         `json:"namespace"`          // repository prefix images are pushed under, e.g. a Harbor project
+	Username  string         `json:"username"`           // access key ID for ecr
+	Password  string         `json:"-" gorm:"type:text"` // encrypted; secret access key for ecr
+	Region    string         `json:"region"`             // ecr only
+	Push      bool           `json:"push"`               // images of the project are pushed to this registry
+	CreatedBy uint           `json:"created_by"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Project Project `json:"-" gorm:"foreignKey:ProjectID"`
+}
+
+type Cluster struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" gorm:"uniqueIndex:idx_clusters_name_active,where:deleted_at IS NULL;not null"` // unique among undeleted clusters
+	Description string         `json:"description"`
+	AuthType    string         `json:"auth_type"` // kubeconfig, token
+	Server      string         `json:"server"`
+	CAData      string         `json:"-" gorm:"type:text"`
+	Insecure    bool           `json:"insecure"`
+	Kubeconfig  string         `json:"-" gorm:"type:text"` // encrypted
+	Token       string         `json:"-" gorm:"type:text"` // encrypted
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// ClusterBinding maps an environment name to the cluster and namespace its deployments target
+type ClusterBinding struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Environment string         `json:"environment" gorm:"uniqueIndex;not null"`
+	ClusterID   uint           `json:"cluster_id"`
+	Namespace   string         `json:"namespace"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+
+	Cluster Cluster `json:"cluster" gorm:"foreignKey:ClusterID"`
 }
 
 type EnvironmentVariable struct {
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"time"
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ApprovalRepository struct {
+	db *gorm.DB
+}
+
+func NewApprovalRepository(db *gorm.DB) *ApprovalRepository {
+	return &ApprovalRepository{db: db}
+}
+
+func (r *ApprovalRepository) Create(request *models.ApprovalRequest) error {
+	return r.db.Create(request).Error
+}
+
+func (r *ApprovalRepository) GetByID(id uint) (*models.ApprovalRequest, error) {
+	var request models.ApprovalRequest
+	err := r.preload().First(&request, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (r *ApprovalRepository) GetByDeploymentID(deploymentID uint) (*models.ApprovalRequest, error) {
+	var request models.ApprovalRequest
+	err := r.preload().Where("deployment_id = ?", deploymentID).First(&request).Error
+	if err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+// List returns the requests of environments of the given projects
+func (r *ApprovalRepository) List(projectIDs []uint, status string, offset, limit int) ([]*models.ApprovalRequest, error) {
+	var requests []*models.ApprovalRequest
+	if len(projectIDs) == 0 {
+		return requests, nil
+	}
+	query := r.preload().Where("environment_id IN (?)", r.db.Model(&models.Environment{}).Select("id").Where("project_id IN ?", projectIDs))
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&requests).Error
+	return requests, err
+}
+
+// ListExpired returns pending requests whose approval window has closed
+func (r *ApprovalRepository) ListExpired(now time.Time) ([]*models.ApprovalRequest, error) {
+	var requests []*models.ApprovalRequest
+	err := r.db.Where("status = ? AND expires_at < ?", "pending", now).Find(&requests).Error
+	return requests, err
+}
+
+func (r *ApprovalRepository) Update(request *models.ApprovalRequest) error {
+	return r.db.Omit("Deployment", "Environment", "Requester", "Decisions").Save(request).Error
+}
+
+func (r *ApprovalRepository) CreateDecision(decision *models.ApprovalDecision) error {
+	return r.db.Create(decision).Error
+}
+
+func (r *ApprovalRepository) preload() *gorm.DB {
+	return r.db.Preload("Deployment").Preload("Environment.Approvers").Preload("Requester").Preload("Decisions.User")
+}
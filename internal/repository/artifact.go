@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type BuildArtifactRepository struct {
+	db *gorm.DB
+}
+
+func NewBuildArtifactRepository(db *gorm.DB) *BuildArtifactRepository {
+	return &BuildArtifactRepository{db: db}
+}
+
+func (r *BuildArtifactRepository) Create(artifact *models.BuildArtifact) error {
+	return r.db.Create(artifact).Error
+}
+
+func (r *BuildArtifactRepository) GetByID(id uint) (*models.BuildArtifact, error) {
+	var artifact models.BuildArtifact
+	err := r.db.First(&artifact, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &artifact, nil
+}
+
+// GetByBuildID returns the artifacts of a build without their content
+func (r *BuildArtifactRepository) GetByBuildID(buildID uint) ([]*models.BuildArtifact, error) {
+	var artifacts []*models.BuildArtifact
+	err := r.db.Omit("Content").Where("build_id = ?", buildID).Order("created_at").Find(&artifacts).Error
+	return artifacts, err
+}
+
+func (r *BuildArtifactRepository) DeleteByBuildID(buildID uint) error {
+	return r.db.Where("build_id = ?", buildID).Delete(&models.BuildArtifact{}).Error
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"time"
 	"ys-cloud/internal/models"
 
 	"gorm.io/gorm"
@@ -20,7 +21,7 @@ func (r *BuildRepository) Create(build *models.Build) error {
 
 func (r *BuildRepository) GetByID(id uint) (*models.Build, error) {
 	var build models.Build
-	err := r.db.Preload("Pipeline").Preload("Deployments").First(&build, id).Error
+	err := r.db.Preload("Pipeline.Project").Preload("Deployments").First(&build, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -55,4 +56,27 @@ func (r *BuildRepository) GetRunningBuilds() ([]*models.Build, error) {
 	var builds []*models.Build
 	err := r.db.Where("status IN ?", []string{"pending", "running"}).Find(&builds).Error
 	return builds, err
+}
+
+func (r *BuildRepository) UpdateScanStatus(id uint, status string) error {
+	return r.db.Model(&models.Build{}).Where("id = ?", id).Update("scan_status", status).Error
+}
+
+func (r *BuildRepository) UpdateSigned(id uint, signed bool) error {
+	return r.db.Model(&models.Build{}).Where("id = ?", id).Update("signed", signed).Error
+}
+
+// GetImagesByProjectID returns the successful builds of a project whose image has not been
+// deleted from the registry, newest first
+func (r *BuildRepository) GetImagesByProjectID(projectID uint) ([]*models.Build, error) {
+	var builds []*models.Build
+	err := r.db.Joins("JOIN pipelines ON pipelines.id = builds.pipeline_id").
+		Where("pipelines.project_id = ? AND builds.status = ? AND builds.image_name <> '' AND builds.image_deleted_at IS NULL", projectID, "success").
+		Order("builds.created_at DESC").
+		Find(&builds).Error
+	return builds, err
+}
+
+func (r *BuildRepository) MarkImageDeleted(id uint, deletedAt time.Time) error {
+	return r.db.Model(&models.Build{}).Where("id = ?", id).Update("image_deleted_at", deletedAt).Error
 }
\ No newline at end of file
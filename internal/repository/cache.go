@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"time"
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type BuildCacheRepository struct {
+	db *gorm.DB
+}
+
+func NewBuildCacheRepository(db *gorm.DB) *BuildCacheRepository {
+	return &BuildCacheRepository{db: db}
+}
+
+func (r *BuildCacheRepository) GetByID(id uint) (*models.BuildCache, error) {
+	var cache models.BuildCache
+	err := r.db.First(&cache, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func (r *BuildCacheRepository) GetByKey(projectID uint, scope, name, key string) (*models.BuildCache, error) {
+	var cache models.BuildCache
+	err := r.db.Where("project_id = ? AND scope = ? AND name = ? AND key = ?", projectID, scope, name, key).First(&cache).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+// GetLatest returns the most recently saved cache of a name in a scope, whatever its key
+func (r *BuildCacheRepository) GetLatest(projectID uint, scope, name string) (*models.BuildCache, error) {
+	var cache models.BuildCache
+	err := r.db.Where("project_id = ? AND scope = ? AND name = ?", projectID, scope, name).Order("created_at DESC").First(&cache).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cache, nil
+}
+
+func (r *BuildCacheRepository) GetByProjectID(projectID uint) ([]*models.BuildCache, error) {
+	var caches []*models.BuildCache
+	err := r.db.Where("project_id = ?", projectID).Order("name, last_used_at DESC").Find(&caches).Error
+	return caches, err
+}
+
+// ListUnusedSince returns the caches last used before a time
+func (r *BuildCacheRepository) ListUnusedSince(since time.Time) ([]*models.BuildCache, error) {
+	var caches []*models.BuildCache
+	err := r.db.Where("last_used_at < ?", since).Find(&caches).Error
+	return caches, err
+}
+
+func (r *BuildCacheRepository) Save(cache *models.BuildCache) error {
+	return r.db.Save(cache).Error
+}
+
+func (r *BuildCacheRepository) Touch(id uint) error {
+	return r.db.Model(&models.BuildCache{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error
+}
+
+func (r *BuildCacheRepository) Delete(id uint) error {
+	return r.db.Delete(&models.BuildCache{}, id).Error
+}
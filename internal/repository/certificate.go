@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type CertificateRepository struct {
+	db *gorm.DB
+}
+
+func NewCertificateRepository(db *gorm.DB) *CertificateRepository {
+	return &CertificateRepository{db: db}
+}
+
+func (r *CertificateRepository) Create(certificate *models.Certificate) error {
+	return r.db.Create(certificate).Error
+}
+
+func (r *CertificateRepository) GetByID(id uint) (*models.Certificate, error) {
+	var certificate models.Certificate
+	err := r.db.First(&certificate, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+func (r *CertificateRepository) GetByProjectID(projectID uint) ([]*models.Certificate, error) {
+	var certificates []*models.Certificate
+	err := r.db.Where("project_id = ?", projectID).Order("name").Find(&certificates).Error
+	return certificates, err
+}
+
+func (r *CertificateRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Certificate{}, id).Error
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type ClusterRepository struct {
+	db *gorm.DB
+}
+
+func NewClusterRepository(db *gorm.DB) *ClusterRepository {
+	return &ClusterRepository{db: db}
+}
+
+func (r *ClusterRepository) Create(cluster *models.Cluster) error {
+	return r.db.Create(cluster).Error
+}
+
+func (r *ClusterRepository) GetByID(id uint) (*models.Cluster, error) {
+	var cluster models.Cluster
+	err := r.db.First(&cluster, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &cluster, nil
+}
+
+func (r *ClusterRepository) List() ([]*models.Cluster, error) {
+	var clusters []*models.Cluster
+	err := r.db.Order("name").Find(&clusters).Error
+	return clusters, err
+}
+
+func (r *ClusterRepository) Update(cluster *models.Cluster) error {
+	return r.db.Save(cluster).Error
+}
+
+func (r *ClusterRepository) Delete(id uint) error {
+	return r.db.Delete(&models.Cluster{}, id).Error
+}
+
+func (r *ClusterRepository) GetBindingByEnvironment(environment string) (*models.ClusterBinding, error) {
+	var binding models.ClusterBinding
+	err := r.db.Preload("Cluster").Where("environment = ?", environment).First(&binding).Error
+	if err != nil {
+		return nil, err
+	}
+	return &binding, nil
+}
+
+func (r *ClusterRepository) ListBindings() ([]*models.ClusterBinding, error) {
+	var bindings []*models.ClusterBinding
+	err := r.db.Preload("Cluster").Order("environment").Find(&bindings).Error
+	return bindings, err
+}
+
+func (r *ClusterRepository) CountBindings(clusterID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.ClusterBinding{}).Where("cluster_id = ?", clusterID).Count(&count).Error
+	return count, err
+}
+
+// CountEnvironments counts the environments targeting a cluster
+func (r *ClusterRepository) CountEnvironments(clusterID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Environment{}).Where("cluster_id = ?", clusterID).Count(&count).Error
+	return count, err
+}
+
+// CountActiveDeployments counts the deployments to a cluster that are still waiting, rolling out or
+// running a canary
+func (r *ClusterRepository) CountActiveDeployments(clusterID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Deployment{}).
+		Where("cluster_id = ? AND status IN ?", clusterID, []string{"pending", "awaiting_approval", "running", "canary"}).
+		Count(&count).Error
+	return count, err
+}
+
+// CountOpenPreviews counts the preview environments on a cluster that were not torn down yet
+func (r *ClusterRepository) CountOpenPreviews(clusterID uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.PreviewEnvironment{}).
+		Where("cluster_id = ? AND status IN ?", clusterID, []string{"pending", "deploying", "active", "failed"}).
+		Count(&count).Error
+	return count, err
+}
+
+func (r *ClusterRepository) SaveBinding(binding *models.ClusterBinding) error {
+	return r.db.Save(binding).Error
+}
+
+func (r *ClusterRepository) DeleteBinding(environment string) error {
+	return r.db.Unscoped().Where("environment = ?", environment).Delete(&models.ClusterBinding{}).Error
+}
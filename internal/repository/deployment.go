@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"time"
 	"ys-cloud/internal/models"
 
 	"gorm.io/gorm"
@@ -20,7 +21,7 @@ func (r *DeploymentRepository) Create(deployment *models.Deployment) error {
 
 func (r *DeploymentRepository) GetByID(id uint) (*models.Deployment, error) {
 	var deployment models.Deployment
-	err := r.db.Preload("Build").First(&deployment, id).Error
+	err := r.db.Preload("Build.Pipeline").First(&deployment, id).Error
 	if err != nil {
 		return nil, err
 	}
@@ -33,16 +34,154 @@ func (r *DeploymentRepository) GetByBuildID(buildID uint) ([]*models.Deployment,
 	return deployments, err
 }
 
-func (r *DeploymentRepository) GetByEnvironment(environment string) ([]*models.Deployment, error) {
+func (r *DeploymentRepository) GetByEnvironment(environmentID uint) ([]*models.Deployment, error) {
+	var deployments []*models.Deployment
+	err := r.db.Preload("Build").Where("environment_id = ?", environmentID).Order("created_at DESC").Find(&deployments).Error
+	return deployments, err
+}
+
+// GetByEnvironmentName returns the deployments to environments of a name, e.g. every project's prod
+func (r *DeploymentRepository) GetByEnvironmentName(environment string) ([]*models.Deployment, error) {
 	var deployments []*models.Deployment
 	err := r.db.Preload("Build").Where("environment = ?", environment).Order("created_at DESC").Find(&deployments).Error
 	return deployments, err
 }
 
+func (r *DeploymentRepository) GetLatestByEnvironment(environmentID uint, status string) (*models.Deployment, error) {
+	var deployment models.Deployment
+	err := r.db.Preload("Build").Where("environment_id = ? AND status = ?", environmentID, status).Order("created_at DESC").First(&deployment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
 func (r *DeploymentRepository) Update(deployment *models.Deployment) error {
 	return r.db.Save(deployment).Error
 }
 
+func (r *DeploymentRepository) UpdateAppliedState(id uint, state string) error {
+	return r.db.Model(&models.Deployment{}).Where("id = ?", id).Update("applied_state", state).Error
+}
+
+// ListLive returns the deployments whose workloads are currently running: for every kubernetes
+// workload, identified by cluster, namespace and service name, the most recently started
+// deployment if it succeeded
+func (r *DeploymentRepository) ListLive() ([]*models.Deployment, error) {
+	var deployments []*models.Deployment
+	err := r.db.Preload("Build.Pipeline").
+		Where("type = ? AND status = ? AND started_at IS NOT NULL", "kubernetes", "success").
+		Where(`NOT EXISTS (SELECT 1 FROM deployments newer WHERE newer.deleted_at IS NULL AND newer.type = deployments.type
+			AND newer.namespace = deployments.namespace AND newer.service_name = deployments.service_name
+			AND (newer.cluster_id = deployments.cluster_id OR (newer.cluster_id IS NULL AND deployments.cluster_id IS NULL))
+			AND newer.started_at > deployments.started_at)`).
+		Find(&deployments).Error
+	return deployments, err
+}
+
+// GetLastApplied returns the latest successful manifest deployment of the same workload as the given one
+func (r *DeploymentRepository) GetLastApplied(deployment *models.Deployment) (*models.Deployment, error) {
+	var previous models.Deployment
+	query := r.db.Where("id <> ? AND type IN ? AND status = ? AND namespace = ? AND service_name = ?",
+		deployment.ID, []string{"manifests", "kustomize"}, "success", deployment.Namespace, deployment.ServiceName)
+	if deployment.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *deployment.ClusterID)
+	} else {
+		query = query.Where("cluster_id IS NULL")
+	}
+	err := query.Order("started_at DESC").First(&previous).Error
+	if err != nil {
+		return nil, err
+	}
+	return &previous, nil
+}
+
+// GetRollbackTarget returns the deployment a rollback of the given one returns to: the one with the
+// Helm revision when revision is set, otherwise the latest successful deployment of the same
+// workload started before it
+func (r *DeploymentRepository) GetRollbackTarget(deployment *models.Deployment, revision int) (*models.Deployment, error) {
+	var target models.Deployment
+	query := r.db.Preload("Build").Where("id <> ? AND type = ? AND namespace = ? AND service_name = ?",
+		deployment.ID, deployment.Type, deployment.Namespace, deployment.ServiceName)
+	if deployment.ClusterID != nil {
+		query = query.Where("cluster_id = ?", *deployment.ClusterID)
+	} else {
+		query = query.Where("cluster_id IS NULL")
+	}
+	if revision > 0 {
+		query = query.Where("helm_revision = ?", revision)
+	} else {
+		query = query.Where("status = ? AND started_at < ?", "success", deployment.StartedAt)
+	}
+	err := query.Order("started_at DESC").First(&target).Error
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+// GetDeployedBuildIDs returns the builds of a project whose images are or may soon be running: those
+// of the two most recent successful deployments of every workload, the older one being its rollback
+// target, and of deployments in progress
+func (r *DeploymentRepository) GetDeployedBuildIDs(projectID uint) ([]uint, error) {
+	var buildIDs []uint
+	err := r.db.Raw(`SELECT DISTINCT build_id FROM (
+			SELECT deployments.build_id, deployments.status, ROW_NUMBER() OVER (
+				PARTITION BY deployments.cluster_id, deployments.namespace, deployments.service_name, deployments.status
+				ORDER BY deployments.started_at DESC NULLS LAST, deployments.id DESC) AS position
+			FROM deployments
+			JOIN builds ON builds.id = deployments.build_id
+			JOIN pipelines ON pipelines.id = builds.pipeline_id
+			WHERE deployments.deleted_at IS NULL AND pipelines.project_id = ?
+		) ranked
+		WHERE (status = 'success' AND position <= 2) OR status IN ('pending', 'running', 'awaiting_approval', 'canary')`, projectID).
+		Scan(&buildIDs).Error
+	return buildIDs, err
+}
+
+// GetActiveByProject returns the deployments of a project that are in progress or succeeded, most
+// recent first
+func (r *DeploymentRepository) GetActiveByProject(projectID uint) ([]*models.Deployment, error) {
+	var deployments []*models.Deployment
+	err := r.db.Joins("JOIN builds ON builds.id = deployments.build_id").
+		Joins("JOIN pipelines ON pipelines.id = builds.pipeline_id").
+		Where("pipelines.project_id = ? AND deployments.status IN ?", projectID,
+			[]string{"pending", "awaiting_approval", "running", "canary", "success"}).
+		Order("deployments.id DESC").
+		Find(&deployments).Error
+	return deployments, err
+}
+
+// ListRetiring returns the blue/green deployments whose inactive color is due to be deleted
+func (r *DeploymentRepository) ListRetiring(now time.Time) ([]*models.Deployment, error) {
+	var deployments []*models.Deployment
+	err := r.db.Where("retire_color <> '' AND retire_at <= ?", now).Find(&deployments).Error
+	return deployments, err
+}
+
+func (r *DeploymentRepository) ClearRetirement(id uint) error {
+	return r.db.Model(&models.Deployment{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"retire_color": "", "retire_image": "", "retire_at": nil}).Error
+}
+
+// MarkNamespaceDeleted gives the deployments into a namespace that was removed the deleted status
+func (r *DeploymentRepository) MarkNamespaceDeleted(clusterID *uint, namespace string) error {
+	return r.inCluster(clusterID).Where("namespace = ?", namespace).Update("status", "deleted").Error
+}
+
+// MarkWorkloadDeleted gives the deployments of a workload that was removed the deleted status
+func (r *DeploymentRepository) MarkWorkloadDeleted(clusterID *uint, namespace, serviceName string) error {
+	return r.inCluster(clusterID).Where("namespace = ? AND service_name = ?", namespace, serviceName).Update("status", "deleted").Error
+}
+
+func (r *DeploymentRepository) inCluster(clusterID *uint) *gorm.DB {
+	query := r.db.Model(&models.Deployment{})
+	if clusterID != nil {
+		return query.Where("cluster_id = ?", *clusterID)
+	}
+	return query.Where("cluster_id IS NULL")
+}
+
 func (r *DeploymentRepository) UpdateStatus(id uint, status string) error {
 	return r.db.Model(&models.Deployment{}).Where("id = ?", id).Update("status", status).Error
 }
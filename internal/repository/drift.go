@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type DriftRepository struct {
+	db *gorm.DB
+}
+
+func NewDriftRepository(db *gorm.DB) *DriftRepository {
+	return &DriftRepository{db: db}
+}
+
+func (r *DriftRepository) Create(drift *models.DeploymentDrift) error {
+	return r.db.Omit("Deployment").Create(drift).Error
+}
+
+func (r *DriftRepository) GetByID(id uint) (*models.DeploymentDrift, error) {
+	var drift models.DeploymentDrift
+	err := r.db.Preload("Deployment").First(&drift, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &drift, nil
+}
+
+// GetOpenByDeployment returns the unresolved drift of a deployment
+func (r *DriftRepository) GetOpenByDeployment(deploymentID uint) (*models.DeploymentDrift, error) {
+	var drift models.DeploymentDrift
+	err := r.db.Where("deployment_id = ? AND status = ?", deploymentID, "open").First(&drift).Error
+	if err != nil {
+		return nil, err
+	}
+	return &drift, nil
+}
+
+func (r *DriftRepository) GetByDeployment(deploymentID uint) ([]*models.DeploymentDrift, error) {
+	var drifts []*models.DeploymentDrift
+	err := r.db.Where("deployment_id = ?", deploymentID).Order("detected_at DESC").Find(&drifts).Error
+	return drifts, err
+}
+
+// List returns the drifts of the given projects with the given status, or with any status when
+// status is empty
+func (r *DriftRepository) List(projectIDs []uint, status string, offset, limit int) ([]*models.DeploymentDrift, error) {
+	var drifts []*models.DeploymentDrift
+	if len(projectIDs) == 0 {
+		return drifts, nil
+	}
+	query := r.db.Preload("Deployment").Where("deployment_id IN (?)", r.db.Model(&models.Deployment{}).Select("deployments.id").
+		Joins("JOIN builds ON builds.id = deployments.build_id").
+		Joins("JOIN pipelines ON pipelines.id = builds.pipeline_id").
+		Where("pipelines.project_id IN ?", projectIDs))
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Offset(offset).Limit(limit).Order("detected_at DESC").Find(&drifts).Error
+	return drifts, err
+}
+
+func (r *DriftRepository) ListOpen() ([]*models.DeploymentDrift, error) {
+	var drifts []*models.DeploymentDrift
+	err := r.db.Where("status = ?", "open").Find(&drifts).Error
+	return drifts, err
+}
+
+func (r *DriftRepository) Update(drift *models.DeploymentDrift) error {
+	return r.db.Omit("Deployment").Save(drift).Error
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type EnvironmentRepository struct {
+	db *gorm.DB
+}
+
+func NewEnvironmentRepository(db *gorm.DB) *EnvironmentRepository {
+	return &EnvironmentRepository{db: db}
+}
+
+func (r *EnvironmentRepository) Create(environment *models.Environment) error {
+	return r.db.Omit("Approvers").Create(environment).Error
+}
+
+func (r *EnvironmentRepository) GetByID(id uint) (*models.Environment, error) {
+	var environment models.Environment
+	err := r.db.Preload("Approvers").First(&environment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &environment, nil
+}
+
+func (r *EnvironmentRepository) GetByProjectAndName(projectID uint, name string) (*models.Environment, error) {
+	var environment models.Environment
+	err := r.db.Preload("Approvers").Where("project_id = ? AND name = ?", projectID, name).First(&environment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &environment, nil
+}
+
+func (r *EnvironmentRepository) GetByProjectID(projectID uint) ([]*models.Environment, error) {
+	var environments []*models.Environment
+	err := r.db.Preload("Approvers").Where("project_id = ?", projectID).Order("sort_order, id").Find(&environments).Error
+	return environments, err
+}
+
+// GetNext returns the environment that follows the given one in its project's promotion order
+func (r *EnvironmentRepository) GetNext(environment *models.Environment) (*models.Environment, error) {
+	var next models.Environment
+	err := r.db.Where("project_id = ? AND (sort_order > ? OR (sort_order = ? AND id > ?))",
+		environment.ProjectID, environment.Order, environment.Order, environment.ID).
+		Order("sort_order, id").First(&next).Error
+	if err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+func (r *EnvironmentRepository) Update(environment *models.Environment) error {
+	return r.db.Omit("Approvers").Save(environment).Error
+}
+
+func (r *EnvironmentRepository) ReplaceApprovers(environment *models.Environment, userIDs []uint) error {
+	var users []models.User
+	if len(userIDs) > 0 {
+		if err := r.db.Find(&users, userIDs).Error; err != nil {
+			return err
+		}
+	}
+	return r.db.Model(environment).Association("Approvers").Replace(users)
+}
+
+// CountDeployments counts the deployments made to an environment
+func (r *EnvironmentRepository) CountDeployments(id uint) (int64, error) {
+	var count int64
+	err := r.db.Model(&models.Deployment{}).Where("environment_id = ?", id).Count(&count).Error
+	return count, err
+}
+
+func (r *EnvironmentRepository) Delete(id uint) error {
+	// Hard delete so the project can reuse the environment name
+	if err := r.db.Model(&models.Environment{ID: id}).Association("Approvers").Clear(); err != nil {
+		return err
+	}
+	return r.db.Unscoped().Delete(&models.Environment{}, id).Error
+}
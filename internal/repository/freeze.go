@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type FreezeWindowRepository struct {
+	db *gorm.DB
+}
+
+func NewFreezeWindowRepository(db *gorm.DB) *FreezeWindowRepository {
+	return &FreezeWindowRepository{db: db}
+}
+
+func (r *FreezeWindowRepository) Create(window *models.FreezeWindow) error {
+	return r.db.Omit("Environment").Create(window).Error
+}
+
+func (r *FreezeWindowRepository) GetByID(id uint) (*models.FreezeWindow, error) {
+	var window models.FreezeWindow
+	err := r.db.Preload("Environment").First(&window, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &window, nil
+}
+
+func (r *FreezeWindowRepository) GetByProjectID(projectID uint) ([]*models.FreezeWindow, error) {
+	var windows []*models.FreezeWindow
+	err := r.db.Preload("Environment").Where("project_id = ?", projectID).Order("created_at DESC").Find(&windows).Error
+	return windows, err
+}
+
+// GetApplicable returns the active windows covering an environment, including project-wide ones
+func (r *FreezeWindowRepository) GetApplicable(projectID, environmentID uint) ([]*models.FreezeWindow, error) {
+	var windows []*models.FreezeWindow
+	err := r.db.Where("project_id = ? AND active = ? AND (environment_id IS NULL OR environment_id = ?)", projectID, true, environmentID).
+		Find(&windows).Error
+	return windows, err
+}
+
+func (r *FreezeWindowRepository) Update(window *models.FreezeWindow) error {
+	return r.db.Omit("Environment").Save(window).Error
+}
+
+func (r *FreezeWindowRepository) Delete(id uint) error {
+	return r.db.Delete(&models.FreezeWindow{}, id).Error
+}
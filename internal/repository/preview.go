@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type PreviewEnvironmentRepository struct {
+	db *gorm.DB
+}
+
+func NewPreviewEnvironmentRepository(db *gorm.DB) *PreviewEnvironmentRepository {
+	return &PreviewEnvironmentRepository{db: db}
+}
+
+func (r *PreviewEnvironmentRepository) Create(preview *models.PreviewEnvironment) error {
+	return r.db.Create(preview).Error
+}
+
+func (r *PreviewEnvironmentRepository) GetByID(id uint) (*models.PreviewEnvironment, error) {
+	var preview models.PreviewEnvironment
+	err := r.db.First(&preview, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+func (r *PreviewEnvironmentRepository) GetByPullRequest(projectID, pipelineID uint, pullRequest int) (*models.PreviewEnvironment, error) {
+	var preview models.PreviewEnvironment
+	err := r.db.Where("project_id = ? AND pipeline_id = ? AND pull_request = ?", projectID, pipelineID, pullRequest).First(&preview).Error
+	if err != nil {
+		return nil, err
+	}
+	return &preview, nil
+}
+
+// ListByPullRequest returns the previews of every pipeline of a pull request
+func (r *PreviewEnvironmentRepository) ListByPullRequest(projectID uint, pullRequest int) ([]*models.PreviewEnvironment, error) {
+	var previews []*models.PreviewEnvironment
+	err := r.db.Where("project_id = ? AND pull_request = ?", projectID, pullRequest).Find(&previews).Error
+	return previews, err
+}
+
+func (r *PreviewEnvironmentRepository) GetByProjectID(projectID uint) ([]*models.PreviewEnvironment, error) {
+	var previews []*models.PreviewEnvironment
+	err := r.db.Where("project_id = ?", projectID).Order("pull_request DESC, pipeline_id").Find(&previews).Error
+	return previews, err
+}
+
+// ListExpired returns the previews still running past their expiry time
+func (r *PreviewEnvironmentRepository) ListExpired(now time.Time) ([]*models.PreviewEnvironment, error) {
+	var previews []*models.PreviewEnvironment
+	err := r.db.Where("status NOT IN ? AND expires_at < ?", []string{"closed", "expired"}, now).Find(&previews).Error
+	return previews, err
+}
+
+func (r *PreviewEnvironmentRepository) Update(preview *models.PreviewEnvironment) error {
+	return r.db.Save(preview).Error
+}
@@ -62,4 +62,45 @@ func (r *ProjectRepository) AddCollaborator(projectID, userID uint) error {
 
 func (r *ProjectRepository) RemoveCollaborator(projectID, userID uint) error {
 	return r.db.Exec("DELETE FROM user_projects WHERE user_id = ? AND project_id = ?", userID, projectID).Error
-}
\ No newline at end of file
+}
+
+func (r *ProjectRepository) IsMember(projectID, userID uint) (bool, error) {
+	var count int64
+	err := r.db.Model(&models.Project{}).Where("id = ? AND owner_id = ?", projectID, userID).Count(&count).Error
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+	err = r.db.Table("user_projects").Where("project_id = ? AND user_id = ?", projectID, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// GetMemberIDs returns the owner and collaborators of a project
+func (r *ProjectRepository) GetMemberIDs(projectID uint) ([]uint, error) {
+	project, err := r.GetByID(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var collaborators []uint
+	err = r.db.Table("user_projects").Where("project_id = ?", projectID).Pluck("user_id", &collaborators).Error
+	if err != nil {
+		return nil, err
+	}
+
+	memberIDs := []uint{project.OwnerID}
+	for _, userID := range collaborators {
+		if userID != project.OwnerID {
+			memberIDs = append(memberIDs, userID)
+		}
+	}
+	return memberIDs, nil
+}
+
+// GetMemberProjectIDs returns the projects a user owns or collaborates on
+func (r *ProjectRepository) GetMemberProjectIDs(userID uint) ([]uint, error) {
+	var projectIDs []uint
+	err := r.db.Model(&models.Project{}).
+		Where("owner_id = ? OR id IN (?)", userID, r.db.Table("user_projects").Select("project_id").Where("user_id = ?", userID)).
+		Pluck("id", &projectIDs).Error
+	return projectIDs, err
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type RegistryCredentialRepository struct {
+	db *gorm.DB
+}
+
+func NewRegistryCredentialRepository(db *gorm.DB) *RegistryCredentialRepository {
+	return &RegistryCredentialRepository{db: db}
+}
+
+// Create stores a credential; a push credential becomes the only push registry of its project
+func (r *RegistryCredentialRepository) Create(credential *models.RegistryCredential) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(credential).Error; err != nil {
+			return err
+		}
+		return clearPush(tx, credential)
+	})
+}
+
+func (r *RegistryCredentialRepository) GetByID(id uint) (*models.RegistryCredential, error) {
+	var credential models.RegistryCredential
+	err := r.db.First(&credential, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+func (r *RegistryCredentialRepository) GetByProjectID(projectID uint) ([]*models.RegistryCredential, error) {
+	var credentials []*models.RegistryCredential
+	err := r.db.Where("project_id = ?", projectID).Order("name").Find(&credentials).Error
+	return credentials, err
+}
+
+// Update saves a credential; a push credential becomes the only push registry of its project
+func (r *RegistryCredentialRepository) Update(credential *models.RegistryCredential) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Project").Save(credential).Error; err != nil {
+			return err
+		}
+		return clearPush(tx, credential)
+	})
+}
+
+// clearPush unsets the other push registries of the project of a push credential
+func clearPush(tx *gorm.DB, credential *models.RegistryCredential) error {
+	if !credential.Push {
+		return nil
+	}
+	return tx.Model(&models.RegistryCredential{}).
+		Where("project_id = ? AND id <> ? AND push", credential.ProjectID, credential.ID).
+		Update("push", false).Error
+}
+
+func (r *RegistryCredentialRepository) Delete(id uint) error {
+	return r.db.Delete(&models.RegistryCredential{}, id).Error
+}
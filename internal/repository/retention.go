@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type RetentionPolicyRepository struct {
+	db *gorm.DB
+}
+
+func NewRetentionPolicyRepository(db *gorm.DB) *RetentionPolicyRepository {
+	return &RetentionPolicyRepository{db: db}
+}
+
+func (r *RetentionPolicyRepository) GetByProjectID(projectID uint) (*models.RetentionPolicy, error) {
+	var policy models.RetentionPolicy
+	err := r.db.Where("project_id = ?", projectID).First(&policy).Error
+	if err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (r *RetentionPolicyRepository) ListEnabled() ([]*models.RetentionPolicy, error) {
+	var policies []*models.RetentionPolicy
+	err := r.db.Where("enabled = ?", true).Order("project_id").Find(&policies).Error
+	return policies, err
+}
+
+func (r *RetentionPolicyRepository) Save(policy *models.RetentionPolicy) error {
+	return r.db.Save(policy).Error
+}
+
+func (r *RetentionPolicyRepository) DeleteByProjectID(projectID uint) error {
+	return r.db.Where("project_id = ?", projectID).Delete(&models.RetentionPolicy{}).Error
+}
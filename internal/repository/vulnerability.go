@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"ys-cloud/internal/models"
+
+	"gorm.io/gorm"
+)
+
+type VulnerabilityRepository struct {
+	db *gorm.DB
+}
+
+func NewVulnerabilityRepository(db *gorm.DB) *VulnerabilityRepository {
+	return &VulnerabilityRepository{db: db}
+}
+
+func (r *VulnerabilityRepository) CreateInBatches(vulnerabilities []*models.Vulnerability) error {
+	if len(vulnerabilities) == 0 {
+		return nil
+	}
+	return r.db.CreateInBatches(vulnerabilities, 500).Error
+}
+
+// GetByBuildID returns the findings of a build, most severe first
+func (r *VulnerabilityRepository) GetByBuildID(buildID uint) ([]*models.Vulnerability, error) {
+	var vulnerabilities []*models.Vulnerability
+	err := r.db.Where("build_id = ?", buildID).
+		Order("CASE severity WHEN 'CRITICAL' THEN 0 WHEN 'HIGH' THEN 1 WHEN 'MEDIUM' THEN 2 WHEN 'LOW' THEN 3 ELSE 4 END").
+		Order("vulnerability_id").
+		Find(&vulnerabilities).Error
+	return vulnerabilities, err
+}
+
+func (r *VulnerabilityRepository) DeleteByBuildID(buildID uint) error {
+	return r.db.Where("build_id = ?", buildID).Delete(&models.Vulnerability{}).Error
+}
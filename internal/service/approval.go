@@ -0,0 +1,257 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+
+	"github.com/sirupsen/logrus"
+)
+
+type ApprovalService struct {
+	approvalRepo      *repository.ApprovalRepository
+	projectRepo       *repository.ProjectRepository
+	deploymentService *DeploymentService
+
+	// mu serialises decisions so concurrent approvals start a deployment only once
+	mu sync.Mutex
+}
+
+func NewApprovalService(approvalRepo *repository.ApprovalRepository, projectRepo *repository.ProjectRepository, deploymentService *DeploymentService) *ApprovalService {
+	return &ApprovalService{
+		approvalRepo:      approvalRepo,
+		projectRepo:       projectRepo,
+		deploymentService: deploymentService,
+	}
+}
+
+func (s *ApprovalService) GetByID(id, userID uint) (*models.ApprovalRequest, error) {
+	request, err := s.approvalRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("approval request not found")
+	}
+	if err := s.checkMember(request, userID); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func (s *ApprovalService) GetByDeploymentID(deploymentID, userID uint) (*models.ApprovalRequest, error) {
+	request, err := s.approvalRepo.GetByDeploymentID(deploymentID)
+	if err != nil {
+		return nil, errors.New("approval request not found")
+	}
+	if err := s.checkMember(request, userID); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// List returns the approval requests of the projects the user belongs to
+func (s *ApprovalService) List(userID uint, status string, offset, limit int) ([]*models.ApprovalRequest, error) {
+	projectIDs, err := s.projectRepo.GetMemberProjectIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.approvalRepo.List(projectIDs, status, offset, limit)
+}
+
+// Approve records an approval and starts the deployment once enough approvers have signed off
+func (s *ApprovalService) Approve(id, userID uint, comment string) (*models.ApprovalRequest, error) {
+	return s.decide(id, userID, "approved", comment)
+}
+
+// Reject records a rejection; a single rejection fails the deployment
+func (s *ApprovalService) Reject(id, userID uint, comment string) (*models.ApprovalRequest, error) {
+	return s.decide(id, userID, "rejected", comment)
+}
+
+// ExpireStale fails deployments whose approval window closed without a verdict. A request that
+// cannot be resolved does not hold back the others.
+func (s *ApprovalService) ExpireStale() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	requests, err := s.approvalRepo.ListExpired(time.Now())
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, request := range requests {
+		if err := s.resolve(request, "expired", "approval request expired"); err != nil {
+			logrus.WithError(err).WithField("approval_request_id", request.ID).Warn("Failed to expire approval request")
+			errs = append(errs, fmt.Errorf("approval request %d: %w", request.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// StartExpiryWorker periodically expires stale approval requests in the background
+func (s *ApprovalService) StartExpiryWorker(interval time.Duration) {
+	every(interval, func() {
+		if err := s.ExpireStale(); err != nil {
+			logrus.WithError(err).Error("Failed to expire approval requests")
+		}
+	})
+}
+
+func (s *ApprovalService) decide(id, userID uint, decision, comment string) (*models.ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	request, err := s.approvalRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("approval request not found")
+	}
+
+	if request.Status != "pending" {
+		return nil, fmt.Errorf("approval request is already %s", request.Status)
+	}
+	if time.Now().After(request.ExpiresAt) {
+		if err := s.resolve(request, "expired", "approval request expired"); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("approval request has expired")
+	}
+
+	// Project members only decide in environments without designated approvers
+	var members []uint
+	if len(request.Environment.Approvers) == 0 {
+		if members, err = s.projectRepo.GetMemberIDs(request.Environment.ProjectID); err != nil {
+			return nil, errors.New("project not found")
+		}
+	}
+	if err := checkApprover(request, members, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.approvalRepo.CreateDecision(&models.ApprovalDecision{
+		ApprovalRequestID: request.ID,
+		UserID:            userID,
+		Decision:          decision,
+		Comment:           comment,
+	}); err != nil {
+		return nil, err
+	}
+
+	if decision == "rejected" {
+		message := "deployment rejected"
+		if comment != "" {
+			message += ": " + comment
+		}
+		if err := s.resolve(request, "rejected", message); err != nil {
+			return nil, err
+		}
+		return s.approvalRepo.GetByID(id)
+	}
+
+	approvals := 1
+	for _, existing := range request.Decisions {
+		if existing.Decision == "approved" {
+			approvals++
+		}
+	}
+
+	if approvals >= request.RequiredApprovals {
+		if err := s.resolve(request, "approved", ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.approvalRepo.GetByID(id)
+}
+
+func (s *ApprovalService) checkMember(request *models.ApprovalRequest, userID uint) error {
+	member, err := s.projectRepo.IsMember(request.Environment.ProjectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+// checkApprover verifies that a user may still decide on a request, given the project members
+// that approve when the environment designates no approvers
+func checkApprover(request *models.ApprovalRequest, members []uint, userID uint) error {
+	if request.RequestedBy == userID {
+		return errors.New("requesters cannot approve their own deployments")
+	}
+
+	for _, decision := range request.Decisions {
+		if decision.UserID == userID {
+			return errors.New("user has already decided on this request")
+		}
+	}
+
+	for _, approver := range eligibleApprovers(request.Environment, members, request.RequestedBy) {
+		if approver == userID {
+			return nil
+		}
+	}
+
+	return errors.New("user is not an approver for this environment")
+}
+
+// eligibleApprovers returns the users who may approve a deployment requested by requestedBy:
+// the environment's designated approvers, or any project member when it has none. Requesters
+// never approve their own deployments.
+func eligibleApprovers(environment models.Environment, members []uint, requestedBy uint) []uint {
+	candidates := members
+	if len(environment.Approvers) > 0 {
+		candidates = make([]uint, 0, len(environment.Approvers))
+		for _, approver := range environment.Approvers {
+			candidates = append(candidates, approver.ID)
+		}
+	}
+
+	eligible := make([]uint, 0, len(candidates))
+	for _, userID := range candidates {
+		if userID != requestedBy {
+			eligible = append(eligible, userID)
+		}
+	}
+	return eligible
+}
+
+// resolve closes an approval request and moves its deployment on accordingly
+func (s *ApprovalService) resolve(request *models.ApprovalRequest, status, message string) error {
+	deployment, err := s.deploymentService.GetByID(request.DeploymentID)
+	if err != nil {
+		return err
+	}
+
+	// The deployment was cancelled while it waited
+	if deployment.Status != "awaiting_approval" {
+		status = "cancelled"
+	}
+
+	now := time.Now()
+	request.Status = status
+	request.ResolvedAt = &now
+	if err := s.approvalRepo.Update(request); err != nil {
+		return err
+	}
+
+	switch status {
+	case "approved":
+		if err := s.deploymentService.UpdateStatus(deployment.ID, "pending"); err != nil {
+			return err
+		}
+		// The approval stands even if the deployment cannot start, e.g. inside a freeze window
+		if err := s.deploymentService.StartDeployment(deployment.ID); err != nil {
+			return s.deploymentService.CompleteDeployment(deployment.ID, "failed", err.Error())
+		}
+		return nil
+	case "rejected", "expired":
+		return s.deploymentService.CompleteDeployment(deployment.ID, status, message)
+	}
+
+	return nil
+}
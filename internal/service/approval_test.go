@@ -0,0 +1,101 @@
+package service
+
+import (
+	"testing"
+	"ys-cloud/internal/models"
+)
+
+func TestCheckApprover(t *testing.T) {
+	designated := models.Environment{Approvers: []models.User{{ID: 2}, {ID: 3}}}
+
+	tests := []struct {
+		name    string
+		request models.ApprovalRequest
+		members []uint
+		userID  uint
+		wantErr string
+	}{
+		{
+			name:    "project member without designated approvers",
+			request: models.ApprovalRequest{RequestedBy: 1},
+			members: []uint{1, 2, 3},
+			userID:  2,
+		},
+		{
+			name:    "not a project member",
+			request: models.ApprovalRequest{RequestedBy: 1},
+			members: []uint{1, 2},
+			userID:  4,
+			wantErr: "user is not an approver for this environment",
+		},
+		{
+			name:    "designated approver",
+			request: models.ApprovalRequest{RequestedBy: 1, Environment: designated},
+			members: []uint{1, 2, 3, 4},
+			userID:  3,
+		},
+		{
+			name:    "member who is not a designated approver",
+			request: models.ApprovalRequest{RequestedBy: 1, Environment: designated},
+			members: []uint{1, 2, 3, 4},
+			userID:  4,
+			wantErr: "user is not an approver for this environment",
+		},
+		{
+			name:    "designated approver outside the members",
+			request: models.ApprovalRequest{RequestedBy: 1, Environment: designated},
+			members: []uint{1},
+			userID:  2,
+		},
+		{
+			name:    "requester",
+			request: models.ApprovalRequest{RequestedBy: 1},
+			members: []uint{1, 2},
+			userID:  1,
+			wantErr: "requesters cannot approve their own deployments",
+		},
+		{
+			name:    "requester who is a designated approver",
+			request: models.ApprovalRequest{RequestedBy: 2, Environment: designated},
+			members: []uint{2, 3},
+			userID:  2,
+			wantErr: "requesters cannot approve their own deployments",
+		},
+		{
+			name: "already decided",
+			request: models.ApprovalRequest{
+				RequestedBy: 1,
+				Environment: designated,
+				Decisions:   []models.ApprovalDecision{{UserID: 3, Decision: "approved"}},
+			},
+			members: []uint{1, 2, 3},
+			userID:  3,
+			wantErr: "user has already decided on this request",
+		},
+		{
+			name: "another approver decided",
+			request: models.ApprovalRequest{
+				RequestedBy: 1,
+				Environment: designated,
+				Decisions:   []models.ApprovalDecision{{UserID: 3, Decision: "rejected"}},
+			},
+			members: []uint{1, 2, 3},
+			userID:  2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkApprover(&tt.request, tt.members, tt.userID)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkApprover() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("checkApprover() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+	"ys-cloud/pkg/registry"
+	"ys-cloud/pkg/scanner"
+	"ys-cloud/pkg/signing"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ArtifactService produces the supply chain artifacts of build images: SBOMs generated by the
+// vulnerability scanner and cosign signatures made with the key held by ys-cloud
+type ArtifactService struct {
+	artifactRepo  *repository.BuildArtifactRepository
+	buildRepo     *repository.BuildRepository
+	scanner       *scanner.Scanner
+	signer        *signing.Signer
+	sbomFormat    string
+	requireSigned bool
+	username      string
+	password      string
+}
+
+// NewArtifactService creates the service; images get no SBOM when imageScanner is nil and are
+// not signed when signer is nil
+func NewArtifactService(artifactRepo *repository.BuildArtifactRepository, buildRepo *repository.BuildRepository, imageScanner *scanner.Scanner, signer *signing.Signer, cfg *config.Config) *ArtifactService {
+	return &ArtifactService{
+		artifactRepo:  artifactRepo,
+		buildRepo:     buildRepo,
+		scanner:       imageScanner,
+		signer:        signer,
+		sbomFormat:    cfg.Scan.SBOMFormat,
+		requireSigned: cfg.Signing.RequireSigned,
+		username:      cfg.Docker.Username,
+		password:      cfg.Docker.Password,
+	}
+}
+
+// AttachArtifacts generates the SBOM of a pushed build image and signs its digest, attaching both
+// to the image in the registry and to the build. It returns an error when the build must fail:
+// when the image cannot be signed, or when the SBOM or its attestation fails while signed images
+// are required. Otherwise such failures are recorded on the build's artifacts, like failed scans.
+func (s *ArtifactService) AttachArtifacts(build *models.Build, image ImageBuild, digest string, output io.Writer) error {
+	signs := s.signer != nil && s.signer.CanSign()
+	if s.scanner == nil && !signs {
+		return nil
+	}
+	if digest == "" {
+		if signs {
+			return errors.New("image digest is unknown, the image cannot be signed")
+		}
+		fmt.Fprintln(output, "\nImage digest is unknown, skipping SBOM generation")
+		return nil
+	}
+
+	if err := s.artifactRepo.DeleteByBuildID(build.ID); err != nil {
+		return err
+	}
+
+	reference := fmt.Sprintf("%s@%s", image.Image, digest)
+	auths := s.auths(image)
+
+	var sbom *models.BuildArtifact
+	if s.scanner != nil {
+		fmt.Fprintf(output, "\nGenerating %s SBOM of %s\n", s.sbomFormat, reference)
+
+		opts := scanner.ScanOptions{Image: reference, Output: output}
+		if auth := registry.Find(auths, image.Image); auth != nil {
+			opts.Username, opts.Password = auth.Username, auth.Password
+		}
+		content, err := s.scanner.SBOM(opts, s.sbomFormat)
+		if err == nil {
+			sbom = &models.BuildArtifact{
+				BuildID: build.ID,
+				Type:    "sbom",
+				Format:  s.sbomFormat,
+				Digest:  fmt.Sprintf("sha256:%x", sha256.Sum256(content)),
+				Size:    len(content),
+				Content: string(content),
+			}
+		} else if err := s.degrade(build.ID, "sbom", s.sbomFormat, err, output); err != nil {
+			return err
+		}
+	}
+
+	if signs {
+		fmt.Fprintf(output, "\nSigning %s\n", reference)
+
+		opts := signing.SignOptions{Image: reference, Auths: auths, Output: output}
+		if err := s.signer.Sign(opts); err != nil {
+			return err
+		}
+		if err := s.artifactRepo.Create(&models.BuildArtifact{
+			BuildID:   build.ID,
+			Type:      "signature",
+			Format:    "cosign",
+			Reference: fmt.Sprintf("%s:%s", image.Image, signing.SignatureTag(digest)),
+			Digest:    digest,
+		}); err != nil {
+			return err
+		}
+
+		// The SBOM travels with the image as a signed attestation
+		if sbom != nil {
+			predicateType := signing.PredicateCycloneDX
+			if sbom.Format == scanner.FormatSPDX {
+				predicateType = signing.PredicateSPDX
+			}
+			if err := s.signer.Attest(opts, predicateType, []byte(sbom.Content)); err != nil {
+				if err := s.degrade(build.ID, "attestation", sbom.Format, err, output); err != nil {
+					return err
+				}
+			} else {
+				sbom.Reference = fmt.Sprintf("%s:%s", image.Image, signing.AttestationTag(digest))
+			}
+		}
+
+		if err := s.buildRepo.UpdateSigned(build.ID, true); err != nil {
+			return err
+		}
+	}
+
+	if sbom != nil {
+		return s.artifactRepo.Create(sbom)
+	}
+	return nil
+}
+
+// degrade records an artifact that could not be produced and lets the build go on, unless signed
+// images are required
+func (s *ArtifactService) degrade(buildID uint, artifactType, format string, reason error, output io.Writer) error {
+	if s.requireSigned {
+		return reason
+	}
+
+	fmt.Fprintf(output, "Generating the %s failed: %v\n", artifactType, reason)
+	logrus.WithError(reason).WithField("build_id", buildID).Warnf("Build %s failed", artifactType)
+	return s.artifactRepo.Create(&models.BuildArtifact{
+		BuildID: buildID,
+		Type:    artifactType,
+		Format:  format,
+		Error:   reason.Error(),
+	})
+}
+
+// auths returns the registry credentials of a build image, falling back to the global ones
+func (s *ArtifactService) auths(image ImageBuild) []registry.Auth {
+	if registry.Find(image.Registries, image.Image) != nil || s.username == "" {
+		return image.Registries
+	}
+	return append(slices.Clip(image.Registries), registry.Auth{
+		Registry: registry.ImageHost(image.Image),
+		Username: s.username,
+		Password: s.password,
+	})
+}
+
+func (s *ArtifactService) GetByBuildID(buildID uint) ([]*models.BuildArtifact, error) {
+	return s.artifactRepo.GetByBuildID(buildID)
+}
+
+func (s *ArtifactService) GetByID(id uint) (*models.BuildArtifact, error) {
+	return s.artifactRepo.GetByID(id)
+}
+
+// Verifier returns the verifier deployed images are checked with, nil when unsigned images may
+// be deployed. auths are the credentials for reading signatures from the registry.
+func (s *ArtifactService) Verifier(auths []registry.Auth) k8s.ImageVerifier {
+	if !s.requireSigned {
+		return nil
+	}
+	return &signatureVerifier{signer: s.signer, auths: auths}
+}
+
+// signatureVerifier accepts images signed with the key pair of ys-cloud
+type signatureVerifier struct {
+	signer *signing.Signer
+	auths  []registry.Auth
+}
+
+func (v *signatureVerifier) Verify(image string) error {
+	if v.signer == nil {
+		return errors.New("no image signer is available to verify signatures")
+	}
+	return v.signer.Verify(signing.SignOptions{Image: image, Auths: v.auths})
+}
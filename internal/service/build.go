@@ -1,42 +1,81 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strings"
+	"sync"
 	"time"
+	"ys-cloud/internal/config"
 	"ys-cloud/internal/models"
 	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+	"ys-cloud/pkg/registry"
+
+	"github.com/sirupsen/logrus"
 )
 
 type BuildService struct {
-	buildRepo     *repository.BuildRepository
-	pipelineRepo  *repository.PipelineRepository
-	gitService    *GitService
-	dockerService *DockerService
-	k8sService    *K8sService
+	buildRepo       *repository.BuildRepository
+	pipelineRepo    *repository.PipelineRepository
+	gitService      *GitService
+	builder         ImageBuilder
+	stepRunner      *StepRunner
+	k8sService      *K8sService
+	previewService  *PreviewService
+	registryService *RegistryCredentialService
+	scanService     *ScanService
+	artifactService *ArtifactService
+	registry        string
+	username        string // global registry credentials, for registries without project credentials
+	password        string
+
+	mu      sync.Mutex
+	cancels map[uint]context.CancelFunc // stops the running builds
 }
 
-func NewBuildService(buildRepo *repository.BuildRepository, pipelineRepo *repository.PipelineRepository) *BuildService {
+func NewBuildService(buildRepo *repository.BuildRepository, pipelineRepo *repository.PipelineRepository, builder ImageBuilder, stepRunner *StepRunner, previewService *PreviewService, registryService *RegistryCredentialService, scanService *ScanService, artifactService *ArtifactService, cfg *config.Config) *BuildService {
 	return &BuildService{
-		buildRepo:    buildRepo,
-		pipelineRepo: pipelineRepo,
+		buildRepo:       buildRepo,
+		pipelineRepo:    pipelineRepo,
+		builder:         builder,
+		stepRunner:      stepRunner,
+		previewService:  previewService,
+		registryService: registryService,
+		scanService:     scanService,
+		artifactService: artifactService,
+		registry:        strings.TrimSuffix(cfg.Docker.Registry, "/"),
+		username:        cfg.Docker.Username,
+		password:        cfg.Docker.Password,
+		cancels:         make(map[uint]context.CancelFunc),
 	}
 }
 
 func (s *BuildService) Create(pipelineID uint, commitHash, branch, tag string) (*models.Build, error) {
 	// Check if pipeline exists
-	_, err := s.pipelineRepo.GetByID(pipelineID)
+	pipeline, err := s.pipelineRepo.GetByID(pipelineID)
 	if err != nil {
 		return nil, errors.New("pipeline not found")
 	}
 
+	imageConfig, err := parseImageConfig(pipeline.Config)
+	if err != nil {
+		return nil, err
+	}
+
 	build := &models.Build{
 		PipelineID: pipelineID,
 		CommitHash: commitHash,
 		Branch:     branch,
 		Tag:        tag,
 		Status:     "pending",
-		ImageTag:   time.Now().Format("20060102-150405"),
 	}
+	tags := imageConfig.renderTags(build, time.Now())
+	build.ImageTag = tags[0]
+	build.ImageTags = strings.Join(tags, ",")
 
 	if err := s.buildRepo.Create(build); err != nil {
 		return nil, err
@@ -45,6 +84,22 @@ func (s *BuildService) Create(pipelineID uint, commitHash, branch, tag string) (
 	return s.buildRepo.GetByID(build.ID)
 }
 
+// CreateForPullRequest creates a build of a pull request's head commit; once it succeeds
+// it is deployed to the pull request's preview environment
+func (s *BuildService) CreateForPullRequest(pipelineID uint, commitHash, branch string, pullRequest int) (*models.Build, error) {
+	build, err := s.Create(pipelineID, commitHash, branch, "")
+	if err != nil {
+		return nil, err
+	}
+
+	build.PullRequest = pullRequest
+	if err := s.buildRepo.Update(build); err != nil {
+		return nil, err
+	}
+
+	return build, nil
+}
+
 func (s *BuildService) GetByID(id uint) (*models.Build, error) {
 	return s.buildRepo.GetByID(id)
 }
@@ -66,6 +121,10 @@ func (s *BuildService) List(offset, limit int) ([]*models.Build, error) {
 }
 
 func (s *BuildService) StartBuild(id uint) error {
+	if s.builder == nil {
+		return errors.New("no image builder is available")
+	}
+
 	build, err := s.buildRepo.GetByID(id)
 	if err != nil {
 		return err
@@ -79,11 +138,154 @@ func (s *BuildService) StartBuild(id uint) error {
 		return err
 	}
 
-	// TODO: Start actual build process in background
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.cancels[build.ID] = cancel
+	s.mu.Unlock()
+
+	go s.run(ctx, build)
 	return nil
 }
 
-func (s *BuildService) CompleteBuild(id uint, status, logs, imageName string) error {
+// run runs the pipeline steps of a started build, then builds, pushes, scans and signs its image, keeping its logs current while it runs
+func (s *BuildService) run(ctx context.Context, build *models.Build) {
+	output := newBuildLogWriter(s.buildRepo, build.ID)
+	defer func() {
+		s.mu.Lock()
+		if cancel, ok := s.cancels[build.ID]; ok {
+			cancel()
+			delete(s.cancels, build.ID)
+		}
+		s.mu.Unlock()
+	}()
+	defer func() {
+		// A panic fails the build instead of leaving it running and taking the server down
+		if r := recover(); r != nil {
+			logrus.WithField("build_id", build.ID).Errorf("Build panicked: %v\n%s", r, debug.Stack())
+			fmt.Fprintf(output, "\nBuild failed: internal error: %v\n", r)
+			if err := s.CompleteBuild(build.ID, "failed", output.String(), "", ""); err != nil {
+				logrus.WithError(err).WithField("build_id", build.ID).Error("Failed to record build result")
+			}
+		}
+	}()
+
+	var digest string
+	image, err := s.imageBuild(build)
+	if err == nil {
+		err = s.runSteps(ctx, build, image, output)
+	}
+	// Release tags such as latest are only published once the scan passed
+	var release []string
+	if err == nil && s.scanService != nil && s.scanService.Gates(build) {
+		release, image.Tags = image.Tags, []string{stagingTag(build.ID)}
+	}
+	if err == nil {
+		digest, err = s.builder.Build(ctx, image, output)
+	}
+	if err == nil && s.scanService != nil {
+		err = s.scanService.ScanBuild(build, image, digest, output)
+	}
+	if err == nil && release != nil {
+		err = s.promoteTags(image, release, digest, output)
+		image.Tags = release
+	}
+	if err == nil && s.artifactService != nil {
+		err = s.artifactService.AttachArtifacts(build, image, digest, output)
+	}
+
+	status, imageName := "success", image.Image
+	if err != nil {
+		status, imageName, digest = "failed", "", ""
+		fmt.Fprintf(output, "\nBuild failed: %v\n", err)
+		logrus.WithError(err).WithField("build_id", build.ID).Error("Build failed")
+	}
+
+	// A build cancelled meanwhile keeps its status
+	if current, err := s.buildRepo.GetByID(build.ID); err == nil && current.Status == "cancelled" {
+		s.buildRepo.UpdateLogs(build.ID, output.String())
+		return
+	}
+
+	if err := s.CompleteBuild(build.ID, status, output.String(), imageName, digest); err != nil {
+		logrus.WithError(err).WithField("build_id", build.ID).Error("Failed to record build result")
+	}
+}
+
+// promoteTags adds the release tags to the staged image of a build in the registry
+func (s *BuildService) promoteTags(image ImageBuild, tags []string, digest string, output io.Writer) error {
+	if digest == "" {
+		return errors.New("staged image has no digest")
+	}
+	host, repository := registry.SplitImage(image.Image)
+
+	// Registries without project credentials fall back to the global ones
+	auth := registry.Find(image.Registries, image.Image)
+	if auth == nil && s.username != "" {
+		auth = &registry.Auth{Registry: host, Username: s.username, Password: s.password}
+	}
+
+	client := registry.NewClient(host, auth)
+	for _, tag := range tags {
+		if err := client.TagManifest(repository, digest, tag); err != nil {
+			return err
+		}
+		fmt.Fprintf(output, "Pushed %s:%s\n", image.Image, tag)
+	}
+	return nil
+}
+
+// imageBuild describes the image of a build: pushed to the project's registry with its credentials,
+// or to the global registry
+func (s *BuildService) imageBuild(build *models.Build) (ImageBuild, error) {
+	imageConfig, err := parseImageConfig(build.Pipeline.Config)
+	if err != nil {
+		return ImageBuild{}, err
+	}
+
+	tags := []string{build.ImageTag}
+	if build.ImageTags != "" {
+		tags = strings.Split(build.ImageTags, ",")
+	}
+
+	project := build.Pipeline.Project
+	image := ImageBuild{
+		BuildID:     build.ID,
+		ProjectID:   project.ID,
+		GitURL:      project.GitURL,
+		Branch:      build.Branch,
+		Tag:         build.Tag,
+		Ref:         pullRequestRef(project.GitProvider, build.PullRequest),
+		PullRequest: build.PullRequest,
+		CommitHash:  build.CommitHash,
+		Dockerfile:  imageConfig.Dockerfile,
+		Image:       fmt.Sprintf("%s/%s", s.registry, k8s.SanitizeName(project.Name)),
+		Tags:        tags,
+		BuildKit:    imageConfig.BuildKitOptions,
+	}
+	if s.registryService == nil {
+		return image, nil
+	}
+
+	if image.Image, err = s.registryService.Repository(&project, s.registry); err != nil {
+		return image, err
+	}
+	image.Registries, err = s.registryService.Auths(project.ID)
+	return image, err
+}
+
+// runSteps runs the steps of the pipeline configuration in containers before the image is built
+func (s *BuildService) runSteps(ctx context.Context, build *models.Build, image ImageBuild, output io.Writer) error {
+	steps, err := parsePipelineSteps(build.Pipeline.Config)
+	if err != nil || len(steps) == 0 {
+		return err
+	}
+	if s.stepRunner == nil {
+		return errors.New("pipeline steps require a Docker daemon")
+	}
+	return s.stepRunner.Run(ctx, image, steps, output)
+}
+
+func (s *BuildService) CompleteBuild(id uint, status, logs, imageName, imageDigest string) error {
 	build, err := s.buildRepo.GetByID(id)
 	if err != nil {
 		return err
@@ -94,10 +296,70 @@ func (s *BuildService) CompleteBuild(id uint, status, logs, imageName string) er
 	build.CompletedAt = &now
 	build.Logs = logs
 	build.ImageName = imageName
+	build.ImageDigest = imageDigest
+
+	if err := s.buildRepo.Update(build); err != nil {
+		return err
+	}
 
-	return s.buildRepo.Update(build)
+	if status == "success" && build.PullRequest > 0 && s.previewService != nil {
+		go func() {
+			if _, err := s.previewService.DeployBuild(build.ID); err != nil {
+				logrus.WithError(err).WithField("build_id", build.ID).Error("Failed to deploy preview environment")
+			}
+		}()
+	}
+
+	return nil
 }
 
+// CancelBuild marks a build cancelled and stops it when it is running: its step containers are
+// killed and its image build or build job is aborted
 func (s *BuildService) CancelBuild(id uint) error {
-	return s.buildRepo.UpdateStatus(id, "cancelled")
-}
\ No newline at end of file
+	if err := s.buildRepo.UpdateStatus(id, "cancelled"); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	cancel, ok := s.cancels[id]
+	s.mu.Unlock()
+	if ok {
+		cancel()
+	}
+	return nil
+}
+
+// buildLogWriter collects the output of a running build and saves it to the build every few
+// seconds so that it can be followed through the logs endpoint
+type buildLogWriter struct {
+	buildRepo *repository.BuildRepository
+	buildID   uint
+
+	mu        sync.Mutex
+	logs      strings.Builder
+	flushedAt time.Time
+}
+
+func newBuildLogWriter(buildRepo *repository.BuildRepository, buildID uint) *buildLogWriter {
+	return &buildLogWriter{buildRepo: buildRepo, buildID: buildID, flushedAt: time.Now()}
+}
+
+func (w *buildLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.logs.Write(p)
+	if time.Since(w.flushedAt) >= 2*time.Second {
+		w.flushedAt = time.Now()
+		if err := w.buildRepo.UpdateLogs(w.buildID, w.logs.String()); err != nil {
+			logrus.WithError(err).WithField("build_id", w.buildID).Warn("Failed to save build logs")
+		}
+	}
+	return len(p), nil
+}
+
+func (w *buildLogWriter) String() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.logs.String()
+}
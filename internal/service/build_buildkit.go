@@ -0,0 +1,142 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"ys-cloud/pkg/docker"
+)
+
+// BuildKitOptions are the BuildKit settings of a pipeline's image section. They are only honoured
+// by the docker build backend with BuildKit enabled.
+//
+//	image:
+//	  platforms: [linux/amd64, linux/arm64]
+//	  cache_from: ["type=registry,ref=registry.example.com/app:buildcache"]
+//	  cache_to: ["type=registry,ref=registry.example.com/app:buildcache,mode=max"]
+//	  secrets:
+//	    - id: npmrc
+//	      src: npm/.npmrc
+//	  ssh: [github=keys/deploy_key]
+//	  push: true
+//
+// Secret sources and SSH keys are files below docker.secrets_dir on the build host.
+type BuildKitOptions struct {
+	Platforms []string            `json:"platforms,omitempty"`
+	CacheFrom []string            `json:"cache_from,omitempty"`
+	CacheTo   []string            `json:"cache_to,omitempty"`
+	Secrets   []BuildSecretConfig `json:"secrets,omitempty"`
+	SSH       []string            `json:"ssh,omitempty"`  // id=key, or id for a key file named after it
+	Push      bool                `json:"push,omitempty"` // push from BuildKit instead of the daemon, required for several platforms
+}
+
+// BuildSecretConfig mounts a file of the build host at RUN --mount=type=secret,id=<ID>
+type BuildSecretConfig struct {
+	ID  string `json:"id"`
+	Src string `json:"src"`
+}
+
+var platformPattern = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9_]+(/[a-z0-9]+)?$`)
+
+// cacheTypes are the cache backends pipelines may use. Local caches would let a pipeline read and
+// write arbitrary paths of the build host.
+var cacheTypes = map[string]bool{"registry": true, "inline": true, "gha": true, "s3": true, "azblob": true}
+
+// empty reports whether no BuildKit option is set
+func (o BuildKitOptions) empty() bool {
+	return len(o.Platforms) == 0 && len(o.CacheFrom) == 0 && len(o.CacheTo) == 0 &&
+		len(o.Secrets) == 0 && len(o.SSH) == 0 && !o.Push
+}
+
+func (o BuildKitOptions) validate() error {
+	for _, platform := range o.Platforms {
+		if !platformPattern.MatchString(platform) {
+			return fmt.Errorf("invalid image platform %q", platform)
+		}
+	}
+	if len(o.Platforms) > 1 && !o.Push {
+		return errors.New("images for several platforms must set push")
+	}
+
+	for _, cache := range append(append([]string{}, o.CacheFrom...), o.CacheTo...) {
+		if err := validateCache(cache); err != nil {
+			return err
+		}
+	}
+
+	for _, secret := range o.Secrets {
+		if secret.ID == "" {
+			return errors.New("image secret id is required")
+		}
+		if err := validateSecretPath(secret.Src); err != nil {
+			return fmt.Errorf("image secret %s: %w", secret.ID, err)
+		}
+	}
+	for _, ssh := range o.SSH {
+		id, key, _ := strings.Cut(ssh, "=")
+		if id == "" {
+			return fmt.Errorf("invalid image ssh entry %q", ssh)
+		}
+		if key == "" {
+			key = id
+		}
+		if err := validateSecretPath(key); err != nil {
+			return fmt.Errorf("image ssh key %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// validateCache accepts registry references and the cache backends of cacheTypes
+func validateCache(cache string) error {
+	if !strings.Contains(cache, "=") {
+		// A bare reference is a registry cache
+		return nil
+	}
+	for _, attribute := range strings.Split(cache, ",") {
+		if key, value, _ := strings.Cut(attribute, "="); key == "type" {
+			if !cacheTypes[value] {
+				return fmt.Errorf("unsupported image cache type %q", value)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("image cache %q has no type", cache)
+}
+
+// validateSecretPath accepts paths that stay inside the secrets directory
+func validateSecretPath(path string) error {
+	if path == "" {
+		return errors.New("source is required")
+	}
+	if filepath.IsAbs(path) || !filepath.IsLocal(path) {
+		return errors.New("source must be a relative path inside the secrets directory")
+	}
+	return nil
+}
+
+// dockerSecrets resolves the secrets and SSH keys of the options below the secrets directory
+func (o BuildKitOptions) dockerSecrets(secretsDir string) ([]docker.BuildSecret, []string, error) {
+	if len(o.Secrets) == 0 && len(o.SSH) == 0 {
+		return nil, nil, nil
+	}
+	if secretsDir == "" {
+		return nil, nil, errors.New("build secrets and ssh keys require docker.secrets_dir")
+	}
+
+	secrets := make([]docker.BuildSecret, 0, len(o.Secrets))
+	for _, secret := range o.Secrets {
+		secrets = append(secrets, docker.BuildSecret{ID: secret.ID, Src: filepath.Join(secretsDir, secret.Src)})
+	}
+	ssh := make([]string, 0, len(o.SSH))
+	for _, entry := range o.SSH {
+		id, key, _ := strings.Cut(entry, "=")
+		if key == "" {
+			key = id
+		}
+		ssh = append(ssh, id+"="+filepath.Join(secretsDir, key))
+	}
+	return secrets, ssh, nil
+}
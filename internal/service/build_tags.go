@@ -0,0 +1,154 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"ys-cloud/internal/models"
+
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+const defaultDockerfile = "Dockerfile"
+
+// ImageConfig is the image section of a pipeline configuration:
+//
+//	image:
+//	  dockerfile: build/Dockerfile
+//	  tags:
+//	    - "{{branch}}-{{short_sha}}"
+//	    - "{{version}}"
+//	    - template: latest
+//	      branches: [main]
+//	  platforms: [linux/amd64, linux/arm64]
+//	  push: true
+//
+// See BuildKitOptions for the remaining BuildKit settings.
+type ImageConfig struct {
+	Dockerfile string    `json:"dockerfile,omitempty"`
+	Tags       []TagRule `json:"tags,omitempty"`
+	BuildKitOptions
+}
+
+// TagRule renders one image tag. Rules limited to branches only apply to builds of those
+// branches, and rules using a variable that is empty for a build are skipped.
+type TagRule struct {
+	Template string   `json:"template"`
+	Branches []string `json:"branches,omitempty"`
+}
+
+// UnmarshalJSON accepts a plain template string as well as the object form
+func (r *TagRule) UnmarshalJSON(data []byte) error {
+	var template string
+	if err := json.Unmarshal(data, &template); err == nil {
+		*r = TagRule{Template: template}
+		return nil
+	}
+
+	type rule TagRule
+	return json.Unmarshal(data, (*rule)(r))
+}
+
+var (
+	tagVariablePattern = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+	semverPattern      = regexp.MustCompile(`^v?((\d+)\.(\d+)\.(\d+)(?:[-+][0-9A-Za-z.+-]*)?)$`)
+	invalidTagChars    = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+var tagVariables = map[string]bool{
+	"branch": true, "sha": true, "short_sha": true, "tag": true,
+	"version": true, "major": true, "minor": true, "patch": true, "timestamp": true,
+}
+
+// parseImageConfig reads the image section of a YAML pipeline configuration
+func parseImageConfig(raw string) (*ImageConfig, error) {
+	var config struct {
+		Image *ImageConfig `json:"image"`
+	}
+	if strings.TrimSpace(raw) != "" {
+		if err := utilyaml.Unmarshal([]byte(raw), &config); err != nil {
+			return nil, fmt.Errorf("invalid pipeline config: %w", err)
+		}
+	}
+	if config.Image == nil {
+		config.Image = &ImageConfig{}
+	}
+	if config.Image.Dockerfile == "" {
+		config.Image.Dockerfile = defaultDockerfile
+	}
+
+	if err := config.Image.BuildKitOptions.validate(); err != nil {
+		return nil, fmt.Errorf("invalid pipeline config: %w", err)
+	}
+
+	for _, rule := range config.Image.Tags {
+		if strings.TrimSpace(rule.Template) == "" {
+			return nil, fmt.Errorf("invalid pipeline config: image tag template is empty")
+		}
+		for _, match := range tagVariablePattern.FindAllStringSubmatch(rule.Template, -1) {
+			if !tagVariables[match[1]] {
+				return nil, fmt.Errorf("invalid pipeline config: unknown image tag variable %s", match[0])
+			}
+		}
+	}
+
+	return config.Image, nil
+}
+
+// renderTags renders the image tags of a build, the first one being its primary tag. Builds
+// without applicable rules are tagged with the build time.
+func (config *ImageConfig) renderTags(build *models.Build, now time.Time) []string {
+	timestamp := now.Format("20060102-150405")
+	variables := map[string]string{
+		"branch":    build.Branch,
+		"sha":       build.CommitHash,
+		"short_sha": shortCommit(build.CommitHash),
+		"tag":       build.Tag,
+		"timestamp": timestamp,
+	}
+	if match := semverPattern.FindStringSubmatch(build.Tag); match != nil {
+		variables["version"] = match[1]
+		variables["major"] = match[2]
+		variables["minor"] = match[3]
+		variables["patch"] = match[4]
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, rule := range config.Tags {
+		if len(rule.Branches) > 0 && !slices.Contains(rule.Branches, build.Branch) {
+			continue
+		}
+
+		complete := true
+		tag := tagVariablePattern.ReplaceAllStringFunc(rule.Template, func(variable string) string {
+			value := variables[tagVariablePattern.FindStringSubmatch(variable)[1]]
+			if value == "" {
+				complete = false
+			}
+			return value
+		})
+		if tag = sanitizeTag(tag); !complete || tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) == 0 {
+		tags = []string{timestamp}
+	}
+	return tags
+}
+
+// sanitizeTag maps a rendered template onto the characters and length allowed in image tags
+func sanitizeTag(tag string) string {
+	tag = strings.TrimLeft(invalidTagChars.ReplaceAllString(tag, "-"), ".-")
+	if len(tag) > 128 {
+		tag = tag[:128]
+	}
+	return tag
+}
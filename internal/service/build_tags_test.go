@@ -0,0 +1,127 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"ys-cloud/internal/models"
+)
+
+func TestRenderTags(t *testing.T) {
+	now := time.Date(2024, 3, 9, 14, 5, 30, 0, time.UTC)
+	commit := "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name  string
+		rules []TagRule
+		build models.Build
+		want  []string
+	}{
+		{
+			name:  "no rules",
+			build: models.Build{Branch: "main", CommitHash: commit},
+			want:  []string{"20240309-140530"},
+		},
+		{
+			name:  "branch and commit",
+			rules: []TagRule{{Template: "{{branch}}-{{short_sha}}"}, {Template: "{{ sha }}"}},
+			build: models.Build{Branch: "main", CommitHash: commit},
+			want:  []string{"main-0123456", commit},
+		},
+		{
+			name:  "semver tag",
+			rules: []TagRule{{Template: "{{version}}"}, {Template: "{{major}}.{{minor}}"}, {Template: "{{major}}"}},
+			build: models.Build{Branch: "main", Tag: "v1.2.3", CommitHash: commit},
+			want:  []string{"1.2.3", "1.2", "1"},
+		},
+		{
+			name:  "pre-release tag",
+			rules: []TagRule{{Template: "{{version}}"}, {Template: "{{tag}}"}},
+			build: models.Build{Tag: "v2.0.0-rc.1"},
+			want:  []string{"2.0.0-rc.1", "v2.0.0-rc.1"},
+		},
+		{
+			name:  "rules with empty variables are skipped",
+			rules: []TagRule{{Template: "{{version}}"}, {Template: "{{tag}}"}, {Template: "{{branch}}"}},
+			build: models.Build{Branch: "main", CommitHash: commit},
+			want:  []string{"main"},
+		},
+		{
+			name:  "non semver tag has no version",
+			rules: []TagRule{{Template: "{{version}}"}, {Template: "{{tag}}"}},
+			build: models.Build{Tag: "release-7"},
+			want:  []string{"release-7"},
+		},
+		{
+			name:  "rules limited to branches",
+			rules: []TagRule{{Template: "latest", Branches: []string{"main"}}, {Template: "{{branch}}"}},
+			build: models.Build{Branch: "develop"},
+			want:  []string{"develop"},
+		},
+		{
+			name:  "rules of the build branch apply",
+			rules: []TagRule{{Template: "latest", Branches: []string{"main", "master"}}, {Template: "{{branch}}"}},
+			build: models.Build{Branch: "master"},
+			want:  []string{"latest", "master"},
+		},
+		{
+			name:  "duplicates are dropped",
+			rules: []TagRule{{Template: "{{branch}}"}, {Template: "main"}, {Template: "{{branch}}"}},
+			build: models.Build{Branch: "main"},
+			want:  []string{"main"},
+		},
+		{
+			name:  "branch names are sanitized",
+			rules: []TagRule{{Template: "{{branch}}-{{short_sha}}"}},
+			build: models.Build{Branch: "feature/login page", CommitHash: "abc"},
+			want:  []string{"feature-login-page-abc"},
+		},
+		{
+			name:  "timestamp",
+			rules: []TagRule{{Template: "build-{{timestamp}}"}},
+			build: models.Build{Branch: "main"},
+			want:  []string{"build-20240309-140530"},
+		},
+		{
+			name:  "no applicable rules",
+			rules: []TagRule{{Template: "latest", Branches: []string{"main"}}, {Template: "{{version}}"}},
+			build: models.Build{Branch: "develop"},
+			want:  []string{"20240309-140530"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &ImageConfig{Tags: tt.rules}
+			if got := config.renderTags(&tt.build, now); !slices.Equal(got, tt.want) {
+				t.Errorf("renderTags() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeTag(t *testing.T) {
+	tests := []struct {
+		name string
+		tag  string
+		want string
+	}{
+		{name: "valid", tag: "v1.2.3_rc-1", want: "v1.2.3_rc-1"},
+		{name: "invalid characters", tag: "feature/login page", want: "feature-login-page"},
+		{name: "runs of invalid characters", tag: "a//@@b", want: "a-b"},
+		{name: "leading separators", tag: "..-/tag", want: "tag"},
+		{name: "trailing separators are kept", tag: "tag.", want: "tag."},
+		{name: "only invalid characters", tag: "///", want: ""},
+		{name: "empty", tag: "", want: ""},
+		{name: "truncated", tag: strings.Repeat("a", 200), want: strings.Repeat("a", 128)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeTag(tt.tag); got != tt.want {
+				t.Errorf("sanitizeTag(%q) = %q, want %q", tt.tag, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/pkg/docker"
+	"ys-cloud/pkg/k8s"
+	"ys-cloud/pkg/registry"
+
+	dockerregistry "github.com/docker/docker/api/types/registry"
+)
+
+// ImageBuild describes an image built from a commit of a project repository
+type ImageBuild struct {
+	BuildID     uint
+	ProjectID   uint
+	GitURL      string
+	Branch      string
+	Tag         string // git tag, built instead of the branch when set
+	Ref         string // git ref fetched instead of the branch when set, e.g. the head of a pull request
+	PullRequest int    // pull request the build was made for, 0 otherwise
+	CommitHash  string
+	Dockerfile  string
+	Image       string   // repository the image is pushed to
+	Tags        []string // tags pushed, the first one is the primary tag
+	BuildArgs   map[string]string
+	Target      string
+	Registries  []registry.Auth // credentials for pushing the image and pulling base images
+	BuildKit    BuildKitOptions
+}
+
+// ImageBuilder builds an image, pushes it to the registry under every tag and returns its digest,
+// writing the build output to output. Cancelling ctx stops the build.
+type ImageBuilder interface {
+	Build(ctx context.Context, build ImageBuild, output io.Writer) (string, error)
+}
+
+// NewImageBuilder picks the build backend configured by build.backend. The auto backend builds
+// with the Docker daemon when it is reachable and with Kubernetes jobs otherwise. It returns nil
+// when the chosen backend is unavailable.
+func NewImageBuilder(cfg *config.Config, dockerService *DockerService, gitService *GitService, k8sService *K8sService) ImageBuilder {
+	switch cfg.Build.Backend {
+	case "docker":
+		if dockerService != nil {
+			return NewDockerBuilder(dockerService, gitService, cfg)
+		}
+	case "kubernetes":
+		if k8sService != nil {
+			return NewKubernetesBuilder(k8sService, cfg)
+		}
+	default:
+		if dockerService != nil {
+			return NewDockerBuilder(dockerService, gitService, cfg)
+		}
+		if k8sService != nil {
+			return NewKubernetesBuilder(k8sService, cfg)
+		}
+	}
+	return nil
+}
+
+// DockerBuilder builds images with the Docker daemon from a local checkout
+type DockerBuilder struct {
+	dockerService *DockerService
+	gitService    *GitService
+	username      string
+	password      string
+	secretsDir    string
+}
+
+func NewDockerBuilder(dockerService *DockerService, gitService *GitService, cfg *config.Config) *DockerBuilder {
+	return &DockerBuilder{
+		dockerService: dockerService,
+		gitService:    gitService,
+		username:      cfg.Docker.Username,
+		password:      cfg.Docker.Password,
+		secretsDir:    cfg.Docker.SecretsDir,
+	}
+}
+
+func (b *DockerBuilder) Build(ctx context.Context, build ImageBuild, output io.Writer) (string, error) {
+	secrets, ssh, err := build.BuildKit.dockerSecrets(b.secretsDir)
+	if err != nil {
+		return "", err
+	}
+
+	repo, err := b.gitService.CloneSources(build.GitURL, build.Tag, build.Ref, build.Branch, build.CommitHash)
+	if err != nil {
+		return "", err
+	}
+	defer b.gitService.Cleanup(repo.RepoPath)
+
+	buildArgs := make(map[string]*string, len(build.BuildArgs))
+	for key, value := range build.BuildArgs {
+		buildArgs[key] = &value
+	}
+	authConfigs := make(map[string]dockerregistry.AuthConfig, len(build.Registries))
+	for _, auth := range build.Registries {
+		authConfigs[registry.ConfigKey(auth.Registry)] = dockerregistry.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.Registry,
+		}
+	}
+
+	// Registries without project credentials fall back to the global ones
+	username, password := b.username, b.password
+	if auth := registry.Find(build.Registries, build.Image); auth != nil {
+		username, password = auth.Username, auth.Password
+	} else if build.BuildKit.Push && username != "" {
+		authConfigs[registry.ConfigKey(registry.ImageHost(build.Image))] = dockerregistry.AuthConfig{Username: username, Password: password}
+	}
+
+	opts := docker.BuildOptions{
+		ContextDir:  repo.RepoPath,
+		Dockerfile:  build.Dockerfile,
+		ImageName:   build.Image,
+		ImageTag:    build.Tags[0],
+		BuildArgs:   buildArgs,
+		Target:      build.Target,
+		Labels:      k8s.Owner{ProjectID: build.ProjectID}.Labels(),
+		Remove:      true,
+		AuthConfigs: authConfigs,
+		Platforms:   build.BuildKit.Platforms,
+		CacheFrom:   build.BuildKit.CacheFrom,
+		CacheTo:     build.BuildKit.CacheTo,
+		Secrets:     secrets,
+		SSH:         ssh,
+		Push:        build.BuildKit.Push,
+	}
+	if opts.Push {
+		// BuildKit pushes every tag itself and the image never reaches the daemon
+		opts.ExtraTags = build.Tags[1:]
+	}
+
+	logs, err := b.dockerService.BuildImageWithLogs(ctx, opts)
+	io.WriteString(output, logs)
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Push {
+		for _, tag := range build.Tags {
+			fmt.Fprintf(output, "Pushed %s:%s\n", build.Image, tag)
+		}
+		return b.dockerService.RemoteDigest(build.Image, build.Tags[0], username, password)
+	}
+
+	for i, tag := range build.Tags {
+		if i > 0 {
+			if err := b.dockerService.TagImage(build.Image, build.Tags[0], build.Image, tag); err != nil {
+				return "", err
+			}
+		}
+		if err := b.dockerService.PushImage(ctx, build.Image, tag, username, password); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(output, "Pushed %s:%s\n", build.Image, tag)
+	}
+
+	return b.dockerService.ImageDigest(build.Image, build.Tags[0])
+}
+
+// KubernetesBuilder builds images in Kubernetes jobs with Kaniko or rootless BuildKit, for
+// clusters where no Docker daemon is available
+type KubernetesBuilder struct {
+	k8sService   *K8sService
+	config       config.BuildConfig
+	namespace    string
+	timeout      time.Duration
+	installation string
+	gitUsername  string
+	gitPassword  string
+}
+
+func NewKubernetesBuilder(k8sService *K8sService, cfg *config.Config) *KubernetesBuilder {
+	namespace := cfg.Build.Namespace
+	if namespace == "" {
+		namespace = cfg.K8s.Namespace
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	return &KubernetesBuilder{
+		k8sService:   k8sService,
+		config:       cfg.Build,
+		namespace:    namespace,
+		timeout:      parseDuration(cfg.Build.Timeout, 30*time.Minute),
+		installation: cfg.K8s.InstallationID,
+		gitUsername:  cfg.Git.CloneUsername,
+		gitPassword:  cfg.Git.ClonePassword,
+	}
+}
+
+func (b *KubernetesBuilder) Build(ctx context.Context, build ImageBuild, output io.Writer) (string, error) {
+	if !build.BuildKit.empty() {
+		return "", errors.New("image platforms, caches, secrets, ssh and push require the docker build backend")
+	}
+
+	ref := build.Ref
+	if build.Tag != "" {
+		ref = "refs/tags/" + build.Tag
+	} else if ref == "" && build.Branch != "" {
+		ref = "refs/heads/" + build.Branch
+	}
+
+	var dockerConfig []byte
+	if len(build.Registries) > 0 {
+		var err error
+		if dockerConfig, err = registry.DockerConfigJSON(build.Registries); err != nil {
+			return "", err
+		}
+	}
+
+	destinations := make([]string, 0, len(build.Tags))
+	for _, tag := range build.Tags {
+		destinations = append(destinations, fmt.Sprintf("%s:%s", build.Image, tag))
+	}
+
+	return b.k8sService.RunBuildJob(ctx, k8s.BuildJobOptions{
+		Name:           fmt.Sprintf("build-%d-%d", build.BuildID, time.Now().Unix()),
+		Namespace:      b.namespace,
+		Executor:       b.config.Executor,
+		ExecutorImage:  b.config.ExecutorImage,
+		GitURL:         build.GitURL,
+		GitUsername:    b.gitUsername,
+		GitPassword:    b.gitPassword,
+		Ref:            ref,
+		Commit:         build.CommitHash,
+		Dockerfile:     build.Dockerfile,
+		Destinations:   destinations,
+		BuildArgs:      build.BuildArgs,
+		Target:         build.Target,
+		RegistrySecret: b.config.RegistrySecret,
+		DockerConfig:   dockerConfig,
+		Timeout:        b.timeout,
+		Owner:          k8s.Owner{Installation: b.installation, ProjectID: build.ProjectID},
+		Output:         output,
+	})
+}
@@ -0,0 +1,505 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/docker"
+	"ys-cloud/pkg/storage"
+
+	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// StepCache is an entry of the caches of a pipeline step:
+//
+//	caches:
+//	  - name: go-build
+//	    path: /root/.cache/go-build
+//	    key: go-{{ checksum go.sum }}
+//	  - name: node-modules
+//	    path: node_modules
+//	    key: "{{ branch }}-{{ checksum package-lock.json }}"
+//
+// The path is absolute in the step container or relative to the workspace. The key template takes
+// the branch (the git tag for tag builds) and checksums of workspace files matching glob patterns.
+// A cache restores the saved cache of its key, or the latest one of its name when the key has none
+// yet, and is saved under its key once every step has passed. Steps declaring the same cache name
+// share the cache. Pull request builds save their caches apart from the branches, which never
+// restore them, and fall back to the caches of the branches.
+type StepCache struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Key  string `json:"key"`
+}
+
+var (
+	cacheNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	cacheKeyPattern  = regexp.MustCompile(`\{\{\s*(\w+)((?:\s+[^\s{}]+)*)\s*\}\}`)
+)
+
+// validateStepCache checks a cache declaration without rendering its key
+func validateStepCache(cache StepCache) error {
+	if !cacheNamePattern.MatchString(cache.Name) {
+		return fmt.Errorf("invalid cache name %q", cache.Name)
+	}
+
+	target := cachePath(cache.Path)
+	escapes := !path.IsAbs(cache.Path) && strings.HasPrefix(path.Clean(cache.Path), "..")
+	if cache.Path == "" || strings.HasPrefix(cache.Path, "~") || escapes || target == "/" || target == docker.StepWorkDir {
+		return fmt.Errorf("cache %s: path must be absolute or inside the workspace", cache.Name)
+	}
+
+	if strings.TrimSpace(cache.Key) == "" {
+		return fmt.Errorf("cache %s: key is required", cache.Name)
+	}
+	for _, match := range cacheKeyPattern.FindAllStringSubmatch(cache.Key, -1) {
+		args := strings.Fields(match[2])
+		switch match[1] {
+		case "branch":
+			if len(args) > 0 {
+				return fmt.Errorf("cache %s: %s takes no arguments", cache.Name, match[0])
+			}
+		case "checksum":
+			if len(args) == 0 {
+				return fmt.Errorf("cache %s: %s needs file patterns", cache.Name, match[0])
+			}
+			for _, arg := range args {
+				pattern := strings.Trim(arg, `"'`)
+				if filepath.IsAbs(pattern) || strings.Contains(pattern, "..") {
+					return fmt.Errorf("cache %s: checksum pattern %s must be inside the workspace", cache.Name, arg)
+				}
+				if _, err := filepath.Match(pattern, ""); err != nil {
+					return fmt.Errorf("cache %s: invalid checksum pattern %s", cache.Name, arg)
+				}
+			}
+		default:
+			return fmt.Errorf("cache %s: unknown key variable %s", cache.Name, match[0])
+		}
+	}
+	return nil
+}
+
+// cachePath resolves the path of a cache in the step container
+func cachePath(cachePath string) string {
+	if path.IsAbs(cachePath) {
+		return path.Clean(cachePath)
+	}
+	return path.Join(docker.StepWorkDir, cachePath)
+}
+
+// renderCacheKey renders the key template of a cache against the sources of a build
+func renderCacheKey(template string, build ImageBuild, workspace string) (string, error) {
+	var renderErr error
+	key := cacheKeyPattern.ReplaceAllStringFunc(template, func(match string) string {
+		parts := cacheKeyPattern.FindStringSubmatch(match)
+		switch parts[1] {
+		case "branch":
+			if build.Tag != "" {
+				return build.Tag
+			}
+			return build.Branch
+		case "checksum":
+			sum, err := checksumFiles(workspace, strings.Fields(parts[2]))
+			if err != nil && renderErr == nil {
+				renderErr = err
+			}
+			return sum
+		}
+		return match
+	})
+	if renderErr != nil {
+		return "", renderErr
+	}
+
+	key = strings.Trim(invalidTagChars.ReplaceAllString(key, "-"), "-.")
+	if len(key) > 128 {
+		key = key[:128]
+	}
+	if key == "" {
+		return "", errors.New("key is empty")
+	}
+	return key, nil
+}
+
+// checksumFiles hashes the names and contents of the workspace files matching glob patterns
+func checksumFiles(workspace string, patterns []string) (string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, `"'`)
+		matches, err := filepath.Glob(filepath.Join(workspace, pattern))
+		if err != nil {
+			return "", fmt.Errorf("invalid checksum pattern %s: %w", pattern, err)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() && !slices.Contains(files, match) {
+				files = append(files, match)
+			}
+		}
+	}
+	if len(files) == 0 {
+		return "", fmt.Errorf("no files match %s", strings.Join(patterns, " "))
+	}
+	sort.Strings(files)
+
+	hash := sha256.New()
+	for _, file := range files {
+		rel, _ := filepath.Rel(workspace, file)
+		fmt.Fprintf(hash, "%s\x00", filepath.ToSlash(rel))
+
+		content, err := os.Open(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+		_, err = io.Copy(hash, content)
+		content.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", rel, err)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))[:16], nil
+}
+
+// CacheService restores and saves the caches of pipeline steps, keeping their archives in the
+// storage backend
+type CacheService struct {
+	cacheRepo   *repository.BuildCacheRepository
+	projectRepo *repository.ProjectRepository
+	storage     storage.Storage
+	ttl         time.Duration
+
+	// mu keeps cleanup runs from overlapping
+	mu sync.Mutex
+}
+
+// NewCacheService creates the service; steps run without caches when store is nil
+func NewCacheService(cacheRepo *repository.BuildCacheRepository, projectRepo *repository.ProjectRepository, store storage.Storage, cfg *config.Config) *CacheService {
+	service := &CacheService{
+		cacheRepo:   cacheRepo,
+		projectRepo: projectRepo,
+		storage:     store,
+	}
+	if ttl, err := time.ParseDuration(cfg.Build.CacheTTL); err == nil {
+		service.ttl = ttl
+	}
+	return service
+}
+
+// buildCaches are the caches of a running build, extracted to directories of the build host that
+// are mounted into the step containers
+type buildCaches struct {
+	dir     string
+	entries []*cacheEntry
+}
+
+type cacheEntry struct {
+	name string
+	key  string // empty when the key could not be rendered, the cache is then not saved
+	dir  string
+	hit  bool // restored from its own key
+}
+
+// mounts returns the cache directories of a step by the container path they are mounted at
+func (c *buildCaches) mounts(step PipelineStep) map[string]string {
+	if c == nil || len(step.Caches) == 0 {
+		return nil
+	}
+
+	mounts := make(map[string]string, len(step.Caches))
+	for _, cache := range step.Caches {
+		for _, entry := range c.entries {
+			if entry.name == cache.Name {
+				mounts[cachePath(cache.Path)] = entry.dir
+			}
+		}
+	}
+	return mounts
+}
+
+func (c *buildCaches) remove() {
+	if c != nil {
+		os.RemoveAll(c.dir)
+	}
+}
+
+// Restore prepares the caches declared by the steps of a build next to its workspace. Caches that
+// cannot be restored start empty; caching problems never fail a build.
+func (s *CacheService) Restore(build ImageBuild, steps []PipelineStep, workspace string, output io.Writer) *buildCaches {
+	var declared []StepCache
+	for _, step := range steps {
+		for _, cache := range step.Caches {
+			if !slices.ContainsFunc(declared, func(c StepCache) bool { return c.Name == cache.Name }) {
+				declared = append(declared, cache)
+			}
+		}
+	}
+	if len(declared) == 0 {
+		return nil
+	}
+	if s.storage == nil {
+		fmt.Fprintln(output, "Step caches are disabled: no storage backend is available")
+		return nil
+	}
+
+	dir, err := os.MkdirTemp(filepath.Dir(workspace), "cache-")
+	if err != nil {
+		fmt.Fprintf(output, "Warning: failed to prepare step caches: %v\n", err)
+		return nil
+	}
+
+	caches := &buildCaches{dir: dir}
+	for _, cache := range declared {
+		entry := &cacheEntry{name: cache.Name, dir: filepath.Join(dir, cache.Name)}
+		if err := os.Mkdir(entry.dir, 0755); err != nil {
+			fmt.Fprintf(output, "Warning: failed to prepare cache %s: %v\n", cache.Name, err)
+			continue
+		}
+		caches.entries = append(caches.entries, entry)
+
+		if entry.key, err = renderCacheKey(cache.Key, build, workspace); err != nil {
+			fmt.Fprintf(output, "Warning: cache %s is not used: %v\n", cache.Name, err)
+			continue
+		}
+		s.restore(build, entry, output)
+	}
+	return caches
+}
+
+// cacheScope keeps the caches saved by pull request builds, whose steps run untrusted code, from
+// the builds of branches and tags
+func cacheScope(build ImageBuild) string {
+	if build.PullRequest > 0 {
+		return fmt.Sprintf("pull-%d", build.PullRequest)
+	}
+	return ""
+}
+
+// restore fills a cache directory from the saved cache of its key or the latest one of its name,
+// looking in the scope of the build before the caches of the branches
+func (s *CacheService) restore(build ImageBuild, entry *cacheEntry, output io.Writer) {
+	scopes := []string{cacheScope(build)}
+	if scopes[0] != "" {
+		scopes = append(scopes, "")
+	}
+
+	var saved *models.BuildCache
+	var err error
+	for _, scope := range scopes {
+		if saved, err = s.cacheRepo.GetByKey(build.ProjectID, scope, entry.name, entry.key); !errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		}
+	}
+	entry.hit = err == nil
+	for i := 0; i < len(scopes) && errors.Is(err, gorm.ErrRecordNotFound); i++ {
+		saved, err = s.cacheRepo.GetLatest(build.ProjectID, scopes[i], entry.name)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fmt.Fprintf(output, "Cache %s: no saved cache, starting empty\n", entry.name)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(output, "Warning: failed to look up cache %s: %v\n", entry.name, err)
+		return
+	}
+
+	if err := s.download(saved, entry.dir); err != nil {
+		fmt.Fprintf(output, "Warning: failed to restore cache %s: %v\n", entry.name, err)
+		entry.hit = false
+		os.RemoveAll(entry.dir)
+		os.Mkdir(entry.dir, 0755)
+		return
+	}
+	if err := s.cacheRepo.Touch(saved.ID); err != nil {
+		logrus.WithError(err).WithField("cache_id", saved.ID).Warn("Failed to record cache use")
+	}
+
+	if entry.hit {
+		fmt.Fprintf(output, "Restored cache %s from key %s (%s)\n", entry.name, saved.Key, units.HumanSize(float64(saved.Size)))
+	} else {
+		fmt.Fprintf(output, "Restored cache %s from key %s (%s), it is saved under key %s after the build\n",
+			entry.name, saved.Key, units.HumanSize(float64(saved.Size)), entry.key)
+	}
+}
+
+func (s *CacheService) download(cache *models.BuildCache, dir string) error {
+	content, err := s.storage.Get(cacheObjectKey(cache))
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	// Ownership is kept when running as root, so that steps running as other users can write
+	return archive.Untar(content, dir, &archive.TarOptions{NoLchown: os.Geteuid() != 0})
+}
+
+// Save stores the caches of a build whose steps passed. Saved caches are immutable: a cache
+// restored from its own key is left as it is and a changed key saves a new cache.
+func (s *CacheService) Save(build ImageBuild, caches *buildCaches, output io.Writer) {
+	if caches == nil {
+		return
+	}
+
+	for _, entry := range caches.entries {
+		if entry.hit || entry.key == "" {
+			continue
+		}
+
+		cache, err := s.upload(build, caches.dir, entry)
+		if err != nil {
+			fmt.Fprintf(output, "Warning: failed to save cache %s: %v\n", entry.name, err)
+			continue
+		}
+		fmt.Fprintf(output, "Saved cache %s under key %s (%s)\n", entry.name, entry.key, units.HumanSize(float64(cache.Size)))
+	}
+}
+
+func (s *CacheService) upload(build ImageBuild, dir string, entry *cacheEntry) (*models.BuildCache, error) {
+	// Archive to a file first, uploads need the size
+	file, err := os.CreateTemp(dir, entry.name+"-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	tarball, err := archive.TarWithOptions(entry.dir, &archive.TarOptions{Compression: archive.Gzip})
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive cache: %w", err)
+	}
+	size, err := io.Copy(file, tarball)
+	tarball.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to archive cache: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	cache := &models.BuildCache{
+		ProjectID:  build.ProjectID,
+		Scope:      cacheScope(build),
+		Name:       entry.name,
+		Key:        entry.key,
+		BuildID:    build.BuildID,
+		Size:       size,
+		LastUsedAt: time.Now(),
+	}
+	if existing, err := s.cacheRepo.GetByKey(cache.ProjectID, cache.Scope, cache.Name, cache.Key); err == nil {
+		cache.ID, cache.CreatedAt = existing.ID, existing.CreatedAt
+	}
+
+	if err := s.storage.Put(cacheObjectKey(cache), file, size); err != nil {
+		return nil, err
+	}
+	if err := s.cacheRepo.Save(cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+func (s *CacheService) GetByProjectID(projectID, userID uint) ([]*models.BuildCache, error) {
+	if err := s.checkMember(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.cacheRepo.GetByProjectID(projectID)
+}
+
+// Delete removes a saved cache, the next build starts from the latest remaining cache of its name
+func (s *CacheService) Delete(projectID, cacheID, userID uint) error {
+	if err := s.checkOwner(projectID, userID); err != nil {
+		return err
+	}
+
+	cache, err := s.cacheRepo.GetByID(cacheID)
+	if err != nil || cache.ProjectID != projectID {
+		return errors.New("cache not found")
+	}
+	return s.delete(cache)
+}
+
+func (s *CacheService) delete(cache *models.BuildCache) error {
+	if s.storage != nil {
+		if err := s.storage.Delete(cacheObjectKey(cache)); err != nil {
+			return err
+		}
+	}
+	return s.cacheRepo.Delete(cache.ID)
+}
+
+// StartCleaner periodically deletes the caches unused for longer than build.cache_ttl
+func (s *CacheService) StartCleaner(interval time.Duration) {
+	if s.ttl <= 0 {
+		return
+	}
+
+	every(interval, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		caches, err := s.cacheRepo.ListUnusedSince(time.Now().Add(-s.ttl))
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list unused build caches")
+			return
+		}
+
+		deleted := 0
+		for _, cache := range caches {
+			if err := s.delete(cache); err != nil {
+				logrus.WithError(err).WithField("cache_id", cache.ID).Warn("Failed to delete unused build cache")
+				continue
+			}
+			deleted++
+		}
+		if deleted > 0 {
+			logrus.WithField("caches", deleted).Info("Deleted unused build caches")
+		}
+	})
+}
+
+// cacheObjectKey is the storage key of a cache archive
+func cacheObjectKey(cache *models.BuildCache) string {
+	if cache.Scope != "" {
+		return fmt.Sprintf("caches/%d/%s/%s/%s.tar.gz", cache.ProjectID, cache.Scope, cache.Name, cache.Key)
+	}
+	return fmt.Sprintf("caches/%d/%s/%s.tar.gz", cache.ProjectID, cache.Name, cache.Key)
+}
+
+func (s *CacheService) checkOwner(projectID, ownerID uint) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return errors.New("project not found")
+	}
+
+	if project.OwnerID != ownerID {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+func (s *CacheService) checkMember(projectID, userID uint) error {
+	member, err := s.projectRepo.IsMember(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
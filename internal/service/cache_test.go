@@ -0,0 +1,132 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"ys-cloud/internal/models"
+)
+
+func TestValidateStepCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		cache   StepCache
+		wantErr string
+	}{
+		{name: "absolute path", cache: StepCache{Name: "go-build", Path: "/root/.cache/go-build", Key: "go-{{ checksum go.sum }}"}},
+		{name: "workspace path", cache: StepCache{Name: "node_modules", Path: "node_modules", Key: "{{ branch }}-{{ checksum package-lock.json }}"}},
+		{name: "quoted glob pattern", cache: StepCache{Name: "m2", Path: ".m2", Key: `maven-{{ checksum "**/pom.xml" }}`}},
+		{name: "static key", cache: StepCache{Name: "tools", Path: "/opt/tools", Key: "v1"}},
+		{name: "invalid name", cache: StepCache{Name: "go build", Path: "/cache", Key: "v1"}, wantErr: `invalid cache name "go build"`},
+		{name: "name with path", cache: StepCache{Name: "../cache", Path: "/cache", Key: "v1"}, wantErr: `invalid cache name "../cache"`},
+		{name: "empty path", cache: StepCache{Name: "deps", Key: "v1"}, wantErr: "cache deps: path must be absolute or inside the workspace"},
+		{name: "home path", cache: StepCache{Name: "deps", Path: "~/.npm", Key: "v1"}, wantErr: "cache deps: path must be absolute or inside the workspace"},
+		{name: "path outside the workspace", cache: StepCache{Name: "deps", Path: "../deps", Key: "v1"}, wantErr: "cache deps: path must be absolute or inside the workspace"},
+		{name: "root path", cache: StepCache{Name: "deps", Path: "/", Key: "v1"}, wantErr: "cache deps: path must be absolute or inside the workspace"},
+		{name: "workspace itself", cache: StepCache{Name: "deps", Path: ".", Key: "v1"}, wantErr: "cache deps: path must be absolute or inside the workspace"},
+		{name: "absolute workspace", cache: StepCache{Name: "deps", Path: "/workspace/", Key: "v1"}, wantErr: "cache deps: path must be absolute or inside the workspace"},
+		{name: "empty key", cache: StepCache{Name: "deps", Path: "deps", Key: "  "}, wantErr: "cache deps: key is required"},
+		{name: "branch with arguments", cache: StepCache{Name: "deps", Path: "deps", Key: "{{ branch main }}"}, wantErr: "cache deps: {{ branch main }} takes no arguments"},
+		{name: "checksum without patterns", cache: StepCache{Name: "deps", Path: "deps", Key: "{{ checksum }}"}, wantErr: "cache deps: {{ checksum }} needs file patterns"},
+		{name: "checksum outside the workspace", cache: StepCache{Name: "deps", Path: "deps", Key: "{{ checksum ../go.sum }}"}, wantErr: "cache deps: checksum pattern ../go.sum must be inside the workspace"},
+		{name: "absolute checksum pattern", cache: StepCache{Name: "deps", Path: "deps", Key: "{{ checksum /etc/passwd }}"}, wantErr: "cache deps: checksum pattern /etc/passwd must be inside the workspace"},
+		{name: "invalid checksum pattern", cache: StepCache{Name: "deps", Path: "deps", Key: "{{ checksum [a-.lock }}"}, wantErr: "cache deps: invalid checksum pattern [a-.lock"},
+		{name: "unknown variable", cache: StepCache{Name: "deps", Path: "deps", Key: "{{ commit }}"}, wantErr: "cache deps: unknown key variable {{ commit }}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStepCache(tt.cache)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateStepCache() error = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateStepCache() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderCacheKey(t *testing.T) {
+	workspace := t.TempDir()
+	files := map[string]string{
+		"go.sum":                "golang.org/x/sync v0.7.0 h1:abc\n",
+		"web/package-lock.json": `{"lockfileVersion": 3}`,
+		"api/package-lock.json": `{"lockfileVersion": 2}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(workspace, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checksum := func(names ...string) string {
+		hash := sha256.New()
+		for _, name := range names {
+			hash.Write([]byte(name + "\x00" + files[name]))
+		}
+		return hex.EncodeToString(hash.Sum(nil))[:16]
+	}
+
+	branch := ImageBuild{Branch: "feature/login"}
+	tests := []struct {
+		name     string
+		template string
+		build    ImageBuild
+		want     string
+		wantErr  bool
+	}{
+		{name: "static", template: "v1", build: branch, want: "v1"},
+		{name: "branch", template: "deps-{{ branch }}", build: branch, want: "deps-feature-login"},
+		{name: "tag build", template: "{{branch}}", build: ImageBuild{Branch: "main", Tag: "v1.2.0"}, want: "v1.2.0"},
+		{name: "checksum", template: "go-{{ checksum go.sum }}", build: branch, want: "go-" + checksum("go.sum")},
+		{name: "checksum of a glob", template: "npm-{{ checksum */package-lock.json }}", build: branch, want: "npm-" + checksum("api/package-lock.json", "web/package-lock.json")},
+		{name: "checksum of several patterns", template: `{{ checksum "web/package-lock.json" api/package-lock.json }}`, build: branch, want: checksum("api/package-lock.json", "web/package-lock.json")},
+		{name: "duplicate matches", template: "{{ checksum go.sum go.* }}", build: branch, want: checksum("go.sum")},
+		{name: "invalid characters", template: "deps @ {{ branch }}!", build: branch, want: "deps-feature-login"},
+		{name: "truncated", template: strings.Repeat("k", 200), build: branch, want: strings.Repeat("k", 128)},
+		{name: "no matching files", template: "{{ checksum yarn.lock }}", build: branch, wantErr: true},
+		{name: "empty after sanitizing", template: "{{ branch }}", build: ImageBuild{Branch: "//"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderCacheKey(tt.template, tt.build, workspace)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("renderCacheKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("renderCacheKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCacheObjectKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		build ImageBuild
+		want  string
+	}{
+		{name: "branch build", build: ImageBuild{ProjectID: 7, Branch: "main"}, want: "caches/7/deps/v1.tar.gz"},
+		{name: "pull request build", build: ImageBuild{ProjectID: 7, Branch: "fix", PullRequest: 12}, want: "caches/7/pull-12/deps/v1.tar.gz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := &models.BuildCache{ProjectID: tt.build.ProjectID, Scope: cacheScope(tt.build), Name: "deps", Key: "v1"}
+			if got := cacheObjectKey(cache); got != tt.want {
+				t.Errorf("cacheObjectKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/crypto"
+)
+
+// CertificateService stores uploaded TLS certificates whose private keys are encrypted at rest
+type CertificateService struct {
+	certificateRepo *repository.CertificateRepository
+	projectRepo     *repository.ProjectRepository
+	deploymentRepo  *repository.DeploymentRepository
+	cipher          *crypto.Cipher
+}
+
+type CertificateInput struct {
+	Name        string
+	Certificate string // PEM encoded chain, leaf first
+	PrivateKey  string // PEM encoded
+}
+
+func NewCertificateService(certificateRepo *repository.CertificateRepository, projectRepo *repository.ProjectRepository, deploymentRepo *repository.DeploymentRepository, cipher *crypto.Cipher) *CertificateService {
+	return &CertificateService{
+		certificateRepo: certificateRepo,
+		projectRepo:     projectRepo,
+		deploymentRepo:  deploymentRepo,
+		cipher:          cipher,
+	}
+}
+
+func (s *CertificateService) Create(projectID uint, input CertificateInput, ownerID uint) (*models.Certificate, error) {
+	if err := s.checkOwner(projectID, ownerID); err != nil {
+		return nil, err
+	}
+	if input.Name == "" {
+		return nil, errors.New("certificate name is required")
+	}
+
+	pair, err := tls.X509KeyPair([]byte(input.Certificate), []byte(input.PrivateKey))
+	if err != nil {
+		return nil, errors.New("certificate and private key do not form a valid key pair")
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, errors.New("invalid certificate")
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return nil, errors.New("certificate has expired")
+	}
+
+	key, err := s.cipher.Encrypt(input.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	certificate := &models.Certificate{
+		ProjectID:   projectID,
+		Name:        input.Name,
+		Certificate: input.Certificate,
+		PrivateKey:  key,
+		Domains:     strings.Join(leaf.DNSNames, ","),
+		ExpiresAt:   leaf.NotAfter,
+		CreatedBy:   ownerID,
+	}
+	if err := s.certificateRepo.Create(certificate); err != nil {
+		return nil, err
+	}
+
+	return certificate, nil
+}
+
+func (s *CertificateService) GetByID(id, userID uint) (*models.Certificate, error) {
+	certificate, err := s.certificateRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("certificate not found")
+	}
+	if err := s.checkMember(certificate.ProjectID, userID); err != nil {
+		return nil, err
+	}
+	return certificate, nil
+}
+
+func (s *CertificateService) GetByProjectID(projectID, userID uint) ([]*models.Certificate, error) {
+	if err := s.checkMember(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.certificateRepo.GetByProjectID(projectID)
+}
+
+func (s *CertificateService) Delete(id, ownerID uint) error {
+	certificate, err := s.certificateRepo.GetByID(id)
+	if err != nil {
+		return errors.New("certificate not found")
+	}
+	if err := s.checkOwner(certificate.ProjectID, ownerID); err != nil {
+		return err
+	}
+	if err := s.checkUnused(certificate); err != nil {
+		return err
+	}
+	return s.certificateRepo.Delete(id)
+}
+
+// checkUnused refuses certificates that the running version of a workload, or a deployment in
+// progress, serves its ingress with
+func (s *CertificateService) checkUnused(certificate *models.Certificate) error {
+	deployments, err := s.deploymentRepo.GetActiveByProject(certificate.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	live := make(map[string]bool)
+	for _, deployment := range deployments {
+		if deployment.Status == "success" {
+			workload := fmt.Sprintf("%s/%s/%s", clusterName(deployment.ClusterID), deployment.Namespace, deployment.ServiceName)
+			// Only the latest success of a workload is still running
+			if live[workload] {
+				continue
+			}
+			live[workload] = true
+		}
+
+		spec, err := parseDeploymentSpec(deployment.Spec)
+		if err != nil {
+			continue
+		}
+		if spec.Ingress != nil && spec.Ingress.TLS != nil && spec.Ingress.TLS.CertificateID != nil &&
+			*spec.Ingress.TLS.CertificateID == certificate.ID {
+			return fmt.Errorf("certificate is in use by deployment %d", deployment.ID)
+		}
+	}
+	return nil
+}
+
+// CheckProject verifies that a certificate was uploaded for the given project
+func (s *CertificateService) CheckProject(id, projectID uint) error {
+	certificate, err := s.certificateRepo.GetByID(id)
+	if err != nil || certificate.ProjectID != projectID {
+		return errors.New("certificate not found")
+	}
+	return nil
+}
+
+// KeyPair returns the PEM encoded certificate and decrypted private key of a project's certificate
+func (s *CertificateService) KeyPair(id, projectID uint) ([]byte, []byte, error) {
+	certificate, err := s.certificateRepo.GetByID(id)
+	if err != nil || certificate.ProjectID != projectID {
+		return nil, nil, errors.New("certificate not found")
+	}
+
+	key, err := s.cipher.Decrypt(certificate.PrivateKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(certificate.Certificate), []byte(key), nil
+}
+
+// checkCertificateHosts verifies that a PEM encoded certificate is valid for every host
+func checkCertificateHosts(certificate []byte, hosts []string) error {
+	block, _ := pem.Decode(certificate)
+	if block == nil {
+		return errors.New("invalid certificate")
+	}
+	leaf, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.New("invalid certificate")
+	}
+
+	for _, host := range hosts {
+		if err := leaf.VerifyHostname(host); err != nil {
+			return fmt.Errorf("certificate does not cover host %s", host)
+		}
+	}
+	return nil
+}
+
+func (s *CertificateService) checkOwner(projectID, ownerID uint) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return errors.New("project not found")
+	}
+
+	if project.OwnerID != ownerID {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+func (s *CertificateService) checkMember(projectID, userID uint) error {
+	member, err := s.projectRepo.IsMember(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/crypto"
+
+	"gorm.io/gorm"
+)
+
+type ClusterService struct {
+	clusterRepo *repository.ClusterRepository
+	cipher      *crypto.Cipher
+	cfg         *config.Config
+	defaultK8s  *K8sService
+
+	mu      sync.Mutex
+	clients map[uint]*K8sService
+}
+
+type ClusterInput struct {
+	Name        string
+	Description string
+	AuthType    string
+	Server      string
+	CAData      string
+	Insecure    bool
+	Kubeconfig  string
+	Token       string
+}
+
+func NewClusterService(clusterRepo *repository.ClusterRepository, cipher *crypto.Cipher, cfg *config.Config, defaultK8s *K8sService) *ClusterService {
+	return &ClusterService{
+		clusterRepo: clusterRepo,
+		cipher:      cipher,
+		cfg:         cfg,
+		defaultK8s:  defaultK8s,
+		clients:     make(map[uint]*K8sService),
+	}
+}
+
+func (s *ClusterService) Create(input ClusterInput) (*models.Cluster, error) {
+	cluster := &models.Cluster{}
+	if err := s.assign(cluster, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.Create(cluster); err != nil {
+		return nil, err
+	}
+
+	return cluster, nil
+}
+
+func (s *ClusterService) GetByID(id uint) (*models.Cluster, error) {
+	return s.clusterRepo.GetByID(id)
+}
+
+func (s *ClusterService) List() ([]*models.Cluster, error) {
+	return s.clusterRepo.List()
+}
+
+func (s *ClusterService) Update(id uint, input ClusterInput) (*models.Cluster, error) {
+	cluster, err := s.clusterRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keep the stored credentials unless new ones are supplied
+	if input.Kubeconfig == "" && input.Token == "" && input.AuthType == cluster.AuthType {
+		kubeconfig, err := s.cipher.Decrypt(cluster.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		token, err := s.cipher.Decrypt(cluster.Token)
+		if err != nil {
+			return nil, err
+		}
+		input.Kubeconfig, input.Token = kubeconfig, token
+	}
+
+	if err := s.assign(cluster, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.clusterRepo.Update(cluster); err != nil {
+		return nil, err
+	}
+
+	s.forget(id)
+	return cluster, nil
+}
+
+func (s *ClusterService) Delete(id uint) error {
+	count, err := s.clusterRepo.CountBindings(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("cluster is still bound to environments")
+	}
+
+	// Environments, unfinished deployments and previews still to be torn down need the cluster to
+	// reach their workloads. Finished deployments only keep the cluster ID as history.
+	count, err = s.clusterRepo.CountEnvironments(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("cluster is still used by environments")
+	}
+	count, err = s.clusterRepo.CountActiveDeployments(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("cluster still has deployments in progress")
+	}
+	count, err = s.clusterRepo.CountOpenPreviews(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("cluster still hosts preview environments")
+	}
+
+	if err := s.clusterRepo.Delete(id); err != nil {
+		return err
+	}
+
+	s.forget(id)
+	return nil
+}
+
+// CheckConnectivity connects to the cluster and returns the version of its API server
+func (s *ClusterService) CheckConnectivity(id uint) (string, error) {
+	s.forget(id)
+
+	client, err := s.Client(&id)
+	if err != nil {
+		return "", err
+	}
+
+	return client.ServerVersion()
+}
+
+func (s *ClusterService) ListBindings() ([]*models.ClusterBinding, error) {
+	return s.clusterRepo.ListBindings()
+}
+
+func (s *ClusterService) SetBinding(environment string, clusterID uint, namespace string) (*models.ClusterBinding, error) {
+	if environment == "" {
+		return nil, errors.New("environment is required")
+	}
+
+	if _, err := s.clusterRepo.GetByID(clusterID); err != nil {
+		return nil, errors.New("cluster not found")
+	}
+
+	binding, err := s.clusterRepo.GetBindingByEnvironment(environment)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		binding = &models.ClusterBinding{Environment: environment}
+	} else if err != nil {
+		return nil, err
+	}
+
+	binding.ClusterID = clusterID
+	binding.Namespace = namespace
+	binding.Cluster = models.Cluster{}
+	if err := s.clusterRepo.SaveBinding(binding); err != nil {
+		return nil, err
+	}
+
+	return s.clusterRepo.GetBindingByEnvironment(environment)
+}
+
+func (s *ClusterService) DeleteBinding(environment string) error {
+	return s.clusterRepo.DeleteBinding(environment)
+}
+
+// Resolve returns the cluster and namespace an environment deploys to. Environments
+// without a binding use the default cluster and an empty namespace.
+func (s *ClusterService) Resolve(environment string) (*uint, string, error) {
+	binding, err := s.clusterRepo.GetBindingByEnvironment(environment)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	clusterID := binding.ClusterID
+	return &clusterID, binding.Namespace, nil
+}
+
+// Client returns the Kubernetes client of a cluster, or the default client for a nil ID
+func (s *ClusterService) Client(clusterID *uint) (*K8sService, error) {
+	if clusterID == nil {
+		if s.defaultK8s == nil {
+			return nil, errors.New("kubernetes service not available")
+		}
+		return s.defaultK8s, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if client, ok := s.clients[*clusterID]; ok {
+		return client, nil
+	}
+
+	cluster, err := s.clusterRepo.GetByID(*clusterID)
+	if err != nil {
+		return nil, errors.New("cluster not found")
+	}
+
+	client, err := s.connect(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	s.clients[*clusterID] = client
+	return client, nil
+}
+
+func (s *ClusterService) connect(cluster *models.Cluster) (*K8sService, error) {
+	switch cluster.AuthType {
+	case "kubeconfig":
+		kubeconfig, err := s.cipher.Decrypt(cluster.Kubeconfig)
+		if err != nil {
+			return nil, err
+		}
+		return NewK8sServiceFromKubeconfig([]byte(kubeconfig), s.cfg)
+	case "token":
+		token, err := s.cipher.Decrypt(cluster.Token)
+		if err != nil {
+			return nil, err
+		}
+		return NewK8sServiceFromToken(cluster.Server, token, []byte(cluster.CAData), cluster.Insecure, s.cfg)
+	default:
+		return nil, errors.New("unsupported cluster auth type")
+	}
+}
+
+func (s *ClusterService) assign(cluster *models.Cluster, input ClusterInput) error {
+	if input.Name == "" {
+		return errors.New("cluster name is required")
+	}
+
+	switch input.AuthType {
+	case "kubeconfig":
+		if input.Kubeconfig == "" {
+			return errors.New("kubeconfig is required")
+		}
+		input.Token = ""
+	case "token":
+		if input.Server == "" || input.Token == "" {
+			return errors.New("server and token are required")
+		}
+		input.Kubeconfig = ""
+	default:
+		return errors.New("unsupported cluster auth type")
+	}
+
+	kubeconfig, err := s.cipher.Encrypt(input.Kubeconfig)
+	if err != nil {
+		return err
+	}
+	token, err := s.cipher.Encrypt(input.Token)
+	if err != nil {
+		return err
+	}
+
+	cluster.Name = input.Name
+	cluster.Description = input.Description
+	cluster.AuthType = input.AuthType
+	cluster.Server = input.Server
+	cluster.CAData = input.CAData
+	cluster.Insecure = input.Insecure
+	cluster.Kubeconfig = kubeconfig
+	cluster.Token = token
+	return nil
+}
+
+// forget drops the cached client so the next use reconnects with the stored credentials
+func (s *ClusterService) forget(id uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, id)
+}
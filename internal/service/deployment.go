@@ -2,27 +2,74 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"time"
+	"ys-cloud/internal/config"
 	"ys-cloud/internal/models"
 	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+
+	"gorm.io/gorm"
 )
 
 type DeploymentService struct {
-	deploymentRepo *repository.DeploymentRepository
-	buildRepo      *repository.BuildRepository
-	k8sService     *K8sService
+	deploymentRepo     *repository.DeploymentRepository
+	buildRepo          *repository.BuildRepository
+	environmentRepo    *repository.EnvironmentRepository
+	approvalRepo       *repository.ApprovalRepository
+	projectRepo        *repository.ProjectRepository
+	freezeService      *FreezeService
+	clusterService     *ClusterService
+	certificateService *CertificateService
+	registryService    *RegistryCredentialService
+	artifactService    *ArtifactService
+	gitService         *GitService
+	readyTimeout       time.Duration
+	blueGreenRetention time.Duration
+	approvalTTL        time.Duration
+	clusterKinds       []string // cluster-scoped kinds manifest and Helm deployments may apply
+	installation       string   // labels the cluster resources of this installation
 }
 
-func NewDeploymentService(deploymentRepo *repository.DeploymentRepository, k8sService *K8sService) *DeploymentService {
+func NewDeploymentService(deploymentRepo *repository.DeploymentRepository, buildRepo *repository.BuildRepository, environmentRepo *repository.EnvironmentRepository, approvalRepo *repository.ApprovalRepository, projectRepo *repository.ProjectRepository, freezeService *FreezeService, clusterService *ClusterService, certificateService *CertificateService, registryService *RegistryCredentialService, artifactService *ArtifactService, gitService *GitService, cfg *config.Config) *DeploymentService {
 	return &DeploymentService{
-		deploymentRepo: deploymentRepo,
-		k8sService:     k8sService,
+		deploymentRepo:     deploymentRepo,
+		buildRepo:          buildRepo,
+		environmentRepo:    environmentRepo,
+		approvalRepo:       approvalRepo,
+		projectRepo:        projectRepo,
+		freezeService:      freezeService,
+		clusterService:     clusterService,
+		certificateService: certificateService,
+		registryService:    registryService,
+		artifactService:    artifactService,
+		gitService:         gitService,
+		readyTimeout:       parseDuration(cfg.K8s.ReadyTimeout, 10*time.Minute),
+		blueGreenRetention: parseDuration(cfg.K8s.BlueGreenRetention, 30*time.Minute),
+		approvalTTL:        parseDuration(cfg.Approval.TTL, 24*time.Hour),
+		clusterKinds:       splitList(cfg.K8s.ManifestClusterKinds),
+		installation:       cfg.K8s.InstallationID,
 	}
 }
 
-func (s *DeploymentService) Create(buildID uint, environment string, replicas int32, namespace, serviceName, ingressHost string) (*models.Deployment, error) {
+type CreateDeploymentInput struct {
+	BuildID      uint
+	Environment  string
+	Replicas     int32
+	Namespace    string
+	ServiceName  string
+	IngressHost  string
+	Type         string
+	Strategy     string
+	CanaryWeight int
+	Spec         *DeploymentSpec
+	RequestedBy  uint
+	Override     bool // deploy through active freeze windows
+}
+
+func (s *DeploymentService) Create(input CreateDeploymentInput) (*models.Deployment, error) {
 	// Check if build exists
-	build, err := s.buildRepo.GetByID(buildID)
+	build, err := s.buildRepo.GetByID(input.BuildID)
 	if err != nil {
 		return nil, errors.New("build not found")
 	}
@@ -31,15 +78,213 @@ func (s *DeploymentService) Create(buildID uint, environment string, replicas in
 	if build.Status != "success" {
 		return nil, errors.New("build was not successful")
 	}
+	if build.ScanStatus == "blocked" {
+		return nil, errors.New("build is blocked by its vulnerability scan")
+	}
+	if build.ImageDeletedAt != nil {
+		return nil, errors.New("build image was deleted by the retention policy")
+	}
+
+	member, err := s.projectRepo.IsMember(build.Pipeline.ProjectID, input.RequestedBy)
+	if err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, errors.New("access denied")
+	}
+
+	// Check if the environment is defined for the project
+	environment, err := s.environmentRepo.GetByProjectAndName(build.Pipeline.ProjectID, input.Environment)
+	if err != nil {
+		return nil, errors.New("environment not found")
+	}
+
+	// Freeze windows block deployments unless an admin overrides them
+	if !input.Override {
+		if err := s.freezeService.Check(environment.ProjectID, environment.ID, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// Target the environment's cluster, falling back to the cluster bound to its name
+	clusterID, namespace, err := s.clusterService.Resolve(environment.Name)
+	if err != nil {
+		return nil, err
+	}
+	if environment.ClusterID != nil {
+		clusterID = environment.ClusterID
+	}
+	if environment.Namespace != "" {
+		namespace = environment.Namespace
+	}
+
+	if namespace == "" {
+		namespace = "default"
+		if client, err := s.clusterService.Client(clusterID); err == nil {
+			namespace = client.DefaultNamespace()
+		}
+	}
+	// Deployments stay in the namespace their environment maps to
+	if input.Namespace != "" && input.Namespace != namespace {
+		return nil, fmt.Errorf("deployments to %s must use namespace %s", environment.Name, namespace)
+	}
+	input.Namespace = namespace
+	if input.Replicas <= 0 {
+		input.Replicas = environment.DefaultReplicas
+	}
+	if input.ServiceName == "" {
+		input.ServiceName = k8s.SanitizeName(build.Pipeline.Name)
+	}
+	if input.IngressHost == "" && environment.IngressDomain != "" {
+		input.IngressHost = input.ServiceName + "." + environment.IngressDomain
+	}
+
+	switch input.Type {
+	case "":
+		input.Type = "kubernetes"
+	case "kubernetes":
+	case "helm":
+		// Helm performs its own rolling upgrade of the chart's workloads
+		if input.Strategy != "" && input.Strategy != "rolling" {
+			return nil, errors.New("helm deployments only support the rolling strategy")
+		}
+		if input.Spec == nil || input.Spec.Helm == nil {
+			return nil, errors.New("helm deployments require chart settings")
+		}
+	case "manifests", "kustomize":
+		// Manifests define their own workloads, which are updated in place when applied
+		if input.Strategy != "" && input.Strategy != "rolling" {
+			return nil, errors.New("manifest deployments only support the rolling strategy")
+		}
+		if input.Spec == nil || input.Spec.Manifests == nil {
+			return nil, errors.New("manifest deployments require manifest settings")
+		}
+	default:
+		return nil, errors.New("unsupported deployment type")
+	}
+
+	switch input.Strategy {
+	case "":
+		input.Strategy = "rolling"
+	case "rolling", "blue_green":
+	case "canary":
+		if input.IngressHost == "" {
+			return nil, errors.New("canary deployments require an ingress host")
+		}
+		if input.CanaryWeight <= 0 {
+			input.CanaryWeight = defaultCanaryWeight
+		}
+		if input.CanaryWeight > 100 {
+			return nil, errors.New("canary weight must be between 0 and 100")
+		}
+	default:
+		return nil, errors.New("unsupported deployment strategy")
+	}
+
+	if input.Spec != nil {
+		if err := input.Spec.validate(); err != nil {
+			return nil, err
+		}
+		if err := s.checkIngressSpec(input.Spec.Ingress, input.Type, build.Pipeline.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+	spec, err := input.Spec.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	deployment := &models.Deployment{
+		BuildID:        input.BuildID,
+		Environment:    environment.Name,
+		EnvironmentID:  &environment.ID,
+		Status:         "pending",
+		Type:           input.Type,
+		Strategy:       input.Strategy,
+		CanaryWeight:   input.CanaryWeight,
+		Replicas:       input.Replicas,
+		Namespace:      input.Namespace,
+		ServiceName:    input.ServiceName,
+		IngressHost:    input.IngressHost,
+		Spec:           spec,
+		ClusterID:      clusterID,
+		FreezeOverride: input.Override,
+	}
+
+	// Deployments to protected environments wait for approval before they can start
+	requiredApprovals := environment.RequiredApprovals
+	if environment.Protected {
+		deployment.Status = "awaiting_approval"
+		if requiredApprovals <= 0 {
+			requiredApprovals = 1
+		}
+		if err := s.checkApprovers(environment, input.RequestedBy, requiredApprovals); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.deploymentRepo.Create(deployment); err != nil {
+		return nil, err
+	}
+
+	if environment.Protected {
+		request := &models.ApprovalRequest{
+			DeploymentID:      deployment.ID,
+			EnvironmentID:     environment.ID,
+			RequestedBy:       input.RequestedBy,
+			Status:            "pending",
+			RequiredApprovals: requiredApprovals,
+			ExpiresAt:         time.Now().Add(s.approvalTTL),
+		}
+		if err := s.approvalRepo.Create(request); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.deploymentRepo.GetByID(deployment.ID)
+}
+
+// checkApprovers refuses a deployment that could never collect its approvals, e.g. when the
+// requester is the only project member
+func (s *DeploymentService) checkApprovers(environment *models.Environment, requestedBy uint, required int) error {
+	var members []uint
+	if len(environment.Approvers) == 0 {
+		var err error
+		if members, err = s.projectRepo.GetMemberIDs(environment.ProjectID); err != nil {
+			return errors.New("project not found")
+		}
+	}
+	if len(eligibleApprovers(*environment, members, requestedBy)) < required {
+		return errors.New("not enough approvers besides the requester for this protected environment")
+	}
+	return nil
+}
+
+// CreatePreview records a rolling deployment of a pull request build into its preview
+// namespace. Previews sit outside the project's environments, so approvals and freeze
+// windows do not apply to them.
+func (s *DeploymentService) CreatePreview(build *models.Build, clusterID *uint, namespace, host string) (*models.Deployment, error) {
+	if build.Status != "success" {
+		return nil, errors.New("build was not successful")
+	}
+	if build.ScanStatus == "blocked" {
+		return nil, errors.New("build is blocked by its vulnerability scan")
+	}
+	if build.ImageDeletedAt != nil {
+		return nil, errors.New("build image was deleted by the retention policy")
+	}
 
 	deployment := &models.Deployment{
-		BuildID:     buildID,
-		Environment: environment,
+		BuildID:     build.ID,
+		Environment: "preview",
 		Status:      "pending",
-		Replicas:    replicas,
+		Type:        "kubernetes",
+		Strategy:    "rolling",
+		Replicas:    1,
 		Namespace:   namespace,
-		ServiceName: serviceName,
-		IngressHost: ingressHost,
+		ServiceName: k8s.SanitizeName(build.Pipeline.Name),
+		IngressHost: host,
+		ClusterID:   clusterID,
 	}
 
 	if err := s.deploymentRepo.Create(deployment); err != nil {
@@ -57,8 +302,86 @@ func (s *DeploymentService) GetByBuildID(buildID uint) ([]*models.Deployment, er
 	return s.deploymentRepo.GetByBuildID(buildID)
 }
 
-func (s *DeploymentService) GetByEnvironment(environment string) ([]*models.Deployment, error) {
-	return s.deploymentRepo.GetByEnvironment(environment)
+func (s *DeploymentService) GetByEnvironment(environmentID uint) ([]*models.Deployment, error) {
+	return s.deploymentRepo.GetByEnvironment(environmentID)
+}
+
+func (s *DeploymentService) GetByEnvironmentName(environment string) ([]*models.Deployment, error) {
+	return s.deploymentRepo.GetByEnvironmentName(environment)
+}
+
+// Promote deploys the build last deployed successfully to an environment into the target
+// environment, which defaults to the next one in the project's promotion order
+func (s *DeploymentService) Promote(environmentID uint, targetID *uint, requestedBy uint, override bool) (*models.Deployment, error) {
+	source, err := s.environmentRepo.GetByID(environmentID)
+	if err != nil {
+		return nil, errors.New("environment not found")
+	}
+
+	var target *models.Environment
+	if targetID != nil {
+		target, err = s.environmentRepo.GetByID(*targetID)
+		if err != nil || target.ProjectID != source.ProjectID {
+			return nil, errors.New("target environment not found")
+		}
+	} else {
+		target, err = s.environmentRepo.GetNext(source)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("environment is the last in the promotion order")
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if target.ID == source.ID {
+		return nil, errors.New("cannot promote an environment to itself")
+	}
+
+	current, err := s.deploymentRepo.GetLatestByEnvironment(source.ID, "success")
+	if err != nil {
+		return nil, errors.New("no successful deployment to promote")
+	}
+
+	spec, err := parseDeploymentSpec(current.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Carry the release over; placement and sizing come from the target environment
+	deployment, err := s.Create(CreateDeploymentInput{
+		BuildID:      current.BuildID,
+		Environment:  target.Name,
+		ServiceName:  current.ServiceName,
+		Type:         current.Type,
+		Strategy:     current.Strategy,
+		CanaryWeight: current.CanaryWeight,
+		Spec:         spec,
+		RequestedBy:  requestedBy,
+		Override:     override,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if deployment.Status == "awaiting_approval" {
+		return deployment, nil
+	}
+
+	if err := s.StartDeployment(deployment.ID); err != nil {
+		return nil, err
+	}
+
+	return s.deploymentRepo.GetByID(deployment.ID)
+}
+
+// MarkNamespaceDeleted records that the deployments into a namespace are gone with it, so they no
+// longer count as live workloads
+func (s *DeploymentService) MarkNamespaceDeleted(clusterID *uint, namespace string) error {
+	return s.deploymentRepo.MarkNamespaceDeleted(clusterID, namespace)
+}
+
+func (s *DeploymentService) MarkWorkloadDeleted(clusterID *uint, namespace, serviceName string) error {
+	return s.deploymentRepo.MarkWorkloadDeleted(clusterID, namespace, serviceName)
 }
 
 func (s *DeploymentService) UpdateStatus(id uint, status string) error {
@@ -70,24 +393,57 @@ func (s *DeploymentService) List(offset, limit int) ([]*models.Deployment, error
 }
 
 func (s *DeploymentService) StartDeployment(id uint) error {
-	deployment, err := s.deploymentRepo.GetByID(id)
+	client, deployment, err := s.begin(id)
 	if err != nil {
 		return err
 	}
 
+	go s.execute(client, deployment)
+	return nil
+}
+
+// Deploy rolls a deployment out in the foreground and returns it with its final status
+func (s *DeploymentService) Deploy(id uint) (*models.Deployment, error) {
+	client, deployment, err := s.begin(id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.execute(client, deployment)
+	return s.deploymentRepo.GetByID(id)
+}
+
+// begin checks that a deployment may start and marks it as running
+func (s *DeploymentService) begin(id uint) (*K8sService, *models.Deployment, error) {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if deployment.Status == "awaiting_approval" {
+		return nil, nil, errors.New("deployment is awaiting approval")
+	}
+	if err := s.checkFreeze(deployment, deployment.FreezeOverride); err != nil {
+		return nil, nil, err
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	now := time.Now()
 	deployment.Status = "running"
 	deployment.StartedAt = &now
 
 	if err := s.deploymentRepo.Update(deployment); err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// TODO: Start actual deployment process
-	return nil
+	return client, deployment, nil
 }
 
-func (s *DeploymentService) CompleteDeployment(id uint, status string) error {
+func (s *DeploymentService) CompleteDeployment(id uint, status, message string) error {
 	deployment, err := s.deploymentRepo.GetByID(id)
 	if err != nil {
 		return err
@@ -95,6 +451,7 @@ func (s *DeploymentService) CompleteDeployment(id uint, status string) error {
 
 	now := time.Now()
 	deployment.Status = status
+	deployment.Message = message
 	deployment.CompletedAt = &now
 
 	return s.deploymentRepo.Update(deployment)
@@ -104,12 +461,280 @@ func (s *DeploymentService) CancelDeployment(id uint) error {
 	return s.deploymentRepo.UpdateStatus(id, "cancelled")
 }
 
-func (s *DeploymentService) Rollback(id uint) error {
+// Rollback reverts a deployment. revision selects a Helm release revision and is ignored
+// for other deployment types; 0 means the revision before this deployment.
+func (s *DeploymentService) Rollback(id uint, revision int, override bool) error {
 	deployment, err := s.deploymentRepo.GetByID(id)
 	if err != nil {
 		return err
 	}
+	if err := s.checkProtected(deployment, override); err != nil {
+		return err
+	}
+	if err := s.checkFreeze(deployment, override); err != nil {
+		return err
+	}
+	if err := s.checkRollbackImage(deployment, revision); err != nil {
+		return err
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return err
+	}
+
+	switch deployment.Type {
+	case "helm":
+		return s.rollbackHelm(client, deployment, revision)
+	case "manifests", "kustomize":
+		return errors.New("manifest deployments are rolled back by redeploying an earlier build")
+	}
+	if deployment.Strategy == "blue_green" {
+		return s.switchBack(client, deployment)
+	}
+	if deployment.Strategy == "canary" && deployment.Status == "canary" {
+		return s.AbortCanary(id)
+	}
 
 	// TODO: Implement rollback logic
-	return s.k8sService.RollbackDeployment(deployment.Namespace, deployment.ServiceName)
+	return client.RollbackDeployment(deployment.Namespace, deployment.ServiceName)
+}
+
+// checkRollbackImage refuses rollbacks to a build whose image the retention policy deleted from the registry
+func (s *DeploymentService) checkRollbackImage(deployment *models.Deployment, revision int) error {
+	if deployment.StartedAt == nil && revision <= 0 {
+		return nil
+	}
+	target, err := s.deploymentRepo.GetRollbackTarget(deployment, revision)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// The target was not deployed through ys-cloud
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if target.Build.ImageDeletedAt != nil {
+		return fmt.Errorf("the image of build %d was deleted by the retention policy, redeploy a newer build instead", target.BuildID)
+	}
+	return nil
+}
+
+func (s *DeploymentService) GetPods(id uint) ([]k8s.PodInfo, error) {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.ListDeploymentPods(deployment.Namespace, workloadName(deployment))
+}
+
+func (s *DeploymentService) GetEvents(id uint) ([]k8s.EventInfo, error) {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.ListDeploymentEvents(deployment.Namespace, workloadName(deployment))
+}
+
+func (s *DeploymentService) SetCanaryWeight(id uint, weight int, override bool) (*models.Deployment, error) {
+	deployment, client, err := s.activeCanary(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkFreeze(deployment, override); err != nil {
+		return nil, err
+	}
+
+	if err := client.SetCanaryWeight(deployment.Namespace, deployment.ServiceName, weight); err != nil {
+		return nil, err
+	}
+
+	deployment.CanaryWeight = weight
+	if err := s.deploymentRepo.Update(deployment); err != nil {
+		return nil, err
+	}
+
+	return deployment, nil
+}
+
+func (s *DeploymentService) PromoteCanary(id uint, override bool) error {
+	deployment, client, err := s.activeCanary(id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkProtected(deployment, override); err != nil {
+		return err
+	}
+	if err := s.checkFreeze(deployment, override); err != nil {
+		return err
+	}
+
+	opts, err := s.deploymentOptions(client, deployment)
+	if err != nil {
+		return err
+	}
+
+	// Move the primary to the canary version before the canary stops taking traffic
+	if err := client.UpdateDeployment(opts); err != nil {
+		return err
+	}
+	if err := client.WaitForDeploymentReady(opts.Namespace, opts.Name, s.readyTimeout); err != nil {
+		return err
+	}
+	if err := client.DeleteCanary(deployment.Namespace, deployment.ServiceName); err != nil {
+		return err
+	}
+	s.recordAppliedState(deployment)
+
+	return s.CompleteDeployment(id, "success", "canary promoted")
+}
+
+func (s *DeploymentService) AbortCanary(id uint) error {
+	deployment, client, err := s.activeCanary(id)
+	if err != nil {
+		return err
+	}
+
+	if err := client.DeleteCanary(deployment.Namespace, deployment.ServiceName); err != nil {
+		return err
+	}
+
+	return s.CompleteDeployment(id, "aborted", "canary aborted")
+}
+
+func (s *DeploymentService) activeCanary(id uint) (*models.Deployment, *K8sService, error) {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if deployment.Strategy != "canary" || deployment.Status != "canary" {
+		return nil, nil, errors.New("deployment is not an active canary")
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return deployment, client, nil
+}
+
+// checkFreeze refuses to change a deployment while its environment is frozen, e.g. to start it
+// after a late approval, unless an admin overrides it
+func (s *DeploymentService) checkFreeze(deployment *models.Deployment, override bool) error {
+	if override || deployment.EnvironmentID == nil {
+		return nil
+	}
+
+	return s.freezeService.CheckEnvironment(*deployment.EnvironmentID, time.Now())
+}
+
+// checkProtected refuses changes to deployments in protected environments that did not go
+// through approval, unless an admin overrides it
+func (s *DeploymentService) checkProtected(deployment *models.Deployment, override bool) error {
+	if override || deployment.EnvironmentID == nil {
+		return nil
+	}
+
+	environment, err := s.environmentRepo.GetByID(*deployment.EnvironmentID)
+	if err != nil {
+		return errors.New("environment not found")
+	}
+	if !environment.Protected {
+		return nil
+	}
+
+	request, err := s.approvalRepo.GetByDeploymentID(deployment.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if request == nil || request.Status != "approved" {
+		return errors.New("changes to a protected environment require an approved deployment")
+	}
+
+	return nil
+}
+
+// CheckMember refuses access to the deployments of projects the user is not a member of
+func (s *DeploymentService) CheckMember(id uint, userID uint) error {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return errors.New("deployment not found")
+	}
+
+	member, err := s.projectRepo.IsMember(deployment.Build.Pipeline.ProjectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+// client returns the Kubernetes client of the cluster a deployment targets
+func (s *DeploymentService) client(deployment *models.Deployment) (*K8sService, error) {
+	return s.clusterService.Client(deployment.ClusterID)
+}
+
+// Scale changes the replica count of a deployment unless an autoscaler manages it
+func (s *DeploymentService) Scale(id uint, replicas int32, override bool) (*models.Deployment, error) {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkProtected(deployment, override); err != nil {
+		return nil, err
+	}
+	if err := s.checkFreeze(deployment, override); err != nil {
+		return nil, err
+	}
+
+	switch deployment.Type {
+	case "helm":
+		return nil, errors.New("helm releases are scaled through chart values")
+	case "manifests", "kustomize":
+		return nil, errors.New("manifest deployments are scaled through their manifests")
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	name := workloadName(deployment)
+	managed, err := client.HorizontalPodAutoscalerExists(deployment.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	if managed {
+		return nil, errors.New("replica count is managed by a horizontal pod autoscaler")
+	}
+
+	if err := client.ScaleDeployment(deployment.Namespace, name, replicas); err != nil {
+		return nil, err
+	}
+
+	deployment.Replicas = replicas
+	if deployment.Status == "success" {
+		s.recordAppliedState(deployment)
+	}
+	if err := s.deploymentRepo.Update(deployment); err != nil {
+		return nil, err
+	}
+
+	return deployment, nil
 }
\ No newline at end of file
@@ -0,0 +1,472 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+	"ys-cloud/internal/models"
+	"ys-cloud/pkg/k8s"
+	"ys-cloud/pkg/registry"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultServicePort   int32 = 80
+	defaultContainerPort int32 = 8080
+	defaultCanaryWeight        = 5
+)
+
+// execute rolls the deployment out to the cluster and records the outcome
+func (s *DeploymentService) execute(client *K8sService, deployment *models.Deployment) {
+	var err error
+	switch {
+	case deployment.Type == "helm":
+		err = s.deployHelm(client, deployment)
+	case deployment.Type == "manifests" || deployment.Type == "kustomize":
+		err = s.deployManifests(client, deployment)
+	case deployment.Strategy == "blue_green":
+		err = s.deployBlueGreen(client, deployment)
+	case deployment.Strategy == "canary":
+		err = s.deployCanary(client, deployment)
+	default:
+		err = s.deployRolling(client, deployment)
+	}
+
+	status, message := "success", ""
+	if deployment.Strategy == "canary" {
+		// A canary stays open until it is promoted or aborted
+		status = "canary"
+	}
+	if err != nil {
+		status, message = "failed", err.Error()
+		logrus.WithError(err).WithField("deployment_id", deployment.ID).Error("Deployment failed")
+	} else if status == "success" && deployment.Type == "kubernetes" {
+		s.recordAppliedState(deployment)
+	}
+
+	if err := s.CompleteDeployment(deployment.ID, status, message); err != nil {
+		logrus.WithError(err).WithField("deployment_id", deployment.ID).Error("Failed to record deployment result")
+	}
+}
+
+// deploymentOptions renders the workload options of a deployment. The registry credentials of the
+// project are applied to the namespace as the image pull secret of the workload.
+func (s *DeploymentService) deploymentOptions(client *K8sService, deployment *models.Deployment) (k8s.DeploymentOptions, error) {
+	opts, err := s.workloadOptions(deployment)
+	if err != nil {
+		return k8s.DeploymentOptions{}, err
+	}
+
+	pullSecret, err := s.ensureRegistrySecret(client, deployment)
+	if err != nil {
+		return k8s.DeploymentOptions{}, err
+	}
+	if pullSecret != "" {
+		opts.ImagePullSecrets = []string{pullSecret}
+	}
+
+	if opts.Verifier, err = s.imageVerifier(deployment); err != nil {
+		return k8s.DeploymentOptions{}, err
+	}
+
+	return opts, nil
+}
+
+// workloadOptions renders the workload of a deployment from its build and spec alone
+func (s *DeploymentService) workloadOptions(deployment *models.Deployment) (k8s.DeploymentOptions, error) {
+	if deployment.Build.ImageName == "" {
+		return k8s.DeploymentOptions{}, errors.New("build has no image")
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return k8s.DeploymentOptions{}, err
+	}
+
+	opts := k8s.DeploymentOptions{
+		Name:      deployment.ServiceName,
+		Namespace: deployment.Namespace,
+		Image:     deployment.Build.ImageName,
+		Tag:       imageTag(deployment.Build),
+		Replicas:  deployment.Replicas,
+		Port:      defaultContainerPort,
+		Owner:     s.resourceOwner(deployment),
+	}
+	if err := spec.apply(&opts); err != nil {
+		return k8s.DeploymentOptions{}, err
+	}
+	return opts, nil
+}
+
+// imageVerifier returns the verifier refusing unsigned images, nil when they may be deployed
+func (s *DeploymentService) imageVerifier(deployment *models.Deployment) (k8s.ImageVerifier, error) {
+	if s.artifactService == nil {
+		return nil, nil
+	}
+
+	var auths []registry.Auth
+	if s.registryService != nil {
+		var err error
+		if auths, err = s.registryService.Auths(deployment.Build.Pipeline.ProjectID); err != nil {
+			return nil, err
+		}
+	}
+	return s.artifactService.Verifier(auths), nil
+}
+
+// ensureRegistrySecret stores the credentials for the registry of the deployment's image in its
+// namespace and returns the secret name, or "" when the project has no credentials for it. Each
+// workload gets its own secret, so it never holds credentials for other registries or projects.
+func (s *DeploymentService) ensureRegistrySecret(client *K8sService, deployment *models.Deployment) (string, error) {
+	if s.registryService == nil {
+		return "", nil
+	}
+
+	auth, err := s.registryService.PullAuth(deployment.Build.Pipeline.ProjectID, deployment.Build.ImageName)
+	if err != nil || auth == nil {
+		return "", err
+	}
+
+	dockerConfig, err := registry.DockerConfigJSON([]registry.Auth{*auth})
+	if err != nil {
+		return "", err
+	}
+	name := k8s.RegistrySecretName(deployment.ServiceName)
+	if err := client.ApplyRegistrySecret(deployment.Namespace, name, dockerConfig, k8s.Owner{Installation: s.installation, ProjectID: deployment.Build.Pipeline.ProjectID}); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// StartRegistryRefresher periodically renews the image pull secrets of live workloads whose
+// registry credentials are short-lived, such as ECR tokens, which expire after 12 hours
+func (s *DeploymentService) StartRegistryRefresher(interval time.Duration) {
+	if s.registryService == nil {
+		return
+	}
+	every(interval, func() {
+		deployments, err := s.deploymentRepo.ListLive()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list live deployments")
+			return
+		}
+
+		for _, deployment := range deployments {
+			expires, err := s.registryService.Expires(deployment.Build.Pipeline.ProjectID, deployment.Build.ImageName)
+			if err != nil || !expires {
+				continue
+			}
+			client, err := s.client(deployment)
+			if err == nil {
+				_, err = s.ensureRegistrySecret(client, deployment)
+			}
+			if err != nil {
+				logrus.WithError(err).WithField("deployment_id", deployment.ID).Error("Failed to refresh registry secret")
+			}
+		}
+	})
+}
+
+func (s *DeploymentService) deployRolling(client *K8sService, deployment *models.Deployment) error {
+	opts, err := s.deploymentOptions(client, deployment)
+	if err != nil {
+		return err
+	}
+
+	exists, err := client.DeploymentExists(opts.Namespace, opts.Name)
+	if err != nil {
+		return err
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+
+	if exists {
+		if err := client.UpdateDeployment(opts); err != nil {
+			return err
+		}
+		// An autoscaler owns the replica count, so only scale manually without one
+		if opts.Replicas > 0 && spec.Autoscaling == nil {
+			if err := client.ScaleDeployment(opts.Namespace, opts.Name, opts.Replicas); err != nil {
+				return err
+			}
+		}
+	} else if err := client.Deploy(opts); err != nil {
+		return err
+	}
+
+	if err := client.WaitForDeploymentReady(opts.Namespace, opts.Name, s.readyTimeout); err != nil {
+		return err
+	}
+
+	if err := s.syncAutoscaler(client, opts.Namespace, opts.Name, spec, opts.Owner); err != nil {
+		return err
+	}
+
+	if err := client.ApplyService(k8s.ServiceOptions{
+		Name:       opts.Name,
+		Namespace:  opts.Namespace,
+		Port:       defaultServicePort,
+		TargetPort: opts.Port,
+		Ports:      k8s.AdditionalPorts(opts.Ports),
+		Type:       corev1.ServiceTypeClusterIP,
+		Owner:      opts.Owner,
+	}); err != nil {
+		return err
+	}
+
+	return s.ensureIngress(client, deployment)
+}
+
+func (s *DeploymentService) deployBlueGreen(client *K8sService, deployment *models.Deployment) error {
+	opts, err := s.deploymentOptions(client, deployment)
+	if err != nil {
+		return err
+	}
+
+	result, err := client.DeployBlueGreen(k8s.BlueGreenOptions{
+		Deployment:   opts,
+		ServicePort:  defaultServicePort,
+		ReadyTimeout: s.readyTimeout,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Keep the previous color running for instant switch-back until the retention expires
+	deployment.Color = result.ActiveColor
+	if result.PreviousColor != "" {
+		s.scheduleRetirement(deployment, result.PreviousColor, result.PreviousImage)
+	}
+	if err := s.deploymentRepo.Update(deployment); err != nil {
+		return err
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	if err := s.syncAutoscaler(client, opts.Namespace, k8s.ColorDeploymentName(opts.Name, result.ActiveColor), spec, opts.Owner); err != nil {
+		return err
+	}
+
+	return s.ensureIngress(client, deployment)
+}
+
+func (s *DeploymentService) deployCanary(client *K8sService, deployment *models.Deployment) error {
+	opts, err := s.deploymentOptions(client, deployment)
+	if err != nil {
+		return err
+	}
+
+	// The canary ingress shares the host of the primary one
+	if err := s.ensureIngress(client, deployment); err != nil {
+		return err
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	className := ""
+	if spec.Ingress != nil {
+		className = spec.Ingress.ClassName
+	}
+
+	err = client.DeployCanary(k8s.CanaryOptions{
+		Deployment:   opts,
+		Host:         deployment.IngressHost,
+		ClassName:    className,
+		TLS:          canaryTLS(deployment, spec),
+		ServicePort:  defaultServicePort,
+		Weight:       deployment.CanaryWeight,
+		ReadyTimeout: s.readyTimeout,
+	})
+	if err != nil {
+		// Leave the primary serving alone rather than a canary that never became ready
+		if cleanupErr := client.DeleteCanary(deployment.Namespace, deployment.ServiceName); cleanupErr != nil {
+			logrus.WithError(cleanupErr).WithField("deployment_id", deployment.ID).Warn("Failed to remove failed canary")
+		}
+		return err
+	}
+	return nil
+}
+
+// switchBack routes the service back to the color that was live before the deployment
+func (s *DeploymentService) switchBack(client *K8sService, deployment *models.Deployment) error {
+	activeColor, err := client.GetActiveColor(deployment.Namespace, deployment.ServiceName)
+	if err != nil {
+		return err
+	}
+	if activeColor == "" {
+		return errors.New("service is not using blue/green deployments")
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	opts := k8s.DeploymentOptions{Port: defaultContainerPort}
+	if err := spec.apply(&opts); err != nil {
+		return err
+	}
+
+	color := k8s.OppositeColor(activeColor)
+	image, err := client.GetDeploymentImage(deployment.Namespace, k8s.ColorDeploymentName(deployment.ServiceName, activeColor))
+	if err != nil {
+		return err
+	}
+	if err := client.SwitchColor(deployment.Namespace, deployment.ServiceName, color, defaultServicePort, opts.Port, k8s.AdditionalPorts(opts.Ports), s.resourceOwner(deployment)); err != nil {
+		return err
+	}
+
+	// The color switched away from is retired like the previous color of a rollout
+	deployment.Color = color
+	s.scheduleRetirement(deployment, activeColor, image)
+	if err := s.deploymentRepo.Update(deployment); err != nil {
+		return err
+	}
+	s.recordAppliedState(deployment)
+	return nil
+}
+
+// scheduleRetirement records when the inactive color of a blue/green deployment is deleted
+func (s *DeploymentService) scheduleRetirement(deployment *models.Deployment, color, image string) {
+	retireAt := time.Now().Add(s.blueGreenRetention)
+	deployment.RetireColor = color
+	deployment.RetireImage = image
+	deployment.RetireAt = &retireAt
+}
+
+// StartRetirer periodically deletes the inactive blue/green colors whose retention has expired.
+// Retirements are stored with their deployments, so they survive restarts, and wait out freeze
+// windows so a frozen environment keeps its color to switch back to.
+func (s *DeploymentService) StartRetirer(interval time.Duration) {
+	every(interval, func() {
+		deployments, err := s.deploymentRepo.ListRetiring(time.Now())
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list retiring blue/green colors")
+			return
+		}
+
+		for _, deployment := range deployments {
+			if err := s.checkFreeze(deployment, false); err != nil {
+				logrus.WithError(err).WithField("deployment_id", deployment.ID).Debug("Postponing blue/green retirement")
+				continue
+			}
+			client, err := s.client(deployment)
+			if err == nil {
+				err = client.RetireColor(deployment.Namespace, deployment.ServiceName, deployment.RetireColor, deployment.RetireImage)
+			}
+			if err != nil {
+				logrus.WithError(err).WithFields(logrus.Fields{
+					"service": deployment.ServiceName,
+					"color":   deployment.RetireColor,
+				}).Error("Failed to retire previous blue/green color")
+				continue
+			}
+			if err := s.deploymentRepo.ClearRetirement(deployment.ID); err != nil {
+				logrus.WithError(err).WithField("deployment_id", deployment.ID).Error("Failed to clear blue/green retirement")
+			}
+		}
+	})
+}
+
+// recordAppliedState stores the workload rendered for a finished rollout as the state drift is
+// measured against. Reading it back from the cluster would accept changes made during the rollout
+// as intended. Failures only disable drift detection for the deployment.
+func (s *DeploymentService) recordAppliedState(deployment *models.Deployment) {
+	var state *k8s.WorkloadState
+	opts, err := s.workloadOptions(deployment)
+	if err == nil {
+		opts.Name = workloadName(deployment)
+		state, err = k8s.RenderWorkloadState(opts)
+	}
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(state); err == nil {
+			deployment.AppliedState = string(data)
+			err = s.deploymentRepo.UpdateAppliedState(deployment.ID, deployment.AppliedState)
+		}
+	}
+	if err != nil {
+		logrus.WithError(err).WithField("deployment_id", deployment.ID).Warn("Failed to record applied workload state")
+	}
+}
+
+// syncAutoscaler creates, updates or removes the autoscaler of a workload to match the spec
+func (s *DeploymentService) syncAutoscaler(client *K8sService, namespace, name string, spec *DeploymentSpec, owner k8s.Owner) error {
+	if spec.Autoscaling == nil {
+		return client.DeleteHorizontalPodAutoscaler(namespace, name)
+	}
+	return client.ApplyHorizontalPodAutoscaler(namespace, name, *spec.Autoscaling, owner)
+}
+
+// checkoutBuild clones the project repository at the commit a build was made from and
+// returns the workspace path; callers remove it with gitService.Cleanup
+func (s *DeploymentService) checkoutBuild(buildID uint) (string, error) {
+	build, err := s.buildRepo.GetByID(buildID)
+	if err != nil {
+		return "", errors.New("build not found")
+	}
+
+	project := build.Pipeline.Project
+	repo, err := s.gitService.CloneSources(project.GitURL, "", pullRequestRef(project.GitProvider, build.PullRequest), build.Branch, build.CommitHash)
+	if err != nil {
+		return "", err
+	}
+	return repo.RepoPath, nil
+}
+
+// resourceOwner labels the cluster resources of a deployment so that garbage collection can
+// find them once the project, environment or deployment is gone
+func (s *DeploymentService) resourceOwner(deployment *models.Deployment) k8s.Owner {
+	owner := k8s.Owner{
+		Installation: s.installation,
+		ProjectID:    deployment.Build.Pipeline.ProjectID,
+		DeploymentID: deployment.ID,
+	}
+	if deployment.EnvironmentID != nil {
+		owner.EnvironmentID = *deployment.EnvironmentID
+	}
+	return owner
+}
+
+// imageTag returns the tag deployments of a build run. Pushed images are pinned to their digest,
+// e.g. main-1a2b3c4@sha256:..., so that re-pushing the tag cannot change what is running.
+func imageTag(build models.Build) string {
+	if build.ImageDigest == "" {
+		return build.ImageTag
+	}
+	return build.ImageTag + "@" + build.ImageDigest
+}
+
+// imageReference returns the full reference of the image of a build
+func imageReference(build models.Build) string {
+	if tag := imageTag(build); tag != "" {
+		return build.ImageName + ":" + tag
+	}
+	return build.ImageName
+}
+
+// workloadName returns the name of the Kubernetes Deployment currently serving a deployment
+func workloadName(deployment *models.Deployment) string {
+	if deployment.Strategy == "blue_green" && deployment.Color != "" {
+		return k8s.ColorDeploymentName(deployment.ServiceName, deployment.Color)
+	}
+	return deployment.ServiceName
+}
+
+// parseDuration parses a configured duration, falling back when it is empty or invalid
+func parseDuration(value string, fallback time.Duration) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return fallback
+	}
+	return duration
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"ys-cloud/internal/models"
+	"ys-cloud/pkg/k8s"
+)
+
+const (
+	defaultHelmImageRepositoryKey = "image.repository"
+	defaultHelmImageTagKey        = "image.tag"
+)
+
+// HelmSpec describes the chart a helm deployment installs. The chart comes either from a
+// directory of the project repository at the build's commit, or from a chart repository.
+type HelmSpec struct {
+	ReleaseName        string                 `json:"release_name,omitempty"` // defaults to the service name
+	ChartPath          string                 `json:"chart_path,omitempty"`   // chart directory within the project repository
+	Chart              string                 `json:"chart,omitempty"`        // chart name within RepoURL, or an oci:// reference
+	RepoURL            string                 `json:"repo_url,omitempty"`
+	Version            string                 `json:"version,omitempty"`
+	Values             map[string]interface{} `json:"values,omitempty"`
+	ImageRepositoryKey string                 `json:"image_repository_key,omitempty"` // value path receiving the build image, defaults to image.repository
+	ImageTagKey        string                 `json:"image_tag_key,omitempty"`        // value path receiving the build tag, defaults to image.tag
+}
+
+func (spec *HelmSpec) validate() error {
+	switch {
+	case spec.ChartPath != "" && spec.Chart != "":
+		return errors.New("helm chart_path and chart are mutually exclusive")
+	case spec.ChartPath != "":
+		if !filepath.IsLocal(spec.ChartPath) {
+			return errors.New("helm chart_path must be a relative path within the repository")
+		}
+	case spec.Chart != "":
+		if spec.RepoURL == "" && !strings.HasPrefix(spec.Chart, "oci://") {
+			return errors.New("helm chart requires a repo_url unless it is an oci:// reference")
+		}
+	default:
+		return errors.New("helm deployments require a chart_path or chart")
+	}
+	return nil
+}
+
+// values merges the build image into the configured chart values
+func (spec *HelmSpec) values(build models.Build) map[string]interface{} {
+	values := copyValues(spec.Values)
+
+	repositoryKey, tagKey := spec.ImageRepositoryKey, spec.ImageTagKey
+	if repositoryKey == "" {
+		repositoryKey = defaultHelmImageRepositoryKey
+	}
+	if tagKey == "" {
+		tagKey = defaultHelmImageTagKey
+	}
+
+	if build.ImageName != "" {
+		setValue(values, repositoryKey, build.ImageName)
+	}
+	if tag := imageTag(build); tag != "" {
+		setValue(values, tagKey, tag)
+	}
+	return values
+}
+
+func (s *DeploymentService) deployHelm(client *K8sService, deployment *models.Deployment) error {
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	if spec.Helm == nil {
+		return errors.New("helm deployment has no chart settings")
+	}
+	// Every image of the rendered chart is verified, not only the build image
+	verifier, err := s.imageVerifier(deployment)
+	if err != nil {
+		return err
+	}
+
+	opts := k8s.HelmOptions{
+		ReleaseName:  helmReleaseName(deployment, spec.Helm),
+		Namespace:    deployment.Namespace,
+		Chart:        spec.Helm.Chart,
+		RepoURL:      spec.Helm.RepoURL,
+		Version:      spec.Helm.Version,
+		Values:       spec.Helm.values(deployment.Build),
+		Wait:         true,
+		Timeout:      s.readyTimeout,
+		Owner:        s.resourceOwner(deployment),
+		ClusterKinds: s.clusterKinds,
+		Verifier:     verifier,
+	}
+
+	// Charts kept in the project repository are taken from the commit the build was made from
+	if spec.Helm.ChartPath != "" {
+		repoPath, err := s.checkoutBuild(deployment.BuildID)
+		if err != nil {
+			return err
+		}
+		defer s.gitService.Cleanup(repoPath)
+
+		opts.Chart = filepath.Join(repoPath, spec.Helm.ChartPath)
+		opts.RepoURL = ""
+	}
+
+	release, err := client.HelmUpgradeInstall(opts)
+	if err != nil {
+		return err
+	}
+
+	deployment.HelmRevision = release.Revision
+	return s.deploymentRepo.Update(deployment)
+}
+
+// rollbackHelm returns the release to the given revision, or to the one preceding this deployment
+func (s *DeploymentService) rollbackHelm(client *K8sService, deployment *models.Deployment, revision int) error {
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	if spec.Helm == nil {
+		return errors.New("helm deployment has no chart settings")
+	}
+
+	if revision <= 0 {
+		if deployment.HelmRevision <= 1 {
+			return errors.New("no previous release revision to roll back to")
+		}
+		revision = deployment.HelmRevision - 1
+	}
+
+	release, err := client.HelmRollback(deployment.Namespace, helmReleaseName(deployment, spec.Helm), revision, true, s.readyTimeout)
+	if err != nil {
+		return err
+	}
+
+	// The deployment now runs the revision Helm created for the rollback
+	deployment.HelmRevision = release.Revision
+	deployment.Message = fmt.Sprintf("rolled back to revision %d", revision)
+	return s.deploymentRepo.Update(deployment)
+}
+
+// GetReleases returns the Helm release history of a helm deployment
+func (s *DeploymentService) GetReleases(id uint) ([]k8s.HelmRelease, error) {
+	deployment, err := s.deploymentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if deployment.Type != "helm" {
+		return nil, errors.New("deployment is not a helm deployment")
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Helm == nil {
+		return nil, errors.New("helm deployment has no chart settings")
+	}
+
+	client, err := s.client(deployment)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.HelmHistory(deployment.Namespace, helmReleaseName(deployment, spec.Helm))
+}
+
+func helmReleaseName(deployment *models.Deployment, spec *HelmSpec) string {
+	if spec.ReleaseName != "" {
+		return spec.ReleaseName
+	}
+	return deployment.ServiceName
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if nested, ok := value.(map[string]interface{}); ok {
+			value = copyValues(nested)
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// setValue assigns a value at a dotted path such as image.tag, creating intermediate maps
+func setValue(values map[string]interface{}, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		nested, ok := values[key].(map[string]interface{})
+		if !ok {
+			nested = map[string]interface{}{}
+			values[key] = nested
+		}
+		values = nested
+	}
+	values[keys[len(keys)-1]] = value
+}
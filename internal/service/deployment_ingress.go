@@ -0,0 +1,121 @@
+package service
+
+import (
+	"errors"
+	"ys-cloud/internal/models"
+	"ys-cloud/pkg/k8s"
+)
+
+// IngressSpec customises the ingress of a kubernetes deployment. The ingress host of the
+// deployment keeps routing / to its service; rules add further hosts and paths.
+type IngressSpec struct {
+	ClassName string                   `json:"class_name,omitempty"`
+	Rules     []k8s.IngressRuleOptions `json:"rules,omitempty"`
+	TLS       *IngressTLSSpec          `json:"tls,omitempty"`
+}
+
+// IngressTLSSpec serves the ingress hosts over TLS with a certificate provisioned by a
+// cert-manager ClusterIssuer or uploaded to the project
+type IngressTLSSpec struct {
+	ClusterIssuer string `json:"cluster_issuer,omitempty"`
+	CertificateID *uint  `json:"certificate_id,omitempty"`
+}
+
+func (spec *IngressSpec) validate() error {
+	if err := k8s.ValidateIngressRules(spec.Rules); err != nil {
+		return err
+	}
+	if spec.TLS != nil {
+		if spec.TLS.ClusterIssuer == "" && spec.TLS.CertificateID == nil {
+			return errors.New("ingress TLS requires a cluster issuer or a certificate")
+		}
+		if spec.TLS.ClusterIssuer != "" && spec.TLS.CertificateID != nil {
+			return errors.New("ingress TLS takes either a cluster issuer or a certificate, not both")
+		}
+	}
+	return nil
+}
+
+// checkIngressSpec rejects ingress settings the deployment type does not manage and
+// certificates of other projects
+func (s *DeploymentService) checkIngressSpec(spec *IngressSpec, deploymentType string, projectID uint) error {
+	if spec == nil {
+		return nil
+	}
+	if deploymentType != "kubernetes" {
+		return errors.New("ingress settings are only supported for kubernetes deployments")
+	}
+	if spec.TLS != nil && spec.TLS.CertificateID != nil {
+		return s.certificateService.CheckProject(*spec.TLS.CertificateID, projectID)
+	}
+	return nil
+}
+
+// ensureIngress routes the ingress hosts of a deployment to its service, storing an uploaded
+// certificate as the TLS secret of the ingress first
+func (s *DeploymentService) ensureIngress(client *K8sService, deployment *models.Deployment) error {
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	if deployment.IngressHost == "" && (spec.Ingress == nil || len(spec.Ingress.Rules) == 0) {
+		return nil
+	}
+
+	opts := k8s.IngressOptions{
+		Name:        deployment.ServiceName,
+		Namespace:   deployment.Namespace,
+		Host:        deployment.IngressHost,
+		ServiceName: deployment.ServiceName,
+		ServicePort: defaultServicePort,
+		Owner:       s.resourceOwner(deployment),
+	}
+	if deployment.IngressHost != "" {
+		opts.Paths = k8s.PortIngressPaths(spec.Ports)
+	}
+
+	if spec.Ingress != nil {
+		opts.ClassName = spec.Ingress.ClassName
+		opts.Rules = spec.Ingress.Rules
+
+		if tls := spec.Ingress.TLS; tls != nil {
+			opts.TLS = &k8s.IngressTLSOptions{ClusterIssuer: tls.ClusterIssuer}
+			if tls.CertificateID != nil {
+				certificate, key, err := s.certificateService.KeyPair(*tls.CertificateID, deployment.Build.Pipeline.ProjectID)
+				if err != nil {
+					return err
+				}
+				if err := checkCertificateHosts(certificate, ingressHosts(opts)); err != nil {
+					return err
+				}
+				opts.TLS.SecretName = k8s.TLSSecretName(deployment.ServiceName)
+				if err := client.ApplyTLSSecret(opts.Namespace, opts.TLS.SecretName, certificate, key, opts.Owner); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return client.ApplyIngress(opts)
+}
+
+// ingressHosts returns the hosts an ingress serves
+func ingressHosts(opts k8s.IngressOptions) []string {
+	var hosts []string
+	if opts.Host != "" {
+		hosts = append(hosts, opts.Host)
+	}
+	for _, rule := range opts.Rules {
+		hosts = append(hosts, rule.Host)
+	}
+	return hosts
+}
+
+// canaryTLS serves the canary ingress with the certificate Secret of the primary one, which
+// cert-manager or ensureIngress fills
+func canaryTLS(deployment *models.Deployment, spec *DeploymentSpec) *k8s.IngressTLSOptions {
+	if spec.Ingress == nil || spec.Ingress.TLS == nil {
+		return nil
+	}
+	return &k8s.IngressTLSOptions{SecretName: k8s.TLSSecretName(deployment.ServiceName)}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"ys-cloud/internal/models"
+	"ys-cloud/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+)
+
+// imagePlaceholder is replaced with the full build image reference in raw manifests
+const imagePlaceholder = "${IMAGE}"
+
+// ManifestSpec describes the Kubernetes manifests a manifests or kustomize deployment applies.
+// The manifests are read from the project repository at the build's commit.
+type ManifestSpec struct {
+	Path  string `json:"path"`            // manifest file or directory, or kustomization directory, within the repository
+	Image string `json:"image,omitempty"` // image repository replaced with the build image, defaults to the build image name
+}
+
+func (spec *ManifestSpec) validate() error {
+	if spec.Path == "" {
+		return errors.New("manifests path is required")
+	}
+	if !filepath.IsLocal(spec.Path) {
+		return errors.New("manifests path must be a relative path within the repository")
+	}
+	return nil
+}
+
+// deployManifests applies raw manifests or a rendered kustomization with the build image substituted
+func (s *DeploymentService) deployManifests(client *K8sService, deployment *models.Deployment) error {
+	if deployment.Build.ImageName == "" {
+		return errors.New("build has no image")
+	}
+
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return err
+	}
+	if spec.Manifests == nil {
+		return errors.New("manifest deployment has no manifest settings")
+	}
+
+	repoPath, err := s.checkoutBuild(deployment.BuildID)
+	if err != nil {
+		return err
+	}
+	defer s.gitService.Cleanup(repoPath)
+
+	path := filepath.Join(repoPath, spec.Manifests.Path)
+	var manifests []byte
+	if deployment.Type == "kustomize" {
+		manifests, err = k8s.RenderKustomization(path)
+	} else {
+		manifests, err = readManifests(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	verifier, err := s.imageVerifier(deployment)
+	if err != nil {
+		return err
+	}
+
+	image := imageReference(deployment.Build)
+	manifests = bytes.ReplaceAll(manifests, []byte(imagePlaceholder), []byte(image))
+
+	repository := spec.Manifests.Image
+	if repository == "" {
+		repository = deployment.Build.ImageName
+	}
+
+	// Objects the last successful apply created but these manifests no longer contain are pruned
+	var previous []k8s.AppliedResource
+	if last, err := s.deploymentRepo.GetLastApplied(deployment); err == nil && last.Resources != "" {
+		if err := json.Unmarshal([]byte(last.Resources), &previous); err != nil {
+			return fmt.Errorf("failed to read previously applied resources: %w", err)
+		}
+	}
+
+	applied, err := client.ApplyManifests(k8s.ManifestOptions{
+		Namespace:    deployment.Namespace,
+		Manifests:    manifests,
+		Images:       map[string]string{repository: image},
+		Owner:        s.resourceOwner(deployment),
+		ClusterKinds: s.clusterKinds,
+		Prune:        previous,
+		Verifier:     verifier,
+	})
+	if err != nil {
+		return err
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"deployment_id": deployment.ID,
+		"resources":     len(applied),
+	}).Info("Applied deployment manifests")
+
+	resources, err := json.Marshal(applied)
+	if err != nil {
+		return err
+	}
+	deployment.Resources = string(resources)
+	return s.deploymentRepo.Update(deployment)
+}
+
+// readManifests reads a manifest file, or every YAML and JSON file of a directory in name order
+func readManifests(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %w", err)
+	}
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifests: %w", err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("manifests directory contains no YAML or JSON files")
+	}
+	sort.Strings(names)
+
+	var manifests bytes.Buffer
+	for _, name := range names {
+		data, err := os.ReadFile(filepath.Join(path, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifests: %w", err)
+		}
+		manifests.WriteString("\n---\n")
+		manifests.Write(data)
+	}
+	return manifests.Bytes(), nil
+}
+
+// splitList parses a configured comma separated list, dropping blank entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"ys-cloud/pkg/k8s"
+)
+
+// DeploymentSpec holds the container settings of a deployment. It is stored as JSON on
+// models.Deployment so that later rollouts of the same deployment reuse it.
+type DeploymentSpec struct {
+	Ports          []k8s.PortOptions         `json:"ports,omitempty"`
+	LivenessProbe  *k8s.ProbeOptions         `json:"liveness_probe,omitempty"`
+	ReadinessProbe *k8s.ProbeOptions         `json:"readiness_probe,omitempty"`
+	Resources      *k8s.ResourceOptions      `json:"resources,omitempty"`
+	RollingUpdate  *k8s.RollingUpdateOptions `json:"rolling_update,omitempty"`
+	Command        []string                  `json:"command,omitempty"`
+	Args           []string                  `json:"args,omitempty"`
+	Volumes        []k8s.VolumeOptions       `json:"volumes,omitempty"`
+	Autoscaling    *k8s.AutoscalingOptions   `json:"autoscaling,omitempty"`
+	Helm           *HelmSpec                 `json:"helm,omitempty"`
+	Manifests      *ManifestSpec             `json:"manifests,omitempty"`
+	Ingress        *IngressSpec              `json:"ingress,omitempty"`
+}
+
+func parseDeploymentSpec(raw string) (*DeploymentSpec, error) {
+	spec := &DeploymentSpec{}
+	if raw == "" {
+		return spec, nil
+	}
+	if err := json.Unmarshal([]byte(raw), spec); err != nil {
+		return nil, fmt.Errorf("invalid deployment spec: %w", err)
+	}
+	return spec, nil
+}
+
+func (spec *DeploymentSpec) encode() (string, error) {
+	if spec == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// validate renders the spec once so that invalid settings are rejected before the deployment is stored
+func (spec *DeploymentSpec) validate() error {
+	opts := k8s.DeploymentOptions{
+		Name:      "validate",
+		Namespace: "validate",
+		Image:     "validate",
+		Tag:       "latest",
+	}
+	if err := spec.apply(&opts); err != nil {
+		return err
+	}
+	if err := k8s.ValidatePorts(spec.Ports, defaultServicePort); err != nil {
+		return err
+	}
+	if spec.Autoscaling != nil {
+		if err := k8s.ValidateAutoscalingOptions(*spec.Autoscaling); err != nil {
+			return err
+		}
+	}
+	if spec.Helm != nil {
+		if err := spec.Helm.validate(); err != nil {
+			return err
+		}
+	}
+	if spec.Manifests != nil {
+		if err := spec.Manifests.validate(); err != nil {
+			return err
+		}
+	}
+	if spec.Ingress != nil {
+		if err := spec.Ingress.validate(); err != nil {
+			return err
+		}
+	}
+	return k8s.ValidateDeploymentOptions(opts)
+}
+
+func (spec *DeploymentSpec) apply(opts *k8s.DeploymentOptions) error {
+	if spec.Resources != nil {
+		resources, err := spec.Resources.Requirements()
+		if err != nil {
+			return err
+		}
+		opts.Resources = resources
+	}
+
+	opts.Ports = spec.Ports
+	opts.LivenessProbe = spec.LivenessProbe
+	opts.ReadinessProbe = spec.ReadinessProbe
+	opts.RollingUpdate = spec.RollingUpdate
+	opts.Command = spec.Command
+	opts.Args = spec.Args
+	opts.Volumes = spec.Volumes
+
+	if len(spec.Ports) > 0 {
+		opts.Port = spec.Ports[0].ContainerPort
+	}
+
+	return nil
+}
@@ -0,0 +1,317 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// DriftService compares the live workloads of successful deployments with the state ys-cloud
+// applied and records the fields someone changed directly in the cluster
+type DriftService struct {
+	driftRepo      *repository.DriftRepository
+	deploymentRepo *repository.DeploymentRepository
+	projectRepo    *repository.ProjectRepository
+	clusterService *ClusterService
+	freezeService  *FreezeService
+	autoRevert     bool
+
+	// mu keeps detection runs and reverts from overlapping
+	mu sync.Mutex
+}
+
+// DriftCheck is the outcome of comparing one deployment with its live workload
+type DriftCheck struct {
+	DeploymentID uint                    `json:"deployment_id"`
+	InSync       bool                    `json:"in_sync"`
+	Differences  []k8s.DriftDifference   `json:"differences"`
+	Drift        *models.DeploymentDrift `json:"drift,omitempty"`
+}
+
+func NewDriftService(driftRepo *repository.DriftRepository, deploymentRepo *repository.DeploymentRepository, projectRepo *repository.ProjectRepository, clusterService *ClusterService, freezeService *FreezeService, cfg *config.Config) *DriftService {
+	return &DriftService{
+		driftRepo:      driftRepo,
+		deploymentRepo: deploymentRepo,
+		projectRepo:    projectRepo,
+		clusterService: clusterService,
+		freezeService:  freezeService,
+		autoRevert:     cfg.K8s.DriftAutoRevert,
+	}
+}
+
+func (s *DriftService) GetByID(id, userID uint) (*models.DeploymentDrift, error) {
+	drift, err := s.driftRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("drift not found")
+	}
+	if err := s.checkMember(drift.DeploymentID, userID); err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+func (s *DriftService) GetByDeployment(deploymentID, userID uint) ([]*models.DeploymentDrift, error) {
+	if err := s.checkMember(deploymentID, userID); err != nil {
+		return nil, err
+	}
+	return s.driftRepo.GetByDeployment(deploymentID)
+}
+
+// List returns the drifts of the projects the user belongs to
+func (s *DriftService) List(userID uint, status string, offset, limit int) ([]*models.DeploymentDrift, error) {
+	projectIDs, err := s.projectRepo.GetMemberProjectIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.driftRepo.List(projectIDs, status, offset, limit)
+}
+
+// Check compares a live deployment with its workload now and records the result
+func (s *DriftService) Check(deploymentID, userID uint) (*DriftCheck, error) {
+	if err := s.checkMember(deploymentID, userID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployment, err := s.liveDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.check(deployment, false)
+}
+
+// Revert restores the workload of a live deployment to the state ys-cloud applied
+func (s *DriftService) Revert(deploymentID, userID uint) (*DriftCheck, error) {
+	if err := s.checkMember(deploymentID, userID); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployment, err := s.liveDeployment(deploymentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.check(deployment, true)
+}
+
+// DetectAll checks every live deployment, reverting drift when auto-revert is enabled and the
+// environment is not frozen, and resolves the drift of deployments that have since been replaced
+func (s *DriftService) DetectAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deployments, err := s.deploymentRepo.ListLive()
+	if err != nil {
+		return err
+	}
+
+	live := make(map[uint]bool, len(deployments))
+	for _, deployment := range deployments {
+		live[deployment.ID] = true
+		if deployment.AppliedState == "" {
+			continue
+		}
+		if _, err := s.check(deployment, s.autoRevert && !s.frozen(deployment)); err != nil {
+			logrus.WithError(err).WithField("deployment_id", deployment.ID).Warn("Failed to check deployment drift")
+		}
+	}
+
+	open, err := s.driftRepo.ListOpen()
+	if err != nil {
+		return err
+	}
+	for _, drift := range open {
+		if live[drift.DeploymentID] {
+			continue
+		}
+		// A newer deployment replaced the drifted workload
+		if err := s.resolve(drift, "resolved"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// StartDetector periodically checks live deployments for drift in the background
+func (s *DriftService) StartDetector(interval time.Duration) {
+	every(interval, func() {
+		if err := s.DetectAll(); err != nil {
+			logrus.WithError(err).Error("Failed to detect deployment drift")
+		}
+	})
+}
+
+// checkMember verifies that the user belongs to the project of a deployment
+func (s *DriftService) checkMember(deploymentID, userID uint) error {
+	deployment, err := s.deploymentRepo.GetByID(deploymentID)
+	if err != nil {
+		return errors.New("deployment not found")
+	}
+	member, err := s.projectRepo.IsMember(deployment.Build.Pipeline.ProjectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+// frozen reports whether a freeze window holds back automatic changes to a deployment
+func (s *DriftService) frozen(deployment *models.Deployment) bool {
+	if deployment.EnvironmentID == nil {
+		return false
+	}
+	if err := s.freezeService.CheckEnvironment(*deployment.EnvironmentID, time.Now()); err != nil {
+		logrus.WithError(err).WithField("deployment_id", deployment.ID).Info("Not reverting deployment drift")
+		return true
+	}
+	return false
+}
+
+// liveDeployment returns a deployment that still defines its workload; older deployments of the
+// same workload must not be compared or restored
+func (s *DriftService) liveDeployment(id uint) (*models.Deployment, error) {
+	deployments, err := s.deploymentRepo.ListLive()
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		if deployment.ID == id {
+			if deployment.AppliedState == "" {
+				return nil, errors.New("deployment has no recorded applied state")
+			}
+			return deployment, nil
+		}
+	}
+	return nil, errors.New("deployment is not the live release of its workload")
+}
+
+func (s *DriftService) check(deployment *models.Deployment, revert bool) (*DriftCheck, error) {
+	applied := &k8s.WorkloadState{}
+	if err := json.Unmarshal([]byte(deployment.AppliedState), applied); err != nil {
+		return nil, err
+	}
+	spec, err := parseDeploymentSpec(deployment.Spec)
+	if err != nil {
+		return nil, err
+	}
+	// An autoscaler owns the replica count
+	ignoreReplicas := spec.Autoscaling != nil
+
+	client, err := s.clusterService.Client(deployment.ClusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	name := workloadName(deployment)
+	live, err := client.GetWorkloadState(deployment.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var differences []k8s.DriftDifference
+	if live == nil {
+		differences = []k8s.DriftDifference{{Field: "deployment", Applied: "present", Live: "<unset>"}}
+	} else {
+		differences = k8s.CompareWorkloadState(applied, live, ignoreReplicas)
+	}
+
+	drift, err := s.record(deployment, differences)
+	if err != nil {
+		return nil, err
+	}
+
+	if revert && len(differences) > 0 {
+		if live == nil {
+			return nil, errors.New("workload no longer exists, redeploy to restore it")
+		}
+		if err := client.RestoreWorkloadState(deployment.Namespace, name, applied, ignoreReplicas); err != nil {
+			return nil, err
+		}
+		if err := s.resolve(drift, "reverted"); err != nil {
+			return nil, err
+		}
+	}
+
+	return &DriftCheck{
+		DeploymentID: deployment.ID,
+		InSync:       len(differences) == 0,
+		Differences:  differences,
+		Drift:        drift,
+	}, nil
+}
+
+// record opens or updates the drift of a deployment, or resolves it once the workload matches again
+func (s *DriftService) record(deployment *models.Deployment, differences []k8s.DriftDifference) (*models.DeploymentDrift, error) {
+	drift, err := s.driftRepo.GetOpenByDeployment(deployment.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		drift = nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(differences) == 0 {
+		if drift != nil {
+			return drift, s.resolve(drift, "resolved")
+		}
+		return nil, nil
+	}
+
+	data, err := json.Marshal(differences)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if drift == nil {
+		drift = &models.DeploymentDrift{
+			DeploymentID: deployment.ID,
+			Status:       "open",
+			Differences:  string(data),
+			DetectedAt:   now,
+			CheckedAt:    now,
+		}
+		if err := s.driftRepo.Create(drift); err != nil {
+			return nil, err
+		}
+
+		logrus.WithFields(logrus.Fields{
+			"deployment_id": deployment.ID,
+			"namespace":     deployment.Namespace,
+			"service":       deployment.ServiceName,
+			"fields":        len(differences),
+		}).Warn("Deployment drift detected")
+		return drift, nil
+	}
+
+	drift.Differences = string(data)
+	drift.CheckedAt = now
+	if err := s.driftRepo.Update(drift); err != nil {
+		return nil, err
+	}
+	return drift, nil
+}
+
+func (s *DriftService) resolve(drift *models.DeploymentDrift, status string) error {
+	now := time.Now()
+	drift.Status = status
+	drift.CheckedAt = now
+	drift.ResolvedAt = &now
+	return s.driftRepo.Update(drift)
+}
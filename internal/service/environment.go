@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+
+	"gorm.io/gorm"
+)
+
+type EnvironmentService struct {
+	environmentRepo *repository.EnvironmentRepository
+	projectRepo     *repository.ProjectRepository
+	clusterRepo     *repository.ClusterRepository
+}
+
+type EnvironmentInput struct {
+	Name            string
+	ClusterID       *uint
+	Namespace       string
+	IngressDomain   string
+	DefaultReplicas int32
+	Protected       bool
+	Order           int
+
+	// Approval settings for protected environments
+	RequiredApprovals int
+	ApproverIDs       []uint
+}
+
+func NewEnvironmentService(environmentRepo *repository.EnvironmentRepository, projectRepo *repository.ProjectRepository, clusterRepo *repository.ClusterRepository) *EnvironmentService {
+	return &EnvironmentService{
+		environmentRepo: environmentRepo,
+		projectRepo:     projectRepo,
+		clusterRepo:     clusterRepo,
+	}
+}
+
+func (s *EnvironmentService) Create(projectID uint, input EnvironmentInput, ownerID uint) (*models.Environment, error) {
+	if err := s.checkOwner(projectID, ownerID); err != nil {
+		return nil, err
+	}
+
+	// Check if the name is already taken in the project
+	if _, err := s.environmentRepo.GetByProjectAndName(projectID, input.Name); err == nil {
+		return nil, errors.New("environment already exists")
+	}
+
+	environment := &models.Environment{ProjectID: projectID}
+	if err := s.assign(environment, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.environmentRepo.Create(environment); err != nil {
+		return nil, err
+	}
+
+	if err := s.environmentRepo.ReplaceApprovers(environment, input.ApproverIDs); err != nil {
+		return nil, err
+	}
+
+	return s.environmentRepo.GetByID(environment.ID)
+}
+
+func (s *EnvironmentService) GetByID(id uint) (*models.Environment, error) {
+	return s.environmentRepo.GetByID(id)
+}
+
+func (s *EnvironmentService) GetByProjectID(projectID uint) ([]*models.Environment, error) {
+	return s.environmentRepo.GetByProjectID(projectID)
+}
+
+func (s *EnvironmentService) Update(id uint, input EnvironmentInput, ownerID uint) (*models.Environment, error) {
+	environment, err := s.environmentRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkOwner(environment.ProjectID, ownerID); err != nil {
+		return nil, err
+	}
+
+	if input.Name != environment.Name {
+		if _, err := s.environmentRepo.GetByProjectAndName(environment.ProjectID, input.Name); err == nil {
+			return nil, errors.New("environment already exists")
+		}
+	}
+
+	if err := s.assign(environment, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.environmentRepo.Update(environment); err != nil {
+		return nil, err
+	}
+
+	if err := s.environmentRepo.ReplaceApprovers(environment, input.ApproverIDs); err != nil {
+		return nil, err
+	}
+
+	return s.environmentRepo.GetByID(id)
+}
+
+func (s *EnvironmentService) Delete(id uint, ownerID uint) error {
+	environment, err := s.environmentRepo.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkOwner(environment.ProjectID, ownerID); err != nil {
+		return err
+	}
+
+	if environment.Protected {
+		return errors.New("protected environments cannot be deleted")
+	}
+
+	// The environment is hard deleted, so deployments referencing it would be left dangling
+	count, err := s.environmentRepo.CountDeployments(id)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("environment still has deployments")
+	}
+
+	return s.environmentRepo.Delete(id)
+}
+
+// CheckMember refuses access to the environments of projects the user is not a member of
+func (s *EnvironmentService) CheckMember(id uint, userID uint) error {
+	environment, err := s.environmentRepo.GetByID(id)
+	if err != nil {
+		return errors.New("environment not found")
+	}
+
+	isMember, err := s.projectRepo.IsMember(environment.ProjectID, userID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+// Next returns the environment a build in the given environment is promoted to
+func (s *EnvironmentService) Next(environment *models.Environment) (*models.Environment, error) {
+	next, err := s.environmentRepo.GetNext(environment)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("environment is the last in the promotion order")
+	}
+	return next, err
+}
+
+func (s *EnvironmentService) checkOwner(projectID, ownerID uint) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return errors.New("project not found")
+	}
+
+	if project.OwnerID != ownerID {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+func (s *EnvironmentService) assign(environment *models.Environment, input EnvironmentInput) error {
+	if input.Name == "" {
+		return errors.New("environment name is required")
+	}
+	if k8s.SanitizeName(input.Name) != input.Name {
+		return errors.New("environment name must be a lowercase DNS label")
+	}
+
+	if input.ClusterID != nil {
+		if _, err := s.clusterRepo.GetByID(*input.ClusterID); err != nil {
+			return errors.New("cluster not found")
+		}
+	}
+
+	if input.DefaultReplicas <= 0 {
+		input.DefaultReplicas = 1
+	}
+
+	// Approvers must belong to the project; without any, every other project member approves
+	for _, userID := range input.ApproverIDs {
+		member, err := s.projectRepo.IsMember(environment.ProjectID, userID)
+		if err != nil {
+			return err
+		}
+		if !member {
+			return errors.New("approvers must be project members")
+		}
+	}
+	if input.Protected {
+		if input.RequiredApprovals <= 0 {
+			input.RequiredApprovals = 1
+		}
+		if len(input.ApproverIDs) > 0 {
+			if input.RequiredApprovals > len(input.ApproverIDs) {
+				return errors.New("required approvals exceed the number of approvers")
+			}
+		} else {
+			// Requesters cannot approve their own deployments, so one member is always left out
+			members, err := s.projectRepo.GetMemberIDs(environment.ProjectID)
+			if err != nil {
+				return errors.New("project not found")
+			}
+			if input.RequiredApprovals > len(members)-1 {
+				return errors.New("required approvals exceed the project members who can approve")
+			}
+		}
+	} else {
+		input.RequiredApprovals = 0
+	}
+
+	environment.Name = input.Name
+	environment.ClusterID = input.ClusterID
+	environment.Namespace = input.Namespace
+	environment.IngressDomain = input.IngressDomain
+	environment.DefaultReplicas = input.DefaultReplicas
+	environment.Protected = input.Protected
+	environment.RequiredApprovals = input.RequiredApprovals
+	environment.Order = input.Order
+	return nil
+}
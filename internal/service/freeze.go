@@ -0,0 +1,230 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+type FreezeService struct {
+	freezeRepo      *repository.FreezeWindowRepository
+	projectRepo     *repository.ProjectRepository
+	environmentRepo *repository.EnvironmentRepository
+}
+
+type FreezeWindowInput struct {
+	ProjectID     uint
+	EnvironmentID *uint
+	Reason        string
+	Schedule      string
+	Duration      string
+	Timezone      string
+	StartsAt      *time.Time
+	EndsAt        *time.Time
+	Active        bool
+}
+
+func NewFreezeService(freezeRepo *repository.FreezeWindowRepository, projectRepo *repository.ProjectRepository, environmentRepo *repository.EnvironmentRepository) *FreezeService {
+	return &FreezeService{
+		freezeRepo:      freezeRepo,
+		projectRepo:     projectRepo,
+		environmentRepo: environmentRepo,
+	}
+}
+
+func (s *FreezeService) Create(input FreezeWindowInput, createdBy uint) (*models.FreezeWindow, error) {
+	window := &models.FreezeWindow{CreatedBy: createdBy}
+	if err := s.assign(window, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.freezeRepo.Create(window); err != nil {
+		return nil, err
+	}
+
+	return s.freezeRepo.GetByID(window.ID)
+}
+
+func (s *FreezeService) GetByID(id, userID uint) (*models.FreezeWindow, error) {
+	window, err := s.freezeRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("freeze window not found")
+	}
+	if err := s.checkMember(window.ProjectID, userID); err != nil {
+		return nil, err
+	}
+	return window, nil
+}
+
+func (s *FreezeService) GetByProjectID(projectID, userID uint) ([]*models.FreezeWindow, error) {
+	if err := s.checkMember(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.freezeRepo.GetByProjectID(projectID)
+}
+
+func (s *FreezeService) Update(id uint, input FreezeWindowInput) (*models.FreezeWindow, error) {
+	window, err := s.freezeRepo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.assign(window, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.freezeRepo.Update(window); err != nil {
+		return nil, err
+	}
+
+	return s.freezeRepo.GetByID(id)
+}
+
+func (s *FreezeService) Delete(id uint) error {
+	return s.freezeRepo.Delete(id)
+}
+
+// Active returns the freeze window in effect for an environment at the given time, or nil.
+// Malformed windows are logged and skipped rather than freezing the environment indefinitely.
+func (s *FreezeService) Active(projectID, environmentID uint, at time.Time) (*models.FreezeWindow, error) {
+	windows, err := s.freezeRepo.GetApplicable(projectID, environmentID)
+	if err != nil {
+		return nil, err
+	}
+
+	return activeWindow(windows, at), nil
+}
+
+// Check returns an error naming the reason when deployments to the environment are frozen
+func (s *FreezeService) Check(projectID, environmentID uint, at time.Time) error {
+	window, err := s.Active(projectID, environmentID, at)
+	if err != nil {
+		return err
+	}
+	if window != nil {
+		return fmt.Errorf("deployments are frozen: %s", window.Reason)
+	}
+	return nil
+}
+
+// CheckEnvironment is Check for an environment looked up by ID
+func (s *FreezeService) CheckEnvironment(environmentID uint, at time.Time) error {
+	environment, err := s.environmentRepo.GetByID(environmentID)
+	if err != nil {
+		return errors.New("environment not found")
+	}
+
+	return s.Check(environment.ProjectID, environment.ID, at)
+}
+
+func (s *FreezeService) checkMember(projectID, userID uint) error {
+	member, err := s.projectRepo.IsMember(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+func (s *FreezeService) assign(window *models.FreezeWindow, input FreezeWindowInput) error {
+	if input.Reason == "" {
+		return errors.New("freeze reason is required")
+	}
+
+	if _, err := s.projectRepo.GetByID(input.ProjectID); err != nil {
+		return errors.New("project not found")
+	}
+	if input.EnvironmentID != nil {
+		environment, err := s.environmentRepo.GetByID(*input.EnvironmentID)
+		if err != nil || environment.ProjectID != input.ProjectID {
+			return errors.New("environment not found")
+		}
+	}
+
+	switch {
+	case input.Schedule != "":
+		if input.Duration == "" {
+			return errors.New("recurring freeze windows require a duration")
+		}
+		if duration, err := time.ParseDuration(input.Duration); err != nil || duration <= 0 {
+			return errors.New("invalid freeze duration")
+		}
+		if _, err := cron.ParseStandard(input.Schedule); err != nil {
+			return fmt.Errorf("invalid freeze schedule: %w", err)
+		}
+		input.StartsAt, input.EndsAt = nil, nil
+	case input.StartsAt != nil && input.EndsAt != nil:
+		if !input.EndsAt.After(*input.StartsAt) {
+			return errors.New("freeze window must end after it starts")
+		}
+		input.Duration = ""
+	default:
+		return errors.New("freeze window requires a schedule or a start and end time")
+	}
+
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return errors.New("invalid freeze timezone")
+	}
+
+	window.ProjectID = input.ProjectID
+	window.EnvironmentID = input.EnvironmentID
+	window.Reason = input.Reason
+	window.Schedule = input.Schedule
+	window.Duration = input.Duration
+	window.Timezone = input.Timezone
+	window.StartsAt = input.StartsAt
+	window.EndsAt = input.EndsAt
+	window.Active = input.Active
+	return nil
+}
+
+// activeWindow returns the first window in effect at the given time, or nil
+func activeWindow(windows []*models.FreezeWindow, at time.Time) *models.FreezeWindow {
+	for _, window := range windows {
+		inEffect, err := freezeInEffect(window, at)
+		if err != nil {
+			logrus.WithError(err).WithField("freeze_window_id", window.ID).Warn("Skipping malformed freeze window")
+			continue
+		}
+		if inEffect {
+			return window
+		}
+	}
+
+	return nil
+}
+
+// freezeInEffect reports whether a freeze window covers the given time. A recurring window is
+// in effect when one of its schedule activations falls within the last Duration.
+func freezeInEffect(window *models.FreezeWindow, at time.Time) (bool, error) {
+	if window.Schedule == "" {
+		if window.StartsAt == nil || window.EndsAt == nil {
+			return false, nil
+		}
+		return !at.Before(*window.StartsAt) && at.Before(*window.EndsAt), nil
+	}
+
+	schedule, err := cron.ParseStandard(window.Schedule)
+	if err != nil {
+		return false, fmt.Errorf("invalid freeze schedule: %w", err)
+	}
+	duration, err := time.ParseDuration(window.Duration)
+	if err != nil {
+		return false, fmt.Errorf("invalid freeze duration: %w", err)
+	}
+	location, err := time.LoadLocation(window.Timezone)
+	if err != nil {
+		return false, fmt.Errorf("invalid freeze timezone: %w", err)
+	}
+
+	// The first activation after the window's lookback is the one that may still be running
+	start := schedule.Next(at.In(location).Add(-duration))
+	return !start.After(at), nil
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"ys-cloud/internal/models"
+)
+
+func TestFreezeInEffect(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	startsAt, endsAt := at("2024-03-01T00:00:00Z"), at("2024-03-02T00:00:00Z")
+	fixed := &models.FreezeWindow{StartsAt: &startsAt, EndsAt: &endsAt}
+	// Fridays 18:00 until Mondays 08:00
+	weekend := &models.FreezeWindow{Schedule: "0 18 * * 5", Duration: "62h"}
+	shanghai := &models.FreezeWindow{Schedule: "0 18 * * 5", Duration: "62h", Timezone: "Asia/Shanghai"}
+
+	tests := []struct {
+		name    string
+		window  *models.FreezeWindow
+		at      time.Time
+		want    bool
+		wantErr bool
+	}{
+		{name: "before fixed window", window: fixed, at: at("2024-02-29T23:59:59Z"), want: false},
+		{name: "start of fixed window", window: fixed, at: startsAt, want: true},
+		{name: "inside fixed window", window: fixed, at: at("2024-03-01T12:00:00Z"), want: true},
+		{name: "end of fixed window", window: fixed, at: endsAt, want: false},
+		{name: "fixed window without end", window: &models.FreezeWindow{StartsAt: &startsAt}, at: at("2024-03-01T12:00:00Z"), want: false},
+		{name: "before recurring window", window: weekend, at: at("2024-03-08T17:59:00Z"), want: false},
+		{name: "start of recurring window", window: weekend, at: at("2024-03-08T18:00:00Z"), want: true},
+		{name: "inside recurring window", window: weekend, at: at("2024-03-10T12:00:00Z"), want: true},
+		{name: "last minute of recurring window", window: weekend, at: at("2024-03-11T07:59:00Z"), want: true},
+		{name: "end of recurring window", window: weekend, at: at("2024-03-11T08:00:00Z"), want: false},
+		{name: "between recurring windows", window: weekend, at: at("2024-03-13T12:00:00Z"), want: false},
+		{name: "schedule in timezone", window: shanghai, at: at("2024-03-08T10:30:00Z"), want: true},
+		{name: "before schedule in timezone", window: shanghai, at: at("2024-03-08T09:30:00Z"), want: false},
+		{name: "end of schedule in timezone", window: shanghai, at: at("2024-03-11T00:00:00Z"), want: false},
+		{name: "invalid schedule", window: &models.FreezeWindow{Schedule: "every friday", Duration: "1h"}, at: startsAt, wantErr: true},
+		{name: "invalid duration", window: &models.FreezeWindow{Schedule: "0 18 * * 5", Duration: "weekend"}, at: startsAt, wantErr: true},
+		{name: "invalid timezone", window: &models.FreezeWindow{Schedule: "0 18 * * 5", Duration: "1h", Timezone: "Mars/Olympus"}, at: startsAt, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := freezeInEffect(tt.window, tt.at)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("freezeInEffect() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("freezeInEffect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveWindow(t *testing.T) {
+	at := time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC)
+	malformed := &models.FreezeWindow{ID: 1, Schedule: "bogus", Duration: "1h"}
+	weekday := &models.FreezeWindow{ID: 2, Schedule: "0 9 * * 1-5", Duration: "8h"}
+	weekend := &models.FreezeWindow{ID: 3, Schedule: "0 18 * * 5", Duration: "62h"}
+	saturday := &models.FreezeWindow{ID: 4, Schedule: "0 0 * * 6", Duration: "24h"}
+
+	tests := []struct {
+		name    string
+		windows []*models.FreezeWindow
+		want    *models.FreezeWindow
+	}{
+		{name: "no windows", want: nil},
+		{name: "no window in effect", windows: []*models.FreezeWindow{weekday}, want: nil},
+		{name: "window in effect", windows: []*models.FreezeWindow{weekday, weekend}, want: weekend},
+		{name: "first window in effect", windows: []*models.FreezeWindow{saturday, weekend}, want: saturday},
+		{name: "malformed windows are skipped", windows: []*models.FreezeWindow{malformed, weekend}, want: weekend},
+		{name: "only malformed windows", windows: []*models.FreezeWindow{malformed}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := activeWindow(tt.windows, at); got != tt.want {
+				t.Errorf("activeWindow() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
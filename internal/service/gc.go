@@ -0,0 +1,253 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// GarbageCollectionService finds cluster resources labelled for projects, environments,
+// pipelines or deployments that no longer exist and deletes them
+type GarbageCollectionService struct {
+	clusterService  *ClusterService
+	projectRepo     *repository.ProjectRepository
+	environmentRepo *repository.EnvironmentRepository
+	deploymentRepo  *repository.DeploymentRepository
+	installation    string
+	delete          bool // the collector deletes orphans instead of only reporting them
+
+	// mu keeps collection runs from overlapping
+	mu sync.Mutex
+}
+
+func NewGarbageCollectionService(clusterService *ClusterService, projectRepo *repository.ProjectRepository, environmentRepo *repository.EnvironmentRepository, deploymentRepo *repository.DeploymentRepository, cfg *config.Config) *GarbageCollectionService {
+	return &GarbageCollectionService{
+		clusterService:  clusterService,
+		projectRepo:     projectRepo,
+		environmentRepo: environmentRepo,
+		deploymentRepo:  deploymentRepo,
+		installation:    cfg.K8s.InstallationID,
+		delete:          cfg.K8s.GCDelete,
+	}
+}
+
+// OrphanedResource is a managed resource whose owner no longer exists
+type OrphanedResource struct {
+	k8s.ManagedResource
+	ClusterID *uint  `json:"cluster_id"` // nil is the default cluster
+	Reason    string `json:"reason"`
+	Deleted   bool   `json:"deleted"`
+	Error     string `json:"error,omitempty"`
+}
+
+type GarbageReport struct {
+	DryRun    bool                `json:"dry_run"`
+	Orphans   []*OrphanedResource `json:"orphans"`
+	Errors    []string            `json:"errors,omitempty"` // clusters that could not be inspected
+	CheckedAt time.Time           `json:"checked_at"`
+}
+
+// Report lists the orphaned resources of every cluster without deleting anything
+func (s *GarbageCollectionService) Report() (*GarbageReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.run(true)
+}
+
+// Collect deletes the orphaned resources of every cluster. Only resources labelled with this
+// installation's ID are deleted, so the ID must be configured; without it resources of other
+// installations sharing a cluster would look orphaned.
+func (s *GarbageCollectionService) Collect() (*GarbageReport, error) {
+	if s.installation == "" {
+		return nil, errors.New("k8s.installation_id must be configured to delete orphaned resources")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.run(false)
+}
+
+// StartCollector periodically looks for orphaned resources in the background. They are only
+// reported unless k8s.gc_delete is set.
+func (s *GarbageCollectionService) StartCollector(interval time.Duration) {
+	collect, action := s.Report, "Found"
+	if s.delete {
+		collect, action = s.Collect, "Collected"
+	}
+
+	every(interval, func() {
+		report, err := collect()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to collect orphaned Kubernetes resources")
+			if report == nil {
+				return
+			}
+		}
+		if len(report.Orphans) > 0 || len(report.Errors) > 0 {
+			logrus.WithFields(logrus.Fields{
+				"orphans": len(report.Orphans),
+				"errors":  len(report.Errors),
+			}).Info(action + " orphaned Kubernetes resources")
+		}
+	})
+}
+
+func (s *GarbageCollectionService) run(dryRun bool) (*GarbageReport, error) {
+	clusters, err := s.clusterService.List()
+	if err != nil {
+		return nil, err
+	}
+
+	clusterIDs := []*uint{nil}
+	for _, cluster := range clusters {
+		id := cluster.ID
+		clusterIDs = append(clusterIDs, &id)
+	}
+
+	report := &GarbageReport{
+		DryRun:    dryRun,
+		Orphans:   []*OrphanedResource{},
+		CheckedAt: time.Now(),
+	}
+	checker := newOwnerChecker(s)
+
+	for _, clusterID := range clusterIDs {
+		client, err := s.clusterService.Client(clusterID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", clusterName(clusterID), err))
+			continue
+		}
+
+		resources, err := client.ListManagedResources()
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", clusterName(clusterID), err))
+			continue
+		}
+
+		for _, resource := range resources {
+			reason, err := checker.orphaned(resource.Owner)
+			if err != nil {
+				// Report what was already deleted before giving up
+				return report, err
+			}
+			if reason == "" {
+				continue
+			}
+
+			orphan := &OrphanedResource{
+				ManagedResource: resource,
+				ClusterID:       clusterID,
+				Reason:          reason,
+			}
+			if !dryRun {
+				if err := client.DeleteManagedResource(resource); err != nil {
+					orphan.Error = err.Error()
+				} else {
+					orphan.Deleted = true
+				}
+			}
+			report.Orphans = append(report.Orphans, orphan)
+		}
+	}
+
+	return report, nil
+}
+
+func clusterName(clusterID *uint) string {
+	if clusterID == nil {
+		return "default cluster"
+	}
+	return fmt.Sprintf("cluster %d", *clusterID)
+}
+
+// ownerChecker looks up resource owners once per collection run
+type ownerChecker struct {
+	service      *GarbageCollectionService
+	projects     map[uint]bool
+	environments map[uint]bool
+	deployments  map[uint]string
+}
+
+func newOwnerChecker(service *GarbageCollectionService) *ownerChecker {
+	return &ownerChecker{
+		service:      service,
+		projects:     make(map[uint]bool),
+		environments: make(map[uint]bool),
+		deployments:  make(map[uint]string),
+	}
+}
+
+// orphaned returns why a resource's owner is gone, or an empty string while it still exists.
+// Lookup failures other than missing records abort the run so nothing is deleted by mistake.
+func (c *ownerChecker) orphaned(owner k8s.Owner) (string, error) {
+	if owner.ProjectID == 0 {
+		return "", nil
+	}
+
+	exists, ok := c.projects[owner.ProjectID]
+	if !ok {
+		_, err := c.service.projectRepo.GetByID(owner.ProjectID)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", err
+		}
+		exists = err == nil
+		c.projects[owner.ProjectID] = exists
+	}
+	if !exists {
+		return "project deleted", nil
+	}
+
+	if owner.EnvironmentID != 0 {
+		exists, ok := c.environments[owner.EnvironmentID]
+		if !ok {
+			_, err := c.service.environmentRepo.GetByID(owner.EnvironmentID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return "", err
+			}
+			exists = err == nil
+			c.environments[owner.EnvironmentID] = exists
+		}
+		if !exists {
+			return "environment deleted", nil
+		}
+	}
+
+	if owner.DeploymentID != 0 {
+		reason, ok := c.deployments[owner.DeploymentID]
+		if !ok {
+			var err error
+			reason, err = c.deploymentReason(owner.DeploymentID)
+			if err != nil {
+				return "", err
+			}
+			c.deployments[owner.DeploymentID] = reason
+		}
+		return reason, nil
+	}
+
+	return "", nil
+}
+
+func (c *ownerChecker) deploymentReason(id uint) (string, error) {
+	deployment, err := c.service.deploymentRepo.GetByID(id)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return "deployment deleted", nil
+	case err != nil:
+		return "", err
+	case deployment.Build.ID == 0:
+		return "build deleted", nil
+	case deployment.Build.Pipeline.ID == 0:
+		return "pipeline deleted", nil
+	}
+	return "", nil
+}
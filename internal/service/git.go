@@ -1,15 +1,46 @@
 package service
 
 import (
+	"fmt"
+	"ys-cloud/internal/config"
 	"ys-cloud/pkg/git"
 )
 
 type GitService struct {
 	*git.GitService
+	username string
+	password string
 }
 
-func NewGitService() *GitService {
+func NewGitService(cfg *config.Config) *GitService {
 	return &GitService{
 		GitService: git.NewGitService(),
+		username:   cfg.Git.CloneUsername,
+		password:   cfg.Git.ClonePassword,
 	}
-}
\ No newline at end of file
+}
+
+// CloneSources checks out the sources of a build: its git tag, the ref of its pull request, or its
+// commit on its branch
+func (s *GitService) CloneSources(gitURL, tag, ref, branch, commit string) (*git.GitRepo, error) {
+	switch {
+	case tag != "":
+		return s.Clone(gitURL, "", tag, s.username, s.password)
+	case ref != "":
+		return s.CloneRef(gitURL, ref, commit, s.username, s.password)
+	default:
+		return s.CloneCommit(gitURL, branch, commit, s.username, s.password)
+	}
+}
+
+// pullRequestRef returns the ref a Git provider publishes the head of a pull request under. It is
+// present in the base repository even when the pull request comes from a fork.
+func pullRequestRef(provider string, number int) string {
+	if number <= 0 {
+		return ""
+	}
+	if provider == "gitlab" {
+		return fmt.Sprintf("refs/merge-requests/%d/head", number)
+	}
+	return fmt.Sprintf("refs/pull/%d/head", number)
+}
@@ -17,4 +17,24 @@ func NewK8sService(cfg *config.Config) (*K8sService, error) {
 	return &K8sService{
 		K8sService: k8sService,
 	}, nil
+}
+
+func NewK8sServiceFromKubeconfig(kubeconfig []byte, cfg *config.Config) (*K8sService, error) {
+	k8sService, err := k8s.NewK8sServiceFromKubeconfig(kubeconfig, &cfg.K8s)
+	if err != nil {
+		return nil, err
+	}
+	return &K8sService{
+		K8sService: k8sService,
+	}, nil
+}
+
+func NewK8sServiceFromToken(server, token string, caData []byte, insecure bool, cfg *config.Config) (*K8sService, error) {
+	k8sService, err := k8s.NewK8sServiceFromToken(server, token, caData, insecure, &cfg.K8s)
+	if err != nil {
+		return nil, err
+	}
+	return &K8sService{
+		K8sService: k8sService,
+	}, nil
 }
\ No newline at end of file
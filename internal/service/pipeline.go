@@ -25,6 +25,16 @@ func (s *PipelineService) Create(name, description, config string, projectID uin
 		return nil, errors.New("project not found")
 	}
 
+	if _, err := parseImageConfig(config); err != nil {
+		return nil, err
+	}
+	if _, err := parseScanPolicy(config); err != nil {
+		return nil, err
+	}
+	if _, err := parsePipelineSteps(config); err != nil {
+		return nil, err
+	}
+
 	pipeline := &models.Pipeline{
 		Name:        name,
 		Description: description,
@@ -66,6 +76,15 @@ func (s *PipelineService) Update(id, projectID uint, name, description, config s
 		pipeline.Description = description
 	}
 	if config != "" {
+		if _, err := parseImageConfig(config); err != nil {
+			return nil, err
+		}
+		if _, err := parseScanPolicy(config); err != nil {
+			return nil, err
+		}
+		if _, err := parsePipelineSteps(config); err != nil {
+			return nil, err
+		}
 		pipeline.Config = config
 	}
 
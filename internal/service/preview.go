@@ -0,0 +1,382 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PreviewService deploys successful pull request builds into an ephemeral namespace per pull
+// request and pipeline, and tears the namespaces down when the pull request closes or the
+// previews expire
+type PreviewService struct {
+	previewRepo       *repository.PreviewEnvironmentRepository
+	projectRepo       *repository.ProjectRepository
+	buildRepo         *repository.BuildRepository
+	deploymentService *DeploymentService
+	clusterService    *ClusterService
+	gitService        *GitService
+	domain            string
+	githubToken       string
+	ttl               time.Duration
+	installation      string
+
+	// mu serialises changes to previews so a teardown never races a rollout
+	mu sync.Mutex
+}
+
+func NewPreviewService(previewRepo *repository.PreviewEnvironmentRepository, projectRepo *repository.ProjectRepository, buildRepo *repository.BuildRepository, deploymentService *DeploymentService, clusterService *ClusterService, gitService *GitService, cfg *config.Config) *PreviewService {
+	return &PreviewService{
+		previewRepo:       previewRepo,
+		projectRepo:       projectRepo,
+		buildRepo:         buildRepo,
+		deploymentService: deploymentService,
+		clusterService:    clusterService,
+		gitService:        gitService,
+		domain:            cfg.Preview.Domain,
+		githubToken:       cfg.Git.GitHubToken,
+		ttl:               parseDuration(cfg.Preview.TTL, 72*time.Hour),
+		installation:      cfg.K8s.InstallationID,
+	}
+}
+
+func (s *PreviewService) GetByID(id, userID uint) (*models.PreviewEnvironment, error) {
+	preview, err := s.previewRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("preview environment not found")
+	}
+	if err := s.checkMember(preview.ProjectID, userID); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+func (s *PreviewService) GetByProjectID(projectID, userID uint) ([]*models.PreviewEnvironment, error) {
+	if err := s.checkMember(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.previewRepo.GetByProjectID(projectID)
+}
+
+// Open records the head commit of an opened or updated pull request for a pipeline. The preview
+// itself is deployed once the pipeline's build of that commit succeeds.
+func (s *PreviewService) Open(pipeline *models.Pipeline, repository string, pullRequest int, branch, commit string) (*models.PreviewEnvironment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preview, err := s.previewRepo.GetByPullRequest(pipeline.ProjectID, pipeline.ID, pullRequest)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		project, err := s.projectRepo.GetByID(pipeline.ProjectID)
+		if err != nil {
+			return nil, errors.New("project not found")
+		}
+
+		namespace := previewNamespace(project, pipeline, pullRequest)
+		preview = &models.PreviewEnvironment{
+			ProjectID:   pipeline.ProjectID,
+			PipelineID:  pipeline.ID,
+			PullRequest: pullRequest,
+			Namespace:   namespace,
+			Status:      "pending",
+		}
+		if s.domain != "" {
+			preview.Host = namespace + "." + s.domain
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if repository != "" {
+		preview.Repository = repository
+	}
+	preview.Branch = branch
+	preview.CommitHash = commit
+	preview.Status = "pending"
+	preview.ClosedAt = nil
+	preview.ExpiresAt = time.Now().Add(s.ttl)
+
+	if preview.ID == 0 {
+		err = s.previewRepo.Create(preview)
+	} else {
+		err = s.previewRepo.Update(preview)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return preview, nil
+}
+
+// DeployBuild rolls a successful pull request build out to the preview of its pull request and pipeline
+// and posts the preview URL back to the pull request
+func (s *PreviewService) DeployBuild(buildID uint) (*models.PreviewEnvironment, error) {
+	build, deployment, err := s.prepare(buildID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The rollout runs without holding the lock so the pull request can be closed meanwhile
+	deployment, err = s.deploymentService.Deploy(deployment.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.finish(build, deployment)
+}
+
+// prepare creates the namespace of a pull request's preview and records the deployment of the build
+func (s *PreviewService) prepare(buildID uint) (*models.Build, *models.Deployment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	build, err := s.buildRepo.GetByID(buildID)
+	if err != nil {
+		return nil, nil, errors.New("build not found")
+	}
+	if build.PullRequest <= 0 {
+		return nil, nil, errors.New("build is not for a pull request")
+	}
+
+	preview, err := s.previewRepo.GetByPullRequest(build.Pipeline.ProjectID, build.PipelineID, build.PullRequest)
+	if err != nil {
+		return nil, nil, errors.New("preview environment not found")
+	}
+
+	// Closed pull requests and builds of superseded commits are not deployed
+	if preview.Status == "closed" || preview.Status == "expired" {
+		return nil, nil, errors.New("preview environment is closed")
+	}
+	if preview.CommitHash != "" && preview.CommitHash != build.CommitHash {
+		return nil, nil, errors.New("build is not for the latest commit of the pull request")
+	}
+
+	clusterID, _, err := s.clusterService.Resolve("preview")
+	if err != nil {
+		return nil, nil, err
+	}
+	client, err := s.clusterService.Client(clusterID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	preview.BuildID = &build.ID
+	preview.ClusterID = clusterID
+	preview.Status = "deploying"
+	preview.ExpiresAt = time.Now().Add(s.ttl)
+	if err := s.previewRepo.Update(preview); err != nil {
+		return nil, nil, err
+	}
+
+	exists, err := client.NamespaceExists(preview.Namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exists {
+		if err := client.CreateNamespace(preview.Namespace, k8s.Owner{Installation: s.installation, ProjectID: preview.ProjectID}); err != nil {
+			return nil, nil, err
+		}
+		preview.OwnsNamespace = true
+		if err := s.previewRepo.Update(preview); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	deployment, err := s.deploymentService.CreatePreview(build, clusterID, preview.Namespace, preview.Host)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	preview.DeploymentID = &deployment.ID
+	if err := s.previewRepo.Update(preview); err != nil {
+		return nil, nil, err
+	}
+
+	return build, deployment, nil
+}
+
+// finish records the outcome of a preview rollout unless the pull request moved on meanwhile
+func (s *PreviewService) finish(build *models.Build, deployment *models.Deployment) (*models.PreviewEnvironment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preview, err := s.previewRepo.GetByPullRequest(build.Pipeline.ProjectID, build.PipelineID, build.PullRequest)
+	if err != nil {
+		return nil, errors.New("preview environment not found")
+	}
+	if preview.Status != "deploying" || preview.DeploymentID == nil || *preview.DeploymentID != deployment.ID {
+		return preview, nil
+	}
+
+	preview.Status = "active"
+	if deployment.Status != "success" {
+		preview.Status = "failed"
+	}
+	if err := s.previewRepo.Update(preview); err != nil {
+		return nil, err
+	}
+
+	if preview.Status == "active" {
+		s.notify(preview, fmt.Sprintf("Preview environment of %s for %s is ready: %s", build.Pipeline.Name, shortCommit(build.CommitHash), previewURL(preview)))
+	} else {
+		s.notify(preview, fmt.Sprintf("Preview deployment of %s for %s failed: %s", build.Pipeline.Name, shortCommit(build.CommitHash), deployment.Message))
+	}
+
+	return preview, nil
+}
+
+// Close tears down the previews of a pull request that was closed or merged
+func (s *PreviewService) Close(projectID uint, pullRequest int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previews, err := s.previewRepo.ListByPullRequest(projectID, pullRequest)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, preview := range previews {
+		if err := s.teardown(preview, "closed"); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Teardown removes a preview on request of a project member
+func (s *PreviewService) Teardown(id, userID uint) (*models.PreviewEnvironment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	preview, err := s.previewRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("preview environment not found")
+	}
+	if err := s.checkMember(preview.ProjectID, userID); err != nil {
+		return nil, err
+	}
+
+	if err := s.teardown(preview, "closed"); err != nil {
+		return nil, err
+	}
+	return preview, nil
+}
+
+// ExpireStale tears down previews that outlived their time to live
+func (s *PreviewService) ExpireStale() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previews, err := s.previewRepo.ListExpired(time.Now())
+	if err != nil {
+		return err
+	}
+
+	for _, preview := range previews {
+		if err := s.teardown(preview, "expired"); err != nil {
+			logrus.WithError(err).WithField("preview_id", preview.ID).Error("Failed to tear down expired preview environment")
+		}
+	}
+	return nil
+}
+
+// StartReaper periodically tears down expired previews in the background
+func (s *PreviewService) StartReaper(interval time.Duration) {
+	every(interval, func() {
+		if err := s.ExpireStale(); err != nil {
+			logrus.WithError(err).Error("Failed to expire preview environments")
+		}
+	})
+}
+
+func (s *PreviewService) teardown(preview *models.PreviewEnvironment, status string) error {
+	if preview.Status == "closed" || preview.Status == "expired" {
+		return nil
+	}
+
+	// Previews that were never deployed have nothing to remove. Namespaces that existed before
+	// the preview are kept and only the preview's workload is removed from them.
+	switch {
+	case preview.OwnsNamespace:
+		client, err := s.clusterService.Client(preview.ClusterID)
+		if err != nil {
+			return err
+		}
+		if err := client.DeleteNamespace(preview.Namespace); err != nil {
+			return err
+		}
+		if err := s.deploymentService.MarkNamespaceDeleted(preview.ClusterID, preview.Namespace); err != nil {
+			return err
+		}
+	case preview.DeploymentID != nil:
+		deployment, err := s.deploymentService.GetByID(*preview.DeploymentID)
+		if err != nil {
+			return err
+		}
+		client, err := s.clusterService.Client(preview.ClusterID)
+		if err != nil {
+			return err
+		}
+		if err := client.DeleteWorkload(preview.Namespace, deployment.ServiceName); err != nil {
+			return err
+		}
+		if err := s.deploymentService.MarkWorkloadDeleted(preview.ClusterID, preview.Namespace, deployment.ServiceName); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	preview.Status = status
+	preview.ClosedAt = &now
+	return s.previewRepo.Update(preview)
+}
+
+// notify comments on the pull request of a preview; only GitHub repositories are supported
+func (s *PreviewService) notify(preview *models.PreviewEnvironment, message string) {
+	if s.githubToken == "" || preview.Repository == "" {
+		return
+	}
+
+	if err := s.gitService.CommentOnGitHubPullRequest(s.githubToken, preview.Repository, preview.PullRequest, message); err != nil {
+		logrus.WithError(err).WithField("preview_id", preview.ID).Warn("Failed to comment on pull request")
+	}
+}
+
+func (s *PreviewService) checkMember(projectID, userID uint) error {
+	member, err := s.projectRepo.IsMember(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
+
+// previewNamespace names the namespace of a pull request's pipeline, e.g. pr-123-4-my-project. The
+// pipeline ID comes before the project name so that truncation keeps the namespaces apart.
+func previewNamespace(project *models.Project, pipeline *models.Pipeline, pullRequest int) string {
+	return k8s.SanitizeName(fmt.Sprintf("pr-%d-%d-%s", pullRequest, pipeline.ID, project.Name))
+}
+
+func previewURL(preview *models.PreviewEnvironment) string {
+	if preview.Host == "" {
+		return "namespace " + preview.Namespace
+	}
+	return "https://" + preview.Host
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
@@ -1,20 +1,25 @@
 package service
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"ys-cloud/internal/models"
 	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/crypto"
 )
 
 type ProjectService struct {
 	projectRepo *repository.ProjectRepository
 	userRepo    *repository.UserRepository
+	cipher      *crypto.Cipher
 }
 
-func NewProjectService(projectRepo *repository.ProjectRepository, userRepo *repository.UserRepository) *ProjectService {
+func NewProjectService(projectRepo *repository.ProjectRepository, userRepo *repository.UserRepository, cipher *crypto.Cipher) *ProjectService {
 	return &ProjectService{
 		projectRepo: projectRepo,
 		userRepo:    userRepo,
+		cipher:      cipher,
 	}
 }
 
@@ -48,6 +53,45 @@ func (s *ProjectService) GetByID(id uint) (*models.Project, error) {
 	return s.projectRepo.GetByID(id)
 }
 
+// RotateWebhookSecret generates a new webhook secret for a project and returns it. The secret is
+// stored encrypted and cannot be read back, so it must be entered in the Git provider right away.
+func (s *ProjectService) RotateWebhookSecret(id, ownerID uint) (string, error) {
+	project, err := s.projectRepo.GetByID(id)
+	if err != nil {
+		return "", errors.New("project not found")
+	}
+
+	// Check ownership
+	if project.OwnerID != ownerID {
+		return "", errors.New("access denied")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+
+	encrypted, err := s.cipher.Encrypt(secret)
+	if err != nil {
+		return "", err
+	}
+	project.WebhookSecret = encrypted
+	if err := s.projectRepo.Update(project); err != nil {
+		return "", err
+	}
+
+	return secret, nil
+}
+
+// WebhookSecret returns the decrypted webhook secret of a project, or an error when none is set
+func (s *ProjectService) WebhookSecret(project *models.Project) (string, error) {
+	if project.WebhookSecret == "" {
+		return "", errors.New("project has no webhook secret")
+	}
+	return s.cipher.Decrypt(project.WebhookSecret)
+}
+
 func (s *ProjectService) GetByOwnerID(ownerID uint) ([]*models.Project, error) {
 	return s.projectRepo.GetByOwnerID(ownerID)
 }
@@ -0,0 +1,303 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/crypto"
+	"ys-cloud/pkg/k8s"
+	"ys-cloud/pkg/registry"
+)
+
+// ecrTokenMinValidity is how long a cached ECR token has to stay valid to be reused. It exceeds
+// the default registry secret refresh interval, so refreshed pull secrets never hold an expired token.
+const ecrTokenMinValidity = time.Hour
+
+// RegistryCredentialService stores the container registry credentials of projects, encrypted at
+// rest, and resolves them for builds and deployments
+type RegistryCredentialService struct {
+	credentialRepo *repository.RegistryCredentialRepository
+	projectRepo    *repository.ProjectRepository
+	cipher         *crypto.Cipher
+
+	mu        sync.Mutex
+	ecrTokens map[uint]*registry.ECRToken
+}
+
+type RegistryCredentialInput struct {
+	Name      string
+	Provider  string
+	Registry  string
+	Namespace string
+	Username  string
+	Password  string
+	Region    string
+	Push      bool
+}
+
+func NewRegistryCredentialService(credentialRepo *repository.RegistryCredentialRepository, projectRepo *repository.ProjectRepository, cipher *crypto.Cipher) *RegistryCredentialService {
+	return &RegistryCredentialService{
+		credentialRepo: credentialRepo,
+		projectRepo:    projectRepo,
+		cipher:         cipher,
+		ecrTokens:      make(map[uint]*registry.ECRToken),
+	}
+}
+
+func (s *RegistryCredentialService) Create(projectID uint, input RegistryCredentialInput, ownerID uint) (*models.RegistryCredential, error) {
+	if err := s.checkOwner(projectID, ownerID); err != nil {
+		return nil, err
+	}
+
+	credential := &models.RegistryCredential{ProjectID: projectID, CreatedBy: ownerID}
+	if err := s.assign(credential, input); err != nil {
+		return nil, err
+	}
+	if err := s.credentialRepo.Create(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// Update changes a credential, e.g. to rotate its password. The stored password is kept when none
+// is given. Image pull secrets pick up the change with the next deployment or refresh.
+func (s *RegistryCredentialService) Update(id uint, input RegistryCredentialInput, ownerID uint) (*models.RegistryCredential, error) {
+	credential, err := s.credentialRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("registry credential not found")
+	}
+	if err := s.checkOwner(credential.ProjectID, ownerID); err != nil {
+		return nil, err
+	}
+
+	if input.Password == "" {
+		if input.Password, err = s.cipher.Decrypt(credential.Password); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.assign(credential, input); err != nil {
+		return nil, err
+	}
+	if err := s.credentialRepo.Update(credential); err != nil {
+		return nil, err
+	}
+
+	s.forget(id)
+	return credential, nil
+}
+
+// assign validates the input and stores it in the credential, encrypting the password
+func (s *RegistryCredentialService) assign(credential *models.RegistryCredential, input RegistryCredentialInput) error {
+	if input.Name == "" {
+		return errors.New("credential name is required")
+	}
+	if input.Username == "" || input.Password == "" {
+		return errors.New("username and password are required")
+	}
+
+	switch input.Provider {
+	case "":
+		input.Provider = "generic"
+	case "dockerhub":
+		if input.Registry == "" {
+			input.Registry = registry.DockerHub
+		}
+		// Docker Hub repositories live under the account
+		if input.Namespace == "" {
+			input.Namespace = input.Username
+		}
+	case "ecr":
+		if input.Region == "" {
+			return errors.New("region is required for ecr")
+		}
+	case "harbor", "acr", "generic":
+	default:
+		return errors.New("unsupported registry provider")
+	}
+	if input.Registry == "" {
+		return errors.New("registry is required")
+	}
+
+	password, err := s.cipher.Encrypt(input.Password)
+	if err != nil {
+		return err
+	}
+
+	credential.Name = input.Name
+	credential.Provider = input.Provider
+	credential.Registry = registry.NormalizeHost(input.Registry)
+	credential.Namespace = strings.Trim(input.Namespace, "/")
+	credential.Username = input.Username
+	credential.Password = password
+	credential.Region = input.Region
+	credential.Push = input.Push
+	return nil
+}
+
+func (s *RegistryCredentialService) GetByID(id, userID uint) (*models.RegistryCredential, error) {
+	credential, err := s.credentialRepo.GetByID(id)
+	if err != nil {
+		return nil, errors.New("registry credential not found")
+	}
+	if err := s.checkMember(credential.ProjectID, userID); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+func (s *RegistryCredentialService) GetByProjectID(projectID, userID uint) ([]*models.RegistryCredential, error) {
+	if err := s.checkMember(projectID, userID); err != nil {
+		return nil, err
+	}
+	return s.credentialRepo.GetByProjectID(projectID)
+}
+
+func (s *RegistryCredentialService) Delete(id, ownerID uint) error {
+	credential, err := s.credentialRepo.GetByID(id)
+	if err != nil {
+		return errors.New("registry credential not found")
+	}
+	if err := s.checkOwner(credential.ProjectID, ownerID); err != nil {
+		return err
+	}
+
+	s.forget(id)
+	return s.credentialRepo.Delete(id)
+}
+
+// Auths returns the decrypted credentials of a project, exchanging ECR access keys for
+// registry passwords
+func (s *RegistryCredentialService) Auths(projectID uint) ([]registry.Auth, error) {
+	credentials, err := s.credentialRepo.GetByProjectID(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	auths := make([]registry.Auth, 0, len(credentials))
+	for _, credential := range credentials {
+		auth, err := s.auth(credential)
+		if err != nil {
+			return nil, fmt.Errorf("registry credential %s: %w", credential.Name, err)
+		}
+		auths = append(auths, *auth)
+	}
+	return auths, nil
+}
+
+// PullAuth returns the credentials a workload of a project pulls image with, nil when none of the
+// project's registries hosts the image
+func (s *RegistryCredentialService) PullAuth(projectID uint, image string) (*registry.Auth, error) {
+	credential, err := s.credentialFor(projectID, image)
+	if err != nil || credential == nil {
+		return nil, err
+	}
+	auth, err := s.auth(credential)
+	if err != nil {
+		return nil, fmt.Errorf("registry credential %s: %w", credential.Name, err)
+	}
+	return auth, nil
+}
+
+// Expires reports whether the pull credentials of an image are short-lived tokens, which image
+// pull secrets have to be refreshed with
+func (s *RegistryCredentialService) Expires(projectID uint, image string) (bool, error) {
+	credential, err := s.credentialFor(projectID, image)
+	if err != nil || credential == nil {
+		return false, err
+	}
+	return credential.Provider == "ecr", nil
+}
+
+func (s *RegistryCredentialService) credentialFor(projectID uint, image string) (*models.RegistryCredential, error) {
+	credentials, err := s.credentialRepo.GetByProjectID(projectID)
+	if err != nil {
+		return nil, err
+	}
+	host := registry.ImageHost(image)
+	for _, credential := range credentials {
+		if credential.Registry == host {
+			return credential, nil
+		}
+	}
+	return nil, nil
+}
+
+// Repository returns the repository the images of a project are pushed to: under the
+// project's push registry, or under defaultRegistry without one
+func (s *RegistryCredentialService) Repository(project *models.Project, defaultRegistry string) (string, error) {
+	name := k8s.SanitizeName(project.Name)
+
+	credentials, err := s.credentialRepo.GetByProjectID(project.ID)
+	if err != nil {
+		return "", err
+	}
+	for _, credential := range credentials {
+		if !credential.Push {
+			continue
+		}
+		if credential.Namespace != "" {
+			return fmt.Sprintf("%s/%s/%s", credential.Registry, credential.Namespace, name), nil
+		}
+		return fmt.Sprintf("%s/%s", credential.Registry, name), nil
+	}
+
+	return fmt.Sprintf("%s/%s", defaultRegistry, name), nil
+}
+
+func (s *RegistryCredentialService) auth(credential *models.RegistryCredential) (*registry.Auth, error) {
+	password, err := s.cipher.Decrypt(credential.Password)
+	if err != nil {
+		return nil, err
+	}
+	if credential.Provider != "ecr" {
+		return &registry.Auth{Registry: credential.Registry, Username: credential.Username, Password: password}, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Tokens are reused while they stay valid for longer than the refresh interval of pull secrets
+	token, cached := s.ecrTokens[credential.ID]
+	if !cached || time.Until(token.ExpiresAt) < ecrTokenMinValidity {
+		if token, err = registry.ExchangeECRToken(credential.Region, credential.Username, password); err != nil {
+			return nil, err
+		}
+		s.ecrTokens[credential.ID] = token
+	}
+
+	return &registry.Auth{Registry: credential.Registry, Username: token.Username, Password: token.Password}, nil
+}
+
+func (s *RegistryCredentialService) forget(id uint) {
+	s.mu.Lock()
+	delete(s.ecrTokens, id)
+	s.mu.Unlock()
+}
+
+func (s *RegistryCredentialService) checkOwner(projectID, ownerID uint) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return errors.New("project not found")
+	}
+
+	if project.OwnerID != ownerID {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+func (s *RegistryCredentialService) checkMember(projectID, userID uint) error {
+	member, err := s.projectRepo.IsMember(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
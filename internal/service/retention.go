@@ -0,0 +1,422 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/k8s"
+	"ys-cloud/pkg/registry"
+	"ys-cloud/pkg/signing"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// RetentionService deletes the build images that fall outside the retention policies of their
+// projects from the build host and the registry
+type RetentionService struct {
+	policyRepo      *repository.RetentionPolicyRepository
+	projectRepo     *repository.ProjectRepository
+	buildRepo       *repository.BuildRepository
+	deploymentRepo  *repository.DeploymentRepository
+	dockerService   *DockerService
+	registryService *RegistryCredentialService
+	username        string
+	password        string
+
+	// mu keeps enforcement runs from overlapping
+	mu sync.Mutex
+}
+
+type RetentionPolicyInput struct {
+	Enabled       bool
+	KeepPerBranch int
+	MaxAgeDays    int
+	KeepTags      bool
+	CleanRegistry bool
+}
+
+// ExpiredImage is the image of a build that falls outside its project's retention policy
+type ExpiredImage struct {
+	ProjectID       uint     `json:"project_id"`
+	BuildID         uint     `json:"build_id"`
+	Branch          string   `json:"branch"`
+	Image           string   `json:"image"`
+	Tags            []string `json:"tags"`
+	Digest          string   `json:"digest"`
+	Reason          string   `json:"reason"`
+	LocalTags       []string `json:"local_tags"` // tags present on the build host
+	LocalDeleted    bool     `json:"local_deleted"`
+	RegistryDeleted bool     `json:"registry_deleted"`
+	Error           string   `json:"error,omitempty"`
+}
+
+type RetentionReport struct {
+	DryRun         bool            `json:"dry_run"`
+	Images         []*ExpiredImage `json:"images"`
+	SpaceReclaimed uint64          `json:"space_reclaimed"` // bytes freed on the build host by pruning
+	Errors         []string        `json:"errors,omitempty"`
+	CheckedAt      time.Time       `json:"checked_at"`
+}
+
+// NewRetentionService creates the service; local images are left alone when dockerService is nil
+func NewRetentionService(policyRepo *repository.RetentionPolicyRepository, projectRepo *repository.ProjectRepository, buildRepo *repository.BuildRepository, deploymentRepo *repository.DeploymentRepository, dockerService *DockerService, registryService *RegistryCredentialService, cfg *config.Config) *RetentionService {
+	return &RetentionService{
+		policyRepo:      policyRepo,
+		projectRepo:     projectRepo,
+		buildRepo:       buildRepo,
+		deploymentRepo:  deploymentRepo,
+		dockerService:   dockerService,
+		registryService: registryService,
+		username:        cfg.Docker.Username,
+		password:        cfg.Docker.Password,
+	}
+}
+
+func (s *RetentionService) GetPolicy(projectID, userID uint) (*models.RetentionPolicy, error) {
+	if err := s.checkMember(projectID, userID); err != nil {
+		return nil, err
+	}
+
+	policy, err := s.policyRepo.GetByProjectID(projectID)
+	if err != nil {
+		return nil, errors.New("retention policy not found")
+	}
+	return policy, nil
+}
+
+// SavePolicy creates or replaces the retention policy of a project
+func (s *RetentionService) SavePolicy(projectID uint, input RetentionPolicyInput, ownerID uint) (*models.RetentionPolicy, error) {
+	if err := s.checkOwner(projectID, ownerID); err != nil {
+		return nil, err
+	}
+	if input.KeepPerBranch < 0 || input.MaxAgeDays < 0 {
+		return nil, errors.New("retention limits cannot be negative")
+	}
+	if input.KeepPerBranch == 0 && input.MaxAgeDays == 0 {
+		return nil, errors.New("retention policy requires keep_per_branch or max_age_days")
+	}
+
+	policy, err := s.policyRepo.GetByProjectID(projectID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		policy = &models.RetentionPolicy{ProjectID: projectID}
+	} else if err != nil {
+		return nil, err
+	}
+
+	policy.Enabled = input.Enabled
+	policy.KeepPerBranch = input.KeepPerBranch
+	policy.MaxAgeDays = input.MaxAgeDays
+	policy.KeepTags = input.KeepTags
+	policy.CleanRegistry = input.CleanRegistry
+	policy.UpdatedBy = ownerID
+	if err := s.policyRepo.Save(policy); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+func (s *RetentionService) DeletePolicy(projectID, ownerID uint) error {
+	if err := s.checkOwner(projectID, ownerID); err != nil {
+		return err
+	}
+	return s.policyRepo.DeleteByProjectID(projectID)
+}
+
+// Report lists the images of a project the retention policy would delete without deleting anything
+func (s *RetentionService) Report(projectID, userID uint) (*RetentionReport, error) {
+	policy, err := s.GetPolicy(projectID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.run([]*models.RetentionPolicy{policy}, true), nil
+}
+
+// Enforce deletes the images of a project outside its retention policy, even when the policy is disabled
+func (s *RetentionService) Enforce(projectID, ownerID uint) (*RetentionReport, error) {
+	if err := s.checkOwner(projectID, ownerID); err != nil {
+		return nil, err
+	}
+	policy, err := s.policyRepo.GetByProjectID(projectID)
+	if err != nil {
+		return nil, errors.New("retention policy not found")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.run([]*models.RetentionPolicy{policy}, false), nil
+}
+
+// StartEnforcer periodically enforces the enabled retention policies in the background
+func (s *RetentionService) StartEnforcer(interval time.Duration) {
+	every(interval, func() {
+		policies, err := s.policyRepo.ListEnabled()
+		if err != nil {
+			logrus.WithError(err).Error("Failed to list retention policies")
+			return
+		}
+		if len(policies) == 0 {
+			return
+		}
+
+		s.mu.Lock()
+		report := s.run(policies, false)
+		s.mu.Unlock()
+
+		if len(report.Images) > 0 || len(report.Errors) > 0 {
+			logrus.WithFields(logrus.Fields{
+				"images":          len(report.Images),
+				"space_reclaimed": report.SpaceReclaimed,
+				"errors":          len(report.Errors),
+			}).Info("Enforced image retention policies")
+		}
+	})
+}
+
+func (s *RetentionService) run(policies []*models.RetentionPolicy, dryRun bool) *RetentionReport {
+	report := &RetentionReport{
+		DryRun:    dryRun,
+		Images:    []*ExpiredImage{},
+		CheckedAt: time.Now(),
+	}
+
+	// Tags present on the build host
+	localTags := make(map[string]bool)
+	if s.dockerService != nil {
+		images, err := s.dockerService.ListImages()
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("build host: %v", err))
+		}
+		for _, image := range images {
+			for _, tag := range image.RepoTags {
+				localTags[tag] = true
+			}
+		}
+	}
+
+	for _, policy := range policies {
+		images, err := s.expired(policy, report.CheckedAt, localTags)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("project %d: %v", policy.ProjectID, err))
+			continue
+		}
+		if !dryRun {
+			s.delete(policy, images)
+			report.SpaceReclaimed += s.prune(policy, images, report)
+		}
+		report.Images = append(report.Images, images...)
+	}
+
+	return report
+}
+
+// expired lists the images of a project's builds outside its retention policy that are still
+// present on the build host or, when the registry is cleaned, in the registry
+func (s *RetentionService) expired(policy *models.RetentionPolicy, now time.Time, localTags map[string]bool) ([]*ExpiredImage, error) {
+	builds, err := s.buildRepo.GetImagesByProjectID(policy.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	deployedIDs, err := s.deploymentRepo.GetDeployedBuildIDs(policy.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	deployed := make(map[uint]bool, len(deployedIDs))
+	for _, id := range deployedIDs {
+		deployed[id] = true
+	}
+
+	var expired []*models.Build
+	keptDigests := make(map[string]bool)
+	keptTags := make(map[string]bool)
+	positions := make(map[string]int)
+	reasons := make(map[uint]string)
+	for _, build := range builds {
+		position := positions[build.Branch]
+		positions[build.Branch]++
+
+		reason := retentionReason(policy, build, position, now)
+		if reason == "" || deployed[build.ID] || (policy.KeepTags && build.Tag != "") {
+			if build.ImageDigest != "" {
+				keptDigests[build.ImageDigest] = true
+			}
+			for _, tag := range buildTags(build) {
+				keptTags[fmt.Sprintf("%s:%s", build.ImageName, tag)] = true
+			}
+			continue
+		}
+		expired = append(expired, build)
+		reasons[build.ID] = reason
+	}
+
+	var images []*ExpiredImage
+	for _, build := range expired {
+		image := &ExpiredImage{
+			ProjectID: policy.ProjectID,
+			BuildID:   build.ID,
+			Branch:    build.Branch,
+			Image:     build.ImageName,
+			Tags:      buildTags(build),
+			Reason:    reasons[build.ID],
+			LocalTags: []string{},
+		}
+		// Digests and moving tags such as latest shared with a kept build stay
+		if policy.CleanRegistry && build.ImageDigest == "" {
+			image.Error = "image digest is unknown, the image cannot be deleted from the registry"
+		} else if policy.CleanRegistry && !keptDigests[build.ImageDigest] {
+			image.Digest = build.ImageDigest
+		}
+		for _, tag := range image.Tags {
+			reference := fmt.Sprintf("%s:%s", build.ImageName, tag)
+			if localTags[reference] && !keptTags[reference] {
+				image.LocalTags = append(image.LocalTags, tag)
+			}
+		}
+
+		if len(image.LocalTags) > 0 || image.Digest != "" || image.Error != "" {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+// prune removes the dangling images of a project left behind on the build host after deleting its
+// expired images. Only images labelled with the project are pruned, images of other projects and
+// of other users of the Docker daemon are left alone.
+func (s *RetentionService) prune(policy *models.RetentionPolicy, images []*ExpiredImage, report *RetentionReport) uint64 {
+	if s.dockerService == nil || len(images) == 0 {
+		return 0
+	}
+
+	pruned, err := s.dockerService.PruneImages(k8s.Owner{ProjectID: policy.ProjectID}.Labels())
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("build host: %v", err))
+	}
+	return pruned.SpaceReclaimed
+}
+
+// delete removes expired images from the build host and the registry, marking builds whose
+// image is gone from the registry
+func (s *RetentionService) delete(policy *models.RetentionPolicy, images []*ExpiredImage) {
+	var auths []registry.Auth
+	var authsErr error
+	if policy.CleanRegistry && s.registryService != nil {
+		auths, authsErr = s.registryService.Auths(policy.ProjectID)
+	}
+
+	for _, image := range images {
+		var failures []string
+		if image.Error != "" {
+			failures = append(failures, image.Error)
+		}
+		for _, tag := range image.LocalTags {
+			if err := s.dockerService.RemoveImage(image.Image, tag); err != nil {
+				failures = append(failures, err.Error())
+			}
+		}
+		image.LocalDeleted = len(image.LocalTags) > 0 && len(failures) == 0
+
+		if image.Digest != "" && authsErr != nil {
+			failures = append(failures, authsErr.Error())
+		} else if image.Digest != "" {
+			if err := s.deleteFromRegistry(image, auths); err != nil {
+				failures = append(failures, err.Error())
+			} else {
+				image.RegistryDeleted = true
+				if err := s.buildRepo.MarkImageDeleted(image.BuildID, time.Now()); err != nil {
+					failures = append(failures, err.Error())
+				}
+			}
+		}
+
+		image.Error = strings.Join(failures, "; ")
+	}
+}
+
+// deleteFromRegistry deletes the image manifest and the signature and attestations cosign attached to it
+func (s *RetentionService) deleteFromRegistry(image *ExpiredImage, auths []registry.Auth) error {
+	host, repository := registry.SplitImage(image.Image)
+
+	// Registries without project credentials fall back to the global ones
+	auth := registry.Find(auths, image.Image)
+	if auth == nil && s.username != "" {
+		auth = &registry.Auth{Registry: host, Username: s.username, Password: s.password}
+	}
+
+	client := registry.NewClient(host, auth)
+	for _, tag := range []string{signing.SignatureTag(image.Digest), signing.AttestationTag(image.Digest)} {
+		if err := client.DeleteTag(repository, tag); err != nil {
+			return err
+		}
+	}
+	return client.DeleteManifest(repository, image.Digest)
+}
+
+// retentionReason returns why a build falls outside the policy, or an empty string while it is kept.
+// position is the number of newer builds of the same branch.
+func retentionReason(policy *models.RetentionPolicy, build *models.Build, position int, now time.Time) string {
+	if policy.KeepPerBranch == 0 && policy.MaxAgeDays == 0 {
+		return ""
+	}
+	if policy.KeepPerBranch > 0 && position < policy.KeepPerBranch {
+		return ""
+	}
+	if policy.MaxAgeDays > 0 && now.Sub(build.CreatedAt) < time.Duration(policy.MaxAgeDays)*24*time.Hour {
+		return ""
+	}
+
+	branch := "branch " + build.Branch
+	if build.Branch == "" {
+		branch = "tag builds"
+	}
+	switch {
+	case policy.KeepPerBranch > 0 && policy.MaxAgeDays > 0:
+		return fmt.Sprintf("older than %d days and not among the %d newest of %s", policy.MaxAgeDays, policy.KeepPerBranch, branch)
+	case policy.KeepPerBranch > 0:
+		return fmt.Sprintf("not among the %d newest of %s", policy.KeepPerBranch, branch)
+	}
+	return fmt.Sprintf("older than %d days", policy.MaxAgeDays)
+}
+
+// buildTags returns every tag pushed for a build
+func buildTags(build *models.Build) []string {
+	if build.ImageTags == "" {
+		return []string{build.ImageTag}
+	}
+	return strings.Split(build.ImageTags, ",")
+}
+
+func (s *RetentionService) checkOwner(projectID, ownerID uint) error {
+	project, err := s.projectRepo.GetByID(projectID)
+	if err != nil {
+		return errors.New("project not found")
+	}
+
+	if project.OwnerID != ownerID {
+		return errors.New("access denied")
+	}
+
+	return nil
+}
+
+func (s *RetentionService) checkMember(projectID, userID uint) error {
+	member, err := s.projectRepo.IsMember(projectID, userID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return errors.New("access denied")
+	}
+	return nil
+}
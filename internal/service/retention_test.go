@@ -0,0 +1,97 @@
+package service
+
+import (
+	"testing"
+	"time"
+	"ys-cloud/internal/models"
+)
+
+func TestRetentionReason(t *testing.T) {
+	now := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(days int) time.Time { return now.Add(-time.Duration(days) * 24 * time.Hour) }
+
+	tests := []struct {
+		name     string
+		policy   models.RetentionPolicy
+		build    models.Build
+		position int
+		want     string
+	}{
+		{
+			name:     "no limits",
+			policy:   models.RetentionPolicy{},
+			build:    models.Build{Branch: "main", CreatedAt: daysAgo(365)},
+			position: 100,
+			want:     "",
+		},
+		{
+			name:     "among the newest",
+			policy:   models.RetentionPolicy{KeepPerBranch: 3},
+			build:    models.Build{Branch: "main", CreatedAt: daysAgo(365)},
+			position: 2,
+			want:     "",
+		},
+		{
+			name:     "beyond the newest",
+			policy:   models.RetentionPolicy{KeepPerBranch: 3},
+			build:    models.Build{Branch: "main", CreatedAt: daysAgo(1)},
+			position: 3,
+			want:     "not among the 3 newest of branch main",
+		},
+		{
+			name:     "beyond the newest tag builds",
+			policy:   models.RetentionPolicy{KeepPerBranch: 1},
+			build:    models.Build{Tag: "v1.0.0", CreatedAt: daysAgo(1)},
+			position: 1,
+			want:     "not among the 1 newest of tag builds",
+		},
+		{
+			name:     "younger than the maximum age",
+			policy:   models.RetentionPolicy{MaxAgeDays: 30},
+			build:    models.Build{Branch: "main", CreatedAt: daysAgo(29)},
+			position: 50,
+			want:     "",
+		},
+		{
+			name:   "exactly the maximum age",
+			policy: models.RetentionPolicy{MaxAgeDays: 30},
+			build:  models.Build{Branch: "main", CreatedAt: daysAgo(30)},
+			want:   "older than 30 days",
+		},
+		{
+			name:   "older than the maximum age",
+			policy: models.RetentionPolicy{MaxAgeDays: 30},
+			build:  models.Build{Branch: "main", CreatedAt: daysAgo(90)},
+			want:   "older than 30 days",
+		},
+		{
+			name:     "old but among the newest",
+			policy:   models.RetentionPolicy{KeepPerBranch: 5, MaxAgeDays: 30},
+			build:    models.Build{Branch: "main", CreatedAt: daysAgo(90)},
+			position: 4,
+			want:     "",
+		},
+		{
+			name:     "recent but beyond the newest",
+			policy:   models.RetentionPolicy{KeepPerBranch: 5, MaxAgeDays: 30},
+			build:    models.Build{Branch: "main", CreatedAt: daysAgo(10)},
+			position: 8,
+			want:     "",
+		},
+		{
+			name:     "old and beyond the newest",
+			policy:   models.RetentionPolicy{KeepPerBranch: 5, MaxAgeDays: 30},
+			build:    models.Build{Branch: "feature/login", CreatedAt: daysAgo(90)},
+			position: 5,
+			want:     "older than 30 days and not among the 5 newest of branch feature/login",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retentionReason(&tt.policy, &tt.build, tt.position, now); got != tt.want {
+				t.Errorf("retentionReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/models"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/registry"
+	"ys-cloud/pkg/scanner"
+
+	"github.com/sirupsen/logrus"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// ScanPolicy is the scan section of a pipeline configuration:
+//
+//	scan:
+//	  severity: high
+//	  action: block
+//	  ignore_unfixed: true
+//
+// Findings of the severity or above violate the policy and either fail the build or block its
+// deployments. A scan that cannot run violates the policy as well.
+type ScanPolicy struct {
+	Severity      string `json:"severity"`
+	Action        string `json:"action,omitempty"`         // fail or block, fail by default
+	IgnoreUnfixed bool   `json:"ignore_unfixed,omitempty"` // findings without a fixed version do not count
+}
+
+// parseScanPolicy reads the scan section of a YAML pipeline configuration, nil without one
+func parseScanPolicy(raw string) (*ScanPolicy, error) {
+	var config struct {
+		Scan *ScanPolicy `json:"scan"`
+	}
+	if strings.TrimSpace(raw) != "" {
+		if err := utilyaml.Unmarshal([]byte(raw), &config); err != nil {
+			return nil, fmt.Errorf("invalid pipeline config: %w", err)
+		}
+	}
+	policy := config.Scan
+	if policy == nil {
+		return nil, nil
+	}
+
+	policy.Severity = strings.ToUpper(policy.Severity)
+	if !slices.Contains(scanner.Severities, policy.Severity) {
+		return nil, errors.New("invalid pipeline config: scan severity must be one of unknown, low, medium, high or critical")
+	}
+	switch policy.Action {
+	case "":
+		policy.Action = "fail"
+	case "fail", "block":
+	default:
+		return nil, errors.New("invalid pipeline config: scan action must be fail or block")
+	}
+
+	return policy, nil
+}
+
+// violations counts the findings violating the policy
+func (p *ScanPolicy) violations(findings []scanner.Finding) int {
+	count := 0
+	for _, finding := range findings {
+		if p.IgnoreUnfixed && finding.FixedVersion == "" {
+			continue
+		}
+		if scanner.SeverityRank(finding.Severity) >= scanner.SeverityRank(p.Severity) {
+			count++
+		}
+	}
+	return count
+}
+
+type ScanService struct {
+	vulnerabilityRepo *repository.VulnerabilityRepository
+	buildRepo         *repository.BuildRepository
+	scanner           *scanner.Scanner
+	username          string
+	password          string
+}
+
+// NewScanService creates the service recording image scans; builds are not scanned when scanner is nil
+func NewScanService(vulnerabilityRepo *repository.VulnerabilityRepository, buildRepo *repository.BuildRepository, imageScanner *scanner.Scanner, cfg *config.Config) *ScanService {
+	return &ScanService{
+		vulnerabilityRepo: vulnerabilityRepo,
+		buildRepo:         buildRepo,
+		scanner:           imageScanner,
+		username:          cfg.Docker.Username,
+		password:          cfg.Docker.Password,
+	}
+}
+
+// Gates reports whether the release tags of a build wait for its scan. Builds with a scan policy
+// are pushed under their staging tag only, and their tags are added once the scan passed.
+func (s *ScanService) Gates(build *models.Build) bool {
+	policy, err := parseScanPolicy(build.Pipeline.Config)
+	return err == nil && policy != nil
+}
+
+// stagingTag is the tag a gated build is pushed and scanned under
+func stagingTag(buildID uint) string {
+	return fmt.Sprintf("build-%d", buildID)
+}
+
+// ScanBuild scans the pushed image of a build, records its findings and applies the pipeline's
+// scan policy. It returns an error when the policy fails the build.
+func (s *ScanService) ScanBuild(build *models.Build, image ImageBuild, digest string, output io.Writer) error {
+	policy, err := parseScanPolicy(build.Pipeline.Config)
+	if err != nil {
+		return err
+	}
+	if s.scanner == nil {
+		if policy == nil {
+			return nil
+		}
+		return s.enforce(build.ID, policy, errors.New("no vulnerability scanner is available"), output)
+	}
+
+	reference := fmt.Sprintf("%s:%s", image.Image, image.Tags[0])
+	if digest != "" {
+		reference = fmt.Sprintf("%s@%s", image.Image, digest)
+	}
+	fmt.Fprintf(output, "\nScanning %s for vulnerabilities\n", reference)
+
+	// Registries without project credentials fall back to the global ones
+	opts := scanner.ScanOptions{Image: reference, Username: s.username, Password: s.password, Output: output}
+	if auth := registry.Find(image.Registries, image.Image); auth != nil {
+		opts.Username, opts.Password = auth.Username, auth.Password
+	}
+
+	findings, err := s.scanner.Scan(opts)
+	if err != nil {
+		if policy == nil {
+			fmt.Fprintf(output, "Vulnerability scan failed: %v\n", err)
+			logrus.WithError(err).WithField("build_id", build.ID).Warn("Vulnerability scan failed")
+			return s.buildRepo.UpdateScanStatus(build.ID, "error")
+		}
+		return s.enforce(build.ID, policy, err, output)
+	}
+
+	if err := s.record(build.ID, findings); err != nil {
+		return err
+	}
+	fmt.Fprintf(output, "Found %d vulnerabilities%s\n", len(findings), formatSummary(summarize(findings)))
+
+	if policy != nil {
+		if count := policy.violations(findings); count > 0 {
+			return s.enforce(build.ID, policy, fmt.Errorf("%d vulnerabilities of severity %s or above", count, strings.ToLower(policy.Severity)), output)
+		}
+	}
+	return s.buildRepo.UpdateScanStatus(build.ID, "passed")
+}
+
+// enforce applies a violated policy: blocked builds succeed but cannot be deployed, failed builds fail
+func (s *ScanService) enforce(buildID uint, policy *ScanPolicy, reason error, output io.Writer) error {
+	if policy.Action == "block" {
+		fmt.Fprintf(output, "Deployments of this build are blocked: %v\n", reason)
+		return s.buildRepo.UpdateScanStatus(buildID, "blocked")
+	}
+
+	if err := s.buildRepo.UpdateScanStatus(buildID, "failed"); err != nil {
+		return err
+	}
+	return fmt.Errorf("vulnerability scan policy violated: %w", reason)
+}
+
+func (s *ScanService) record(buildID uint, findings []scanner.Finding) error {
+	if err := s.vulnerabilityRepo.DeleteByBuildID(buildID); err != nil {
+		return err
+	}
+
+	vulnerabilities := make([]*models.Vulnerability, 0, len(findings))
+	for _, finding := range findings {
+		vulnerabilities = append(vulnerabilities, &models.Vulnerability{
+			BuildID:          buildID,
+			VulnerabilityID:  finding.VulnerabilityID,
+			Severity:         finding.Severity,
+			Package:          finding.Package,
+			InstalledVersion: finding.InstalledVersion,
+			FixedVersion:     finding.FixedVersion,
+			Title:            finding.Title,
+			Target:           finding.Target,
+		})
+	}
+	return s.vulnerabilityRepo.CreateInBatches(vulnerabilities)
+}
+
+// GetByBuildID returns the findings of a build, most severe first, with their count per severity
+func (s *ScanService) GetByBuildID(buildID uint) ([]*models.Vulnerability, map[string]int, error) {
+	vulnerabilities, err := s.vulnerabilityRepo.GetByBuildID(buildID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := make(map[string]int, len(scanner.Severities))
+	for _, severity := range scanner.Severities {
+		summary[severity] = 0
+	}
+	for _, vulnerability := range vulnerabilities {
+		summary[vulnerability.Severity]++
+	}
+	return vulnerabilities, summary, nil
+}
+
+func summarize(findings []scanner.Finding) map[string]int {
+	summary := make(map[string]int)
+	for _, finding := range findings {
+		summary[finding.Severity]++
+	}
+	return summary
+}
+
+// formatSummary renders the counts per severity, most severe first
+func formatSummary(summary map[string]int) string {
+	var parts []string
+	for i := len(scanner.Severities) - 1; i >= 0; i-- {
+		if count := summary[scanner.Severities[i]]; count > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", scanner.Severities[i], count))
+		}
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(parts, ", ") + ")"
+}
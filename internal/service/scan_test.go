@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+	"ys-cloud/pkg/scanner"
+)
+
+func TestScanPolicyViolations(t *testing.T) {
+	findings := []scanner.Finding{
+		{VulnerabilityID: "CVE-1", Severity: "CRITICAL", FixedVersion: "1.0.1"},
+		{VulnerabilityID: "CVE-2", Severity: "HIGH"},
+		{VulnerabilityID: "CVE-3", Severity: "high", FixedVersion: "2.3.4"},
+		{VulnerabilityID: "CVE-4", Severity: "MEDIUM", FixedVersion: "0.9.0"},
+		{VulnerabilityID: "CVE-5", Severity: "LOW"},
+		{VulnerabilityID: "CVE-6", Severity: "UNKNOWN"},
+		{VulnerabilityID: "CVE-7", Severity: "NEGLIGIBLE"},
+	}
+
+	tests := []struct {
+		name     string
+		policy   ScanPolicy
+		findings []scanner.Finding
+		want     int
+	}{
+		{name: "critical", policy: ScanPolicy{Severity: "CRITICAL"}, findings: findings, want: 1},
+		{name: "high and above", policy: ScanPolicy{Severity: "HIGH"}, findings: findings, want: 3},
+		{name: "medium and above", policy: ScanPolicy{Severity: "MEDIUM"}, findings: findings, want: 4},
+		{name: "low and above", policy: ScanPolicy{Severity: "LOW"}, findings: findings, want: 5},
+		{name: "any severity", policy: ScanPolicy{Severity: "UNKNOWN"}, findings: findings, want: 7},
+		{name: "unfixed ignored", policy: ScanPolicy{Severity: "HIGH", IgnoreUnfixed: true}, findings: findings, want: 2},
+		{name: "unfixed ignored at any severity", policy: ScanPolicy{Severity: "UNKNOWN", IgnoreUnfixed: true}, findings: findings, want: 3},
+		{name: "no findings", policy: ScanPolicy{Severity: "LOW"}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.violations(tt.findings); got != tt.want {
+				t.Errorf("violations() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+package service
+
+import "time"
+
+// every runs fn in the background at a fixed interval for the lifetime of the process
+func every(interval time.Duration, fn func()) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			fn()
+		}
+	}()
+}
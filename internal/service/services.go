@@ -0,0 +1,155 @@
+package service
+
+import (
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/internal/repository"
+	"ys-cloud/pkg/crypto"
+	"ys-cloud/pkg/scanner"
+	"ys-cloud/pkg/signing"
+	"ys-cloud/pkg/storage"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Services holds the services of the API, wired once for every entrypoint
+type Services struct {
+	User        *UserService
+	Project     *ProjectService
+	Pipeline    *PipelineService
+	Build       *BuildService
+	Scan        *ScanService
+	Artifact    *ArtifactService
+	Deployment  *DeploymentService
+	Cluster     *ClusterService
+	Environment *EnvironmentService
+	Approval    *ApprovalService
+	Freeze      *FreezeService
+	Preview     *PreviewService
+	Certificate *CertificateService
+	Registry    *RegistryCredentialService
+	GC          *GarbageCollectionService
+	Drift       *DriftService
+	Retention   *RetentionService
+	Cache       *CacheService
+	Git         *GitService
+	Docker      *DockerService // nil without a Docker daemon
+	K8s         *K8sService    // nil without a default cluster
+
+	cfg *config.Config
+}
+
+// NewServices builds the services of the API. Without a database only the services that need no
+// repository are built and the others are left nil.
+func NewServices(db *gorm.DB, cfg *config.Config) (*Services, error) {
+	s := &Services{Git: NewGitService(cfg), cfg: cfg}
+
+	var err error
+	if s.Docker, err = NewDockerService(cfg); err != nil {
+		logrus.WithError(err).Warn("Failed to initialize Docker service")
+		s.Docker = nil
+	}
+	if s.K8s, err = NewK8sService(cfg); err != nil {
+		logrus.WithError(err).Warn("Failed to initialize Kubernetes service")
+		s.K8s = nil
+	}
+	if db == nil {
+		return s, nil
+	}
+
+	cipher, err := crypto.NewCipher(cfg.Security.EncryptionKey)
+	if err != nil {
+		logrus.WithError(err).Warn("Cluster, registry and webhook credentials cannot be stored or used")
+		cipher = nil
+	}
+	imageScanner, err := scanner.NewScanner(cfg)
+	if err != nil {
+		logrus.WithError(err).Warn("Images will not be scanned for vulnerabilities")
+		imageScanner = nil
+	}
+	imageSigner, err := signing.NewSigner(cfg)
+	if err != nil {
+		logrus.WithError(err).Warn("Images will not be signed")
+		imageSigner = nil
+	}
+	store, err := storage.NewStorage(cfg)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to initialize storage, step caches are disabled")
+		store = nil
+	}
+
+	userRepo := repository.NewUserRepository(db)
+	projectRepo := repository.NewProjectRepository(db)
+	pipelineRepo := repository.NewPipelineRepository(db)
+	buildRepo := repository.NewBuildRepository(db)
+	deploymentRepo := repository.NewDeploymentRepository(db)
+	clusterRepo := repository.NewClusterRepository(db)
+	environmentRepo := repository.NewEnvironmentRepository(db)
+	approvalRepo := repository.NewApprovalRepository(db)
+
+	s.User = NewUserService(userRepo)
+	s.Project = NewProjectService(projectRepo, userRepo, cipher)
+	s.Pipeline = NewPipelineService(pipelineRepo, projectRepo)
+	s.Cluster = NewClusterService(clusterRepo, cipher, cfg, s.K8s)
+	s.Environment = NewEnvironmentService(environmentRepo, projectRepo, clusterRepo)
+	s.Freeze = NewFreezeService(repository.NewFreezeWindowRepository(db), projectRepo, environmentRepo)
+	s.Certificate = NewCertificateService(repository.NewCertificateRepository(db), projectRepo, deploymentRepo, cipher)
+	s.Registry = NewRegistryCredentialService(repository.NewRegistryCredentialRepository(db), projectRepo, cipher)
+	s.Artifact = NewArtifactService(repository.NewBuildArtifactRepository(db), buildRepo, imageScanner, imageSigner, cfg)
+	s.Deployment = NewDeploymentService(deploymentRepo, buildRepo, environmentRepo, approvalRepo, projectRepo, s.Freeze, s.Cluster, s.Certificate, s.Registry, s.Artifact, s.Git, cfg)
+	s.Approval = NewApprovalService(approvalRepo, projectRepo, s.Deployment)
+	s.Preview = NewPreviewService(repository.NewPreviewEnvironmentRepository(db), projectRepo, buildRepo, s.Deployment, s.Cluster, s.Git, cfg)
+	s.Cache = NewCacheService(repository.NewBuildCacheRepository(db), projectRepo, store, cfg)
+	s.Scan = NewScanService(repository.NewVulnerabilityRepository(db), buildRepo, imageScanner, cfg)
+
+	imageBuilder := NewImageBuilder(cfg, s.Docker, s.Git, s.K8s)
+	if imageBuilder == nil {
+		logrus.Warnf("No image builder available for build backend %q", cfg.Build.Backend)
+	}
+	stepRunner := NewStepRunner(s.Docker, s.Git, s.Cache, cfg)
+	s.Build = NewBuildService(buildRepo, pipelineRepo, imageBuilder, stepRunner, s.Preview, s.Registry, s.Scan, s.Artifact, cfg)
+
+	s.GC = NewGarbageCollectionService(s.Cluster, projectRepo, environmentRepo, deploymentRepo, cfg)
+	s.Drift = NewDriftService(repository.NewDriftRepository(db), deploymentRepo, projectRepo, s.Cluster, s.Freeze, cfg)
+	s.Retention = NewRetentionService(repository.NewRetentionPolicyRepository(db), projectRepo, buildRepo, deploymentRepo, s.Docker, s.Registry, cfg)
+
+	return s, nil
+}
+
+// StartWorkers starts the background jobs of the services that were built. Jobs with an interval
+// configured as zero are disabled.
+func (s *Services) StartWorkers() {
+	if s.Deployment != nil {
+		s.Deployment.StartRetirer(time.Minute)
+		if interval, err := time.ParseDuration(s.cfg.K8s.RegistryRefresh); err == nil && interval > 0 {
+			s.Deployment.StartRegistryRefresher(interval)
+		}
+	}
+	if s.Approval != nil {
+		s.Approval.StartExpiryWorker(time.Minute)
+	}
+	if s.Preview != nil {
+		s.Preview.StartReaper(5 * time.Minute)
+	}
+	if s.Cache != nil {
+		if interval, err := time.ParseDuration(s.cfg.Build.CacheCleanInterval); err == nil && interval > 0 {
+			s.Cache.StartCleaner(interval)
+		}
+	}
+	if s.GC != nil {
+		if interval, err := time.ParseDuration(s.cfg.K8s.GCInterval); err == nil && interval > 0 {
+			s.GC.StartCollector(interval)
+		}
+	}
+	if s.Drift != nil {
+		if interval, err := time.ParseDuration(s.cfg.K8s.DriftInterval); err == nil && interval > 0 {
+			s.Drift.StartDetector(interval)
+		}
+	}
+	if s.Retention != nil {
+		if interval, err := time.ParseDuration(s.cfg.Build.RetentionInterval); err == nil && interval > 0 {
+			s.Retention.StartEnforcer(interval)
+		}
+	}
+}
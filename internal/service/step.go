@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/pkg/docker"
+	"ys-cloud/pkg/registry"
+
+	dockerregistry "github.com/docker/docker/api/types/registry"
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// PipelineStep is an entry of the steps section of a pipeline configuration:
+//
+//	steps:
+//	  - name: test
+//	    image: golang:1.24
+//	    commands:
+//	      - go vet ./...
+//	      - go test ./...
+//	    env:
+//	      CGO_ENABLED: "0"
+//	    timeout: 15m
+//	    cpus: 1
+//	    memory: 1GB
+//	    caches:
+//	      - name: go-build
+//	        path: /root/.cache/go-build
+//	        key: go-{{ checksum go.sum }}
+//
+// Steps run in order before the image is built, each in its own container with the cloned
+// repository mounted at /workspace, so files written by a step are seen by the next ones. A step
+// exiting with a non-zero code fails the build.
+type PipelineStep struct {
+	Name     string            `json:"name"`
+	Image    string            `json:"image"`
+	Commands []string          `json:"commands"`
+	Shell    string            `json:"shell,omitempty"` // defaults to /bin/sh
+	Env      map[string]string `json:"env,omitempty"`
+	Timeout  string            `json:"timeout,omitempty"` // defaults to build.step_timeout
+	CPUs     float64           `json:"cpus,omitempty"`    // capped at build.step_cpus
+	Memory   string            `json:"memory,omitempty"`  // capped at build.step_memory
+	Caches   []StepCache       `json:"caches,omitempty"`
+}
+
+// parsePipelineSteps reads the steps section of a YAML pipeline configuration
+func parsePipelineSteps(raw string) ([]PipelineStep, error) {
+	var config struct {
+		Steps []PipelineStep `json:"steps"`
+	}
+	if strings.TrimSpace(raw) != "" {
+		if err := utilyaml.Unmarshal([]byte(raw), &config); err != nil {
+			return nil, fmt.Errorf("invalid pipeline config: %w", err)
+		}
+	}
+
+	names := make(map[string]bool, len(config.Steps))
+	cacheKeys := make(map[string]string)
+	for _, step := range config.Steps {
+		if step.Name == "" {
+			return nil, errors.New("invalid pipeline config: step name is required")
+		}
+		if names[step.Name] {
+			return nil, fmt.Errorf("invalid pipeline config: duplicate step %s", step.Name)
+		}
+		names[step.Name] = true
+
+		if step.Image == "" {
+			return nil, fmt.Errorf("invalid pipeline config: step %s has no image", step.Name)
+		}
+		if len(step.Commands) == 0 {
+			return nil, fmt.Errorf("invalid pipeline config: step %s has no commands", step.Name)
+		}
+		if step.Timeout != "" {
+			if timeout, err := time.ParseDuration(step.Timeout); err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("invalid pipeline config: invalid timeout of step %s", step.Name)
+			}
+		}
+		if step.CPUs < 0 {
+			return nil, fmt.Errorf("invalid pipeline config: invalid cpus of step %s", step.Name)
+		}
+		if step.Memory != "" {
+			if memory, err := units.RAMInBytes(step.Memory); err != nil || memory <= 0 {
+				return nil, fmt.Errorf("invalid pipeline config: invalid memory of step %s", step.Name)
+			}
+		}
+
+		for _, cache := range step.Caches {
+			if err := validateStepCache(cache); err != nil {
+				return nil, fmt.Errorf("invalid pipeline config: step %s: %w", step.Name, err)
+			}
+			if key, ok := cacheKeys[cache.Name]; ok && key != cache.Key {
+				return nil, fmt.Errorf("invalid pipeline config: cache %s is declared with different keys", cache.Name)
+			}
+			cacheKeys[cache.Name] = cache.Key
+		}
+	}
+
+	return config.Steps, nil
+}
+
+// StepRunner runs pipeline steps in containers of the Docker daemon
+type StepRunner struct {
+	dockerService *DockerService
+	gitService    *GitService
+	cacheService  *CacheService
+	timeout       time.Duration
+	nanoCPUs      int64
+	memory        int64
+}
+
+// NewStepRunner returns nil without a Docker daemon
+func NewStepRunner(dockerService *DockerService, gitService *GitService, cacheService *CacheService, cfg *config.Config) *StepRunner {
+	if dockerService == nil {
+		return nil
+	}
+
+	runner := &StepRunner{dockerService: dockerService, gitService: gitService, cacheService: cacheService}
+	if timeout, err := time.ParseDuration(cfg.Build.StepTimeout); err == nil {
+		runner.timeout = timeout
+	}
+	if cfg.Build.StepCPUs > 0 {
+		runner.nanoCPUs = int64(cfg.Build.StepCPUs * 1e9)
+	}
+	if cfg.Build.StepMemory != "" {
+		if memory, err := units.RAMInBytes(cfg.Build.StepMemory); err != nil {
+			logrus.WithError(err).Warn("Invalid build.step_memory, step memory is unlimited")
+		} else {
+			runner.memory = memory
+		}
+	}
+	return runner
+}
+
+// Run clones the sources of a build and runs the steps in order, stopping at the first failing one.
+// The step caches are restored beforehand and saved once every step has passed. Cancelling ctx
+// kills the running step.
+func (r *StepRunner) Run(ctx context.Context, build ImageBuild, steps []PipelineStep, output io.Writer) error {
+	repo, err := r.gitService.CloneSources(build.GitURL, build.Tag, build.Ref, build.Branch, build.CommitHash)
+	if err != nil {
+		return err
+	}
+	defer r.gitService.Cleanup(repo.RepoPath)
+
+	var caches *buildCaches
+	if r.cacheService != nil {
+		caches = r.cacheService.Restore(build, steps, repo.RepoPath, output)
+		defer caches.remove()
+	}
+
+	for _, step := range steps {
+		if ctx.Err() != nil {
+			return errors.New("build cancelled")
+		}
+		fmt.Fprintf(output, "\nStep %s (%s)\n", step.Name, step.Image)
+
+		opts, err := r.stepOptions(build, step, repo.RepoPath, output)
+		if err != nil {
+			return err
+		}
+		opts.Mounts = caches.mounts(step)
+		result, err := r.dockerService.RunStep(ctx, opts)
+		if errors.Is(err, context.Canceled) {
+			// The step container was killed
+			return fmt.Errorf("build cancelled during step %s", step.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+
+		switch {
+		case result.TimedOut:
+			return fmt.Errorf("step %s timed out after %s", step.Name, opts.Timeout)
+		case result.OOMKilled:
+			return fmt.Errorf("step %s ran out of memory", step.Name)
+		case result.ExitCode != 0:
+			return fmt.Errorf("step %s failed with exit code %d", step.Name, result.ExitCode)
+		}
+		fmt.Fprintf(output, "Step %s passed in %s\n", step.Name, result.Duration.Round(time.Second))
+	}
+
+	if r.cacheService != nil {
+		r.cacheService.Save(build, caches, output)
+	}
+	return nil
+}
+
+// stepOptions resolves the container of a step: its limits, the build variables and the credentials
+// for pulling its image
+func (r *StepRunner) stepOptions(build ImageBuild, step PipelineStep, workspace string, output io.Writer) (docker.StepOptions, error) {
+	env := map[string]string{
+		"CI":            "true",
+		"YS_BUILD_ID":   strconv.FormatUint(uint64(build.BuildID), 10),
+		"YS_BRANCH":     build.Branch,
+		"YS_TAG":        build.Tag,
+		"YS_COMMIT_SHA": build.CommitHash,
+		"YS_IMAGE":      build.Image,
+	}
+	for key, value := range step.Env {
+		env[key] = value
+	}
+
+	opts := docker.StepOptions{
+		Name:      step.Name,
+		Image:     step.Image,
+		Commands:  step.Commands,
+		Shell:     step.Shell,
+		Env:       env,
+		Workspace: workspace,
+		Timeout:   r.timeout,
+		NanoCPUs:  r.nanoCPUs,
+		Memory:    r.memory,
+		Output:    output,
+	}
+	if step.Timeout != "" {
+		timeout, err := time.ParseDuration(step.Timeout)
+		if err != nil {
+			return opts, fmt.Errorf("invalid timeout of step %s: %w", step.Name, err)
+		}
+		opts.Timeout = timeout
+	}
+	if nanoCPUs := int64(step.CPUs * 1e9); nanoCPUs > 0 && (opts.NanoCPUs == 0 || nanoCPUs < opts.NanoCPUs) {
+		opts.NanoCPUs = nanoCPUs
+	}
+	if step.Memory != "" {
+		memory, err := units.RAMInBytes(step.Memory)
+		if err != nil {
+			return opts, fmt.Errorf("invalid memory of step %s: %w", step.Name, err)
+		}
+		if opts.Memory == 0 || memory < opts.Memory {
+			opts.Memory = memory
+		}
+	}
+
+	if auth := registry.Find(build.Registries, step.Image); auth != nil {
+		opts.Auth = &dockerregistry.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.Registry,
+		}
+	}
+	return opts, nil
+}
@@ -38,6 +38,12 @@ kubectl apply -f configmaps.yaml
 echo "  - 创建密钥..."
 kubectl apply -f secrets.yaml
 
+# 加密密钥用于加密数据库中保存的集群、镜像仓库等凭据，只在首次部署时随机生成，更换后已保存的凭据将无法解密
+if ! kubectl get secret app-encryption-key -n ys-cloud > /dev/null 2>&1; then
+    echo "  - 生成加密密钥..."
+    kubectl create secret generic app-encryption-key -n ys-cloud --from-literal=encryption-key="$(openssl rand -hex 32)"
+fi
+
 # 3. 部署后端应用
 echo "  - 部署 ys-cloud 后端服务..."
 kubectl apply -f ys-cloud-app-deployment.yaml
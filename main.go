@@ -6,7 +6,6 @@ import (
 	"ys-cloud/internal/config"
 	"ys-cloud/internal/handler"
 	"ys-cloud/internal/middleware"
-	"ys-cloud/internal/repository"
 	"ys-cloud/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -35,38 +34,31 @@ func Run() error {
 		return fmt.Errorf("failed to initialize database: %w", err)
 	}
 
-	// Initialize repositories
-	userRepo := repository.NewUserRepository(db)
-	projectRepo := repository.NewProjectRepository(db)
-	pipelineRepo := repository.NewPipelineRepository(db)
-	buildRepo := repository.NewBuildRepository(db)
-	deploymentRepo := repository.NewDeploymentRepository(db)
-
 	// Initialize services
-	userService := service.NewUserService(userRepo)
-	projectService := service.NewProjectService(projectRepo, userRepo)
-	pipelineService := service.NewPipelineService(pipelineRepo, projectRepo)
-	buildService := service.NewBuildService(buildRepo, pipelineRepo)
-	gitService := service.NewGitService()
-	dockerService, err := service.NewDockerService(cfg)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize Docker service: %v", err)
-		dockerService = nil
-	}
-	k8sService, err := service.NewK8sService(cfg)
+	services, err := service.NewServices(db, cfg)
 	if err != nil {
-		log.Printf("Warning: Failed to initialize Kubernetes service: %v", err)
-		k8sService = nil
+		return err
 	}
-	deploymentService := service.NewDeploymentService(deploymentRepo, k8sService)
+	services.StartWorkers()
 
 	// Initialize handlers
-	userHandler := handler.NewUserHandler(userService)
-	projectHandler := handler.NewProjectHandler(projectService)
-	pipelineHandler := handler.NewPipelineHandler(pipelineService, gitService)
-	buildHandler := handler.NewBuildHandler(buildService, gitService, dockerService, k8sService)
-	deploymentHandler := handler.NewDeploymentHandler(deploymentService, k8sService)
-	webhookHandler := handler.NewWebhookHandler(projectService, pipelineService, buildService)
+	userHandler := handler.NewUserHandler(services.User)
+	projectHandler := handler.NewProjectHandler(services.Project)
+	pipelineHandler := handler.NewPipelineHandler(services.Pipeline, services.Git)
+	buildHandler := handler.NewBuildHandler(services.Build, services.Scan, services.Artifact, services.Git, services.K8s)
+	deploymentHandler := handler.NewDeploymentHandler(services.Deployment, services.K8s)
+	clusterHandler := handler.NewClusterHandler(services.Cluster)
+	environmentHandler := handler.NewEnvironmentHandler(services.Environment, services.Deployment)
+	approvalHandler := handler.NewApprovalHandler(services.Approval)
+	freezeHandler := handler.NewFreezeHandler(services.Freeze)
+	previewHandler := handler.NewPreviewHandler(services.Preview)
+	certificateHandler := handler.NewCertificateHandler(services.Certificate)
+	registryHandler := handler.NewRegistryCredentialHandler(services.Registry)
+	gcHandler := handler.NewGarbageCollectionHandler(services.GC)
+	driftHandler := handler.NewDriftHandler(services.Drift)
+	retentionHandler := handler.NewRetentionHandler(services.Retention)
+	cacheHandler := handler.NewCacheHandler(services.Cache)
+	webhookHandler := handler.NewWebhookHandler(services.Project, services.Pipeline, services.Build, services.Git, services.Preview)
 
 	// Set Gin mode
 	gin.SetMode(cfg.Server.GinMode)
@@ -137,6 +129,54 @@ func Run() error {
 				projects.DELETE("/:id", projectHandler.DeleteProject)
 				projects.POST("/:id/collaborators", projectHandler.AddCollaborator)
 				projects.DELETE("/:id/collaborators/:userId", projectHandler.RemoveCollaborator)
+				projects.POST("/:id/webhook-secret", projectHandler.RotateWebhookSecret)
+				projects.GET("/:id/environments", environmentHandler.GetEnvironments)
+				projects.POST("/:id/environments", environmentHandler.CreateEnvironment)
+				projects.GET("/:id/previews", previewHandler.GetPreviews)
+				projects.GET("/:id/certificates", certificateHandler.GetCertificates)
+				projects.POST("/:id/certificates", certificateHandler.CreateCertificate)
+				projects.GET("/:id/registry-credentials", registryHandler.GetRegistryCredentials)
+				projects.POST("/:id/registry-credentials", registryHandler.CreateRegistryCredential)
+				projects.GET("/:id/retention-policy", retentionHandler.GetRetentionPolicy)
+				projects.PUT("/:id/retention-policy", retentionHandler.UpdateRetentionPolicy)
+				projects.DELETE("/:id/retention-policy", retentionHandler.DeleteRetentionPolicy)
+				projects.GET("/:id/retention/report", retentionHandler.GetRetentionReport)
+				projects.POST("/:id/retention/enforce", retentionHandler.EnforceRetentionPolicy)
+				projects.GET("/:id/caches", cacheHandler.GetProjectCaches)
+				projects.DELETE("/:id/caches/:cacheId", cacheHandler.DeleteCache)
+			}
+
+			// Environment routes
+			environments := protected.Group("/environments")
+			{
+				environments.GET("/:id", environmentHandler.GetEnvironment)
+				environments.PUT("/:id", environmentHandler.UpdateEnvironment)
+				environments.DELETE("/:id", environmentHandler.DeleteEnvironment)
+				environments.GET("/:id/deployments", environmentHandler.GetEnvironmentDeployments)
+				environments.POST("/:id/promote", environmentHandler.PromoteEnvironment)
+				environments.POST("/:id/promote/override", middleware.RequireRole("admin"), environmentHandler.PromoteEnvironmentOverride)
+			}
+
+			// Preview environment routes
+			previews := protected.Group("/previews")
+			{
+				previews.GET("/:id", previewHandler.GetPreview)
+				previews.DELETE("/:id", previewHandler.DeletePreview)
+			}
+
+			// Certificate routes
+			certificates := protected.Group("/certificates")
+			{
+				certificates.GET("/:id", certificateHandler.GetCertificate)
+				certificates.DELETE("/:id", certificateHandler.DeleteCertificate)
+			}
+
+			// Registry credential routes
+			registryCredentials := protected.Group("/registry-credentials")
+			{
+				registryCredentials.GET("/:id", registryHandler.GetRegistryCredential)
+				registryCredentials.PUT("/:id", registryHandler.UpdateRegistryCredential)
+				registryCredentials.DELETE("/:id", registryHandler.DeleteRegistryCredential)
 			}
 
 			// Pipeline routes
@@ -159,26 +199,102 @@ func Run() error {
 				builds.GET("/", buildHandler.GetBuilds)
 				builds.GET("/:id", buildHandler.GetBuild)
 				builds.GET("/:id/logs", buildHandler.GetBuildLogs)
+				builds.GET("/:id/vulnerabilities", buildHandler.GetBuildVulnerabilities)
+				builds.GET("/:id/artifacts", buildHandler.GetBuildArtifacts)
+				builds.GET("/:id/artifacts/:artifactId", buildHandler.DownloadBuildArtifact)
 				builds.POST("/:id/cancel", buildHandler.CancelBuild)
 			}
 
 			// Deployment routes
 			deployments := protected.Group("/deployments")
 			{
+				deployments.POST("/", deploymentHandler.CreateDeployment)
+				deployments.POST("/override", middleware.RequireRole("admin"), deploymentHandler.CreateDeploymentOverride)
 				deployments.GET("/", deploymentHandler.GetDeployments)
 				deployments.GET("/:id", deploymentHandler.GetDeployment)
 				deployments.GET("/:id/logs", deploymentHandler.GetDeploymentLogs)
+				deployments.GET("/:id/pods", deploymentHandler.GetDeploymentPods)
+				deployments.GET("/:id/events", deploymentHandler.GetDeploymentEvents)
+				deployments.GET("/:id/releases", deploymentHandler.GetDeploymentReleases)
+				deployments.GET("/:id/approval", approvalHandler.GetDeploymentApproval)
 				deployments.POST("/:id/rollback", deploymentHandler.RollbackDeployment)
+				deployments.POST("/:id/rollback/override", middleware.RequireRole("admin"), deploymentHandler.RollbackDeploymentOverride)
+				deployments.POST("/:id/scale", deploymentHandler.ScaleDeployment)
+				deployments.POST("/:id/scale/override", middleware.RequireRole("admin"), deploymentHandler.ScaleDeploymentOverride)
+				deployments.PUT("/:id/canary/weight", deploymentHandler.SetCanaryWeight)
+				deployments.PUT("/:id/canary/weight/override", middleware.RequireRole("admin"), deploymentHandler.SetCanaryWeightOverride)
+				deployments.POST("/:id/canary/promote", deploymentHandler.PromoteCanary)
+				deployments.POST("/:id/canary/promote/override", middleware.RequireRole("admin"), deploymentHandler.PromoteCanaryOverride)
+				deployments.POST("/:id/canary/abort", deploymentHandler.AbortCanary)
+				deployments.GET("/:id/drift", driftHandler.GetDeploymentDrifts)
+				deployments.POST("/:id/drift/check", driftHandler.CheckDeploymentDrift)
+				deployments.POST("/:id/drift/revert", driftHandler.RevertDeploymentDrift)
+			}
+
+			// Drift routes
+			drifts := protected.Group("/drifts")
+			{
+				drifts.GET("/", driftHandler.GetDrifts)
+				drifts.GET("/:id", driftHandler.GetDrift)
+				drifts.POST("/detect", middleware.RequireRole("admin"), driftHandler.DetectDrift)
+			}
+
+			// Approval routes
+			approvals := protected.Group("/approvals")
+			{
+				approvals.GET("/", approvalHandler.GetApprovals)
+				approvals.GET("/:id", approvalHandler.GetApproval)
+				approvals.POST("/:id/approve", approvalHandler.Approve)
+				approvals.POST("/:id/reject", approvalHandler.Reject)
+			}
+
+			// Freeze window routes
+			freezeWindows := protected.Group("/freeze-windows")
+			{
+				freezeWindows.GET("/", freezeHandler.GetFreezeWindows)
+				freezeWindows.GET("/:id", freezeHandler.GetFreezeWindow)
+				freezeWindows.POST("/", middleware.RequireRole("admin"), freezeHandler.CreateFreezeWindow)
+				freezeWindows.PUT("/:id", middleware.RequireRole("admin"), freezeHandler.UpdateFreezeWindow)
+				freezeWindows.DELETE("/:id", middleware.RequireRole("admin"), freezeHandler.DeleteFreezeWindow)
+			}
+
+			// Cluster routes
+			clusters := protected.Group("/clusters")
+			clusters.Use(middleware.RequireRole("admin"))
+			{
+				clusters.POST("/", clusterHandler.CreateCluster)
+				clusters.GET("/", clusterHandler.GetClusters)
+				clusters.GET("/:id", clusterHandler.GetCluster)
+				clusters.PUT("/:id", clusterHandler.UpdateCluster)
+				clusters.DELETE("/:id", clusterHandler.DeleteCluster)
+				clusters.POST("/:id/check", clusterHandler.CheckCluster)
+			}
+
+			// Cluster binding routes
+			bindings := protected.Group("/cluster-bindings")
+			bindings.Use(middleware.RequireRole("admin"))
+			{
+				bindings.GET("/", clusterHandler.GetBindings)
+				bindings.PUT("/:environment", clusterHandler.SetBinding)
+				bindings.DELETE("/:environment", clusterHandler.DeleteBinding)
+			}
+
+			// Garbage collection routes
+			gc := protected.Group("/gc")
+			gc.Use(middleware.RequireRole("admin"))
+			{
+				gc.GET("/report", gcHandler.GetReport)
+				gc.POST("/collect", gcHandler.Collect)
 			}
 		}
 	}
 
-	// Webhook routes (public, secured by secret)
+	// Webhook routes (public, verified with the project's webhook secret)
 	webhooks := r.Group("/webhooks")
 	{
-		webhooks.POST("/github/:projectSecret", webhookHandler.HandleGitHub)
-		webhooks.POST("/gitlab/:projectSecret", webhookHandler.HandleGitLab)
-		webhooks.POST("/gitee/:projectSecret", webhookHandler.HandleGitee)
+		webhooks.POST("/github/:projectId", webhookHandler.HandleGitHub)
+		webhooks.POST("/gitlab/:projectId", webhookHandler.HandleGitLab)
+		webhooks.POST("/gitee/:projectId", webhookHandler.HandleGitee)
 	}
 
 	// Start server
@@ -0,0 +1,277 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// BuildSecret is exposed to RUN --mount=type=secret,id=<ID> instructions. The value is read from
+// Src, a file on the build host, or passed directly in Value.
+type BuildSecret struct {
+	ID    string
+	Src   string
+	Value string
+}
+
+// requiresBuildKit reports whether the options use features the classic builder lacks
+func (opts BuildOptions) requiresBuildKit() bool {
+	return len(opts.Platforms) > 0 || len(opts.CacheFrom) > 0 || len(opts.CacheTo) > 0 ||
+		len(opts.Secrets) > 0 || len(opts.SSH) > 0 || opts.Push
+}
+
+// tags returns every reference the image is tagged with, the primary tag first
+func (opts BuildOptions) tags() []string {
+	tags := []string{fmt.Sprintf("%s:%s", opts.ImageName, opts.ImageTag)}
+	for _, tag := range opts.ExtraTags {
+		tags = append(tags, fmt.Sprintf("%s:%s", opts.ImageName, tag))
+	}
+	return tags
+}
+
+// useBuildKit reports whether a build runs through docker buildx. Builds fall back to the classic
+// builder when the buildx plugin is missing, unless they need BuildKit features.
+func (s *DockerService) useBuildKit(opts BuildOptions) (bool, error) {
+	if !s.config.BuildKit {
+		if opts.requiresBuildKit() {
+			return false, fmt.Errorf("build options require BuildKit")
+		}
+		return false, nil
+	}
+
+	s.buildx.Do(func() {
+		args := []string{"buildx", "version"}
+		if s.config.Host != "" {
+			args = append([]string{"--host", s.config.Host}, args...)
+		}
+		if err := exec.Command("docker", args...).Run(); err != nil {
+			s.logger.WithError(err).Warn("docker buildx is not available, building with the classic builder")
+			return
+		}
+		s.hasBuildx = true
+	})
+
+	if !s.hasBuildx && opts.requiresBuildKit() {
+		return false, fmt.Errorf("build options require BuildKit, but docker buildx is not installed")
+	}
+	return s.hasBuildx, nil
+}
+
+// buildWithBuildKit runs the build through docker buildx and returns the build output. Registry
+// credentials come from the Docker CLI configuration of the host, extended by opts.AuthConfigs.
+func (s *DockerService) buildWithBuildKit(ctx context.Context, opts BuildOptions) (string, error) {
+	// Multi-platform images cannot be loaded into the local image store
+	if len(opts.Platforms) > 1 && !opts.Push {
+		return "", fmt.Errorf("multi-platform builds must be pushed")
+	}
+
+	args, env, err := s.buildxArgs(opts)
+	if err != nil {
+		return "", err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"image_name": opts.ImageName,
+		"image_tag":  opts.ImageTag,
+		"context":    opts.ContextDir,
+		"dockerfile": opts.Dockerfile,
+		"platforms":  opts.Platforms,
+	}).Info("Starting BuildKit image build")
+
+	if len(opts.AuthConfigs) > 0 {
+		configDir, err := dockerConfigWithAuths(opts.AuthConfigs)
+		if err != nil {
+			return "", err
+		}
+		defer os.RemoveAll(configDir)
+		env = append(env, "DOCKER_CONFIG="+configDir)
+	}
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Dir = opts.ContextDir
+	cmd.Env = append(os.Environ(), env...)
+
+	output, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", fmt.Errorf("failed to start image build: %w", err)
+	}
+	cmd.Stderr = cmd.Stdout
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start image build: %w", err)
+	}
+
+	// Stream and collect build progress
+	var logs bytes.Buffer
+	scanner := bufio.NewScanner(io.TeeReader(output, &logs))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		s.logger.WithField("progress", scanner.Text()).Debug("Build progress")
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return logs.String(), fmt.Errorf("build failed: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"image_name": opts.ImageName,
+		"image_tag":  opts.ImageTag,
+		"pushed":     opts.Push,
+	}).Info("BuildKit image build completed successfully")
+
+	return logs.String(), nil
+}
+
+// buildxArgs renders the docker buildx build command line and the environment carrying secret values
+func (s *DockerService) buildxArgs(opts BuildOptions) ([]string, []string, error) {
+	var args, env []string
+	if s.config.Host != "" {
+		args = append(args, "--host", s.config.Host)
+	}
+	args = append(args, "buildx", "build", "--file", opts.Dockerfile, "--progress", "plain")
+	for _, tag := range opts.tags() {
+		args = append(args, "--tag", tag)
+	}
+	if s.config.Builder != "" {
+		args = append(args, "--builder", s.config.Builder)
+	}
+	if opts.NoCache {
+		args = append(args, "--no-cache")
+	}
+	if opts.Target != "" {
+		args = append(args, "--target", opts.Target)
+	}
+	if len(opts.Platforms) > 0 {
+		args = append(args, "--platform", strings.Join(opts.Platforms, ","))
+	}
+
+	for _, name := range sortedKeys(opts.BuildArgs) {
+		// A nil value takes the argument from the environment, as with the classic builder
+		if value := opts.BuildArgs[name]; value != nil {
+			args = append(args, "--build-arg", name+"="+*value)
+		} else {
+			args = append(args, "--build-arg", name)
+		}
+	}
+	for _, name := range sortedKeys(opts.Labels) {
+		args = append(args, "--label", name+"="+opts.Labels[name])
+	}
+
+	for _, cache := range opts.CacheFrom {
+		args = append(args, "--cache-from", cache)
+	}
+	for _, cache := range opts.CacheTo {
+		args = append(args, "--cache-to", cache)
+	}
+
+	for i, secret := range opts.Secrets {
+		if secret.ID == "" {
+			return nil, nil, fmt.Errorf("build secret id is required")
+		}
+		switch {
+		case secret.Src != "" && secret.Value != "":
+			return nil, nil, fmt.Errorf("build secret %s takes either a source file or a value", secret.ID)
+		case secret.Src != "":
+			args = append(args, "--secret", fmt.Sprintf("id=%s,src=%s", secret.ID, secret.Src))
+		default:
+			// Values travel through the environment so they never appear in the process list
+			variable := fmt.Sprintf("YS_BUILD_SECRET_%d", i)
+			env = append(env, variable+"="+secret.Value)
+			args = append(args, "--secret", fmt.Sprintf("id=%s,env=%s", secret.ID, variable))
+		}
+	}
+	for _, ssh := range opts.SSH {
+		args = append(args, "--ssh", ssh)
+	}
+
+	if opts.Push {
+		args = append(args, "--push")
+	} else {
+		args = append(args, "--load")
+	}
+
+	return append(args, "."), env, nil
+}
+
+// dockerConfigWithAuths writes a temporary Docker CLI configuration directory holding the host's
+// configuration with the given credentials added. Builder instances and contexts of the host
+// stay available through links.
+func dockerConfigWithAuths(auths map[string]registry.AuthConfig) (string, error) {
+	hostDir := os.Getenv("DOCKER_CONFIG")
+	if hostDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate docker config: %w", err)
+		}
+		hostDir = filepath.Join(home, ".docker")
+	}
+
+	config := make(map[string]any)
+	data, err := os.ReadFile(filepath.Join(hostDir, "config.json"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("failed to read docker config: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("failed to parse docker config: %w", err)
+		}
+	}
+
+	// Stored credentials take precedence over credential helpers of the host
+	hostAuths, _ := config["auths"].(map[string]any)
+	if hostAuths == nil {
+		hostAuths = make(map[string]any)
+	}
+	helpers, _ := config["credHelpers"].(map[string]any)
+	for key, auth := range auths {
+		hostAuths[key] = map[string]string{"auth": base64Credentials(auth.Username, auth.Password)}
+		delete(helpers, key)
+	}
+	config["auths"] = hostAuths
+	delete(config, "credsStore")
+
+	dir, err := os.MkdirTemp("", "ys-cloud-docker-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create docker config: %w", err)
+	}
+	if data, err = json.Marshal(config); err == nil {
+		err = os.WriteFile(filepath.Join(dir, "config.json"), data, 0600)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to write docker config: %w", err)
+	}
+
+	for _, name := range []string{"buildx", "contexts"} {
+		if _, err := os.Stat(filepath.Join(hostDir, name)); err == nil {
+			os.Symlink(filepath.Join(hostDir, name), filepath.Join(dir, name))
+		}
+	}
+	return dir, nil
+}
+
+func base64Credentials(username, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+}
+
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/docker/go-units"
+	"github.com/moby/patternmatcher"
+	"github.com/moby/patternmatcher/ignorefile"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultContextExcludes apply to repositories without an ignore file
+var defaultContextExcludes = []string{".git", ".gitignore", "Dockerfile.dockerignore"}
+
+// buildContext describes the files of a context directory sent to the builder
+type buildContext struct {
+	Excludes []string
+	Size     int64
+}
+
+// prepareContext reads the ignore patterns of the build context, measures the files that remain
+// and enforces the configured context size limit
+func (s *DockerService) prepareContext(opts BuildOptions) (*buildContext, error) {
+	excludes, err := contextExcludes(opts.ContextDir, opts.Dockerfile)
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := contextSize(opts.ContextDir, excludes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure build context: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"context": opts.ContextDir,
+		"size":    units.HumanSize(float64(size)),
+	}).Info("Build context prepared")
+
+	if s.config.MaxContextSize != "" {
+		limit, err := units.FromHumanSize(s.config.MaxContextSize)
+		if err != nil {
+			return nil, fmt.Errorf("invalid max context size %q: %w", s.config.MaxContextSize, err)
+		}
+		if size > limit {
+			return nil, fmt.Errorf("build context is %s, which exceeds the limit of %s; exclude large directories such as node_modules in .dockerignore",
+				units.HumanSize(float64(size)), units.HumanSize(float64(limit)))
+		}
+	}
+
+	return &buildContext{Excludes: excludes, Size: size}, nil
+}
+
+// contextExcludes returns the patterns of <Dockerfile>.dockerignore, or else .dockerignore, in
+// the context directory. The Dockerfile and .dockerignore are always sent because the builder
+// reads them.
+func contextExcludes(contextDir, dockerfile string) ([]string, error) {
+	for _, name := range []string{dockerfile + ".dockerignore", ".dockerignore"} {
+		file, err := os.Open(filepath.Join(contextDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+
+		patterns, err := ignorefile.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+		return append(patterns, "!"+filepath.ToSlash(dockerfile), "!.dockerignore"), nil
+	}
+
+	return defaultContextExcludes, nil
+}
+
+// contextSize sums the sizes of the regular files in the context that are not excluded
+func contextSize(contextDir string, excludes []string) (int64, error) {
+	matcher, err := patternmatcher.New(excludes)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ignore pattern: %w", err)
+	}
+
+	var size int64
+	parents := make(map[string]patternmatcher.MatchInfo)
+	err = filepath.WalkDir(contextDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(contextDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		excluded, info, err := matcher.MatchesUsingParentResults(rel, parents[filepath.Dir(rel)])
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			parents[rel] = info
+			// Exclusion exceptions may re-include files below an excluded directory
+			if excluded && !matcher.Exclusions() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if excluded || !entry.Type().IsRegular() {
+			return nil
+		}
+
+		fileInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		size += fileInfo.Size()
+		return nil
+	})
+
+	return size, err
+}
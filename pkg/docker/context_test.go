@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestContextExcludes(t *testing.T) {
+	tests := []struct {
+		name       string
+		files      map[string]string
+		dockerfile string
+		want       []string
+	}{
+		{
+			name:       "no ignore file",
+			dockerfile: "Dockerfile",
+			want:       defaultContextExcludes,
+		},
+		{
+			name:       "dockerignore",
+			files:      map[string]string{".dockerignore": "node_modules\n# comment\n\n*.log\n"},
+			dockerfile: "Dockerfile",
+			want:       []string{"node_modules", "*.log", "!Dockerfile", "!.dockerignore"},
+		},
+		{
+			name: "dockerfile specific ignore file wins",
+			files: map[string]string{
+				".dockerignore":                     "node_modules",
+				"build/app.Dockerfile.dockerignore": "dist",
+			},
+			dockerfile: "build/app.Dockerfile",
+			want:       []string{"dist", "!build/app.Dockerfile", "!.dockerignore"},
+		},
+		{
+			name:       "ignore file of another dockerfile",
+			files:      map[string]string{"Dockerfile.dockerignore": "dist"},
+			dockerfile: "app.Dockerfile",
+			want:       defaultContextExcludes,
+		},
+		{
+			name:       "dockerfile cannot be excluded",
+			files:      map[string]string{".dockerignore": "*\n"},
+			dockerfile: "Dockerfile",
+			want:       []string{"*", "!Dockerfile", "!.dockerignore"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := contextExcludes(dir, tt.dockerfile)
+			if err != nil {
+				t.Fatalf("contextExcludes() error = %v", err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("contextExcludes() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContextExcludesUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	// A directory in place of the ignore file cannot be read
+	if err := os.Mkdir(filepath.Join(dir, ".dockerignore"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := contextExcludes(dir, "Dockerfile"); err == nil {
+		t.Error("contextExcludes() error = nil, want an error")
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 	"ys-cloud/internal/config"
 
 	"github.com/docker/docker/api/types"
@@ -15,6 +17,7 @@ import (
 	"github.com/docker/docker/api/types/system"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/archive"
+	"github.com/docker/go-units"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,17 +25,34 @@ type DockerService struct {
 	client  *client.Client
 	config  *config.DockerConfig
 	logger  *logrus.Logger
+
+	// buildx records once whether the docker buildx plugin is installed
+	buildx    sync.Once
+	hasBuildx bool
 }
 
 type BuildOptions struct {
-	ContextDir    string
-	Dockerfile    string
-	ImageName     string
-	ImageTag      string
-	BuildArgs     map[string]*string
-	Labels        map[string]string
-	NoCache       bool
-	Remove        bool
+	ContextDir string
+	Dockerfile string
+	ImageName  string
+	ImageTag   string
+	ExtraTags  []string // further tags of the image
+	BuildArgs  map[string]*string
+	Labels     map[string]string
+	NoCache    bool
+	Remove     bool
+	Target     string // Dockerfile stage to build
+
+	// Credentials for pulling base images, keyed by registry as in docker config files
+	AuthConfigs map[string]registry.AuthConfig
+
+	// BuildKit only
+	Platforms []string      // target platforms such as linux/amd64 and linux/arm64
+	CacheFrom []string      // cache sources, e.g. type=registry,ref=registry/app:buildcache or type=local,src=/cache
+	CacheTo   []string      // cache exports, e.g. type=registry,ref=registry/app:buildcache,mode=max
+	Secrets   []BuildSecret // secrets mounted into RUN instructions
+	SSH       []string      // SSH agent sockets or keys forwarded to the build, e.g. default
+	Push      bool          // push the image instead of loading it into the daemon; required for multi-platform builds
 }
 
 type BuildProgress struct {
@@ -89,9 +109,24 @@ func (s *DockerService) BuildImage(opts BuildOptions) error {
 		opts.Dockerfile = "Dockerfile"
 	}
 
+	buildKit, err := s.useBuildKit(opts)
+	if err != nil {
+		return err
+	}
+
+	buildInfo, err := s.prepareContext(opts)
+	if err != nil {
+		return err
+	}
+
+	if buildKit {
+		_, err := s.buildWithBuildKit(ctx, opts)
+		return err
+	}
+
 	// Create build context
 	buildContext, err := archive.TarWithOptions(opts.ContextDir, &archive.TarOptions{
-		ExcludePatterns: []string{".git", ".gitignore", "Dockerfile.dockerignore"},
+		ExcludePatterns: buildInfo.Excludes,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create build context: %w", err)
@@ -99,13 +134,15 @@ func (s *DockerService) BuildImage(opts BuildOptions) error {
 	defer buildContext.Close()
 
 	buildOptions := types.ImageBuildOptions{
-		Dockerfile: opts.Dockerfile,
-		Tags:       []string{fmt.Sprintf("%s:%s", opts.ImageName, opts.ImageTag)},
-		BuildArgs:  opts.BuildArgs,
-		Labels:     opts.Labels,
-		NoCache:    opts.NoCache,
-		Remove:     opts.Remove,
+		Dockerfile:  opts.Dockerfile,
+		Tags:        opts.tags(),
+		BuildArgs:   opts.BuildArgs,
+		Labels:      opts.Labels,
+		NoCache:     opts.NoCache,
+		Remove:      opts.Remove,
 		ForceRemove: true,
+		Target:      opts.Target,
+		AuthConfigs: opts.AuthConfigs,
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -150,9 +187,8 @@ func (s *DockerService) BuildImage(opts BuildOptions) error {
 	return nil
 }
 
-func (s *DockerService) BuildImageWithLogs(opts BuildOptions) (string, error) {
-	ctx := context.Background()
-
+// BuildImageWithLogs builds an image and returns the build output. Cancelling ctx aborts the build.
+func (s *DockerService) BuildImageWithLogs(ctx context.Context, opts BuildOptions) (string, error) {
 	// Validate required fields
 	if opts.ContextDir == "" {
 		return "", fmt.Errorf("context directory is required")
@@ -167,23 +203,41 @@ func (s *DockerService) BuildImageWithLogs(opts BuildOptions) (string, error) {
 		opts.Dockerfile = "Dockerfile"
 	}
 
+	buildKit, err := s.useBuildKit(opts)
+	if err != nil {
+		return "", err
+	}
+
+	buildInfo, err := s.prepareContext(opts)
+	if err != nil {
+		return "", err
+	}
+	logs := fmt.Sprintf("Sending build context of %s\n", units.HumanSize(float64(buildInfo.Size)))
+
+	if buildKit {
+		buildLogs, err := s.buildWithBuildKit(ctx, opts)
+		return logs + buildLogs, err
+	}
+
 	// Create build context
 	buildContext, err := archive.TarWithOptions(opts.ContextDir, &archive.TarOptions{
-		ExcludePatterns: []string{".git", ".gitignore", "Dockerfile.dockerignore"},
+		ExcludePatterns: buildInfo.Excludes,
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to create build context: %w", err)
+		return logs, fmt.Errorf("failed to create build context: %w", err)
 	}
 	defer buildContext.Close()
 
 	buildOptions := types.ImageBuildOptions{
-		Dockerfile: opts.Dockerfile,
-		Tags:       []string{fmt.Sprintf("%s:%s", opts.ImageName, opts.ImageTag)},
-		BuildArgs:  opts.BuildArgs,
-		Labels:     opts.Labels,
-		NoCache:    opts.NoCache,
-		Remove:     opts.Remove,
+		Dockerfile:  opts.Dockerfile,
+		Tags:        opts.tags(),
+		BuildArgs:   opts.BuildArgs,
+		Labels:      opts.Labels,
+		NoCache:     opts.NoCache,
+		Remove:      opts.Remove,
 		ForceRemove: true,
+		Target:      opts.Target,
+		AuthConfigs: opts.AuthConfigs,
 	}
 
 	s.logger.WithFields(logrus.Fields{
@@ -199,7 +253,6 @@ func (s *DockerService) BuildImageWithLogs(opts BuildOptions) (string, error) {
 	defer resp.Body.Close()
 
 	// Collect build logs
-	var logs string
 	decoder := json.NewDecoder(resp.Body)
 	for {
 		var progress BuildProgress
@@ -207,6 +260,9 @@ func (s *DockerService) BuildImageWithLogs(opts BuildOptions) (string, error) {
 			if err == io.EOF {
 				break
 			}
+			if ctx.Err() != nil {
+				return logs, ctx.Err()
+			}
 			continue
 		}
 
@@ -227,8 +283,8 @@ func (s *DockerService) BuildImageWithLogs(opts BuildOptions) (string, error) {
 	return logs, nil
 }
 
-func (s *DockerService) PushImage(imageName, imageTag, username, password string) error {
-	ctx := context.Background()
+// PushImage pushes an image tag to its registry. Cancelling ctx aborts the push.
+func (s *DockerService) PushImage(ctx context.Context, imageName, imageTag, username, password string) error {
 
 	// Validate required fields
 	if imageName == "" {
@@ -271,6 +327,9 @@ func (s *DockerService) PushImage(imageName, imageTag, username, password string
 			if err == io.EOF {
 				break
 			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
 			continue
 		}
 
@@ -291,13 +350,16 @@ func (s *DockerService) PushImage(imageName, imageTag, username, password string
 	return nil
 }
 
-func (s *DockerService) TagImage(sourceImage, targetImage, targetTag string) error {
+func (s *DockerService) TagImage(sourceImage, sourceTag, targetImage, targetTag string) error {
 	ctx := context.Background()
 
 	// Validate required fields
 	if sourceImage == "" {
 		return fmt.Errorf("source image is required")
 	}
+	if sourceTag == "" {
+		return fmt.Errorf("source tag is required")
+	}
 	if targetImage == "" {
 		return fmt.Errorf("target image is required")
 	}
@@ -305,7 +367,7 @@ func (s *DockerService) TagImage(sourceImage, targetImage, targetTag string) err
 		return fmt.Errorf("target tag is required")
 	}
 
-	source := fmt.Sprintf("%s:latest", sourceImage)
+	source := fmt.Sprintf("%s:%s", sourceImage, sourceTag)
 	target := fmt.Sprintf("%s:%s", targetImage, targetTag)
 
 	err := s.client.ImageTag(ctx, source, target)
@@ -376,6 +438,45 @@ func (s *DockerService) GetImageInfo(imageName, imageTag string) (*types.ImageIn
 	return &inspect, nil
 }
 
+// ImageDigest returns the registry digest of a pushed image, e.g. sha256:4f3c...
+func (s *DockerService) ImageDigest(imageName, imageTag string) (string, error) {
+	inspect, err := s.GetImageInfo(imageName, imageTag)
+	if err != nil {
+		return "", err
+	}
+
+	for _, repoDigest := range inspect.RepoDigests {
+		name, digest, found := strings.Cut(repoDigest, "@")
+		if found && familiarName(name) == familiarName(imageName) {
+			return digest, nil
+		}
+	}
+	return "", fmt.Errorf("image %s has not been pushed", imageName)
+}
+
+// RemoteDigest returns the digest of an image tag in its registry, for images that were pushed
+// without passing through the daemon
+func (s *DockerService) RemoteDigest(imageName, imageTag, username, password string) (string, error) {
+	authStr, err := encodeAuthToBase64(registry.AuthConfig{Username: username, Password: password})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode auth: %w", err)
+	}
+
+	inspect, err := s.client.DistributionInspect(context.Background(), fmt.Sprintf("%s:%s", imageName, imageTag), authStr)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect pushed image: %w", err)
+	}
+	return inspect.Descriptor.Digest.String(), nil
+}
+
+// familiarName shortens Docker Hub references the way the daemon reports them
+func familiarName(name string) string {
+	for _, prefix := range []string{"docker.io/", "index.docker.io/", "registry.hub.docker.com/", "registry-1.docker.io/"} {
+		name = strings.TrimPrefix(name, prefix)
+	}
+	return strings.TrimPrefix(name, "library/")
+}
+
 func (s *DockerService) ImageExists(imageName, imageTag string) (bool, error) {
 	ctx := context.Background()
 	fullImageName := fmt.Sprintf("%s:%s", imageName, imageTag)
@@ -391,9 +492,13 @@ func (s *DockerService) ImageExists(imageName, imageTag string) (bool, error) {
 	return true, nil
 }
 
-func (s *DockerService) PruneImages() (image.PruneReport, error) {
+// PruneImages removes the dangling images carrying every given label
+func (s *DockerService) PruneImages(labels map[string]string) (image.PruneReport, error) {
 	ctx := context.Background()
 	pruneFilters := filters.NewArgs()
+	for key, value := range labels {
+		pruneFilters.Add("label", key+"="+value)
+	}
 	pruneReport, err := s.client.ImagesPrune(ctx, pruneFilters)
 	if err != nil {
 		return image.PruneReport{}, fmt.Errorf("failed to prune images: %w", err)
@@ -0,0 +1,233 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
+)
+
+// StepWorkDir is where the workspace of a step is mounted
+const StepWorkDir = "/workspace"
+
+// StepOptions describes a pipeline step run in a throwaway container
+type StepOptions struct {
+	Name      string
+	Image     string
+	Commands  []string // run in order by Shell, the first failing command ends the step
+	Shell     string   // defaults to /bin/sh
+	Env       map[string]string
+	Workspace string               // directory mounted at StepWorkDir; a path on the Docker host
+	Mounts    map[string]string    // further host directories by the container path they are mounted at
+	Timeout   time.Duration        // the container is killed when it runs longer
+	NanoCPUs  int64                // CPU limit in units of 1e-9 CPUs, unlimited when zero
+	Memory    int64                // memory limit in bytes, unlimited when zero
+	Auth      *registry.AuthConfig // credentials for pulling the image
+	Output    io.Writer            // receives stdout and stderr of the step
+}
+
+// StepResult is the outcome of a step container
+type StepResult struct {
+	ExitCode  int
+	TimedOut  bool
+	OOMKilled bool
+	Duration  time.Duration
+}
+
+// RunStep pulls the step image when it is missing, runs the step commands in a container with the
+// workspace mounted and removes the container afterwards. Commands failing are reported through
+// the exit code of the result; the error is set only when the container could not run. Cancelling
+// ctx kills the container and returns the context's error.
+func (s *DockerService) RunStep(ctx context.Context, opts StepOptions) (*StepResult, error) {
+	// Validate required fields
+	if opts.Image == "" {
+		return nil, fmt.Errorf("step image is required")
+	}
+	if len(opts.Commands) == 0 {
+		return nil, fmt.Errorf("step commands are required")
+	}
+	if opts.Workspace == "" {
+		return nil, fmt.Errorf("step workspace is required")
+	}
+	shell := opts.Shell
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+
+	if err := s.ensureImage(ctx, opts.Image, opts.Auth); err != nil {
+		return nil, err
+	}
+
+	env := make([]string, 0, len(opts.Env))
+	for key, value := range opts.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+
+	binds := []string{opts.Workspace + ":" + StepWorkDir}
+	for target, source := range opts.Mounts {
+		binds = append(binds, source+":"+target)
+	}
+
+	created, err := s.client.ContainerCreate(ctx, &container.Config{
+		Image:      opts.Image,
+		Entrypoint: []string{shell, "-c", stepScript(opts.Commands)},
+		Env:        env,
+		WorkingDir: StepWorkDir,
+		Labels:     map[string]string{"ys-cloud.step": opts.Name},
+	}, &container.HostConfig{
+		Binds: binds,
+		Resources: container.Resources{
+			NanoCPUs: opts.NanoCPUs,
+			Memory:   opts.Memory,
+		},
+	}, nil, nil, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create step container: %w", err)
+	}
+	defer func() {
+		if err := s.client.ContainerRemove(context.Background(), created.ID, container.RemoveOptions{Force: true, RemoveVolumes: true}); err != nil {
+			s.logger.WithError(err).WithField("container_id", created.ID).Warn("Failed to remove step container")
+		}
+	}()
+
+	// Attach before starting so that no output is lost
+	attached, err := s.client.ContainerAttach(ctx, created.ID, container.AttachOptions{Stream: true, Stdout: true, Stderr: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to step container: %w", err)
+	}
+	defer attached.Close()
+
+	streamed := make(chan struct{})
+	go func() {
+		defer close(streamed)
+		stdcopy.StdCopy(output, output, attached.Reader)
+	}()
+
+	waitCtx := ctx
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	// The wait outlives ctx so that a killed container is still waited for
+	waitC, errC := s.client.ContainerWait(context.Background(), created.ID, container.WaitConditionNextExit)
+
+	s.logger.WithFields(logrus.Fields{
+		"step":  opts.Name,
+		"image": opts.Image,
+	}).Info("Starting step container")
+
+	started := time.Now()
+	if err := s.client.ContainerStart(ctx, created.ID, container.StartOptions{}); err != nil {
+		return nil, fmt.Errorf("failed to start step container: %w", err)
+	}
+
+	result := &StepResult{}
+	select {
+	case response := <-waitC:
+		result.ExitCode = int(response.StatusCode)
+	case err := <-errC:
+		return nil, fmt.Errorf("failed to wait for step container: %w", err)
+	case <-waitCtx.Done():
+		result.TimedOut = ctx.Err() == nil
+		if err := s.client.ContainerKill(context.Background(), created.ID, "KILL"); err != nil {
+			return nil, fmt.Errorf("failed to kill step container: %w", err)
+		}
+		select {
+		case response := <-waitC:
+			result.ExitCode = int(response.StatusCode)
+		case err := <-errC:
+			return nil, fmt.Errorf("failed to wait for step container: %w", err)
+		}
+		if !result.TimedOut {
+			<-streamed
+			return nil, ctx.Err()
+		}
+	}
+	result.Duration = time.Since(started)
+	<-streamed
+
+	if inspect, err := s.client.ContainerInspect(context.Background(), created.ID); err == nil && inspect.State != nil {
+		result.OOMKilled = inspect.State.OOMKilled
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"step":      opts.Name,
+		"exit_code": result.ExitCode,
+		"timed_out": result.TimedOut,
+		"duration":  result.Duration,
+	}).Info("Step container finished")
+
+	return result, nil
+}
+
+// ensureImage pulls an image unless the daemon already has it
+func (s *DockerService) ensureImage(ctx context.Context, ref string, auth *registry.AuthConfig) error {
+	_, _, err := s.client.ImageInspectWithRaw(ctx, ref)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to check image existence: %w", err)
+	}
+
+	pullOptions := image.PullOptions{}
+	if auth != nil {
+		if pullOptions.RegistryAuth, err = encodeAuthToBase64(*auth); err != nil {
+			return fmt.Errorf("failed to encode auth: %w", err)
+		}
+	}
+
+	pullResp, err := s.client.ImagePull(ctx, ref, pullOptions)
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %w", ref, err)
+	}
+	defer pullResp.Close()
+
+	decoder := json.NewDecoder(pullResp)
+	for {
+		var progress map[string]interface{}
+		if err := decoder.Decode(&progress); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+
+		if errorDetail, exists := progress["error"]; exists && errorDetail != nil {
+			return fmt.Errorf("pull failed: %v", errorDetail)
+		}
+	}
+
+	return nil
+}
+
+// stepScript echoes every command before running it and stops at the first failure
+func stepScript(commands []string) string {
+	var script strings.Builder
+	script.WriteString("set -e\n")
+	for _, command := range commands {
+		fmt.Fprintf(&script, "printf '%%s\\n' %s\n%s\n", shellQuote("$ "+command), command)
+	}
+	return script.String()
+}
+
+// shellQuote quotes a string for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
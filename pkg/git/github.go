@@ -0,0 +1,61 @@
+package git
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const githubAPIURL = "https://api.github.com"
+
+// CommentOnGitHubPullRequest posts a comment on a pull request of a GitHub repository,
+// identified by its full name such as owner/repo
+func (s *GitService) CommentOnGitHubPullRequest(token, repository string, number int, body string) error {
+	// Validate required fields
+	if token == "" {
+		return fmt.Errorf("GitHub token is required")
+	}
+	if repository == "" || number <= 0 {
+		return fmt.Errorf("repository and pull request number are required")
+	}
+
+	payload, err := json.Marshal(map[string]string{"body": body})
+	if err != nil {
+		return fmt.Errorf("failed to encode comment: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	url := fmt.Sprintf("%s/repos/%s/issues/%d/comments", githubAPIURL, repository, number)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create comment request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post comment: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to post comment: GitHub returned %s: %s", resp.Status, bytes.TrimSpace(message))
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"repository":   repository,
+		"pull_request": number,
+	}).Info("Pull request comment posted")
+	return nil
+}
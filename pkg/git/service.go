@@ -1,12 +1,18 @@
 package git
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport/http"
 	"github.com/sirupsen/logrus"
@@ -26,18 +32,21 @@ type GitRepo struct {
 }
 
 type GitWebhookPayload struct {
-	Event      string                 `json:"event"`
-	Repository GitWebhookRepository  `json:"repository"`
-	Ref        string                `json:"ref"`
-	Commit     GitWebhookCommit      `json:"commit"`
-	Headers    map[string]string     `json:"headers"`
+	Event       string                 `json:"event"`
+	Repository  GitWebhookRepository   `json:"repository"`
+	Ref         string                 `json:"ref"`
+	Commit      GitWebhookCommit       `json:"commit"`
+	Headers     map[string]string      `json:"headers"`
+	Action      string                 `json:"action,omitempty"`
+	PullRequest *GitWebhookPullRequest `json:"pull_request,omitempty"`
 }
 
 type GitWebhookRepository struct {
-	Name        string `json:"name"`
-	FullName    string `json:"full_name"`
-	CloneURL    string `json:"clone_url"`
+	Name          string `json:"name"`
+	FullName      string `json:"full_name"`
+	CloneURL      string `json:"clone_url"`
 	DefaultBranch string `json:"default_branch"`
+	HTMLURL       string `json:"html_url"`
 }
 
 type GitWebhookCommit struct {
@@ -46,6 +55,15 @@ type GitWebhookCommit struct {
 	URL     string `json:"url"`
 }
 
+type GitWebhookPullRequest struct {
+	Number int    `json:"number"`
+	Branch string `json:"branch"` // head branch
+	Commit string `json:"commit"` // head commit
+	URL    string `json:"url"`
+	Merged bool   `json:"merged"`
+	Fork   bool   `json:"fork"` // head branch lives in another repository
+}
+
 func NewGitService() *GitService {
 	tempDir := filepath.Join(os.TempDir(), "ys-cloud-repos")
 	os.MkdirAll(tempDir, 0755)
@@ -191,21 +209,156 @@ func (s *GitService) Cleanup(repoPath string) {
 }
 
 func (s *GitService) ParseGitHubWebhook(payload []byte, headers map[string]string) (*GitWebhookPayload, error) {
-	// TODO: Implement GitHub webhook parsing
-	// This is a placeholder implementation
-	return &GitWebhookPayload{
-		Event: "push",
-		Ref:   "refs/heads/main",
-	}, nil
+	var event struct {
+		Action     string `json:"action"`
+		Ref        string `json:"ref"`
+		Repository struct {
+			Name          string `json:"name"`
+			FullName      string `json:"full_name"`
+			CloneURL      string `json:"clone_url"`
+			HTMLURL       string `json:"html_url"`
+			DefaultBranch string `json:"default_branch"`
+		} `json:"repository"`
+		HeadCommit  *GitWebhookCommit `json:"head_commit"`
+		PullRequest *struct {
+			Number  int    `json:"number"`
+			HTMLURL string `json:"html_url"`
+			Merged  bool   `json:"merged"`
+			Head    struct {
+				Ref  string `json:"ref"`
+				SHA  string `json:"sha"`
+				Repo *struct {
+					FullName string `json:"full_name"`
+				} `json:"repo"`
+			} `json:"head"`
+		} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse GitHub webhook: %w", err)
+	}
+
+	result := &GitWebhookPayload{
+		Event: headers["X-Github-Event"],
+		Repository: GitWebhookRepository{
+			Name:          event.Repository.Name,
+			FullName:      event.Repository.FullName,
+			CloneURL:      event.Repository.CloneURL,
+			HTMLURL:       event.Repository.HTMLURL,
+			DefaultBranch: event.Repository.DefaultBranch,
+		},
+		Ref:     event.Ref,
+		Headers: headers,
+		Action:  event.Action,
+	}
+	if event.HeadCommit != nil {
+		result.Commit = *event.HeadCommit
+	}
+	if event.PullRequest != nil {
+		result.PullRequest = &GitWebhookPullRequest{
+			Number: event.PullRequest.Number,
+			Branch: event.PullRequest.Head.Ref,
+			Commit: event.PullRequest.Head.SHA,
+			URL:    event.PullRequest.HTMLURL,
+			Merged: event.PullRequest.Merged,
+			// The head repository is missing once a fork is deleted
+			Fork: event.PullRequest.Head.Repo == nil || event.PullRequest.Head.Repo.FullName != event.Repository.FullName,
+		}
+		result.Ref = "refs/heads/" + event.PullRequest.Head.Ref
+		result.Commit.ID = event.PullRequest.Head.SHA
+	}
+
+	return result, nil
 }
 
+// ParseGitLabWebhook parses push and merge request events. Merge request events are reported as
+// pull_request events with GitHub's action names, so they are handled like pull requests.
 func (s *GitService) ParseGitLabWebhook(payload []byte, headers map[string]string) (*GitWebhookPayload, error) {
-	// TODO: Implement GitLab webhook parsing
-	// This is a placeholder implementation
-	return &GitWebhookPayload{
-		Event: "push",
-		Ref:   "refs/heads/main",
-	}, nil
+	var event struct {
+		ObjectKind  string `json:"object_kind"`
+		Ref         string `json:"ref"`
+		CheckoutSHA string `json:"checkout_sha"`
+		Project     struct {
+			Name              string `json:"name"`
+			PathWithNamespace string `json:"path_with_namespace"`
+			GitHTTPURL        string `json:"git_http_url"`
+			WebURL            string `json:"web_url"`
+			DefaultBranch     string `json:"default_branch"`
+		} `json:"project"`
+		ObjectAttributes *struct {
+			IID             int    `json:"iid"`
+			Action          string `json:"action"`
+			SourceBranch    string `json:"source_branch"`
+			SourceProjectID int    `json:"source_project_id"`
+			TargetProjectID int    `json:"target_project_id"`
+			URL             string `json:"url"`
+			LastCommit      struct {
+				ID string `json:"id"`
+			} `json:"last_commit"`
+		} `json:"object_attributes"`
+	}
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse GitLab webhook: %w", err)
+	}
+
+	result := &GitWebhookPayload{
+		Event: event.ObjectKind,
+		Repository: GitWebhookRepository{
+			Name:          event.Project.Name,
+			FullName:      event.Project.PathWithNamespace,
+			CloneURL:      event.Project.GitHTTPURL,
+			HTMLURL:       event.Project.WebURL,
+			DefaultBranch: event.Project.DefaultBranch,
+		},
+		Ref:     event.Ref,
+		Commit:  GitWebhookCommit{ID: event.CheckoutSHA},
+		Headers: headers,
+	}
+
+	if event.ObjectKind == "merge_request" && event.ObjectAttributes != nil {
+		attributes := event.ObjectAttributes
+		result.Event = "pull_request"
+		result.Action = map[string]string{
+			"open":   "opened",
+			"reopen": "reopened",
+			"update": "synchronize",
+			"close":  "closed",
+			"merge":  "closed",
+		}[attributes.Action]
+		result.PullRequest = &GitWebhookPullRequest{
+			Number: attributes.IID,
+			Branch: attributes.SourceBranch,
+			Commit: attributes.LastCommit.ID,
+			URL:    attributes.URL,
+			Merged: attributes.Action == "merge",
+			Fork:   attributes.SourceProjectID != attributes.TargetProjectID,
+		}
+		result.Ref = "refs/heads/" + attributes.SourceBranch
+		result.Commit.ID = attributes.LastCommit.ID
+	}
+
+	return result, nil
+}
+
+// VerifyGitHubSignature checks the X-Hub-Signature-256 header of a GitHub delivery, the hex
+// HMAC-SHA256 of the payload keyed with the webhook secret
+func VerifyGitHubSignature(payload []byte, signature, secret string) bool {
+	digest, ok := strings.CutPrefix(signature, "sha256=")
+	if !ok || secret == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// VerifyToken checks a webhook token sent as is, like GitLab's X-Gitlab-Token, in constant time
+func VerifyToken(token, secret string) bool {
+	return secret != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1
 }
 
 func (s *GitService) ParseGiteeWebhook(payload []byte, headers map[string]string) (*GitWebhookPayload, error) {
@@ -215,4 +368,142 @@ func (s *GitService) ParseGiteeWebhook(payload []byte, headers map[string]string
 		Event: "push",
 		Ref:   "refs/heads/main",
 	}, nil
-}
\ No newline at end of file
+}
+
+// CloneCommit clones a branch with its history and checks out a specific commit, so that
+// later pipeline stages see exactly the sources a build was produced from
+func (s *GitService) CloneCommit(repoURL, branch, commit, username, password string) (*GitRepo, error) {
+	// Validate required fields
+	if repoURL == "" {
+		return nil, fmt.Errorf("repository URL is required")
+	}
+
+	repoName := strings.TrimSuffix(filepath.Base(repoURL), ".git")
+	repoPath, err := os.MkdirTemp(s.tempDir, repoName+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	options := &git.CloneOptions{URL: repoURL}
+	if username != "" || password != "" {
+		options.Auth = &http.BasicAuth{
+			Username: username,
+			Password: password,
+		}
+	}
+	if branch != "" {
+		options.ReferenceName = plumbing.NewBranchReferenceName(branch)
+		options.SingleBranch = true
+	}
+
+	repo, err := git.PlainClone(repoPath, false, options)
+	if err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("failed to clone repository: %w", err)
+	}
+
+	if commit == "" {
+		if commit, err = s.getCommitHash(repo, plumbing.HEAD); err != nil {
+			os.RemoveAll(repoPath)
+			return nil, fmt.Errorf("failed to get commit hash: %w", err)
+		}
+	} else {
+		worktree, err := repo.Worktree()
+		if err != nil {
+			os.RemoveAll(repoPath)
+			return nil, fmt.Errorf("failed to get worktree: %w", err)
+		}
+		if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commit)}); err != nil {
+			os.RemoveAll(repoPath)
+			return nil, fmt.Errorf("failed to checkout commit %s: %w", commit, err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"repo_url":  repoURL,
+		"branch":    branch,
+		"commit":    commit,
+		"repo_path": repoPath,
+	}).Info("Repository cloned successfully")
+
+	return &GitRepo{
+		URL:      repoURL,
+		Branch:   branch,
+		Commit:   commit,
+		RepoPath: repoPath,
+	}, nil
+}
+
+// CloneRef fetches a single ref that need not be a branch, such as refs/pull/12/head, and checks
+// out a specific commit of it. Pull requests from forks are only reachable this way, because
+// their head branch lives in another repository.
+func (s *GitService) CloneRef(repoURL, ref, commit, username, password string) (*GitRepo, error) {
+	// Validate required fields
+	if repoURL == "" {
+		return nil, fmt.Errorf("repository URL is required")
+	}
+	if ref == "" {
+		return nil, fmt.Errorf("ref is required")
+	}
+
+	repoName := strings.TrimSuffix(filepath.Base(repoURL), ".git")
+	repoPath, err := os.MkdirTemp(s.tempDir, repoName+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	repo, err := git.PlainInit(repoPath, false)
+	if err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("failed to initialize repository: %w", err)
+	}
+	remote, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{repoURL}})
+	if err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("failed to add remote: %w", err)
+	}
+
+	target := plumbing.NewRemoteReferenceName(git.DefaultRemoteName, "fetched")
+	options := &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", ref, target))},
+	}
+	if username != "" || password != "" {
+		options.Auth = &http.BasicAuth{
+			Username: username,
+			Password: password,
+		}
+	}
+	if err := remote.Fetch(options); err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+
+	if commit == "" {
+		if commit, err = s.getCommitHash(repo, target); err != nil {
+			os.RemoveAll(repoPath)
+			return nil, fmt.Errorf("failed to get commit hash: %w", err)
+		}
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commit)}); err != nil {
+		os.RemoveAll(repoPath)
+		return nil, fmt.Errorf("failed to checkout commit %s: %w", commit, err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"repo_url":  repoURL,
+		"ref":       ref,
+		"commit":    commit,
+		"repo_path": repoPath,
+	}).Info("Repository cloned successfully")
+
+	return &GitRepo{
+		URL:      repoURL,
+		Commit:   commit,
+		RepoPath: repoPath,
+	}, nil
+}
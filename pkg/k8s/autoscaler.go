@@ -0,0 +1,244 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+type AutoscalingOptions struct {
+	MinReplicas             int32                 `json:"min_replicas"`
+	MaxReplicas             int32                 `json:"max_replicas"`
+	TargetCPUUtilization    int32                 `json:"target_cpu_utilization,omitempty"`    // percent of the CPU request
+	TargetMemoryUtilization int32                 `json:"target_memory_utilization,omitempty"` // percent of the memory request
+	Metrics                 []CustomMetricOptions `json:"metrics,omitempty"`
+}
+
+type CustomMetricOptions struct {
+	Type               string            `json:"type"` // pods, object, external
+	Name               string            `json:"name"`
+	Selector           map[string]string `json:"selector,omitempty"`
+	TargetAverageValue string            `json:"target_average_value,omitempty"`
+	TargetValue        string            `json:"target_value,omitempty"`
+	ObjectAPIVersion   string            `json:"object_api_version,omitempty"`
+	ObjectKind         string            `json:"object_kind,omitempty"`
+	ObjectName         string            `json:"object_name,omitempty"`
+}
+
+// ApplyHorizontalPodAutoscaler creates or updates the autoscaler of a deployment. The autoscaler
+// shares the name of the deployment it scales.
+func (s *K8sService) ApplyHorizontalPodAutoscaler(namespace, deploymentName string, opts AutoscalingOptions, owner Owner) error {
+	ctx := context.Background()
+
+	hpa, err := buildHorizontalPodAutoscaler(namespace, deploymentName, opts)
+	if err != nil {
+		return err
+	}
+	hpa.Labels = withOwner(hpa.Labels, owner)
+
+	autoscalers := s.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace)
+	existing, err := autoscalers.Get(ctx, deploymentName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := autoscalers.Create(ctx, hpa, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create horizontal pod autoscaler: %w", err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to get horizontal pod autoscaler: %w", err)
+	} else {
+		existing.Labels = withOwner(existing.Labels, owner)
+		existing.Spec = hpa.Spec
+		if _, err := autoscalers.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update horizontal pod autoscaler: %w", err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment":   deploymentName,
+		"namespace":    namespace,
+		"min_replicas": opts.MinReplicas,
+		"max_replicas": opts.MaxReplicas,
+	}).Info("Horizontal pod autoscaler applied")
+
+	return nil
+}
+
+func (s *K8sService) GetHorizontalPodAutoscaler(namespace, name string) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	hpa, err := s.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get horizontal pod autoscaler: %w", err)
+	}
+	return hpa, nil
+}
+
+func (s *K8sService) HorizontalPodAutoscalerExists(namespace, name string) (bool, error) {
+	_, err := s.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	return resourceExists(err)
+}
+
+// DeleteHorizontalPodAutoscaler removes the autoscaler of a deployment if there is one
+func (s *K8sService) DeleteHorizontalPodAutoscaler(namespace, name string) error {
+	err := s.clientset.AutoscalingV2().HorizontalPodAutoscalers(namespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete horizontal pod autoscaler: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment": name,
+		"namespace":  namespace,
+	}).Info("Horizontal pod autoscaler deleted")
+
+	return nil
+}
+
+// ValidateAutoscalingOptions reports whether the options render into a valid autoscaler
+func ValidateAutoscalingOptions(opts AutoscalingOptions) error {
+	_, err := buildHorizontalPodAutoscaler("validate", "validate", opts)
+	return err
+}
+
+func buildHorizontalPodAutoscaler(namespace, deploymentName string, opts AutoscalingOptions) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	// Validate required fields
+	if opts.MaxReplicas <= 0 {
+		return nil, fmt.Errorf("max replicas is required")
+	}
+	if opts.MinReplicas <= 0 {
+		opts.MinReplicas = 1
+	}
+	if opts.MinReplicas > opts.MaxReplicas {
+		return nil, fmt.Errorf("min replicas cannot exceed max replicas")
+	}
+
+	var metrics []autoscalingv2.MetricSpec
+	for _, target := range []struct {
+		name        corev1.ResourceName
+		utilization int32
+	}{
+		{corev1.ResourceCPU, opts.TargetCPUUtilization},
+		{corev1.ResourceMemory, opts.TargetMemoryUtilization},
+	} {
+		if target.utilization <= 0 {
+			continue
+		}
+		utilization := target.utilization
+		metrics = append(metrics, autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name: target.name,
+				Target: autoscalingv2.MetricTarget{
+					Type:               autoscalingv2.UtilizationMetricType,
+					AverageUtilization: &utilization,
+				},
+			},
+		})
+	}
+
+	for _, m := range opts.Metrics {
+		metric, err := buildCustomMetric(m)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if len(metrics) == 0 {
+		return nil, fmt.Errorf("at least one autoscaling metric is required")
+	}
+
+	minReplicas := opts.MinReplicas
+	return &autoscalingv2.HorizontalPodAutoscaler{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deploymentName,
+			Namespace: namespace,
+			Labels:    getOrDefaultLabels(nil, deploymentName),
+		},
+		Spec: autoscalingv2.HorizontalPodAutoscalerSpec{
+			ScaleTargetRef: autoscalingv2.CrossVersionObjectReference{
+				APIVersion: "apps/v1",
+				Kind:       "Deployment",
+				Name:       deploymentName,
+			},
+			MinReplicas: &minReplicas,
+			MaxReplicas: opts.MaxReplicas,
+			Metrics:     metrics,
+		},
+	}, nil
+}
+
+func buildCustomMetric(opts CustomMetricOptions) (autoscalingv2.MetricSpec, error) {
+	if opts.Name == "" {
+		return autoscalingv2.MetricSpec{}, fmt.Errorf("metric name is required")
+	}
+
+	identifier := autoscalingv2.MetricIdentifier{Name: opts.Name}
+	if len(opts.Selector) > 0 {
+		identifier.Selector = &metav1.LabelSelector{MatchLabels: opts.Selector}
+	}
+
+	target, err := buildMetricTarget(opts)
+	if err != nil {
+		return autoscalingv2.MetricSpec{}, err
+	}
+
+	switch opts.Type {
+	case "", "pods":
+		if target.Type != autoscalingv2.AverageValueMetricType {
+			return autoscalingv2.MetricSpec{}, fmt.Errorf("pods metric %s requires a target average value", opts.Name)
+		}
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.PodsMetricSourceType,
+			Pods: &autoscalingv2.PodsMetricSource{Metric: identifier, Target: target},
+		}, nil
+	case "object":
+		if opts.ObjectKind == "" || opts.ObjectName == "" {
+			return autoscalingv2.MetricSpec{}, fmt.Errorf("object metric %s requires an object kind and name", opts.Name)
+		}
+		return autoscalingv2.MetricSpec{
+			Type: autoscalingv2.ObjectMetricSourceType,
+			Object: &autoscalingv2.ObjectMetricSource{
+				DescribedObject: autoscalingv2.CrossVersionObjectReference{
+					APIVersion: opts.ObjectAPIVersion,
+					Kind:       opts.ObjectKind,
+					Name:       opts.ObjectName,
+				},
+				Metric: identifier,
+				Target: target,
+			},
+		}, nil
+	case "external":
+		return autoscalingv2.MetricSpec{
+			Type:     autoscalingv2.ExternalMetricSourceType,
+			External: &autoscalingv2.ExternalMetricSource{Metric: identifier, Target: target},
+		}, nil
+	default:
+		return autoscalingv2.MetricSpec{}, fmt.Errorf("unsupported metric type %q", opts.Type)
+	}
+}
+
+func buildMetricTarget(opts CustomMetricOptions) (autoscalingv2.MetricTarget, error) {
+	switch {
+	case opts.TargetAverageValue != "":
+		quantity, err := resource.ParseQuantity(opts.TargetAverageValue)
+		if err != nil {
+			return autoscalingv2.MetricTarget{}, fmt.Errorf("invalid target average value for metric %s: %w", opts.Name, err)
+		}
+		return autoscalingv2.MetricTarget{Type: autoscalingv2.AverageValueMetricType, AverageValue: &quantity}, nil
+	case opts.TargetValue != "":
+		quantity, err := resource.ParseQuantity(opts.TargetValue)
+		if err != nil {
+			return autoscalingv2.MetricTarget{}, fmt.Errorf("invalid target value for metric %s: %w", opts.Name, err)
+		}
+		return autoscalingv2.MetricTarget{Type: autoscalingv2.ValueMetricType, Value: &quantity}, nil
+	default:
+		return autoscalingv2.MetricTarget{}, fmt.Errorf("metric %s requires a target value", opts.Name)
+	}
+}
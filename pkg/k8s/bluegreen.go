@@ -0,0 +1,242 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ColorLabel = "ys-cloud/color"
+	ColorBlue  = "blue"
+	ColorGreen = "green"
+)
+
+type BlueGreenOptions struct {
+	Deployment   DeploymentOptions
+	ServicePort  int32
+	ReadyTimeout time.Duration
+}
+
+type BlueGreenResult struct {
+	ActiveColor   string
+	PreviousColor string
+	PreviousImage string
+}
+
+// ColorDeploymentName returns the name of the Deployment backing one color of a service
+func ColorDeploymentName(name, color string) string {
+	return fmt.Sprintf("%s-%s", name, color)
+}
+
+func OppositeColor(color string) string {
+	if color == ColorBlue {
+		return ColorGreen
+	}
+	return ColorBlue
+}
+
+// GetActiveColor returns the color the service currently routes to, or an empty string
+// when the service does not exist yet
+func (s *K8sService) GetActiveColor(namespace, serviceName string) (string, error) {
+	service, err := s.clientset.CoreV1().Services(namespace).Get(context.Background(), serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get service: %w", err)
+	}
+
+	return service.Spec.Selector[ColorLabel], nil
+}
+
+// DeployBlueGreen deploys the new version next to the live one under the inactive color,
+// waits for it to become ready and then points the service at it
+func (s *K8sService) DeployBlueGreen(opts BlueGreenOptions) (*BlueGreenResult, error) {
+	ctx := context.Background()
+
+	base := opts.Deployment
+	if base.Name == "" {
+		return nil, fmt.Errorf("deployment name is required")
+	}
+	if base.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	if opts.ReadyTimeout <= 0 {
+		opts.ReadyTimeout = 10 * time.Minute
+	}
+
+	activeColor, err := s.GetActiveColor(base.Namespace, base.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BlueGreenResult{
+		ActiveColor:   OppositeColor(activeColor),
+		PreviousColor: activeColor,
+	}
+
+	if activeColor != "" {
+		if result.PreviousImage, err = s.GetDeploymentImage(base.Namespace, ColorDeploymentName(base.Name, activeColor)); err != nil {
+			return nil, err
+		}
+	}
+
+	labels := make(map[string]string, len(base.Labels)+2)
+	for key, value := range base.Labels {
+		labels[key] = value
+	}
+	labels["app"] = base.Name
+	labels[ColorLabel] = result.ActiveColor
+
+	colorOpts := base
+	colorOpts.Name = ColorDeploymentName(base.Name, result.ActiveColor)
+	colorOpts.Labels = labels
+	colorOpts.Selector = map[string]string{
+		"app":      base.Name,
+		ColorLabel: result.ActiveColor,
+	}
+
+	deployment, err := buildDeployment(colorOpts)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyImage(colorOpts); err != nil {
+		return nil, err
+	}
+
+	if err := s.applyDeployment(ctx, deployment); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment": deployment.Name,
+		"namespace":  deployment.Namespace,
+		"color":      result.ActiveColor,
+	}).Info("Blue/green deployment applied, waiting for readiness")
+
+	if err := s.WaitForDeploymentReady(deployment.Namespace, deployment.Name, opts.ReadyTimeout); err != nil {
+		return nil, err
+	}
+
+	targetPort := deployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort
+	if err := s.SwitchColor(base.Namespace, base.Name, result.ActiveColor, opts.ServicePort, targetPort, AdditionalPorts(base.Ports), base.Owner); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetDeploymentImage returns the image of the first container of a Deployment, or an empty string
+// when the Deployment does not exist
+func (s *K8sService) GetDeploymentImage(namespace, name string) (string, error) {
+	deployment, err := s.clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		return containers[0].Image, nil
+	}
+	return "", nil
+}
+
+// SwitchColor points the service selector at the given color, creating the service if needed
+func (s *K8sService) SwitchColor(namespace, serviceName, color string, port, targetPort int32, ports []PortOptions, owner Owner) error {
+	ctx := context.Background()
+
+	exists, err := s.DeploymentExists(namespace, ColorDeploymentName(serviceName, color))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("no %s deployment to switch to", color)
+	}
+
+	selector := map[string]string{
+		"app":      serviceName,
+		ColorLabel: color,
+	}
+
+	serviceOpts := ServiceOptions{
+		Name:       serviceName,
+		Namespace:  namespace,
+		Selector:   selector,
+		Port:       port,
+		TargetPort: targetPort,
+		Ports:      ports,
+		Type:       corev1.ServiceTypeClusterIP,
+		Owner:      owner,
+	}
+	service, err := s.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return s.CreateService(serviceOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
+	}
+
+	servicePorts, err := servicePorts(serviceOpts)
+	if err != nil {
+		return err
+	}
+	keepNodePorts(servicePorts, service.Spec.Ports)
+
+	service.Spec.Selector = selector
+	service.Spec.Ports = servicePorts
+	service.Labels = withOwner(service.Labels, owner)
+	if _, err := s.clientset.CoreV1().Services(namespace).Update(ctx, service, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to switch service selector: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"service":   serviceName,
+		"namespace": namespace,
+		"color":     color,
+	}).Info("Service switched to new color")
+
+	return nil
+}
+
+// RetireColor deletes the Deployment of an inactive color. It is a no-op when traffic was
+// switched back to that color or a newer release has already replaced its image.
+func (s *K8sService) RetireColor(namespace, serviceName, color, image string) error {
+	ctx := context.Background()
+
+	activeColor, err := s.GetActiveColor(namespace, serviceName)
+	if err != nil {
+		return err
+	}
+	if activeColor == color {
+		return nil
+	}
+
+	name := ColorDeploymentName(serviceName, color)
+	deployment, err := s.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	containers := deployment.Spec.Template.Spec.Containers
+	if image != "" && (len(containers) == 0 || containers[0].Image != image) {
+		return nil
+	}
+
+	if err := s.DeleteHorizontalPodAutoscaler(namespace, name); err != nil {
+		return err
+	}
+
+	return s.DeleteDeployment(namespace, name)
+}
@@ -0,0 +1,470 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Executors that build images inside a pod, without a Docker daemon
+const (
+	BuildExecutorKaniko   = "kaniko"
+	BuildExecutorBuildKit = "buildkit"
+)
+
+const (
+	defaultKanikoImage   = "gcr.io/kaniko-project/executor:v1.23.2"
+	defaultBuildKitImage = "moby/buildkit:v0.16.0-rootless"
+
+	buildContainerName = "build"
+
+	gitUsernameKey = "username"
+	gitPasswordKey = "password"
+)
+
+type BuildJobOptions struct {
+	Name           string
+	Namespace      string
+	Executor       string   // kaniko or buildkit, defaults to kaniko
+	ExecutorImage  string   // overrides the default image of the executor
+	GitURL         string   // repository the build context is fetched from
+	GitUsername    string   // credentials for fetching GitURL over HTTPS, stored in a Secret for the duration of the job
+	GitPassword    string   // password or access token for GitUsername
+	Ref            string   // branch, tag or pull request reference, e.g. refs/heads/main
+	Commit         string   // pins the build to a commit of Ref
+	Dockerfile     string   // path relative to the repository root
+	Destinations   []string // image references the result is pushed to, including the tags
+	BuildArgs      map[string]string
+	Target         string
+	RegistrySecret string // kubernetes.io/dockerconfigjson Secret holding the push credentials
+	DockerConfig   []byte // registry credentials stored in a Secret for the duration of the job, instead of RegistrySecret
+	Timeout        time.Duration
+	Owner          Owner
+	Output         io.Writer // receives the build output while the job runs
+}
+
+// RunBuildJob builds an image in a Kubernetes Job, streams the output of the build pod to
+// opts.Output, waits for the job to finish and returns the digest of the pushed image. Cancelling
+// ctx deletes the job together with its pod.
+func (s *K8sService) RunBuildJob(ctx context.Context, opts BuildJobOptions) (string, error) {
+	// Validate required fields
+	if opts.Name == "" {
+		return "", fmt.Errorf("job name is required")
+	}
+	if opts.Namespace == "" {
+		return "", fmt.Errorf("namespace is required")
+	}
+	if opts.GitURL == "" {
+		return "", fmt.Errorf("git URL is required")
+	}
+	if len(opts.Destinations) == 0 {
+		return "", fmt.Errorf("destination is required")
+	}
+	if opts.Dockerfile == "" {
+		opts.Dockerfile = "Dockerfile"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Minute
+	}
+	if opts.Output == nil {
+		opts.Output = io.Discard
+	}
+
+	if len(opts.DockerConfig) > 0 {
+		opts.RegistrySecret = opts.Name + "-registry"
+		secret := registrySecret(opts.Namespace, opts.RegistrySecret, opts.DockerConfig, opts.Owner)
+		if _, err := s.clientset.CoreV1().Secrets(opts.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("failed to create registry secret: %w", err)
+		}
+		defer func() {
+			if err := s.clientset.CoreV1().Secrets(opts.Namespace).Delete(context.Background(), opts.RegistrySecret, metav1.DeleteOptions{}); err != nil {
+				s.logger.WithError(err).WithField("secret", opts.RegistrySecret).Warn("Failed to delete build registry secret")
+			}
+		}()
+	}
+
+	if opts.GitPassword != "" {
+		name := gitSecretName(opts.Name)
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: opts.Namespace,
+				Labels:    withOwner(nil, opts.Owner),
+			},
+			Type: corev1.SecretTypeOpaque,
+			StringData: map[string]string{
+				gitUsernameKey: opts.GitUsername,
+				gitPasswordKey: opts.GitPassword,
+			},
+		}
+		if _, err := s.clientset.CoreV1().Secrets(opts.Namespace).Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return "", fmt.Errorf("failed to create git secret: %w", err)
+		}
+		defer func() {
+			if err := s.clientset.CoreV1().Secrets(opts.Namespace).Delete(context.Background(), name, metav1.DeleteOptions{}); err != nil {
+				s.logger.WithError(err).WithField("secret", name).Warn("Failed to delete build git secret")
+			}
+		}()
+	}
+
+	job, err := buildJob(opts)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := s.clientset.BatchV1().Jobs(opts.Namespace).Create(ctx, job, metav1.CreateOptions{}); err != nil {
+		return "", fmt.Errorf("failed to create build job: %w", err)
+	}
+	defer func() {
+		if ctx.Err() == nil {
+			return
+		}
+		// The build was cancelled: stop the pod instead of leaving it to run until its deadline
+		propagation := metav1.DeletePropagationBackground
+		if err := s.clientset.BatchV1().Jobs(opts.Namespace).Delete(context.Background(), opts.Name, metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil {
+			s.logger.WithError(err).WithField("job", opts.Name).Warn("Failed to delete cancelled build job")
+		}
+	}()
+
+	s.logger.WithFields(logrus.Fields{
+		"job":          opts.Name,
+		"namespace":    opts.Namespace,
+		"executor":     opts.Executor,
+		"destinations": opts.Destinations,
+	}).Info("Build job created")
+
+	waitCtx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	podName, err := s.waitForBuildPod(waitCtx, opts.Namespace, opts.Name)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.streamBuildLogs(waitCtx, opts.Namespace, podName, opts.Output); err != nil {
+		s.logger.WithError(err).WithField("job", opts.Name).Warn("Build log stream interrupted")
+	}
+
+	if err := s.waitForBuildJob(waitCtx, opts.Namespace, opts.Name); err != nil {
+		return "", err
+	}
+	return s.buildDigest(waitCtx, opts.Namespace, podName)
+}
+
+// buildDigest reads the image digest the executor wrote to the termination log of the build
+// container: a plain digest from Kaniko, or the build metadata of BuildKit
+func (s *K8sService) buildDigest(ctx context.Context, namespace, podName string) (string, error) {
+	pod, err := s.clientset.CoreV1().Pods(namespace).Get(ctx, podName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get build pod: %w", err)
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != buildContainerName || status.State.Terminated == nil {
+			continue
+		}
+		message := strings.TrimSpace(status.State.Terminated.Message)
+		if strings.HasPrefix(message, "{") {
+			var metadata struct {
+				Digest string `json:"containerimage.digest"`
+			}
+			if err := json.Unmarshal([]byte(message), &metadata); err != nil {
+				return "", fmt.Errorf("invalid build metadata: %w", err)
+			}
+			message = metadata.Digest
+		}
+		if strings.HasPrefix(message, "sha256:") {
+			return message, nil
+		}
+	}
+	return "", fmt.Errorf("build job did not report an image digest")
+}
+
+func buildJob(opts BuildJobOptions) (*batchv1.Job, error) {
+	var container corev1.Container
+	var volumes []corev1.Volume
+	var securityContext *corev1.PodSecurityContext
+
+	switch opts.Executor {
+	case "", BuildExecutorKaniko:
+		container = kanikoContainer(opts)
+	case BuildExecutorBuildKit:
+		container = buildKitContainer(opts)
+		volumes = append(volumes, corev1.Volume{
+			Name:         "buildkitd",
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		// Rootless BuildKit runs as the unprivileged user of its image
+		user := int64(1000)
+		securityContext = &corev1.PodSecurityContext{
+			RunAsUser:  &user,
+			RunAsGroup: &user,
+			FSGroup:    &user,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported build executor: %s", opts.Executor)
+	}
+
+	if opts.RegistrySecret != "" {
+		volumes = append(volumes, corev1.Volume{
+			Name: "registry-auth",
+			VolumeSource: corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{
+				SecretName: opts.RegistrySecret,
+				Items:      []corev1.KeyToPath{{Key: corev1.DockerConfigJsonKey, Path: "config.json"}},
+			}},
+		})
+	}
+
+	labels := withOwner(map[string]string{
+		"app":       "ys-cloud-build",
+		"build-job": opts.Name,
+	}, opts.Owner)
+
+	// Failed builds are not retried; finished jobs are removed after an hour
+	backoffLimit, ttl := int32(0), int32(3600)
+	deadline := int64(opts.Timeout.Seconds())
+
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Name,
+			Namespace: opts.Namespace,
+			Labels:    labels,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit:            &backoffLimit,
+			ActiveDeadlineSeconds:   &deadline,
+			TTLSecondsAfterFinished: &ttl,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					RestartPolicy:   corev1.RestartPolicyNever,
+					SecurityContext: securityContext,
+					Containers:      []corev1.Container{container},
+					Volumes:         volumes,
+				},
+			},
+		},
+	}, nil
+}
+
+func kanikoContainer(opts BuildJobOptions) corev1.Container {
+	image := opts.ExecutorImage
+	if image == "" {
+		image = defaultKanikoImage
+	}
+
+	args := []string{
+		"--context=" + kanikoGitContext(opts.GitURL, opts.Ref, opts.Commit),
+		"--dockerfile=" + opts.Dockerfile,
+		"--digest-file=/dev/termination-log",
+	}
+	for _, destination := range opts.Destinations {
+		args = append(args, "--destination="+destination)
+	}
+	for _, key := range sortedBuildArgKeys(opts.BuildArgs) {
+		args = append(args, fmt.Sprintf("--build-arg=%s=%s", key, opts.BuildArgs[key]))
+	}
+	if opts.Target != "" {
+		args = append(args, "--target="+opts.Target)
+	}
+
+	container := corev1.Container{
+		Name:  buildContainerName,
+		Image: image,
+		Args:  args,
+	}
+	if opts.RegistrySecret != "" {
+		container.VolumeMounts = []corev1.VolumeMount{{Name: "registry-auth", MountPath: "/kaniko/.docker", ReadOnly: true}}
+	}
+	if opts.GitPassword != "" {
+		// Kaniko authenticates git contexts with these variables
+		container.Env = []corev1.EnvVar{
+			gitSecretEnv("GIT_USERNAME", opts.Name, gitUsernameKey),
+			gitSecretEnv("GIT_PASSWORD", opts.Name, gitPasswordKey),
+		}
+	}
+	return container
+}
+
+// kanikoGitContext renders a git build context, e.g. git://github.com/org/app.git#refs/heads/main#<commit>
+func kanikoGitContext(gitURL, ref, commit string) string {
+	gitContext := "git://" + strings.TrimPrefix(strings.TrimPrefix(gitURL, "https://"), "http://")
+	if ref != "" || commit != "" {
+		gitContext += "#" + ref
+		if commit != "" {
+			gitContext += "#" + commit
+		}
+	}
+	return gitContext
+}
+
+func buildKitContainer(opts BuildJobOptions) corev1.Container {
+	image := opts.ExecutorImage
+	if image == "" {
+		image = defaultBuildKitImage
+	}
+
+	gitContext := opts.GitURL
+	if opts.Commit != "" {
+		gitContext += "#" + opts.Commit
+	} else if opts.Ref != "" {
+		gitContext += "#" + opts.Ref
+	}
+
+	args := []string{
+		"build",
+		"--frontend", "dockerfile.v0",
+		"--opt", "context=" + gitContext,
+		"--opt", "filename=" + opts.Dockerfile,
+		"--output", fmt.Sprintf(`type=image,"name=%s",push=true`, strings.Join(opts.Destinations, ",")),
+		"--metadata-file", "/dev/termination-log",
+		"--progress", "plain",
+	}
+	for _, key := range sortedBuildArgKeys(opts.BuildArgs) {
+		args = append(args, "--opt", fmt.Sprintf("build-arg:%s=%s", key, opts.BuildArgs[key]))
+	}
+	if opts.Target != "" {
+		args = append(args, "--opt", "target="+opts.Target)
+	}
+
+	unconfined := corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}
+	container := corev1.Container{
+		Name:    buildContainerName,
+		Image:   image,
+		Command: []string{"buildctl-daemonless.sh"},
+		Args:    args,
+		Env: []corev1.EnvVar{
+			{Name: "BUILDKITD_FLAGS", Value: "--oci-worker-no-process-sandbox"},
+			{Name: "DOCKER_CONFIG", Value: "/home/user/.docker"},
+		},
+		SecurityContext: &corev1.SecurityContext{
+			SeccompProfile:  &unconfined,
+			AppArmorProfile: &corev1.AppArmorProfile{Type: corev1.AppArmorProfileTypeUnconfined},
+		},
+		VolumeMounts: []corev1.VolumeMount{{Name: "buildkitd", MountPath: "/home/user/.local/share/buildkit"}},
+	}
+	if opts.RegistrySecret != "" {
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{Name: "registry-auth", MountPath: "/home/user/.docker", ReadOnly: true})
+	}
+	if opts.GitPassword != "" {
+		// BuildKit authenticates git contexts with the GIT_AUTH_TOKEN session secret
+		container.Env = append(container.Env, gitSecretEnv("GIT_AUTH_TOKEN", opts.Name, gitPasswordKey))
+		container.Args = append(container.Args, "--secret", "id=GIT_AUTH_TOKEN,env=GIT_AUTH_TOKEN")
+	}
+	return container
+}
+
+func gitSecretName(jobName string) string {
+	return jobName + "-git"
+}
+
+func gitSecretEnv(name, jobName, key string) corev1.EnvVar {
+	return corev1.EnvVar{
+		Name: name,
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: gitSecretName(jobName)},
+			Key:                  key,
+		}},
+	}
+}
+
+// waitForBuildPod waits until the build container of a job has started and returns its pod
+func (s *K8sService) waitForBuildPod(ctx context.Context, namespace, jobName string) (string, error) {
+	var podName string
+	err := wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		pods, err := s.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "build-job=" + jobName,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		for _, pod := range pods.Items {
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.Name != buildContainerName {
+					continue
+				}
+				if status.State.Waiting != nil {
+					switch status.State.Waiting.Reason {
+					case "ErrImagePull", "ImagePullBackOff", "InvalidImageName", "CreateContainerConfigError":
+						return false, fmt.Errorf("build pod cannot start: %s: %s", status.State.Waiting.Reason, status.State.Waiting.Message)
+					}
+					continue
+				}
+				podName = pod.Name
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed waiting for build pod: %w", err)
+	}
+	return podName, nil
+}
+
+func (s *K8sService) streamBuildLogs(ctx context.Context, namespace, podName string, output io.Writer) error {
+	stream, err := s.clientset.CoreV1().Pods(namespace).GetLogs(podName, &corev1.PodLogOptions{
+		Container: buildContainerName,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to stream build logs: %w", err)
+	}
+	defer stream.Close()
+
+	_, err = io.Copy(output, stream)
+	return err
+}
+
+func (s *K8sService) waitForBuildJob(ctx context.Context, namespace, name string) error {
+	var failure error
+	err := wait.PollUntilContextCancel(ctx, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		job, err := s.clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		for _, condition := range job.Status.Conditions {
+			if condition.Status != corev1.ConditionTrue {
+				continue
+			}
+			switch condition.Type {
+			case batchv1.JobComplete:
+				return true, nil
+			case batchv1.JobFailed:
+				failure = fmt.Errorf("build job failed: %s", condition.Message)
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("build job timed out")
+		}
+		return fmt.Errorf("failed waiting for build job: %w", err)
+	}
+	return failure
+}
+
+func sortedBuildArgKeys(args map[string]string) []string {
+	keys := make([]string, 0, len(args))
+	for key := range args {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
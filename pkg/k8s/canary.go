@@ -0,0 +1,200 @@
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	canaryAnnotation       = "nginx.ingress.kubernetes.io/canary"
+	canaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+)
+
+type CanaryOptions struct {
+	Deployment   DeploymentOptions
+	Host         string
+	ClassName    string             // ingress class of the primary ingress
+	TLS          *IngressTLSOptions // TLS of the primary host, sharing its certificate Secret
+	ServicePort  int32
+	Weight       int
+	ReadyTimeout time.Duration
+}
+
+// CanaryName returns the name shared by the canary Deployment, Service and Ingress
+func CanaryName(name string) string {
+	return fmt.Sprintf("%s-canary", name)
+}
+
+// DeployCanary runs the new version as a separate Deployment and routes the given
+// share of the primary host's traffic to it through an nginx canary Ingress
+func (s *K8sService) DeployCanary(opts CanaryOptions) error {
+	ctx := context.Background()
+
+	base := opts.Deployment
+	if base.Name == "" {
+		return fmt.Errorf("deployment name is required")
+	}
+	if base.Namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	if opts.Host == "" {
+		return fmt.Errorf("host is required")
+	}
+	if err := validateCanaryWeight(opts.Weight); err != nil {
+		return err
+	}
+	if opts.ReadyTimeout <= 0 {
+		opts.ReadyTimeout = 10 * time.Minute
+	}
+
+	primary, err := s.clientset.AppsV1().Deployments(base.Namespace).Get(ctx, base.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("canary requires an existing primary deployment %s", base.Name)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get primary deployment: %w", err)
+	}
+
+	name := CanaryName(base.Name)
+	canaryOpts := base
+	canaryOpts.Name = name
+	canaryOpts.Labels = nil
+	canaryOpts.Selector = nil
+	canaryOpts.Replicas = canaryReplicas(primary, opts.Weight)
+
+	deployment, err := buildDeployment(canaryOpts)
+	if err != nil {
+		return err
+	}
+	if err := verifyImage(canaryOpts); err != nil {
+		return err
+	}
+	if err := s.applyDeployment(ctx, deployment); err != nil {
+		return err
+	}
+	if err := s.WaitForDeploymentReady(base.Namespace, name, opts.ReadyTimeout); err != nil {
+		return err
+	}
+
+	exists, err := s.ServiceExists(base.Namespace, name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if err := s.CreateService(ServiceOptions{
+			Name:       name,
+			Namespace:  base.Namespace,
+			Port:       opts.ServicePort,
+			TargetPort: deployment.Spec.Template.Spec.Containers[0].Ports[0].ContainerPort,
+			Ports:      AdditionalPorts(base.Ports),
+			Type:       corev1.ServiceTypeClusterIP,
+			Owner:      base.Owner,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return s.ApplyIngress(IngressOptions{
+		Name:        name,
+		Namespace:   base.Namespace,
+		Host:        opts.Host,
+		ServiceName: name,
+		ServicePort: opts.ServicePort,
+		ClassName:   opts.ClassName,
+		Annotations: map[string]string{
+			canaryAnnotation:       "true",
+			canaryWeightAnnotation: strconv.Itoa(opts.Weight),
+		},
+		TLS:   opts.TLS,
+		Owner: base.Owner,
+	})
+}
+
+// SetCanaryWeight changes the percentage of traffic sent to the canary
+func (s *K8sService) SetCanaryWeight(namespace, name string, weight int) error {
+	ctx := context.Background()
+
+	if err := validateCanaryWeight(weight); err != nil {
+		return err
+	}
+
+	ingress, err := s.clientset.NetworkingV1().Ingresses(namespace).Get(ctx, CanaryName(name), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get canary ingress: %w", err)
+	}
+
+	if ingress.Annotations == nil {
+		ingress.Annotations = make(map[string]string)
+	}
+	ingress.Annotations[canaryAnnotation] = "true"
+	ingress.Annotations[canaryWeightAnnotation] = strconv.Itoa(weight)
+
+	// Resize the canary before sending it more traffic
+	primary, err := s.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get primary deployment: %w", err)
+	}
+	if err := s.ScaleDeployment(namespace, CanaryName(name), canaryReplicas(primary, weight)); err != nil {
+		return err
+	}
+
+	if _, err := s.clientset.NetworkingV1().Ingresses(namespace).Update(ctx, ingress, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update canary weight: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment": name,
+		"namespace":  namespace,
+		"weight":     weight,
+	}).Info("Canary weight updated")
+
+	return nil
+}
+
+// DeleteCanary removes the canary Ingress, Service and Deployment of a primary deployment
+func (s *K8sService) DeleteCanary(namespace, name string) error {
+	canary := CanaryName(name)
+
+	var errs []error
+	if err := s.DeleteIngress(namespace, canary); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+	if err := s.DeleteService(namespace, canary); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+	if err := s.DeleteDeployment(namespace, canary); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// canaryReplicas sizes the canary to its share of the primary's replicas, rounded up so that the
+// canary always runs at least one pod
+func canaryReplicas(primary *appsv1.Deployment, weight int) int32 {
+	replicas := int32(1)
+	if primary.Spec.Replicas != nil {
+		replicas = *primary.Spec.Replicas
+	}
+	if canary := (replicas*int32(weight) + 99) / 100; canary > 1 {
+		return canary
+	}
+	return 1
+}
+
+func validateCanaryWeight(weight int) error {
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("canary weight must be between 0 and 100")
+	}
+	return nil
+}
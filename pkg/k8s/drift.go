@@ -0,0 +1,257 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+// WorkloadState is the part of a Deployment compared when looking for changes made outside ys-cloud
+type WorkloadState struct {
+	Replicas   int32            `json:"replicas"`
+	Containers []ContainerState `json:"containers"`
+}
+
+type ContainerState struct {
+	Name      string                      `json:"name"`
+	Image     string                      `json:"image"`
+	Env       []corev1.EnvVar             `json:"env,omitempty"`
+	Resources corev1.ResourceRequirements `json:"resources"`
+}
+
+// DriftDifference is a single field whose live value no longer matches the applied one
+type DriftDifference struct {
+	Field   string `json:"field"`
+	Applied string `json:"applied"`
+	Live    string `json:"live"`
+}
+
+// unsetValue marks fields that are missing on one side of a comparison
+const unsetValue = "<unset>"
+
+// GetWorkloadState reads the replicas and container settings of a live deployment, returning
+// nil when the deployment does not exist
+func (s *K8sService) GetWorkloadState(namespace, name string) (*WorkloadState, error) {
+	deployment, err := s.clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	return workloadState(deployment), nil
+}
+
+// RenderWorkloadState returns the state of the deployment the options describe, which is what
+// drift is measured against rather than whatever the cluster held once a rollout finished
+func RenderWorkloadState(opts DeploymentOptions) (*WorkloadState, error) {
+	deployment, err := buildDeployment(opts)
+	if err != nil {
+		return nil, err
+	}
+	return workloadState(deployment), nil
+}
+
+func workloadState(deployment *appsv1.Deployment) *WorkloadState {
+	state := &WorkloadState{Replicas: 1}
+	if deployment.Spec.Replicas != nil {
+		state.Replicas = *deployment.Spec.Replicas
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		state.Containers = append(state.Containers, ContainerState{
+			Name:      container.Name,
+			Image:     container.Image,
+			Env:       container.Env,
+			Resources: container.Resources,
+		})
+	}
+	return state
+}
+
+// RestoreWorkloadState writes the images, environment and resources of the given state back to
+// a live deployment, and its replica count unless ignoreReplicas is set. Environment variables
+// are restored one by one, so variables added by others, e.g. injected by a webhook, are kept.
+func (s *K8sService) RestoreWorkloadState(namespace, name string, state *WorkloadState, ignoreReplicas bool) error {
+	ctx := context.Background()
+
+	// Validate required fields
+	if state == nil {
+		return fmt.Errorf("workload state is required")
+	}
+
+	deployments := s.clientset.AppsV1().Deployments(namespace)
+	deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	containers := deployment.Spec.Template.Spec.Containers
+	for _, applied := range state.Containers {
+		index := -1
+		for i := range containers {
+			if containers[i].Name == applied.Name {
+				index = i
+				break
+			}
+		}
+		if index == -1 {
+			return fmt.Errorf("container %s not found in deployment", applied.Name)
+		}
+		containers[index].Image = applied.Image
+		containers[index].Env = mergeEnv(containers[index].Env, applied.Env)
+		containers[index].Resources = applied.Resources
+	}
+	if !ignoreReplicas {
+		replicas := state.Replicas
+		deployment.Spec.Replicas = &replicas
+	}
+
+	if _, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment": name,
+		"namespace":  namespace,
+	}).Info("Kubernetes deployment restored to applied state")
+
+	return nil
+}
+
+// mergeEnv sets the applied variables on the live environment, keeping the order and the
+// variables of the live one
+func mergeEnv(live, applied []corev1.EnvVar) []corev1.EnvVar {
+	merged := make([]corev1.EnvVar, len(live), len(live)+len(applied))
+	copy(merged, live)
+
+	index := make(map[string]int, len(merged))
+	for i, v := range merged {
+		index[v.Name] = i
+	}
+	for _, v := range applied {
+		if i, ok := index[v.Name]; ok {
+			merged[i] = v
+			continue
+		}
+		index[v.Name] = len(merged)
+		merged = append(merged, v)
+	}
+	return merged
+}
+
+// CompareWorkloadState lists the fields of the live state that differ from the applied one.
+// Replicas are skipped when ignoreReplicas is set, e.g. while an autoscaler owns them.
+func CompareWorkloadState(applied, live *WorkloadState, ignoreReplicas bool) []DriftDifference {
+	var differences []DriftDifference
+	add := func(field, appliedValue, liveValue string) {
+		if appliedValue != liveValue {
+			differences = append(differences, DriftDifference{Field: field, Applied: appliedValue, Live: liveValue})
+		}
+	}
+
+	if !ignoreReplicas {
+		add("replicas", fmt.Sprint(applied.Replicas), fmt.Sprint(live.Replicas))
+	}
+
+	liveContainers := make(map[string]ContainerState, len(live.Containers))
+	for _, container := range live.Containers {
+		liveContainers[container.Name] = container
+	}
+
+	for _, appliedContainer := range applied.Containers {
+		prefix := fmt.Sprintf("containers[%s]", appliedContainer.Name)
+		liveContainer, ok := liveContainers[appliedContainer.Name]
+		if !ok {
+			add(prefix, "present", unsetValue)
+			continue
+		}
+		delete(liveContainers, appliedContainer.Name)
+
+		add(prefix+".image", appliedContainer.Image, liveContainer.Image)
+
+		appliedEnv, liveEnv := envValues(appliedContainer.Env), envValues(liveContainer.Env)
+		for _, name := range unionKeys(appliedEnv, liveEnv) {
+			add(prefix+".env."+name, valueOrUnset(appliedEnv, name), valueOrUnset(liveEnv, name))
+		}
+
+		appliedResources, liveResources := resourceValues(appliedContainer.Resources), resourceValues(liveContainer.Resources)
+		for _, name := range unionKeys(appliedResources, liveResources) {
+			add(prefix+".resources."+name, valueOrUnset(appliedResources, name), valueOrUnset(liveResources, name))
+		}
+	}
+
+	extra := make([]string, 0, len(liveContainers))
+	for name := range liveContainers {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		add(fmt.Sprintf("containers[%s]", name), unsetValue, "present")
+	}
+
+	return differences
+}
+
+// envValues describes each environment variable by its value or the source it is read from
+func envValues(env []corev1.EnvVar) map[string]string {
+	values := make(map[string]string, len(env))
+	for _, v := range env {
+		source := v.ValueFrom
+		switch {
+		case source == nil:
+			values[v.Name] = v.Value
+		case source.SecretKeyRef != nil:
+			values[v.Name] = fmt.Sprintf("secret %s/%s", source.SecretKeyRef.Name, source.SecretKeyRef.Key)
+		case source.ConfigMapKeyRef != nil:
+			values[v.Name] = fmt.Sprintf("configmap %s/%s", source.ConfigMapKeyRef.Name, source.ConfigMapKeyRef.Key)
+		case source.FieldRef != nil:
+			values[v.Name] = "field " + source.FieldRef.FieldPath
+		case source.ResourceFieldRef != nil:
+			values[v.Name] = "resource " + source.ResourceFieldRef.Resource
+		default:
+			values[v.Name] = "value from source"
+		}
+	}
+	return values
+}
+
+// resourceValues flattens requests and limits into keys such as limits.cpu
+func resourceValues(resources corev1.ResourceRequirements) map[string]string {
+	values := make(map[string]string, len(resources.Requests)+len(resources.Limits))
+	for name, quantity := range resources.Requests {
+		values["requests."+string(name)] = quantity.String()
+	}
+	for name, quantity := range resources.Limits {
+		values["limits."+string(name)] = quantity.String()
+	}
+	return values
+}
+
+func unionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func valueOrUnset(values map[string]string, key string) string {
+	if value, ok := values[key]; ok {
+		return value
+	}
+	return unsetValue
+}
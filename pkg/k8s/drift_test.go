@@ -0,0 +1,125 @@
+package k8s
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestCompareWorkloadState(t *testing.T) {
+	resources := func(cpu, memory string) corev1.ResourceRequirements {
+		return corev1.ResourceRequirements{
+			Requests: corev1.ResourceList{corev1.ResourceCPU: resource.MustParse(cpu)},
+			Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memory)},
+		}
+	}
+	app := ContainerState{
+		Name:      "app",
+		Image:     "registry.example.com/app:1.0",
+		Env:       []corev1.EnvVar{{Name: "MODE", Value: "production"}},
+		Resources: resources("500m", "1Gi"),
+	}
+	state := func(replicas int32, containers ...ContainerState) *WorkloadState {
+		return &WorkloadState{Replicas: replicas, Containers: containers}
+	}
+	with := func(change func(*ContainerState)) ContainerState {
+		container := app
+		container.Env = append([]corev1.EnvVar(nil), app.Env...)
+		change(&container)
+		return container
+	}
+
+	tests := []struct {
+		name           string
+		applied        *WorkloadState
+		live           *WorkloadState
+		ignoreReplicas bool
+		want           []DriftDifference
+	}{
+		{
+			name:    "no drift",
+			applied: state(2, app),
+			live:    state(2, app),
+		},
+		{
+			name:    "scaled",
+			applied: state(2, app),
+			live:    state(5, app),
+			want:    []DriftDifference{{Field: "replicas", Applied: "2", Live: "5"}},
+		},
+		{
+			name:           "scaled by an autoscaler",
+			applied:        state(2, app),
+			live:           state(5, app),
+			ignoreReplicas: true,
+		},
+		{
+			name:    "image changed",
+			applied: state(1, app),
+			live:    state(1, with(func(c *ContainerState) { c.Image = "registry.example.com/app:hotfix" })),
+			want: []DriftDifference{
+				{Field: "containers[app].image", Applied: "registry.example.com/app:1.0", Live: "registry.example.com/app:hotfix"},
+			},
+		},
+		{
+			name:    "env changed, added and removed",
+			applied: state(1, app),
+			live: state(1, with(func(c *ContainerState) {
+				c.Env = []corev1.EnvVar{{Name: "MODE", Value: "debug"}, {Name: "TRACE", Value: "1"}}
+			})),
+			want: []DriftDifference{
+				{Field: "containers[app].env.MODE", Applied: "production", Live: "debug"},
+				{Field: "containers[app].env.TRACE", Applied: unsetValue, Live: "1"},
+			},
+		},
+		{
+			name:    "env read from a secret",
+			applied: state(1, app),
+			live: state(1, with(func(c *ContainerState) {
+				c.Env[0] = corev1.EnvVar{Name: "MODE", ValueFrom: &corev1.EnvVarSource{
+					SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "app"}, Key: "mode"},
+				}}
+			})),
+			want: []DriftDifference{
+				{Field: "containers[app].env.MODE", Applied: "production", Live: "secret app/mode"},
+			},
+		},
+		{
+			name:    "resources changed",
+			applied: state(1, app),
+			live: state(1, with(func(c *ContainerState) {
+				c.Resources = resources("1", "1Gi")
+				c.Resources.Limits[corev1.ResourceCPU] = resource.MustParse("2")
+			})),
+			want: []DriftDifference{
+				{Field: "containers[app].resources.limits.cpu", Applied: unsetValue, Live: "2"},
+				{Field: "containers[app].resources.requests.cpu", Applied: "500m", Live: "1"},
+			},
+		},
+		{
+			name:    "container removed and added",
+			applied: state(1, app),
+			live:    state(1, with(func(c *ContainerState) { c.Name = "sidecar" })),
+			want: []DriftDifference{
+				{Field: "containers[app]", Applied: "present", Live: unsetValue},
+				{Field: "containers[sidecar]", Applied: unsetValue, Live: "present"},
+			},
+		},
+		{
+			name:    "containers reordered",
+			applied: state(1, app, with(func(c *ContainerState) { c.Name = "sidecar" })),
+			live:    state(1, with(func(c *ContainerState) { c.Name = "sidecar" }), app),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareWorkloadState(tt.applied, tt.live, tt.ignoreReplicas)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("CompareWorkloadState() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
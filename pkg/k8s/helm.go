@@ -0,0 +1,389 @@
+package k8s
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/cli"
+	"helm.sh/helm/v3/pkg/kube"
+	"helm.sh/helm/v3/pkg/registry"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/sirupsen/logrus"
+)
+
+type HelmOptions struct {
+	ReleaseName  string
+	Namespace    string
+	Chart        string // local chart directory, chart name within RepoURL, or oci:// reference
+	RepoURL      string
+	Version      string
+	Values       map[string]interface{}
+	Wait         bool
+	Timeout      time.Duration
+	Owner        Owner         // ownership labels recorded on the release
+	ClusterKinds []string      // cluster-scoped kinds the chart may create, e.g. CustomResourceDefinition
+	Verifier     ImageVerifier // refuses the release when a rendered container image fails verification
+}
+
+type HelmRelease struct {
+	Name         string    `json:"name"`
+	Namespace    string    `json:"namespace"`
+	Revision     int       `json:"revision"`
+	Status       string    `json:"status"`
+	Chart        string    `json:"chart"`
+	ChartVersion string    `json:"chart_version"`
+	AppVersion   string    `json:"app_version"`
+	Description  string    `json:"description"`
+	Updated      time.Time `json:"updated"`
+}
+
+// HelmUpgradeInstall installs a chart as a release, or upgrades the release if it already exists
+func (s *K8sService) HelmUpgradeInstall(opts HelmOptions) (*HelmRelease, error) {
+	// Validate required fields
+	if opts.ReleaseName == "" {
+		return nil, fmt.Errorf("release name is required")
+	}
+	if opts.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	if opts.Chart == "" {
+		return nil, fmt.Errorf("chart is required")
+	}
+
+	cfg, err := s.helmConfiguration(opts.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	// Hooks and the crds directory of a chart bypass the post-renderer, so the objects Helm
+	// creates are checked once more on their way to the cluster
+	client, ok := cfg.KubeClient.(*kube.Client)
+	if !ok {
+		return nil, fmt.Errorf("unexpected Helm kubernetes client %T", cfg.KubeClient)
+	}
+	cfg.KubeClient = &confinedKubeClient{Client: client, namespace: opts.Namespace, clusterKinds: opts.ClusterKinds}
+	postRenderer := &confiningPostRenderer{k8s: s, namespace: opts.Namespace, clusterKinds: opts.ClusterKinds, verifier: opts.Verifier}
+
+	// Like helm upgrade --install, a release without a successful revision is installed again
+	history, err := action.NewHistory(cfg).Run(opts.ReleaseName)
+	if err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+		return nil, fmt.Errorf("failed to get release history: %w", err)
+	}
+
+	var rel *release.Release
+	if helmUpgradable(history) {
+		upgrade := action.NewUpgrade(cfg)
+		upgrade.Namespace = opts.Namespace
+		upgrade.Wait = opts.Wait
+		upgrade.Timeout = opts.Timeout
+		upgrade.RepoURL = opts.RepoURL
+		upgrade.Version = opts.Version
+		upgrade.Labels = opts.Owner.Labels()
+		upgrade.PostRenderer = postRenderer
+
+		chart, err := s.loadChart(&upgrade.ChartPathOptions, opts.Chart)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err = upgrade.Run(opts.ReleaseName, chart, opts.Values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upgrade release: %w", err)
+		}
+	} else {
+		install := action.NewInstall(cfg)
+		install.ReleaseName = opts.ReleaseName
+		install.Namespace = opts.Namespace
+		install.Replace = len(history) > 0 // reuse the name of failed or uninstalled revisions
+		install.Wait = opts.Wait
+		install.Timeout = opts.Timeout
+		install.RepoURL = opts.RepoURL
+		install.Version = opts.Version
+		install.Labels = opts.Owner.Labels()
+		install.PostRenderer = postRenderer
+
+		chart, err := s.loadChart(&install.ChartPathOptions, opts.Chart)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err = install.Run(chart, opts.Values)
+		if err != nil {
+			return nil, fmt.Errorf("failed to install release: %w", err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"release":   rel.Name,
+		"namespace": rel.Namespace,
+		"revision":  rel.Version,
+		"chart":     opts.Chart,
+	}).Info("Helm release deployed successfully")
+
+	return helmReleaseInfo(rel), nil
+}
+
+// helmUpgradable reports whether a release can be upgraded: it must have been deployed
+// successfully at some point and not have been uninstalled since
+func helmUpgradable(history []*release.Release) bool {
+	deployed := false
+	var latest *release.Release
+	for _, rel := range history {
+		switch rel.Info.Status {
+		case release.StatusDeployed, release.StatusSuperseded:
+			deployed = true
+		}
+		if latest == nil || rel.Version > latest.Version {
+			latest = rel
+		}
+	}
+	return deployed && latest.Info.Status != release.StatusUninstalled
+}
+
+// HelmHistory returns the revisions of a release, newest first
+func (s *K8sService) HelmHistory(namespace, name string) ([]HelmRelease, error) {
+	cfg, err := s.helmConfiguration(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	releases, err := action.NewHistory(cfg).Run(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get release history: %w", err)
+	}
+
+	result := make([]HelmRelease, 0, len(releases))
+	for _, rel := range releases {
+		result = append(result, *helmReleaseInfo(rel))
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Revision > result[j].Revision })
+	return result, nil
+}
+
+// HelmRollback rolls a release back to the given revision, or to the previous one when revision is 0.
+// Helm records the rollback as a new revision, which is returned.
+func (s *K8sService) HelmRollback(namespace, name string, revision int, wait bool, timeout time.Duration) (*HelmRelease, error) {
+	cfg, err := s.helmConfiguration(namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	rollback := action.NewRollback(cfg)
+	rollback.Version = revision
+	rollback.Wait = wait
+	rollback.Timeout = timeout
+
+	if err := rollback.Run(name); err != nil {
+		return nil, fmt.Errorf("failed to roll back release: %w", err)
+	}
+
+	rel, err := cfg.Releases.Last(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rolled back release: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"release":   name,
+		"namespace": namespace,
+		"target":    revision,
+		"revision":  rel.Version,
+	}).Info("Helm release rolled back successfully")
+
+	return helmReleaseInfo(rel), nil
+}
+
+// HelmUninstall removes a release and the resources it created
+func (s *K8sService) HelmUninstall(namespace, name string) error {
+	cfg, err := s.helmConfiguration(namespace)
+	if err != nil {
+		return err
+	}
+
+	if _, err := action.NewUninstall(cfg).Run(name); err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to uninstall release: %w", err)
+	}
+
+	return nil
+}
+
+// confiningPostRenderer refuses a rendered chart that leaves the release namespace, creates
+// cluster-scoped objects of a kind that is not allowed or runs an image that fails verification.
+// The manifests themselves are not changed.
+type confiningPostRenderer struct {
+	k8s          *K8sService
+	namespace    string
+	clusterKinds []string
+	verifier     ImageVerifier
+}
+
+func (r *confiningPostRenderer) Run(rendered *bytes.Buffer) (*bytes.Buffer, error) {
+	objects, err := DecodeManifests(rendered.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	// Discovery runs after Helm installed the CRDs of the chart, so their kinds can be mapped
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(r.k8s.clientset.Discovery()))
+	for _, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map %s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+
+		// Helm installs objects without a namespace into the release namespace
+		namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		namespace := obj.GetNamespace()
+		if namespaced && namespace == "" {
+			namespace = r.namespace
+		}
+		if err := checkScope(gvk.Kind, obj.GetName(), namespace, namespaced, r.namespace, r.clusterKinds); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := verifyObjectImages(objects, r.verifier); err != nil {
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// confinedKubeClient refuses to create or update objects outside the release namespace, and
+// cluster-scoped objects of a kind that is not allowed
+type confinedKubeClient struct {
+	*kube.Client
+	namespace    string
+	clusterKinds []string
+}
+
+func (c *confinedKubeClient) Create(resources kube.ResourceList) (*kube.Result, error) {
+	if err := c.check(resources); err != nil {
+		return nil, err
+	}
+	return c.Client.Create(resources)
+}
+
+func (c *confinedKubeClient) Update(original, target kube.ResourceList, force bool) (*kube.Result, error) {
+	if err := c.check(target); err != nil {
+		return nil, err
+	}
+	return c.Client.Update(original, target, force)
+}
+
+func (c *confinedKubeClient) check(resources kube.ResourceList) error {
+	for _, info := range resources {
+		if info.Mapping == nil {
+			return fmt.Errorf("failed to map %s", info.Name)
+		}
+		namespaced := info.Mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		if err := checkScope(info.Mapping.GroupVersionKind.Kind, info.Name, info.Namespace, namespaced, c.namespace, c.clusterKinds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *K8sService) helmConfiguration(namespace string) (*action.Configuration, error) {
+	if s.restConfig == nil {
+		return nil, fmt.Errorf("kubernetes REST config is not available")
+	}
+
+	cfg := &action.Configuration{}
+	debug := func(format string, v ...interface{}) {
+		s.logger.Debugf(format, v...)
+	}
+	if err := cfg.Init(&restClientGetter{config: s.restConfig, namespace: namespace}, namespace, "secret", debug); err != nil {
+		return nil, fmt.Errorf("failed to initialize Helm: %w", err)
+	}
+
+	registryClient, err := registry.NewClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create registry client: %w", err)
+	}
+	cfg.RegistryClient = registryClient
+
+	return cfg, nil
+}
+
+func (s *K8sService) loadChart(pathOptions *action.ChartPathOptions, name string) (*chart.Chart, error) {
+	path, err := pathOptions.LocateChart(name, cli.New())
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate chart: %w", err)
+	}
+
+	chart, err := loader.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chart: %w", err)
+	}
+
+	return chart, nil
+}
+
+func helmReleaseInfo(rel *release.Release) *HelmRelease {
+	info := &HelmRelease{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Revision:  rel.Version,
+	}
+	if rel.Info != nil {
+		info.Status = rel.Info.Status.String()
+		info.Description = rel.Info.Description
+		info.Updated = rel.Info.LastDeployed.Time
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		info.Chart = rel.Chart.Metadata.Name
+		info.ChartVersion = rel.Chart.Metadata.Version
+		info.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	return info
+}
+
+// restClientGetter hands Helm the REST config of a K8sService instead of a kubeconfig file
+type restClientGetter struct {
+	config    *rest.Config
+	namespace string
+}
+
+func (g *restClientGetter) ToRESTConfig() (*rest.Config, error) {
+	return rest.CopyConfig(g.config), nil
+}
+
+func (g *restClientGetter) ToDiscoveryClient() (discovery.CachedDiscoveryInterface, error) {
+	client, err := discovery.NewDiscoveryClientForConfig(rest.CopyConfig(g.config))
+	if err != nil {
+		return nil, err
+	}
+	return memory.NewMemCacheClient(client), nil
+}
+
+func (g *restClientGetter) ToRESTMapper() (meta.RESTMapper, error) {
+	client, err := g.ToDiscoveryClient()
+	if err != nil {
+		return nil, err
+	}
+	return restmapper.NewDeferredDiscoveryRESTMapper(client), nil
+}
+
+func (g *restClientGetter) ToRawKubeConfigLoader() clientcmd.ClientConfig {
+	return clientcmd.NewDefaultClientConfig(*clientcmdapi.NewConfig(), &clientcmd.ConfigOverrides{
+		Context: clientcmdapi.Context{Namespace: g.namespace},
+	})
+}
@@ -0,0 +1,321 @@
+package k8s
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// clusterIssuerAnnotation asks cert-manager to provision the ingress certificate from a ClusterIssuer
+	clusterIssuerAnnotation = "cert-manager.io/cluster-issuer"
+	// managedAnnotationsAnnotation lists the annotations ys-cloud set on an ingress, so that those it
+	// no longer sets are removed while annotations added by others are kept
+	managedAnnotationsAnnotation = "ys-cloud/managed-annotations"
+)
+
+type IngressRuleOptions struct {
+	Host  string               `json:"host"`
+	Paths []IngressPathOptions `json:"paths,omitempty"` // defaults to / on the ingress service
+}
+
+type IngressPathOptions struct {
+	Path        string `json:"path"`
+	PathType    string `json:"path_type,omitempty"`    // Prefix, Exact, ImplementationSpecific; defaults to Prefix
+	ServiceName string `json:"service_name,omitempty"` // defaults to the ingress service
+	ServicePort int32  `json:"service_port,omitempty"` // defaults to the ingress service port
+}
+
+// IngressTLSOptions terminates TLS for every host of the ingress. The certificate is read from
+// SecretName, which cert-manager fills when ClusterIssuer is set.
+type IngressTLSOptions struct {
+	SecretName    string `json:"secret_name,omitempty"` // defaults to <ingress>-tls
+	ClusterIssuer string `json:"cluster_issuer,omitempty"`
+}
+
+// TLSSecretName returns the default name of the certificate Secret of an ingress
+func TLSSecretName(ingress string) string {
+	return fmt.Sprintf("%s-tls", ingress)
+}
+
+// ValidateIngressRules checks the hosts, paths and path types of ingress rules
+func ValidateIngressRules(rules []IngressRuleOptions) error {
+	for _, rule := range rules {
+		if rule.Host == "" {
+			return fmt.Errorf("ingress rule host is required")
+		}
+		for _, path := range rule.Paths {
+			if !strings.HasPrefix(path.Path, "/") {
+				return fmt.Errorf("ingress path %q of host %s must start with /", path.Path, rule.Host)
+			}
+			switch networkingv1.PathType(path.PathType) {
+			case "", networkingv1.PathTypePrefix, networkingv1.PathTypeExact, networkingv1.PathTypeImplementationSpecific:
+			default:
+				return fmt.Errorf("unsupported ingress path type %s", path.PathType)
+			}
+			if path.ServicePort < 0 {
+				return fmt.Errorf("ingress service port must not be negative")
+			}
+		}
+	}
+	return nil
+}
+
+// buildIngress renders the ingress described by the options
+func buildIngress(opts IngressOptions) (*networkingv1.Ingress, error) {
+	// Validate required fields
+	if opts.Name == "" {
+		return nil, fmt.Errorf("ingress name is required")
+	}
+	if opts.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+	if opts.Host == "" && len(opts.Rules) == 0 {
+		return nil, fmt.Errorf("host is required")
+	}
+	if opts.ServiceName == "" {
+		return nil, fmt.Errorf("service name is required")
+	}
+	if opts.ServicePort <= 0 {
+		return nil, fmt.Errorf("service port is required")
+	}
+	if err := ValidateIngressRules(opts.Rules); err != nil {
+		return nil, err
+	}
+	if len(opts.Paths) > 0 {
+		if opts.Host == "" {
+			return nil, fmt.Errorf("ingress paths require a host")
+		}
+		if err := ValidateIngressRules([]IngressRuleOptions{{Host: opts.Host, Paths: opts.Paths}}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Use default labels if none specified
+	labels := withOwner(getOrDefaultLabels(opts.Labels, opts.Name), opts.Owner)
+
+	rules := opts.Rules
+	if opts.Host != "" {
+		hostRule := IngressRuleOptions{Host: opts.Host}
+		if len(opts.Paths) > 0 {
+			hostRule.Paths = append(append(hostRule.Paths, opts.Paths...), IngressPathOptions{Path: "/"})
+		}
+		rules = append([]IngressRuleOptions{hostRule}, rules...)
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        opts.Name,
+			Namespace:   opts.Namespace,
+			Labels:      labels,
+			Annotations: make(map[string]string, len(opts.Annotations)+1),
+		},
+	}
+	for key, value := range opts.Annotations {
+		ingress.Annotations[key] = value
+	}
+	if opts.ClassName != "" {
+		ingress.Spec.IngressClassName = &opts.ClassName
+	}
+
+	for _, rule := range rules {
+		paths := rule.Paths
+		if len(paths) == 0 {
+			paths = []IngressPathOptions{{Path: "/"}}
+		}
+
+		httpPaths := make([]networkingv1.HTTPIngressPath, 0, len(paths))
+		for _, path := range paths {
+			pathType := networkingv1.PathTypePrefix
+			if path.PathType != "" {
+				pathType = networkingv1.PathType(path.PathType)
+			}
+			serviceName, servicePort := opts.ServiceName, opts.ServicePort
+			if path.ServiceName != "" {
+				serviceName = path.ServiceName
+			}
+			if path.ServicePort > 0 {
+				servicePort = path.ServicePort
+			}
+
+			httpPaths = append(httpPaths, networkingv1.HTTPIngressPath{
+				Path:     path.Path,
+				PathType: &pathType,
+				Backend: networkingv1.IngressBackend{
+					Service: &networkingv1.IngressServiceBackend{
+						Name: serviceName,
+						Port: networkingv1.ServiceBackendPort{
+							Number: servicePort,
+						},
+					},
+				},
+			})
+		}
+
+		ingress.Spec.Rules = append(ingress.Spec.Rules, networkingv1.IngressRule{
+			Host: rule.Host,
+			IngressRuleValue: networkingv1.IngressRuleValue{
+				HTTP: &networkingv1.HTTPIngressRuleValue{Paths: httpPaths},
+			},
+		})
+	}
+
+	if opts.TLS != nil {
+		secretName := opts.TLS.SecretName
+		if secretName == "" {
+			secretName = TLSSecretName(opts.Name)
+		}
+		if opts.TLS.ClusterIssuer != "" {
+			ingress.Annotations[clusterIssuerAnnotation] = opts.TLS.ClusterIssuer
+		}
+		ingress.Spec.TLS = []networkingv1.IngressTLS{
+			{
+				Hosts:      ingressHosts(ingress),
+				SecretName: secretName,
+			},
+		}
+	}
+
+	if len(ingress.Annotations) > 0 {
+		keys := make([]string, 0, len(ingress.Annotations))
+		for key := range ingress.Annotations {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		ingress.Annotations[managedAnnotationsAnnotation] = strings.Join(keys, ",")
+	}
+
+	return ingress, nil
+}
+
+// mergeAnnotations applies the annotations ys-cloud manages onto those of an existing ingress,
+// dropping the ones it set before but no longer does
+func mergeAnnotations(existing, managed map[string]string) map[string]string {
+	merged := make(map[string]string, len(existing)+len(managed))
+	for key, value := range existing {
+		merged[key] = value
+	}
+	if previous := existing[managedAnnotationsAnnotation]; previous != "" {
+		for _, key := range strings.Split(previous, ",") {
+			delete(merged, key)
+		}
+	}
+	delete(merged, managedAnnotationsAnnotation)
+	for key, value := range managed {
+		merged[key] = value
+	}
+	return merged
+}
+
+// ingressHosts returns the distinct hosts of the ingress rules in order
+func ingressHosts(ingress *networkingv1.Ingress) []string {
+	var hosts []string
+	seen := make(map[string]bool)
+	for _, rule := range ingress.Spec.Rules {
+		if !seen[rule.Host] {
+			seen[rule.Host] = true
+			hosts = append(hosts, rule.Host)
+		}
+	}
+	return hosts
+}
+
+// ApplyIngress creates the ingress, or replaces the rules, TLS settings and labels of an existing
+// one. Annotations set by others, e.g. controllers, are kept.
+func (s *K8sService) ApplyIngress(opts IngressOptions) error {
+	ctx := context.Background()
+
+	ingress, err := buildIngress(opts)
+	if err != nil {
+		return err
+	}
+
+	ingresses := s.clientset.NetworkingV1().Ingresses(opts.Namespace)
+	existing, err := ingresses.Get(ctx, opts.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return s.CreateIngress(opts)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get ingress: %w", err)
+	}
+
+	existing.Labels = ingress.Labels
+	existing.Annotations = mergeAnnotations(existing.Annotations, ingress.Annotations)
+	existing.Spec = ingress.Spec
+	if _, err := ingresses.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update ingress: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"ingress":   opts.Name,
+		"namespace": opts.Namespace,
+		"hosts":     ingressHosts(ingress),
+		"tls":       len(ingress.Spec.TLS) > 0,
+	}).Info("Kubernetes ingress updated")
+
+	return nil
+}
+
+// ApplyTLSSecret stores a PEM encoded certificate and private key as a kubernetes.io/tls Secret
+func (s *K8sService) ApplyTLSSecret(namespace, name string, certificate, key []byte, owner Owner) error {
+	ctx := context.Background()
+
+	// Validate required fields
+	if namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	if name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+	if _, err := tls.X509KeyPair(certificate, key); err != nil {
+		return fmt.Errorf("invalid TLS certificate: %w", err)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    withOwner(nil, owner),
+		},
+		Type: corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       certificate,
+			corev1.TLSPrivateKeyKey: key,
+		},
+	}
+
+	secrets := s.clientset.CoreV1().Secrets(namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create TLS secret: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get TLS secret: %w", err)
+	case existing.Type != corev1.SecretTypeTLS:
+		return fmt.Errorf("secret %s exists and is not a TLS secret", name)
+	default:
+		existing.Labels = withOwner(existing.Labels, owner)
+		existing.Data = secret.Data
+		if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update TLS secret: %w", err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"secret":    name,
+		"namespace": namespace,
+	}).Info("Kubernetes TLS secret applied")
+
+	return nil
+}
@@ -0,0 +1,346 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/restmapper"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FieldManager identifies ys-cloud as the owner of fields it sets through server-side apply
+const FieldManager = "ys-cloud"
+
+type ManifestOptions struct {
+	Namespace    string
+	Manifests    []byte            // multi-document YAML or JSON
+	Images       map[string]string // image repository -> replacement image reference
+	Owner        Owner             // ownership labels added to every object
+	ClusterKinds []string          // cluster-scoped kinds the manifests may create, e.g. CustomResourceDefinition
+	Prune        []AppliedResource // objects applied previously, deleted when the manifests no longer contain them
+	Verifier     ImageVerifier     // refuses the bundle when a container image fails verification
+}
+
+type AppliedResource struct {
+	APIVersion string `json:"api_version"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+// ApplyManifests server-side applies every object in a manifest bundle. Namespaced objects land in
+// opts.Namespace and may not name another one, cluster-scoped objects are refused unless their kind
+// is allowed, and container images are rewritten per opts.Images. Fields owned by other managers
+// are not taken over, so conflicting changes fail the apply instead of being overwritten.
+func (s *K8sService) ApplyManifests(opts ManifestOptions) ([]AppliedResource, error) {
+	ctx := context.Background()
+
+	// Validate required fields
+	if opts.Namespace == "" {
+		return nil, fmt.Errorf("namespace is required")
+	}
+
+	objects, err := DecodeManifests(opts.Manifests)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("manifests contain no objects")
+	}
+
+	client, err := dynamic.NewForConfig(s.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(s.clientset.Discovery()))
+
+	// Check every object before applying any, so a bundle is not left half applied
+	resources := make([]dynamic.ResourceInterface, len(objects))
+	for i, obj := range objects {
+		gvk := obj.GroupVersionKind()
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map %s %s: %w", gvk.Kind, obj.GetName(), err)
+		}
+
+		namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+		if namespaced && obj.GetNamespace() == "" {
+			obj.SetNamespace(opts.Namespace)
+		}
+		if err := checkScope(gvk.Kind, obj.GetName(), obj.GetNamespace(), namespaced, opts.Namespace, opts.ClusterKinds); err != nil {
+			return nil, err
+		}
+		if namespaced {
+			resources[i] = client.Resource(mapping.Resource).Namespace(opts.Namespace)
+		} else {
+			obj.SetNamespace("")
+			resources[i] = client.Resource(mapping.Resource)
+		}
+
+		if err := replaceImages(obj, opts.Images); err != nil {
+			return nil, err
+		}
+		obj.SetLabels(withOwner(obj.GetLabels(), opts.Owner))
+	}
+	if err := verifyObjectImages(objects, opts.Verifier); err != nil {
+		return nil, err
+	}
+
+	var applied []AppliedResource
+	for i, obj := range objects {
+		data, err := obj.MarshalJSON()
+		if err != nil {
+			return applied, fmt.Errorf("failed to encode %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		if _, err := resources[i].Patch(ctx, obj.GetName(), types.ApplyPatchType, data, metav1.PatchOptions{
+			FieldManager: FieldManager,
+		}); err != nil {
+			return applied, fmt.Errorf("failed to apply %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+
+		applied = append(applied, AppliedResource{
+			APIVersion: obj.GetAPIVersion(),
+			Kind:       obj.GetKind(),
+			Namespace:  obj.GetNamespace(),
+			Name:       obj.GetName(),
+		})
+	}
+
+	pruned, err := s.pruneManifests(ctx, client, mapper, opts, applied)
+	if err != nil {
+		return applied, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"namespace": opts.Namespace,
+		"objects":   len(applied),
+		"pruned":    pruned,
+	}).Info("Manifests applied successfully")
+
+	return applied, nil
+}
+
+// checkScope refuses an object outside the namespace a deployment is confined to. Namespaced
+// objects must be in that namespace, cluster-scoped objects must be of an allowed kind.
+func checkScope(kind, name, objectNamespace string, namespaced bool, namespace string, clusterKinds []string) error {
+	if namespaced {
+		if objectNamespace != namespace {
+			return fmt.Errorf("%s %s targets namespace %s instead of %s", kind, name, objectNamespace, namespace)
+		}
+		return nil
+	}
+	if !slices.Contains(clusterKinds, kind) {
+		return fmt.Errorf("cluster-scoped %s %s is not allowed", kind, name)
+	}
+	return nil
+}
+
+// pruneManifests deletes the previously applied objects missing from the applied set. Objects that
+// no longer carry the project's ownership label were taken over by someone else and are kept.
+func (s *K8sService) pruneManifests(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, opts ManifestOptions, applied []AppliedResource) (int, error) {
+	current := make(map[string]bool, len(applied))
+	for _, resource := range applied {
+		current[resource.key()] = true
+	}
+
+	pruned := 0
+	for _, resource := range opts.Prune {
+		if current[resource.key()] {
+			continue
+		}
+
+		gv, err := schema.ParseGroupVersion(resource.APIVersion)
+		if err != nil {
+			return pruned, fmt.Errorf("invalid api version of %s %s: %w", resource.Kind, resource.Name, err)
+		}
+		mapping, err := mapper.RESTMapping(gv.WithKind(resource.Kind).GroupKind(), gv.Version)
+		if err != nil {
+			// The kind is gone from the cluster, and with it the object
+			continue
+		}
+
+		var target dynamic.ResourceInterface = client.Resource(mapping.Resource)
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			if resource.Namespace != opts.Namespace {
+				continue
+			}
+			target = client.Resource(mapping.Resource).Namespace(resource.Namespace)
+		}
+
+		obj, err := target.Get(ctx, resource.Name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return pruned, fmt.Errorf("failed to get %s %s: %w", resource.Kind, resource.Name, err)
+		}
+		if ParseOwner(obj.GetLabels()).ProjectID != opts.Owner.ProjectID {
+			continue
+		}
+
+		if err := target.Delete(ctx, resource.Name, metav1.DeleteOptions{}); err != nil && !apierrors.IsNotFound(err) {
+			return pruned, fmt.Errorf("failed to prune %s %s: %w", resource.Kind, resource.Name, err)
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// key identifies a resource regardless of the version it was applied with
+func (r AppliedResource) key() string {
+	gv, _ := schema.ParseGroupVersion(r.APIVersion)
+	return gv.Group + "/" + r.Kind + "/" + r.Namespace + "/" + r.Name
+}
+
+// RenderKustomization builds a kustomization directory into a manifest bundle
+func RenderKustomization(dir string) ([]byte, error) {
+	kustomizer := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resources, err := kustomizer.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build kustomization: %w", err)
+	}
+
+	manifests, err := resources.AsYaml()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render kustomization: %w", err)
+	}
+	return manifests, nil
+}
+
+// DecodeManifests splits a multi-document YAML or JSON bundle into objects, expanding List kinds
+func DecodeManifests(manifests []byte) ([]*unstructured.Unstructured, error) {
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifests), 4096)
+
+	var objects []*unstructured.Unstructured
+	for {
+		obj := &unstructured.Unstructured{}
+		if err := decoder.Decode(&obj.Object); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to decode manifests: %w", err)
+		}
+		if len(obj.Object) == 0 {
+			continue
+		}
+
+		if obj.IsList() {
+			list, err := obj.ToList()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode list: %w", err)
+			}
+			for i := range list.Items {
+				objects = append(objects, &list.Items[i])
+			}
+			continue
+		}
+
+		if obj.GetKind() == "" || obj.GetName() == "" {
+			return nil, fmt.Errorf("manifest object is missing kind or metadata.name")
+		}
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// podSpecPaths lists where workload kinds keep their pod spec
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// replaceImages points containers whose image repository is listed in images at the replacement
+func replaceImages(obj *unstructured.Unstructured, images map[string]string) error {
+	path, ok := podSpecPaths[obj.GetKind()]
+	if !ok || len(images) == 0 {
+		return nil
+	}
+
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, found, err := unstructured.NestedSlice(obj.Object, append(path, field)...)
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s %s: %w", field, obj.GetKind(), obj.GetName(), err)
+		}
+		if !found {
+			continue
+		}
+
+		for _, item := range containers {
+			container, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			image, _ := container["image"].(string)
+			if replacement, ok := images[imageRepository(image)]; ok {
+				container["image"] = replacement
+			}
+		}
+
+		if err := unstructured.SetNestedSlice(obj.Object, containers, append(path, field)...); err != nil {
+			return fmt.Errorf("failed to set images in %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+	}
+
+	return nil
+}
+
+// objectImages returns the container images of a workload object
+func objectImages(obj *unstructured.Unstructured) ([]string, error) {
+	path, ok := podSpecPaths[obj.GetKind()]
+	if !ok {
+		return nil, nil
+	}
+
+	var images []string
+	for _, field := range []string{"initContainers", "containers"} {
+		containers, _, err := unstructured.NestedSlice(obj.Object, append(path, field)...)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in %s %s: %w", field, obj.GetKind(), obj.GetName(), err)
+		}
+		for _, item := range containers {
+			if container, ok := item.(map[string]interface{}); ok {
+				if image, _ := container["image"].(string); image != "" {
+					images = append(images, image)
+				}
+			}
+		}
+	}
+	return images, nil
+}
+
+// imageRepository strips the tag or digest from an image reference
+func imageRepository(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// A colon after the last slash separates the tag; earlier ones belong to a registry port
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
@@ -0,0 +1,31 @@
+package k8s
+
+import "testing"
+
+func TestCheckScope(t *testing.T) {
+	clusterKinds := []string{"CustomResourceDefinition"}
+
+	tests := []struct {
+		name            string
+		kind            string
+		objectNamespace string
+		namespaced      bool
+		wantErr         bool
+	}{
+		{name: "own namespace", kind: "Deployment", objectNamespace: "team-a", namespaced: true},
+		{name: "other namespace", kind: "Secret", objectNamespace: "kube-system", namespaced: true, wantErr: true},
+		{name: "no namespace", kind: "ConfigMap", objectNamespace: "", namespaced: true, wantErr: true},
+		{name: "allowed cluster kind", kind: "CustomResourceDefinition", namespaced: false},
+		{name: "cluster kind not allowed", kind: "ClusterRoleBinding", namespaced: false, wantErr: true},
+		{name: "namespace kind not allowed", kind: "Namespace", namespaced: false, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkScope(tt.kind, "example", tt.objectNamespace, tt.namespaced, "team-a", clusterKinds)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkScope() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
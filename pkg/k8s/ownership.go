@@ -0,0 +1,221 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"helm.sh/helm/v3/pkg/action"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Labels recording which ys-cloud objects a Kubernetes resource belongs to
+const (
+	InstallationLabel = "ys-cloud/installation-id"
+	ProjectLabel      = "ys-cloud/project-id"
+	EnvironmentLabel  = "ys-cloud/environment-id"
+	DeploymentLabel   = "ys-cloud/deployment-id"
+)
+
+// Owner identifies the installation, project, environment and deployment a resource was created
+// for. Zero IDs are left out of the labels; resources without a project are not tracked. The
+// installation tells apart ys-cloud instances sharing a cluster, whose project IDs overlap.
+type Owner struct {
+	Installation  string `json:"installation,omitempty"`
+	ProjectID     uint   `json:"project_id"`
+	EnvironmentID uint   `json:"environment_id,omitempty"`
+	DeploymentID  uint   `json:"deployment_id,omitempty"`
+}
+
+// Labels returns the ownership labels of the owner
+func (o Owner) Labels() map[string]string {
+	labels := make(map[string]string, 4)
+	if o.Installation != "" && o.ProjectID != 0 {
+		labels[InstallationLabel] = o.Installation
+	}
+	if o.ProjectID != 0 {
+		labels[ProjectLabel] = strconv.FormatUint(uint64(o.ProjectID), 10)
+	}
+	if o.EnvironmentID != 0 {
+		labels[EnvironmentLabel] = strconv.FormatUint(uint64(o.EnvironmentID), 10)
+	}
+	if o.DeploymentID != 0 {
+		labels[DeploymentLabel] = strconv.FormatUint(uint64(o.DeploymentID), 10)
+	}
+	return labels
+}
+
+// ParseOwner reads the ownership labels of a resource
+func ParseOwner(labels map[string]string) Owner {
+	return Owner{
+		Installation:  labels[InstallationLabel],
+		ProjectID:     parseIDLabel(labels[ProjectLabel]),
+		EnvironmentID: parseIDLabel(labels[EnvironmentLabel]),
+		DeploymentID:  parseIDLabel(labels[DeploymentLabel]),
+	}
+}
+
+func parseIDLabel(value string) uint {
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+// withOwner merges the ownership labels into a label set, which is created when nil
+func withOwner(labels map[string]string, owner Owner) map[string]string {
+	ownerLabels := owner.Labels()
+	if len(ownerLabels) == 0 {
+		return labels
+	}
+	if labels == nil {
+		labels = make(map[string]string, len(ownerLabels))
+	}
+	for key, value := range ownerLabels {
+		labels[key] = value
+	}
+	return labels
+}
+
+// ManagedResource is a resource carrying ys-cloud ownership labels
+type ManagedResource struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Owner     Owner  `json:"owner"`
+
+	resource schema.GroupVersionResource
+}
+
+// managedResourceTypes are the kinds searched for ys-cloud resources. Kinds applied through
+// raw manifests outside this list are not tracked.
+var managedResourceTypes = []struct {
+	kind     string
+	resource schema.GroupVersionResource
+}{
+	{"Deployment", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}},
+	{"StatefulSet", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}},
+	{"DaemonSet", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "daemonsets"}},
+	{"CronJob", schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}},
+	{"Job", schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}},
+	{"HorizontalPodAutoscaler", schema.GroupVersionResource{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}},
+	{"Service", schema.GroupVersionResource{Version: "v1", Resource: "services"}},
+	{"Ingress", schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}},
+	{"ConfigMap", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+	{"Secret", schema.GroupVersionResource{Version: "v1", Resource: "secrets"}},
+	{"PersistentVolumeClaim", schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}},
+	{"Namespace", schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}},
+}
+
+// helmReleaseKind marks Helm releases among managed resources; they are removed by uninstalling
+const helmReleaseKind = "HelmRelease"
+
+// ListManagedResources returns every resource and Helm release in the cluster that carries
+// the ownership labels of this installation. Without an installation ID every resource with
+// ys-cloud ownership labels is returned, including those of other installations.
+func (s *K8sService) ListManagedResources() ([]ManagedResource, error) {
+	ctx := context.Background()
+
+	selector := ProjectLabel
+	if s.config.InstallationID != "" {
+		selector = fmt.Sprintf("%s,%s=%s", ProjectLabel, InstallationLabel, s.config.InstallationID)
+	}
+
+	client, err := dynamic.NewForConfig(s.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	var resources []ManagedResource
+	for _, resourceType := range managedResourceTypes {
+		list, err := client.Resource(resourceType.resource).List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if apierrors.IsNotFound(err) {
+			// The API is not served by this cluster
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s resources: %w", resourceType.kind, err)
+		}
+
+		for _, item := range list.Items {
+			resources = append(resources, ManagedResource{
+				Kind:      resourceType.kind,
+				Namespace: item.GetNamespace(),
+				Name:      item.GetName(),
+				Owner:     ParseOwner(item.GetLabels()),
+				resource:  resourceType.resource,
+			})
+		}
+	}
+
+	cfg, err := s.helmConfiguration("")
+	if err != nil {
+		return nil, err
+	}
+	list := action.NewList(cfg)
+	list.AllNamespaces = true
+	list.All = true
+	list.Selector = selector
+	releases, err := list.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Helm releases: %w", err)
+	}
+	for _, rel := range releases {
+		resources = append(resources, ManagedResource{
+			Kind:      helmReleaseKind,
+			Namespace: rel.Namespace,
+			Name:      rel.Name,
+			Owner:     ParseOwner(rel.Labels),
+		})
+	}
+
+	return resources, nil
+}
+
+// DeleteManagedResource removes a resource found by ListManagedResources; a resource that
+// is already gone is not an error
+func (s *K8sService) DeleteManagedResource(resource ManagedResource) error {
+	ctx := context.Background()
+
+	// Validate required fields
+	if resource.Name == "" {
+		return fmt.Errorf("resource name is required")
+	}
+
+	if resource.Kind == helmReleaseKind {
+		return s.HelmUninstall(resource.Namespace, resource.Name)
+	}
+	if resource.resource.Resource == "" {
+		return fmt.Errorf("unsupported resource kind %s", resource.Kind)
+	}
+
+	client, err := dynamic.NewForConfig(s.restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	var target dynamic.ResourceInterface = client.Resource(resource.resource)
+	if resource.Namespace != "" {
+		target = client.Resource(resource.resource).Namespace(resource.Namespace)
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = target.Delete(ctx, resource.Name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s %s: %w", resource.Kind, resource.Name, err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"kind":      resource.Kind,
+		"namespace": resource.Namespace,
+		"name":      resource.Name,
+	}).Info("Managed Kubernetes resource deleted")
+
+	return nil
+}
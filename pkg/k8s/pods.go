@@ -0,0 +1,220 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+type PodInfo struct {
+	Name       string          `json:"name"`
+	Phase      string          `json:"phase"`
+	Node       string          `json:"node"`
+	PodIP      string          `json:"pod_ip"`
+	Ready      bool            `json:"ready"`
+	Restarts   int32           `json:"restarts"`
+	StartedAt  *time.Time      `json:"started_at"`
+	Containers []ContainerInfo `json:"containers"`
+}
+
+type ContainerInfo struct {
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	Ready        bool   `json:"ready"`
+	RestartCount int32  `json:"restart_count"`
+	State        string `json:"state"` // waiting, running, terminated
+	Reason       string `json:"reason,omitempty"`
+	Message      string `json:"message,omitempty"`
+	ExitCode     *int32 `json:"exit_code,omitempty"`
+}
+
+type EventInfo struct {
+	Type      string    `json:"type"`
+	Reason    string    `json:"reason"`
+	Message   string    `json:"message"`
+	Kind      string    `json:"kind"`
+	Object    string    `json:"object"`
+	Count     int32     `json:"count"`
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// ListDeploymentPods returns the pods selected by a deployment along with their container states
+func (s *K8sService) ListDeploymentPods(namespace, name string) ([]PodInfo, error) {
+	ctx := context.Background()
+
+	pods, err := s.listDeploymentPods(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PodInfo, 0, len(pods))
+	for _, pod := range pods {
+		info := PodInfo{
+			Name:  pod.Name,
+			Phase: string(pod.Status.Phase),
+			Node:  pod.Spec.NodeName,
+			PodIP: pod.Status.PodIP,
+		}
+		if pod.Status.StartTime != nil {
+			startedAt := pod.Status.StartTime.Time
+			info.StartedAt = &startedAt
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady {
+				info.Ready = condition.Status == corev1.ConditionTrue
+			}
+		}
+		for _, status := range pod.Status.ContainerStatuses {
+			info.Restarts += status.RestartCount
+			info.Containers = append(info.Containers, containerInfoFromStatus(status))
+		}
+		result = append(result, info)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// ListDeploymentEvents returns the events of a deployment, its replica sets and pods, newest first
+func (s *K8sService) ListDeploymentEvents(namespace, name string) ([]EventInfo, error) {
+	ctx := context.Background()
+
+	deployment, selector, err := s.deploymentSelector(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Collect every object whose events belong to this deployment
+	related := []corev1.ObjectReference{{Kind: "Deployment", Name: deployment.Name}}
+
+	replicaSets, err := s.clientset.AppsV1().ReplicaSets(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list replica sets: %w", err)
+	}
+	for _, rs := range replicaSets.Items {
+		if metav1.IsControlledBy(&rs, deployment) {
+			related = append(related, corev1.ObjectReference{Kind: "ReplicaSet", Name: rs.Name})
+		}
+	}
+
+	pods, err := s.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+	for _, pod := range pods.Items {
+		related = append(related, corev1.ObjectReference{Kind: "Pod", Name: pod.Name})
+	}
+
+	var result []EventInfo
+	for _, object := range related {
+		events, err := s.clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.Set{"involvedObject.kind": object.Kind, "involvedObject.name": object.Name}.String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list events of %s %s: %w", object.Kind, object.Name, err)
+		}
+		for _, event := range events.Items {
+			result = append(result, eventInfoFromEvent(event))
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].LastSeen.After(result[j].LastSeen) })
+	return result, nil
+}
+
+func (s *K8sService) listDeploymentPods(ctx context.Context, namespace, name string) ([]corev1.Pod, error) {
+	_, selector, err := s.deploymentSelector(ctx, namespace, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := s.clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods: %w", err)
+	}
+
+	return pods.Items, nil
+}
+
+// deploymentSelector returns a deployment with the label selector of its pods and replica sets
+func (s *K8sService) deploymentSelector(ctx context.Context, namespace, name string) (*appsv1.Deployment, string, error) {
+	// Validate required fields
+	if namespace == "" {
+		return nil, "", fmt.Errorf("namespace is required")
+	}
+	if name == "" {
+		return nil, "", fmt.Errorf("deployment name is required")
+	}
+
+	deployment, err := s.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid deployment selector: %w", err)
+	}
+
+	return deployment, selector.String(), nil
+}
+
+func containerInfoFromStatus(status corev1.ContainerStatus) ContainerInfo {
+	info := ContainerInfo{
+		Name:         status.Name,
+		Image:        status.Image,
+		Ready:        status.Ready,
+		RestartCount: status.RestartCount,
+	}
+
+	switch {
+	case status.State.Waiting != nil:
+		info.State = "waiting"
+		info.Reason = status.State.Waiting.Reason
+		info.Message = status.State.Waiting.Message
+	case status.State.Terminated != nil:
+		exitCode := status.State.Terminated.ExitCode
+		info.State = "terminated"
+		info.Reason = status.State.Terminated.Reason
+		info.Message = status.State.Terminated.Message
+		info.ExitCode = &exitCode
+	case status.State.Running != nil:
+		info.State = "running"
+	}
+
+	return info
+}
+
+func eventInfoFromEvent(event corev1.Event) EventInfo {
+	firstSeen := event.FirstTimestamp.Time
+	lastSeen := event.LastTimestamp.Time
+	// Events emitted through the events.k8s.io API only carry EventTime
+	if firstSeen.IsZero() {
+		firstSeen = event.EventTime.Time
+	}
+	if lastSeen.IsZero() {
+		lastSeen = firstSeen
+	}
+	count := event.Count
+	if count == 0 {
+		count = 1
+	}
+
+	return EventInfo{
+		Type:      event.Type,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Kind:      event.InvolvedObject.Kind,
+		Object:    event.InvolvedObject.Name,
+		Count:     count,
+		FirstSeen: firstSeen,
+		LastSeen:  lastSeen,
+	}
+}
@@ -0,0 +1,76 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RegistrySecretName returns the image pull secret holding the registry credentials of a workload
+func RegistrySecretName(workload string) string {
+	return "ys-cloud-registry-" + workload
+}
+
+// ApplyRegistrySecret creates or updates a kubernetes.io/dockerconfigjson Secret for pulling images
+func (s *K8sService) ApplyRegistrySecret(namespace, name string, dockerConfig []byte, owner Owner) error {
+	ctx := context.Background()
+
+	// Validate required fields
+	if namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	if name == "" {
+		return fmt.Errorf("secret name is required")
+	}
+	if !json.Valid(dockerConfig) {
+		return fmt.Errorf("invalid docker config")
+	}
+
+	secret := registrySecret(namespace, name, dockerConfig, owner)
+
+	secrets := s.clientset.CoreV1().Secrets(namespace)
+	existing, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create registry secret: %w", err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to get registry secret: %w", err)
+	case existing.Type != corev1.SecretTypeDockerConfigJson:
+		return fmt.Errorf("secret %s exists and is not a registry secret", name)
+	default:
+		existing.Labels = withOwner(existing.Labels, owner)
+		existing.Data = secret.Data
+		if _, err := secrets.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("failed to update registry secret: %w", err)
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"secret":    name,
+		"namespace": namespace,
+	}).Info("Kubernetes registry secret applied")
+
+	return nil
+}
+
+func registrySecret(namespace, name string, dockerConfig []byte, owner Owner) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+			Labels:    withOwner(nil, owner),
+		},
+		Type: corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			corev1.DockerConfigJsonKey: dockerConfig,
+		},
+	}
+}
@@ -3,16 +3,18 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 	"ys-cloud/internal/config"
 
 	"path/filepath"
 
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
-	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -22,9 +24,10 @@ import (
 )
 
 type K8sService struct {
-	clientset *kubernetes.Clientset
-	config    *config.K8sConfig
-	logger    *logrus.Logger
+	clientset  *kubernetes.Clientset
+	restConfig *rest.Config
+	config     *config.K8sConfig
+	logger     *logrus.Logger
 }
 
 type DeploymentOptions struct {
@@ -38,6 +41,19 @@ type DeploymentOptions struct {
 	Resources   *corev1.ResourceRequirements
 	Labels      map[string]string
 	Annotations map[string]string
+	Selector    map[string]string // pod selector, defaults to app=Name
+	Owner       Owner             // ownership labels set on the Deployment, not on its pods
+
+	Ports          []PortOptions // overrides Port when set, the first port is the primary one
+	LivenessProbe  *ProbeOptions // nil probes check /health on the primary port
+	ReadinessProbe *ProbeOptions
+	RollingUpdate  *RollingUpdateOptions
+	Command        []string
+	Args           []string
+	Volumes        []VolumeOptions
+
+	ImagePullSecrets []string      // Secrets of the namespace holding registry credentials
+	Verifier         ImageVerifier // refuses images failing verification when set
 }
 
 type ServiceOptions struct {
@@ -46,19 +62,26 @@ type ServiceOptions struct {
 	Selector    map[string]string
 	Port        int32
 	TargetPort  int32
+	Ports       []PortOptions // additional ports exposed next to Port
 	Type        corev1.ServiceType
 	Labels      map[string]string
 	Annotations map[string]string
+	Owner       Owner
 }
 
 type IngressOptions struct {
 	Name        string
 	Namespace   string
-	Host        string
+	Host        string               // routes / of the host to the service
+	Paths       []IngressPathOptions // further paths of Host, e.g. to additional service ports
 	ServiceName string
 	ServicePort int32
+	ClassName   string
+	Rules       []IngressRuleOptions // further hosts and paths
+	TLS         *IngressTLSOptions
 	Labels      map[string]string
 	Annotations map[string]string
+	Owner       Owner
 }
 
 func NewK8sService(cfg *config.Config) (*K8sService, error) {
@@ -84,18 +107,63 @@ func NewK8sService(cfg *config.Config) (*K8sService, error) {
 		return nil, fmt.Errorf("failed to create Kubernetes config: %w", err)
 	}
 
+	return newK8sService(k8sConfig, &cfg.K8s)
+}
+
+// NewK8sServiceFromKubeconfig connects to the cluster described by the contents of a kubeconfig file
+func NewK8sServiceFromKubeconfig(kubeconfig []byte, cfg *config.K8sConfig) (*K8sService, error) {
+	k8sConfig, err := clientcmd.RESTConfigFromKubeConfig(kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse kubeconfig: %w", err)
+	}
+
+	return newK8sService(k8sConfig, cfg)
+}
+
+// NewK8sServiceFromToken connects to an API server with a service account token
+func NewK8sServiceFromToken(server, token string, caData []byte, insecure bool, cfg *config.K8sConfig) (*K8sService, error) {
+	if server == "" {
+		return nil, fmt.Errorf("server is required")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	k8sConfig := &rest.Config{
+		Host:        server,
+		BearerToken: token,
+		TLSClientConfig: rest.TLSClientConfig{
+			CAData:   caData,
+			Insecure: insecure,
+		},
+	}
+
+	return newK8sService(k8sConfig, cfg)
+}
+
+func newK8sService(k8sConfig *rest.Config, cfg *config.K8sConfig) (*K8sService, error) {
 	clientset, err := kubernetes.NewForConfig(k8sConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kubernetes clientset: %w", err)
 	}
 
 	return &K8sService{
-		clientset: clientset,
-		config:    &cfg.K8s,
-		logger:    logrus.New(),
+		clientset:  clientset,
+		restConfig: k8sConfig,
+		config:     cfg,
+		logger:     logrus.New(),
 	}, nil
 }
 
+// ServerVersion queries the API server, which doubles as a connectivity check
+func (s *K8sService) ServerVersion() (string, error) {
+	version, err := s.clientset.Discovery().ServerVersion()
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Kubernetes API server: %w", err)
+	}
+	return version.GitVersion, nil
+}
+
 // getDefaultResourceRequirements returns default resource requirements if none are specified
 func getDefaultResourceRequirements() *corev1.ResourceRequirements {
 	return &corev1.ResourceRequirements{
@@ -130,16 +198,16 @@ func getOrDefaultLabels(labels map[string]string, name string) map[string]string
 	return labels
 }
 
-func (s *K8sService) CreateNamespace(name string) error {
+func (s *K8sService) CreateNamespace(name string, owner Owner) error {
 	ctx := context.Background()
 
 	namespace := &corev1.Namespace{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
-			Labels: map[string]string{
+			Labels: withOwner(map[string]string{
 				"name": name,
 				"app":  "ys-cloud",
-			},
+			}, owner),
 		},
 	}
 
@@ -155,18 +223,78 @@ func (s *K8sService) CreateNamespace(name string) error {
 func (s *K8sService) Deploy(opts DeploymentOptions) error {
 	ctx := context.Background()
 
+	deployment, err := buildDeployment(opts)
+	if err != nil {
+		return err
+	}
+	if err := verifyImage(opts); err != nil {
+		return err
+	}
+
+	_, err = s.clientset.AppsV1().Deployments(deployment.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"deployment": deployment.Name,
+		"namespace":  deployment.Namespace,
+		"image":      fmt.Sprintf("%s:%s", opts.Image, opts.Tag),
+		"replicas":   *deployment.Spec.Replicas,
+	}).Info("Kubernetes deployment created")
+
+	return nil
+}
+
+// applyDeployment creates the deployment or replaces the spec of an existing one
+func (s *K8sService) applyDeployment(ctx context.Context, deployment *appsv1.Deployment) error {
+	deployments := s.clientset.AppsV1().Deployments(deployment.Namespace)
+
+	existing, err := deployments.Get(ctx, deployment.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		if _, err := deployments.Create(ctx, deployment, metav1.CreateOptions{}); err != nil {
+			return fmt.Errorf("failed to create deployment: %w", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+
+	existing.Labels = deployment.Labels
+	existing.Annotations = deployment.Annotations
+	existing.Spec = deployment.Spec
+	if _, err := deployments.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+	return nil
+}
+
+func imagePullSecrets(names []string) []corev1.LocalObjectReference {
+	if len(names) == 0 {
+		return nil
+	}
+	references := make([]corev1.LocalObjectReference, 0, len(names))
+	for _, name := range names {
+		references = append(references, corev1.LocalObjectReference{Name: name})
+	}
+	return references
+}
+
+// buildDeployment validates the options and renders the Deployment object
+func buildDeployment(opts DeploymentOptions) (*appsv1.Deployment, error) {
 	// Validate required fields
 	if opts.Name == "" {
-		return fmt.Errorf("deployment name is required")
+		return nil, fmt.Errorf("deployment name is required")
 	}
 	if opts.Namespace == "" {
-		return fmt.Errorf("namespace is required")
+		return nil, fmt.Errorf("namespace is required")
 	}
 	if opts.Image == "" {
-		return fmt.Errorf("image is required")
+		return nil, fmt.Errorf("image is required")
 	}
 	if opts.Tag == "" {
-		return fmt.Errorf("tag is required")
+		return nil, fmt.Errorf("tag is required")
 	}
 
 	// Set defaults
@@ -186,20 +314,54 @@ func (s *K8sService) Deploy(opts DeploymentOptions) error {
 	// Use default labels if none specified
 	labels := getOrDefaultLabels(opts.Labels, opts.Name)
 
+	// Select pods by app name unless a narrower selector is given
+	selector := opts.Selector
+	if selector == nil {
+		selector = map[string]string{
+			"app": opts.Name,
+		}
+	}
+
+	ports, err := containerPorts(opts)
+	if err != nil {
+		return nil, err
+	}
+	primaryPort := ports[0].ContainerPort
+
+	// Add health checks
+	livenessProbe, err := buildProbe(opts.LivenessProbe, primaryPort, 30, 10)
+	if err != nil {
+		return nil, fmt.Errorf("invalid liveness probe: %w", err)
+	}
+	readinessProbe, err := buildProbe(opts.ReadinessProbe, primaryPort, 5, 5)
+	if err != nil {
+		return nil, fmt.Errorf("invalid readiness probe: %w", err)
+	}
+
+	volumes, volumeMounts, err := buildVolumes(opts.Volumes)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ownership labels stay off the pod template so they never trigger a rollout
+	metaLabels := make(map[string]string, len(labels))
+	for key, value := range labels {
+		metaLabels[key] = value
+	}
+
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        opts.Name,
 			Namespace:   opts.Namespace,
-			Labels:      labels,
+			Labels:      withOwner(metaLabels, opts.Owner),
 			Annotations: opts.Annotations,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Replicas: &opts.Replicas,
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": opts.Name,
-				},
+				MatchLabels: selector,
 			},
+			Strategy: buildStrategy(opts.RollingUpdate),
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
@@ -207,58 +369,27 @@ func (s *K8sService) Deploy(opts DeploymentOptions) error {
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
 						{
-							Name:  opts.Name,
-							Image: fmt.Sprintf("%s:%s", opts.Image, opts.Tag),
-							Ports: []corev1.ContainerPort{
-								{
-									ContainerPort: opts.Port,
-									Protocol:      corev1.ProtocolTCP,
-								},
-							},
-							Env:       opts.EnvVars,
-							Resources: *resources,
-							// Add health checks
-							LivenessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/health",
-										Port: intstr.FromInt(int(opts.Port)),
-									},
-								},
-								InitialDelaySeconds: 30,
-								PeriodSeconds:       10,
-							},
-							ReadinessProbe: &corev1.Probe{
-								ProbeHandler: corev1.ProbeHandler{
-									HTTPGet: &corev1.HTTPGetAction{
-										Path: "/health",
-										Port: intstr.FromInt(int(opts.Port)),
-									},
-								},
-								InitialDelaySeconds: 5,
-								PeriodSeconds:       5,
-							},
+							Name:           opts.Name,
+							Image:          fmt.Sprintf("%s:%s", opts.Image, opts.Tag),
+							Command:        opts.Command,
+							Args:           opts.Args,
+							Ports:          ports,
+							Env:            opts.EnvVars,
+							Resources:      *resources,
+							VolumeMounts:   volumeMounts,
+							LivenessProbe:  livenessProbe,
+							ReadinessProbe: readinessProbe,
 						},
 					},
-					RestartPolicy: corev1.RestartPolicyAlways,
+					Volumes:          volumes,
+					ImagePullSecrets: imagePullSecrets(opts.ImagePullSecrets),
+					RestartPolicy:    corev1.RestartPolicyAlways,
 				},
 			},
 		},
 	}
 
-	_, err := s.clientset.AppsV1().Deployments(opts.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to create deployment: %w", err)
-	}
-
-	s.logger.WithFields(logrus.Fields{
-		"deployment": opts.Name,
-		"namespace":  opts.Namespace,
-		"image":      fmt.Sprintf("%s:%s", opts.Image, opts.Tag),
-		"replicas":   opts.Replicas,
-	}).Info("Kubernetes deployment created")
-
-	return nil
+	return deployment, nil
 }
 
 func (s *K8sService) UpdateDeployment(opts DeploymentOptions) error {
@@ -277,6 +408,9 @@ func (s *K8sService) UpdateDeployment(opts DeploymentOptions) error {
 	if opts.Tag == "" {
 		return fmt.Errorf("tag is required")
 	}
+	if err := verifyImage(opts); err != nil {
+		return err
+	}
 
 	deployment, err := s.clientset.AppsV1().Deployments(opts.Namespace).Get(ctx, opts.Name, metav1.GetOptions{})
 	if err != nil {
@@ -296,17 +430,17 @@ func (s *K8sService) UpdateDeployment(opts DeploymentOptions) error {
 		return fmt.Errorf("container %s not found in deployment", opts.Name)
 	}
 
-	deployment.Spec.Template.Spec.Containers[containerIndex].Image = fmt.Sprintf("%s:%s", opts.Image, opts.Tag)
-
-	// Update environment variables if provided
-	if opts.EnvVars != nil {
-		deployment.Spec.Template.Spec.Containers[containerIndex].Env = opts.EnvVars
-	}
-
-	// Update resources if provided
-	if opts.Resources != nil {
-		deployment.Spec.Template.Spec.Containers[containerIndex].Resources = *opts.Resources
+	// The container, its volumes and the strategy come from the full options, so settings dropped from
+	// the spec are removed as well. Replicas are left to scaling and the selector cannot change.
+	desired, err := buildDeployment(opts)
+	if err != nil {
+		return err
 	}
+	deployment.Spec.Template.Spec.Containers[containerIndex] = desired.Spec.Template.Spec.Containers[0]
+	deployment.Spec.Template.Spec.Volumes = desired.Spec.Template.Spec.Volumes
+	deployment.Spec.Template.Spec.ImagePullSecrets = desired.Spec.Template.Spec.ImagePullSecrets
+	deployment.Spec.Strategy = desired.Spec.Strategy
+	deployment.Labels = withOwner(deployment.Labels, opts.Owner)
 
 	_, err = s.clientset.AppsV1().Deployments(opts.Namespace).Update(ctx, deployment, metav1.UpdateOptions{})
 	if err != nil {
@@ -347,7 +481,12 @@ func (s *K8sService) CreateService(opts ServiceOptions) error {
 	}
 
 	// Use default labels if none specified
-	labels := getOrDefaultLabels(opts.Labels, opts.Name)
+	labels := withOwner(getOrDefaultLabels(opts.Labels, opts.Name), opts.Owner)
+
+	ports, err := servicePorts(opts)
+	if err != nil {
+		return err
+	}
 
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -358,18 +497,12 @@ func (s *K8sService) CreateService(opts ServiceOptions) error {
 		},
 		Spec: corev1.ServiceSpec{
 			Selector: opts.Selector,
-			Ports: []corev1.ServicePort{
-				{
-					Port:       opts.Port,
-					TargetPort: intstr.FromInt(int(opts.TargetPort)),
-					Protocol:   corev1.ProtocolTCP,
-				},
-			},
-			Type: opts.Type,
+			Ports:    ports,
+			Type:     opts.Type,
 		},
 	}
 
-	_, err := s.clientset.CoreV1().Services(opts.Namespace).Create(ctx, service, metav1.CreateOptions{})
+	_, err = s.clientset.CoreV1().Services(opts.Namespace).Create(ctx, service, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create service: %w", err)
 	}
@@ -384,66 +517,57 @@ func (s *K8sService) CreateService(opts ServiceOptions) error {
 	return nil
 }
 
-func (s *K8sService) CreateIngress(opts IngressOptions) error {
+// ApplyService creates the service, or replaces the ports of an existing one. The selector of an
+// existing service is kept since blue/green deployments point it at the live color.
+func (s *K8sService) ApplyService(opts ServiceOptions) error {
 	ctx := context.Background()
 
-	// Validate required fields
-	if opts.Name == "" {
-		return fmt.Errorf("ingress name is required")
+	services := s.clientset.CoreV1().Services(opts.Namespace)
+	existing, err := services.Get(ctx, opts.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return s.CreateService(opts)
 	}
-	if opts.Namespace == "" {
-		return fmt.Errorf("namespace is required")
+	if err != nil {
+		return fmt.Errorf("failed to get service: %w", err)
 	}
-	if opts.Host == "" {
-		return fmt.Errorf("host is required")
+
+	if opts.TargetPort <= 0 {
+		opts.TargetPort = opts.Port
 	}
-	if opts.ServiceName == "" {
-		return fmt.Errorf("service name is required")
+	ports, err := servicePorts(opts)
+	if err != nil {
+		return err
 	}
-	if opts.ServicePort <= 0 {
-		return fmt.Errorf("service port is required")
+	keepNodePorts(ports, existing.Spec.Ports)
+
+	existing.Labels = withOwner(existing.Labels, opts.Owner)
+	existing.Spec.Ports = ports
+	if _, err := services.Update(ctx, existing, metav1.UpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
 	}
+	return nil
+}
 
-	// Use default labels if none specified
-	labels := getOrDefaultLabels(opts.Labels, opts.Name)
+// keepNodePorts carries the node ports allocated to existing service ports over to their replacements
+func keepNodePorts(ports, existing []corev1.ServicePort) {
+	for i := range ports {
+		for _, old := range existing {
+			if old.Port == ports[i].Port && old.Protocol == ports[i].Protocol {
+				ports[i].NodePort = old.NodePort
+			}
+		}
+	}
+}
 
-	pathType := networkingv1.PathTypePrefix
+func (s *K8sService) CreateIngress(opts IngressOptions) error {
+	ctx := context.Background()
 
-	ingress := &networkingv1.Ingress{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        opts.Name,
-			Namespace:   opts.Namespace,
-			Labels:      labels,
-			Annotations: opts.Annotations,
-		},
-		Spec: networkingv1.IngressSpec{
-			Rules: []networkingv1.IngressRule{
-				{
-					Host: opts.Host,
-					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue{
-							Paths: []networkingv1.HTTPIngressPath{
-								{
-									Path:     "/",
-									PathType: &pathType,
-									Backend: networkingv1.IngressBackend{
-										Service: &networkingv1.IngressServiceBackend{
-											Name: opts.ServiceName,
-											Port: networkingv1.ServiceBackendPort{
-												Number: opts.ServicePort,
-											},
-										},
-									},
-								},
-							},
-						},
-					},
-				},
-			},
-		},
+	ingress, err := buildIngress(opts)
+	if err != nil {
+		return err
 	}
 
-	_, err := s.clientset.NetworkingV1().Ingresses(opts.Namespace).Create(ctx, ingress, metav1.CreateOptions{})
+	_, err = s.clientset.NetworkingV1().Ingresses(opts.Namespace).Create(ctx, ingress, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create ingress: %w", err)
 	}
@@ -451,7 +575,8 @@ func (s *K8sService) CreateIngress(opts IngressOptions) error {
 	s.logger.WithFields(logrus.Fields{
 		"ingress":   opts.Name,
 		"namespace": opts.Namespace,
-		"host":      opts.Host,
+		"hosts":     ingressHosts(ingress),
+		"tls":       len(ingress.Spec.TLS) > 0,
 	}).Info("Kubernetes ingress created")
 
 	return nil
@@ -468,6 +593,100 @@ func (s *K8sService) GetDeploymentStatus(namespace, name string) (*appsv1.Deploy
 	return &deployment.Status, nil
 }
 
+// WaitForDeploymentReady blocks until every replica of the deployment runs the latest template
+func (s *K8sService) WaitForDeploymentReady(namespace, name string, timeout time.Duration) error {
+	ctx := context.Background()
+
+	err := wait.PollUntilContextTimeout(ctx, 2*time.Second, timeout, true, func(ctx context.Context) (bool, error) {
+		deployment, err := s.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+
+		replicas := int32(1)
+		if deployment.Spec.Replicas != nil {
+			replicas = *deployment.Spec.Replicas
+		}
+
+		status := deployment.Status
+		return status.ObservedGeneration >= deployment.Generation &&
+			status.UpdatedReplicas == replicas &&
+			status.AvailableReplicas == replicas &&
+			status.Replicas == replicas, nil
+	})
+	if err != nil {
+		return fmt.Errorf("deployment %s did not become ready: %w", name, err)
+	}
+
+	return nil
+}
+
+func (s *K8sService) NamespaceExists(name string) (bool, error) {
+	_, err := s.clientset.CoreV1().Namespaces().Get(context.Background(), name, metav1.GetOptions{})
+	return resourceExists(err)
+}
+
+// DeleteNamespace removes a namespace with everything in it; a missing namespace is not an error
+func (s *K8sService) DeleteNamespace(name string) error {
+	err := s.clientset.CoreV1().Namespaces().Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete namespace: %w", err)
+	}
+
+	s.logger.WithField("namespace", name).Info("Kubernetes namespace deleted")
+	return nil
+}
+
+// DeleteWorkload removes the deployment, service, ingress and image pull secret of a workload;
+// resources that are already gone are skipped
+func (s *K8sService) DeleteWorkload(namespace, name string) error {
+	for _, remove := range []func(namespace, name string) error{s.DeleteIngress, s.DeleteService, s.DeleteDeployment} {
+		if err := remove(namespace, name); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	err := s.clientset.CoreV1().Secrets(namespace).Delete(context.Background(), RegistrySecretName(name), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete registry secret: %w", err)
+	}
+	return nil
+}
+
+func (s *K8sService) DeploymentExists(namespace, name string) (bool, error) {
+	_, err := s.clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	return resourceExists(err)
+}
+
+func (s *K8sService) ServiceExists(namespace, name string) (bool, error) {
+	_, err := s.clientset.CoreV1().Services(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	return resourceExists(err)
+}
+
+func (s *K8sService) IngressExists(namespace, name string) (bool, error) {
+	_, err := s.clientset.NetworkingV1().Ingresses(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	return resourceExists(err)
+}
+
+// resourceExists turns the error of a Get call into an existence check
+func resourceExists(err error) (bool, error) {
+	if err == nil {
+		return true, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	return false, fmt.Errorf("failed to get resource: %w", err)
+}
+
+// DefaultNamespace returns the namespace configured for deployments without an explicit one
+func (s *K8sService) DefaultNamespace() string {
+	if s.config.Namespace == "" {
+		return "default"
+	}
+	return s.config.Namespace
+}
+
 func (s *K8sService) GetPodLogs(namespace, podName, containerName string) (string, error) {
 	ctx := context.Background()
 
@@ -580,6 +799,54 @@ func (s *K8sService) DeleteDeployment(namespace, name string) error {
 	return nil
 }
 
+func (s *K8sService) DeleteService(namespace, name string) error {
+	ctx := context.Background()
+
+	// Validate required fields
+	if namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	if name == "" {
+		return fmt.Errorf("service name is required")
+	}
+
+	err := s.clientset.CoreV1().Services(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"service":   name,
+		"namespace": namespace,
+	}).Info("Kubernetes service deleted")
+
+	return nil
+}
+
+func (s *K8sService) DeleteIngress(namespace, name string) error {
+	ctx := context.Background()
+
+	// Validate required fields
+	if namespace == "" {
+		return fmt.Errorf("namespace is required")
+	}
+	if name == "" {
+		return fmt.Errorf("ingress name is required")
+	}
+
+	err := s.clientset.NetworkingV1().Ingresses(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete ingress: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"ingress":   name,
+		"namespace": namespace,
+	}).Info("Kubernetes ingress deleted")
+
+	return nil
+}
+
 // ScaleDeployment scales a deployment to the specified number of replicas
 func (s *K8sService) ScaleDeployment(namespace, name string, replicas int32) error {
 	ctx := context.Background()
@@ -615,3 +882,25 @@ func (s *K8sService) ScaleDeployment(namespace, name string, replicas int32) err
 
 	return nil
 }
+
+// SanitizeName converts an arbitrary name into a valid DNS-1123 label
+func SanitizeName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+
+	sanitized := strings.Trim(b.String(), "-")
+	if len(sanitized) > 63 {
+		sanitized = strings.TrimRight(sanitized[:63], "-")
+	}
+	if sanitized == "" {
+		sanitized = "app"
+	}
+	return sanitized
+}
@@ -0,0 +1,348 @@
+package k8s
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// PortOptions declares a container port. The first port of a deployment is its primary one, served
+// on port 80 of the Service and on / of the ingress host; further ports are exposed on the Service
+// as well and may be routed from a path of the ingress host.
+type PortOptions struct {
+	Name          string `json:"name,omitempty"`
+	ContainerPort int32  `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"`     // TCP, UDP, SCTP; defaults to TCP
+	ServicePort   int32  `json:"service_port,omitempty"` // port of additional ports on the Service, defaults to ContainerPort
+	IngressPath   string `json:"ingress_path,omitempty"` // path of the ingress host routed to an additional TCP port
+}
+
+// exposedPort returns the Service port an additional port is exposed on
+func (p PortOptions) exposedPort() int32 {
+	if p.ServicePort > 0 {
+		return p.ServicePort
+	}
+	return p.ContainerPort
+}
+
+// AdditionalPorts returns the ports exposed next to the primary port
+func AdditionalPorts(ports []PortOptions) []PortOptions {
+	if len(ports) < 2 {
+		return nil
+	}
+	return ports[1:]
+}
+
+// PortIngressPaths returns the ingress paths routed to additional ports
+func PortIngressPaths(ports []PortOptions) []IngressPathOptions {
+	var paths []IngressPathOptions
+	for _, p := range AdditionalPorts(ports) {
+		if p.IngressPath != "" {
+			paths = append(paths, IngressPathOptions{Path: p.IngressPath, ServicePort: p.exposedPort()})
+		}
+	}
+	return paths
+}
+
+// ValidatePorts checks the protocols of the ports, that the additional ones do not clash with each
+// other or the primary service port, and that only additional TCP ports are routed from the ingress
+func ValidatePorts(ports []PortOptions, servicePort int32) error {
+	if _, err := containerPorts(DeploymentOptions{Ports: ports}); err != nil {
+		return err
+	}
+	if _, err := servicePorts(ServiceOptions{Port: servicePort, TargetPort: servicePort, Ports: AdditionalPorts(ports)}); err != nil {
+		return err
+	}
+	for i, p := range ports {
+		if p.IngressPath == "" {
+			continue
+		}
+		if i == 0 {
+			return fmt.Errorf("the primary port is routed from / and takes no ingress path")
+		}
+		if !strings.HasPrefix(p.IngressPath, "/") {
+			return fmt.Errorf("ingress path %q of port %d must start with /", p.IngressPath, p.ContainerPort)
+		}
+		if protocol, _ := portProtocol(p.Protocol); protocol != corev1.ProtocolTCP {
+			return fmt.Errorf("port %d is not TCP and cannot be routed from the ingress", p.ContainerPort)
+		}
+	}
+	return nil
+}
+
+// portProtocol parses the protocol of a port, TCP when unset
+func portProtocol(protocol string) (corev1.Protocol, error) {
+	switch corev1.Protocol(strings.ToUpper(protocol)) {
+	case "", corev1.ProtocolTCP:
+		return corev1.ProtocolTCP, nil
+	case corev1.ProtocolUDP:
+		return corev1.ProtocolUDP, nil
+	case corev1.ProtocolSCTP:
+		return corev1.ProtocolSCTP, nil
+	default:
+		return "", fmt.Errorf("unsupported port protocol %s, expected TCP, UDP or SCTP", protocol)
+	}
+}
+
+// servicePorts returns the primary port of a Service followed by its additional ports. Every port
+// of a multi-port Service needs a name, so unnamed ones are named after their protocol and port.
+func servicePorts(opts ServiceOptions) ([]corev1.ServicePort, error) {
+	ports := []corev1.ServicePort{
+		{
+			Port:       opts.Port,
+			TargetPort: intstr.FromInt(int(opts.TargetPort)),
+			Protocol:   corev1.ProtocolTCP,
+		},
+	}
+
+	type portKey struct {
+		port     int32
+		protocol corev1.Protocol
+	}
+	seen := map[portKey]bool{{opts.Port, corev1.ProtocolTCP}: true}
+	for _, p := range opts.Ports {
+		if p.ContainerPort <= 0 {
+			return nil, fmt.Errorf("container port is required")
+		}
+		if p.ServicePort < 0 {
+			return nil, fmt.Errorf("service port must not be negative")
+		}
+		protocol, err := portProtocol(p.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		key := portKey{p.exposedPort(), protocol}
+		if seen[key] {
+			return nil, fmt.Errorf("service port %d/%s is exposed twice", key.port, protocol)
+		}
+		seen[key] = true
+
+		ports = append(ports, corev1.ServicePort{
+			Name:       p.Name,
+			Port:       key.port,
+			TargetPort: intstr.FromInt(int(p.ContainerPort)),
+			Protocol:   protocol,
+		})
+	}
+
+	if len(ports) > 1 {
+		for i := range ports {
+			if ports[i].Name == "" {
+				ports[i].Name = fmt.Sprintf("%s-%d", strings.ToLower(string(ports[i].Protocol)), ports[i].Port)
+			}
+		}
+	}
+	return ports, nil
+}
+
+type ProbeOptions struct {
+	Type                string   `json:"type"` // http, tcp, exec, none
+	Path                string   `json:"path,omitempty"`
+	Port                int32    `json:"port,omitempty"`
+	Command             []string `json:"command,omitempty"`
+	InitialDelaySeconds int32    `json:"initial_delay_seconds,omitempty"`
+	PeriodSeconds       int32    `json:"period_seconds,omitempty"`
+	TimeoutSeconds      int32    `json:"timeout_seconds,omitempty"`
+	FailureThreshold    int32    `json:"failure_threshold,omitempty"`
+	SuccessThreshold    int32    `json:"success_threshold,omitempty"`
+}
+
+type ResourceOptions struct {
+	CPURequest    string `json:"cpu_request,omitempty"`
+	CPULimit      string `json:"cpu_limit,omitempty"`
+	MemoryRequest string `json:"memory_request,omitempty"`
+	MemoryLimit   string `json:"memory_limit,omitempty"`
+}
+
+type RollingUpdateOptions struct {
+	MaxSurge       string `json:"max_surge,omitempty"`       // count or percentage, e.g. 1 or 25%
+	MaxUnavailable string `json:"max_unavailable,omitempty"` // count or percentage, e.g. 0 or 25%
+}
+
+type VolumeOptions struct {
+	Name                  string `json:"name"`
+	MountPath             string `json:"mount_path"`
+	SubPath               string `json:"sub_path,omitempty"`
+	ReadOnly              bool   `json:"read_only,omitempty"`
+	ConfigMap             string `json:"config_map,omitempty"`
+	Secret                string `json:"secret,omitempty"`
+	PersistentVolumeClaim string `json:"persistent_volume_claim,omitempty"`
+}
+
+// Requirements converts the options into resource requirements, keeping the defaults for unset values
+func (r ResourceOptions) Requirements() (*corev1.ResourceRequirements, error) {
+	requirements := getDefaultResourceRequirements()
+
+	values := []struct {
+		list  corev1.ResourceList
+		name  corev1.ResourceName
+		value string
+	}{
+		{requirements.Requests, corev1.ResourceCPU, r.CPURequest},
+		{requirements.Limits, corev1.ResourceCPU, r.CPULimit},
+		{requirements.Requests, corev1.ResourceMemory, r.MemoryRequest},
+		{requirements.Limits, corev1.ResourceMemory, r.MemoryLimit},
+	}
+	for _, v := range values {
+		if v.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(v.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s quantity %q: %w", v.name, v.value, err)
+		}
+		v.list[v.name] = quantity
+	}
+
+	return requirements, nil
+}
+
+// containerPorts returns the configured ports, or the single default port
+func containerPorts(opts DeploymentOptions) ([]corev1.ContainerPort, error) {
+	if len(opts.Ports) == 0 {
+		return []corev1.ContainerPort{
+			{
+				ContainerPort: opts.Port,
+				Protocol:      corev1.ProtocolTCP,
+			},
+		}, nil
+	}
+
+	ports := make([]corev1.ContainerPort, 0, len(opts.Ports))
+	for _, p := range opts.Ports {
+		if p.ContainerPort <= 0 {
+			return nil, fmt.Errorf("container port is required")
+		}
+		protocol, err := portProtocol(p.Protocol)
+		if err != nil {
+			return nil, err
+		}
+		ports = append(ports, corev1.ContainerPort{
+			Name:          p.Name,
+			ContainerPort: p.ContainerPort,
+			Protocol:      protocol,
+		})
+	}
+	return ports, nil
+}
+
+// buildProbe renders a probe; nil options fall back to an HTTP check of /health
+func buildProbe(opts *ProbeOptions, port, initialDelay, period int32) (*corev1.Probe, error) {
+	if opts == nil {
+		opts = &ProbeOptions{Type: "http", Path: "/health"}
+	}
+	if opts.Type == "none" {
+		return nil, nil
+	}
+
+	if opts.Port > 0 {
+		port = opts.Port
+	}
+
+	probe := &corev1.Probe{
+		InitialDelaySeconds: initialDelay,
+		PeriodSeconds:       period,
+		TimeoutSeconds:      opts.TimeoutSeconds,
+		FailureThreshold:    opts.FailureThreshold,
+		SuccessThreshold:    opts.SuccessThreshold,
+	}
+	if opts.InitialDelaySeconds > 0 {
+		probe.InitialDelaySeconds = opts.InitialDelaySeconds
+	}
+	if opts.PeriodSeconds > 0 {
+		probe.PeriodSeconds = opts.PeriodSeconds
+	}
+
+	switch opts.Type {
+	case "", "http":
+		path := opts.Path
+		if path == "" {
+			path = "/health"
+		}
+		probe.HTTPGet = &corev1.HTTPGetAction{
+			Path: path,
+			Port: intstr.FromInt(int(port)),
+		}
+	case "tcp":
+		probe.TCPSocket = &corev1.TCPSocketAction{
+			Port: intstr.FromInt(int(port)),
+		}
+	case "exec":
+		if len(opts.Command) == 0 {
+			return nil, fmt.Errorf("exec probe requires a command")
+		}
+		probe.Exec = &corev1.ExecAction{
+			Command: opts.Command,
+		}
+	default:
+		return nil, fmt.Errorf("unsupported probe type %q", opts.Type)
+	}
+
+	return probe, nil
+}
+
+func buildStrategy(opts *RollingUpdateOptions) appsv1.DeploymentStrategy {
+	strategy := appsv1.DeploymentStrategy{Type: appsv1.RollingUpdateDeploymentStrategyType}
+	if opts == nil {
+		return strategy
+	}
+
+	strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{}
+	if opts.MaxSurge != "" {
+		maxSurge := intstr.Parse(opts.MaxSurge)
+		strategy.RollingUpdate.MaxSurge = &maxSurge
+	}
+	if opts.MaxUnavailable != "" {
+		maxUnavailable := intstr.Parse(opts.MaxUnavailable)
+		strategy.RollingUpdate.MaxUnavailable = &maxUnavailable
+	}
+	return strategy
+}
+
+func buildVolumes(opts []VolumeOptions) ([]corev1.Volume, []corev1.VolumeMount, error) {
+	var volumes []corev1.Volume
+	var mounts []corev1.VolumeMount
+
+	for _, v := range opts {
+		if v.Name == "" || v.MountPath == "" {
+			return nil, nil, fmt.Errorf("volume name and mount path are required")
+		}
+
+		source := corev1.VolumeSource{}
+		switch {
+		case v.ConfigMap != "":
+			source.ConfigMap = &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: v.ConfigMap},
+			}
+		case v.Secret != "":
+			source.Secret = &corev1.SecretVolumeSource{SecretName: v.Secret}
+		case v.PersistentVolumeClaim != "":
+			source.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{
+				ClaimName: v.PersistentVolumeClaim,
+				ReadOnly:  v.ReadOnly,
+			}
+		default:
+			source.EmptyDir = &corev1.EmptyDirVolumeSource{}
+		}
+
+		volumes = append(volumes, corev1.Volume{Name: v.Name, VolumeSource: source})
+		mounts = append(mounts, corev1.VolumeMount{
+			Name:      v.Name,
+			MountPath: v.MountPath,
+			SubPath:   v.SubPath,
+			ReadOnly:  v.ReadOnly,
+		})
+	}
+
+	return volumes, mounts, nil
+}
+
+// ValidateDeploymentOptions reports whether the options render into a valid Deployment
+func ValidateDeploymentOptions(opts DeploymentOptions) error {
+	_, err := buildDeployment(opts)
+	return err
+}
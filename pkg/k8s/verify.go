@@ -0,0 +1,51 @@
+package k8s
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ImageVerifier checks an image before it is deployed, e.g. that it carries a valid signature
+type ImageVerifier interface {
+	Verify(image string) error
+}
+
+// verifyImage refuses the image of the options when their verifier rejects it
+func verifyImage(opts DeploymentOptions) error {
+	if opts.Verifier == nil {
+		return nil
+	}
+
+	image := fmt.Sprintf("%s:%s", opts.Image, opts.Tag)
+	if err := opts.Verifier.Verify(image); err != nil {
+		return fmt.Errorf("refusing to deploy %s: %w", image, err)
+	}
+	return nil
+}
+
+// verifyObjectImages refuses objects running a container image the verifier rejects. Only the pod
+// specs of the built-in workload kinds are inspected; custom resources embedding pod templates are not.
+func verifyObjectImages(objects []*unstructured.Unstructured, verifier ImageVerifier) error {
+	if verifier == nil {
+		return nil
+	}
+
+	verified := make(map[string]bool)
+	for _, obj := range objects {
+		images, err := objectImages(obj)
+		if err != nil {
+			return err
+		}
+		for _, image := range images {
+			if verified[image] {
+				continue
+			}
+			if err := verifier.Verify(image); err != nil {
+				return fmt.Errorf("refusing to deploy %s in %s %s: %w", image, obj.GetKind(), obj.GetName(), err)
+			}
+			verified[image] = true
+		}
+	}
+	return nil
+}
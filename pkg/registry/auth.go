@@ -0,0 +1,85 @@
+package registry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// DockerHub is the canonical host of Docker Hub
+const DockerHub = "docker.io"
+
+// dockerHubConfigKey is the key Docker Hub credentials are stored under in docker config files
+const dockerHubConfigKey = "https://index.docker.io/v1/"
+
+// Auth holds the credentials of one registry
+type Auth struct {
+	Registry string
+	Username string
+	Password string
+}
+
+// NormalizeHost strips the scheme and trailing slashes of a registry address and maps the
+// aliases of Docker Hub to docker.io
+func NormalizeHost(registry string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(registry, "https://"), "http://")
+	host = strings.TrimSuffix(host, "/")
+	host = strings.TrimSuffix(host, "/v1")
+	switch host {
+	case "", "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return DockerHub
+	}
+	return host
+}
+
+// ImageHost returns the registry host of an image reference, docker.io for unqualified images
+func ImageHost(image string) string {
+	first, _, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		return DockerHub
+	}
+	return NormalizeHost(first)
+}
+
+// ConfigKey returns the key the credentials of a registry are stored under in docker config files
+func ConfigKey(registry string) string {
+	host := NormalizeHost(registry)
+	if host == DockerHub {
+		return dockerHubConfigKey
+	}
+	return host
+}
+
+// Find returns the credentials for the registry an image is stored in, nil without any
+func Find(auths []Auth, image string) *Auth {
+	host := ImageHost(image)
+	for i := range auths {
+		if NormalizeHost(auths[i].Registry) == host {
+			return &auths[i]
+		}
+	}
+	return nil
+}
+
+// DockerConfigJSON renders credentials as a docker config file, the content of
+// kubernetes.io/dockerconfigjson Secrets
+func DockerConfigJSON(auths []Auth) ([]byte, error) {
+	type entry struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+		Auth     string `json:"auth"`
+	}
+
+	config := struct {
+		Auths map[string]entry `json:"auths"`
+	}{Auths: make(map[string]entry, len(auths))}
+	for _, auth := range auths {
+		config.Auths[ConfigKey(auth.Registry)] = entry{
+			Username: auth.Username,
+			Password: auth.Password,
+			Auth:     base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password)),
+		}
+	}
+
+	return json.Marshal(config)
+}
@@ -0,0 +1,238 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// manifestTypes are the manifest media types accepted when resolving tags
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var challengeParams = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// Client calls the HTTP API v2 of one registry, authenticating with basic or token auth
+type Client struct {
+	host   string
+	auth   *Auth
+	client *http.Client
+}
+
+// NewClient creates a client for a registry host; auth may be nil for anonymous access
+func NewClient(host string, auth *Auth) *Client {
+	return &Client{
+		host:   NormalizeHost(host),
+		auth:   auth,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SplitImage returns the registry host and repository of an image reference without tag or digest
+func SplitImage(image string) (string, string) {
+	host := ImageHost(image)
+	repository := image
+	if first, rest, found := strings.Cut(image, "/"); found && NormalizeHost(first) == host && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		repository = rest
+	}
+	if host == DockerHub && !strings.Contains(repository, "/") {
+		repository = "library/" + repository
+	}
+	return host, repository
+}
+
+// DeleteManifest deletes a manifest and with it every tag pointing at it. Manifests that do not
+// exist are considered deleted.
+func (c *Client) DeleteManifest(repository, digest string) error {
+	resp, err := c.do(http.MethodDelete, repository, "manifests/"+digest, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusAccepted, http.StatusOK, http.StatusNotFound:
+		return nil
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("registry %s does not allow deleting images", c.host)
+	}
+	return statusError(resp, "delete manifest")
+}
+
+// DeleteTag resolves a tag to its manifest and deletes it. Tags that do not exist are considered deleted.
+func (c *Client) DeleteTag(repository, tag string) error {
+	resp, err := c.do(http.MethodHead, repository, "manifests/"+tag, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil
+	case resp.StatusCode != http.StatusOK:
+		return statusError(resp, "resolve tag")
+	}
+
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return fmt.Errorf("registry %s returned no digest for %s:%s", c.host, repository, tag)
+	}
+	return c.DeleteManifest(repository, digest)
+}
+
+// TagManifest tags an existing manifest, copying it from its digest to the tag. Image indexes
+// are tagged as a whole, so every platform of the image is kept.
+func (c *Client) TagManifest(repository, digest, tag string) error {
+	resp, err := c.do(http.MethodGet, repository, "manifests/"+digest, nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp, "get manifest")
+	}
+	manifest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	put, err := c.do(http.MethodPut, repository, "manifests/"+tag, manifest, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return err
+	}
+	defer put.Body.Close()
+	if put.StatusCode != http.StatusCreated && put.StatusCode != http.StatusOK {
+		return statusError(put, "tag manifest")
+	}
+	return nil
+}
+
+// do sends a request to the repository, answering an authentication challenge once
+func (c *Client) do(method, repository, path string, body []byte, contentType string) (*http.Response, error) {
+	endpoint := fmt.Sprintf("%s/v2/%s/%s", c.baseURL(), repository, path)
+	send := func(authorization string) (*http.Response, error) {
+		req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reach registry %s: %w", c.host, err)
+		}
+		return resp, nil
+	}
+
+	resp, err := send("")
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+
+	authorization, err := c.authorize(challenge, fmt.Sprintf("repository:%s:*", repository))
+	if err != nil {
+		return nil, err
+	}
+	return send(authorization)
+}
+
+// authorize answers a basic or bearer authentication challenge
+func (c *Client) authorize(challenge, scope string) (string, error) {
+	scheme, _, _ := strings.Cut(challenge, " ")
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if c.auth == nil {
+			return "", fmt.Errorf("registry %s requires credentials", c.host)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(c.auth.Username+":"+c.auth.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("registry %s requested unsupported authentication %q", c.host, scheme)
+	}
+
+	params := make(map[string]string)
+	for _, match := range challengeParams.FindAllStringSubmatch(challenge, -1) {
+		params[strings.ToLower(match[1])] = match[2]
+	}
+	if params["realm"] == "" {
+		return "", fmt.Errorf("registry %s sent an authentication challenge without realm", c.host)
+	}
+
+	query := url.Values{}
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	query.Set("scope", scope)
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to request registry token: %w", err)
+	}
+	if c.auth != nil {
+		req.SetBasicAuth(c.auth.Username, c.auth.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", statusError(resp, "request registry token")
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to parse registry token: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// baseURL returns the API endpoint of the registry; local registries are reached over plain HTTP
+func (c *Client) baseURL() string {
+	host := c.host
+	if host == DockerHub {
+		return "https://registry-1.docker.io"
+	}
+	name := host
+	if h, _, found := strings.Cut(host, ":"); found {
+		name = h
+	}
+	if name == "localhost" || name == "127.0.0.1" {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+func statusError(resp *http.Response, operation string) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = resp.Status
+	}
+	return fmt.Errorf("failed to %s: %s", operation, message)
+}
@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ECRToken is a temporary Amazon ECR password obtained with GetAuthorizationToken
+type ECRToken struct {
+	Auth
+	ExpiresAt time.Time
+}
+
+var ecrClient = &http.Client{Timeout: 30 * time.Second}
+
+// ExchangeECRToken trades AWS access keys for an ECR registry password, valid for 12 hours.
+// The request is signed with AWS Signature Version 4.
+func ExchangeECRToken(region, accessKeyID, secretAccessKey string) (*ECRToken, error) {
+	// Validate required fields
+	if region == "" {
+		return nil, fmt.Errorf("region is required")
+	}
+	if accessKeyID == "" || secretAccessKey == "" {
+		return nil, fmt.Errorf("access key is required")
+	}
+
+	host := fmt.Sprintf("api.ecr.%s.amazonaws.com", region)
+	target := "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+	payload := "{}"
+
+	req, err := http.NewRequest(http.MethodPost, "https://"+host+"/", strings.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ECR request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSRequest(req, host, region, "ecr", payload, accessKeyID, secretAccessKey, time.Now().UTC())
+
+	resp, err := ecrClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request ECR token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ECR response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("ECR token request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+			ProxyEndpoint      string  `json:"proxyEndpoint"`
+		} `json:"authorizationData"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse ECR response: %w", err)
+	}
+	if len(result.AuthorizationData) == 0 {
+		return nil, fmt.Errorf("ECR returned no authorization data")
+	}
+
+	data := result.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ECR authorization token: %w", err)
+	}
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return nil, fmt.Errorf("invalid ECR authorization token")
+	}
+
+	return &ECRToken{
+		Auth: Auth{
+			Registry: NormalizeHost(data.ProxyEndpoint),
+			Username: username,
+			Password: password,
+		},
+		ExpiresAt: time.Unix(int64(data.ExpiresAt), 0),
+	}, nil
+}
+
+// signAWSRequest adds the Signature Version 4 headers to a request without query parameters
+func signAWSRequest(req *http.Request, host, region, service, payload, accessKeyID, secretAccessKey string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	signedHeaders := "content-type;host;x-amz-date;x-amz-target"
+	canonicalHeaders := fmt.Sprintf("content-type:%s\nhost:%s\nx-amz-date:%s\nx-amz-target:%s\n",
+		req.Header.Get("Content-Type"), host, amzDate, req.Header.Get("X-Amz-Target"))
+	canonicalRequest := strings.Join([]string{
+		req.Method, "/", "", canonicalHeaders, signedHeaders, sha256Hex(payload),
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex(canonicalRequest)}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,205 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"ys-cloud/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Severities ordered from least to most severe
+var Severities = []string{"UNKNOWN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// SeverityRank returns the position of a severity in Severities, 0 for unknown severities
+func SeverityRank(severity string) int {
+	severity = strings.ToUpper(severity)
+	for i, s := range Severities {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// Finding is a vulnerability of a package installed in an image
+type Finding struct {
+	VulnerabilityID  string
+	Severity         string
+	Package          string
+	InstalledVersion string
+	FixedVersion     string
+	Title            string
+	Target           string // image layer component the package belongs to, e.g. the OS or a lock file
+}
+
+type ScanOptions struct {
+	Image    string // image reference, preferably pinned by digest
+	Username string // registry credentials for pulling the image
+	Password string
+	Output   io.Writer // receives the scanner's progress output
+}
+
+// SBOM formats
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx-json"
+)
+
+// Scanner runs a Trivy compatible command line scanner against a local vulnerability database
+type Scanner struct {
+	config  *config.ScanConfig
+	command string
+	timeout time.Duration
+	logger  *logrus.Logger
+}
+
+// trivyReport is the part of the JSON report of trivy image the scanner reads
+type trivyReport struct {
+	Results []struct {
+		Target          string `json:"Target"`
+		Vulnerabilities []struct {
+			VulnerabilityID  string `json:"VulnerabilityID"`
+			PkgName          string `json:"PkgName"`
+			InstalledVersion string `json:"InstalledVersion"`
+			FixedVersion     string `json:"FixedVersion"`
+			Severity         string `json:"Severity"`
+			Title            string `json:"Title"`
+		} `json:"Vulnerabilities"`
+	} `json:"Results"`
+}
+
+func NewScanner(cfg *config.Config) (*Scanner, error) {
+	if !cfg.Scan.Enabled {
+		return nil, fmt.Errorf("vulnerability scanning is disabled")
+	}
+
+	command, err := exec.LookPath(cfg.Scan.Command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find scanner %s: %w", cfg.Scan.Command, err)
+	}
+
+	timeout, err := time.ParseDuration(cfg.Scan.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 10 * time.Minute
+	}
+
+	return &Scanner{
+		config:  &cfg.Scan,
+		command: command,
+		timeout: timeout,
+		logger:  logrus.New(),
+	}, nil
+}
+
+// Scan scans an image for vulnerable packages
+func (s *Scanner) Scan(opts ScanOptions) ([]Finding, error) {
+	// Validate required fields
+	if opts.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"image":          opts.Image,
+		"skip_db_update": s.config.SkipDBUpdate,
+	}).Info("Starting vulnerability scan")
+
+	report, err := s.run(opts, "vulnerability scan", "--format", "json", "--scanners", "vuln")
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed trivyReport
+	if err := json.Unmarshal(report, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse scan report: %w", err)
+	}
+
+	var findings []Finding
+	for _, result := range parsed.Results {
+		for _, vulnerability := range result.Vulnerabilities {
+			findings = append(findings, Finding{
+				VulnerabilityID:  vulnerability.VulnerabilityID,
+				Severity:         strings.ToUpper(vulnerability.Severity),
+				Package:          vulnerability.PkgName,
+				InstalledVersion: vulnerability.InstalledVersion,
+				FixedVersion:     vulnerability.FixedVersion,
+				Title:            vulnerability.Title,
+				Target:           result.Target,
+			})
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"image":    opts.Image,
+		"findings": len(findings),
+	}).Info("Vulnerability scan completed successfully")
+
+	return findings, nil
+}
+
+// SBOM generates the software bill of materials of an image in the CycloneDX or SPDX JSON format
+func (s *Scanner) SBOM(opts ScanOptions, format string) ([]byte, error) {
+	// Validate required fields
+	if opts.Image == "" {
+		return nil, fmt.Errorf("image is required")
+	}
+	if format != FormatCycloneDX && format != FormatSPDX {
+		return nil, fmt.Errorf("unsupported SBOM format %s", format)
+	}
+
+	sbom, err := s.run(opts, "SBOM generation", "--format", format)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"image":  opts.Image,
+		"format": format,
+	}).Info("SBOM generated successfully")
+
+	return sbom, nil
+}
+
+// run runs the scanner against an image and returns its report
+func (s *Scanner) run(opts ScanOptions, operation string, flags ...string) ([]byte, error) {
+	if opts.Output == nil {
+		opts.Output = io.Discard
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	args := append([]string{"image"}, flags...)
+	args = append(args, "--timeout", s.timeout.String())
+	if s.config.CacheDir != "" {
+		args = append(args, "--cache-dir", s.config.CacheDir)
+	}
+	if s.config.SkipDBUpdate {
+		args = append(args, "--skip-db-update")
+	}
+	args = append(args, opts.Image)
+
+	var report bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.command, args...)
+	cmd.Stdout = &report
+	cmd.Stderr = opts.Output
+	cmd.Env = os.Environ()
+	if opts.Username != "" {
+		cmd.Env = append(cmd.Env, "TRIVY_USERNAME="+opts.Username, "TRIVY_PASSWORD="+opts.Password)
+	}
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, fmt.Errorf("%s timed out after %s", operation, s.timeout)
+		}
+		return nil, fmt.Errorf("%s failed: %w", operation, err)
+	}
+
+	return report.Bytes(), nil
+}
@@ -0,0 +1,204 @@
+package signing
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"ys-cloud/internal/config"
+	"ys-cloud/pkg/registry"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Predicate types of SBOM attestations
+const (
+	PredicateCycloneDX = "cyclonedx"
+	PredicateSPDX      = "spdxjson"
+)
+
+// Signer signs images and attaches attestations to them with cosign and the key pair held by ys-cloud
+type Signer struct {
+	config  *config.SigningConfig
+	command string
+	timeout time.Duration
+	logger  *logrus.Logger
+}
+
+type SignOptions struct {
+	Image  string          // image reference pinned by digest
+	Auths  []registry.Auth // credentials for the registry signatures are pushed to and read from
+	Output io.Writer       // receives the output of cosign
+}
+
+func NewSigner(cfg *config.Config) (*Signer, error) {
+	if !cfg.Signing.Enabled && !cfg.Signing.RequireSigned {
+		return nil, fmt.Errorf("image signing is disabled")
+	}
+	if cfg.Signing.Enabled && cfg.Signing.Key == "" {
+		return nil, fmt.Errorf("signing key is required")
+	}
+	if cfg.Signing.RequireSigned && cfg.Signing.PublicKey == "" {
+		return nil, fmt.Errorf("public key is required to verify signatures")
+	}
+
+	command, err := exec.LookPath(cfg.Signing.Command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find %s: %w", cfg.Signing.Command, err)
+	}
+
+	timeout, err := time.ParseDuration(cfg.Signing.Timeout)
+	if err != nil || timeout <= 0 {
+		timeout = 5 * time.Minute
+	}
+
+	return &Signer{
+		config:  &cfg.Signing,
+		command: command,
+		timeout: timeout,
+		logger:  logrus.New(),
+	}, nil
+}
+
+// CanSign reports whether the signer holds the private key
+func (s *Signer) CanSign() bool {
+	return s.config.Enabled && s.config.Key != ""
+}
+
+// Sign signs the image digest and pushes the signature next to the image
+func (s *Signer) Sign(opts SignOptions) error {
+	// Validate required fields
+	if opts.Image == "" {
+		return fmt.Errorf("image is required")
+	}
+	if !strings.Contains(opts.Image, "@") {
+		return fmt.Errorf("image must be pinned by digest to be signed")
+	}
+
+	args := []string{"sign", "--yes", "--key", s.config.Key, fmt.Sprintf("--tlog-upload=%t", s.config.TransparencyLog), opts.Image}
+	if err := s.run(opts, args); err != nil {
+		return fmt.Errorf("failed to sign image: %w", err)
+	}
+
+	s.logger.WithField("image", opts.Image).Info("Image signed successfully")
+	return nil
+}
+
+// Attest signs a predicate such as an SBOM and attaches it to the image as an in-toto attestation
+func (s *Signer) Attest(opts SignOptions, predicateType string, predicate []byte) error {
+	// Validate required fields
+	if opts.Image == "" {
+		return fmt.Errorf("image is required")
+	}
+	if predicateType == "" {
+		return fmt.Errorf("predicate type is required")
+	}
+
+	dir, err := os.MkdirTemp("", "ys-cloud-attestation-")
+	if err != nil {
+		return fmt.Errorf("failed to create predicate file: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "predicate.json")
+	if err := os.WriteFile(path, predicate, 0600); err != nil {
+		return fmt.Errorf("failed to create predicate file: %w", err)
+	}
+
+	args := []string{"attest", "--yes", "--key", s.config.Key, "--type", predicateType, "--predicate", path,
+		fmt.Sprintf("--tlog-upload=%t", s.config.TransparencyLog), opts.Image}
+	if err := s.run(opts, args); err != nil {
+		return fmt.Errorf("failed to attest image: %w", err)
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"image":     opts.Image,
+		"predicate": predicateType,
+	}).Info("Image attestation attached successfully")
+	return nil
+}
+
+// Verify checks that the image carries a signature made with the key pair of ys-cloud
+func (s *Signer) Verify(opts SignOptions) error {
+	// Validate required fields
+	if opts.Image == "" {
+		return fmt.Errorf("image is required")
+	}
+	if s.config.PublicKey == "" {
+		return fmt.Errorf("public key is required to verify signatures")
+	}
+
+	args := []string{"verify", "--key", s.config.PublicKey}
+	if !s.config.TransparencyLog {
+		args = append(args, "--insecure-ignore-tlog=true")
+	}
+	args = append(args, opts.Image)
+
+	var stderr bytes.Buffer
+	opts.Output = &stderr
+	if err := s.run(opts, args); err != nil {
+		if message := lastLine(stderr.String()); message != "" {
+			return fmt.Errorf("signature verification failed: %s", message)
+		}
+		return fmt.Errorf("signature verification failed: %w", err)
+	}
+
+	return nil
+}
+
+// run runs cosign with the registry credentials in a temporary docker config
+func (s *Signer) run(opts SignOptions, args []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, s.command, args...)
+	cmd.Env = append(os.Environ(), "COSIGN_PASSWORD="+s.config.Password)
+	if opts.Output != nil {
+		cmd.Stdout = opts.Output
+		cmd.Stderr = opts.Output
+	}
+
+	if len(opts.Auths) > 0 {
+		dockerConfig, err := registry.DockerConfigJSON(opts.Auths)
+		if err != nil {
+			return err
+		}
+		configDir, err := os.MkdirTemp("", "ys-cloud-cosign-")
+		if err != nil {
+			return fmt.Errorf("failed to create docker config: %w", err)
+		}
+		defer os.RemoveAll(configDir)
+		if err := os.WriteFile(filepath.Join(configDir, "config.json"), dockerConfig, 0600); err != nil {
+			return fmt.Errorf("failed to create docker config: %w", err)
+		}
+		cmd.Env = append(cmd.Env, "DOCKER_CONFIG="+configDir)
+	}
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("%s timed out after %s", args[0], s.timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// SignatureTag returns the tag cosign stores the signature of an image digest under
+func SignatureTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".sig"
+}
+
+// AttestationTag returns the tag cosign stores the attestations of an image digest under
+func AttestationTag(digest string) string {
+	return strings.Replace(digest, ":", "-", 1) + ".att"
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalStoragePath(t *testing.T) {
+	root := t.TempDir()
+	storage := &LocalStorage{root: root}
+
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{name: "key", key: "caches/1/deps/v1.tar.gz", want: filepath.Join(root, "caches", "1", "deps", "v1.tar.gz")},
+		{name: "leading slash", key: "/caches/v1.tar.gz", want: filepath.Join(root, "caches", "v1.tar.gz")},
+		{name: "redundant separators", key: "caches//1/./v1.tar.gz", want: filepath.Join(root, "caches", "1", "v1.tar.gz")},
+		{name: "empty", key: "", wantErr: true},
+		{name: "root", key: "/", wantErr: true},
+		{name: "current directory", key: ".", wantErr: true},
+		{name: "parent directory", key: "../secrets", wantErr: true},
+		{name: "escaping through a directory", key: "caches/../../etc/passwd", wantErr: true},
+		{name: "dots in a name", key: "caches/v1..tar.gz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := storage.path(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("path(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("path(%q) = %q, want %q", tt.key, got, tt.want)
+			}
+		})
+	}
+}
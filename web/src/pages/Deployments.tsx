@@ -90,6 +90,12 @@ const Deployments: React.FC = () => {
         return 'red';
       case 'cancelled':
         return 'default';
+      case 'canary':
+        return 'purple';
+      case 'aborted':
+        return 'default';
+      case 'deleted':
+        return 'default';
       case 'pending':
         return 'orange';
       default:
@@ -107,6 +113,12 @@ const Deployments: React.FC = () => {
         return '失败';
       case 'cancelled':
         return '已取消';
+      case 'canary':
+        return '金丝雀发布中';
+      case 'aborted':
+        return '已中止';
+      case 'deleted':
+        return '已删除';
       case 'pending':
         return '等待中';
       default:
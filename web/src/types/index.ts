@@ -69,7 +69,7 @@ export interface Deployment {
   id: number;
   build_id: number;
   environment: 'dev' | 'staging' | 'prod';
-  status: 'pending' | 'running' | 'success' | 'failed' | 'cancelled';
+  status: 'pending' | 'running' | 'success' | 'failed' | 'cancelled' | 'canary' | 'aborted' | 'deleted';
   replicas: number;
   namespace: string;
   service_name: string;